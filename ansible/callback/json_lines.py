@@ -6,10 +6,14 @@ import json
 import pprint
 from os.path import basename
 import os
+import socket
+import time
 
-# JSON Lines STDOUT callback module for Ansible.
+# JSON Lines callback module for Ansible.
 #
-# This callback module prints Ansible events out to STDOUT as JSON Lines.
+# This callback module sends Ansible events as JSON Lines to the address
+# set in ANSIBLE_JSON_LINES_ADDRESS, which is either a unix socket
+# ("unix:/path/to/socket") or a loopback TCP address ("tcp:127.0.0.1:port").
 # The event consists of a type and data. The data has a different structure
 # depending on the event type.
 class CallbackModule(CallbackBase):
@@ -33,7 +37,12 @@ class CallbackModule(CallbackBase):
     RUNNER_ITEM_SKIPPED = "RUNNER_ITEM_SKIPPED"
     RUNNER_ITEM_RETRY   = "RUNNER_ITEM_RETRY"
 
-    named_pipe = None
+    # Number of times to try to (re)connect before giving up on an event
+    CONNECT_ATTEMPTS    = 10
+    CONNECT_BACKOFF     = 0.5
+
+    address = None
+    sock = None
 
     def _new_event(self, eventType, eventData):
         return {
@@ -47,20 +56,49 @@ class CallbackModule(CallbackBase):
             'id': str(task._uuid)
         }
 
+    def _connect(self):
+        if self.address.startswith("unix:"):
+            s = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+            s.connect(self.address[len("unix:"):])
+        elif self.address.startswith("tcp:"):
+            host, port = self.address[len("tcp:"):].rsplit(":", 1)
+            s = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+            s.connect((host, int(port)))
+        else:
+            raise ValueError("invalid event address %r" % self.address)
+        self.sock = s
+
+    def _close(self):
+        if self.sock is not None:
+            try:
+                self.sock.close()
+            except socket.error:
+                pass
+            self.sock = None
+
+    # Send the event, reconnecting if the connection was lost. The listener
+    # drops incomplete lines, so the whole event is sent again after reconnecting.
     def _print_event(self, event):
-        self.named_pipe.write(json.dumps(event, sort_keys = False))
-        self.named_pipe.write("\n")
-        self.named_pipe.flush()
+        line = json.dumps(event, sort_keys = False) + "\n"
+        for attempt in range(self.CONNECT_ATTEMPTS):
+            try:
+                if self.sock is None:
+                    self._connect()
+                self.sock.sendall(line)
+                return
+            except socket.error:
+                self._close()
+                time.sleep(self.CONNECT_BACKOFF * (attempt + 1))
+        self._display.warning("json_lines: could not send event to %s" % self.address)
 
     def __init__(self):
-        named_pipe_file = os.environ["ANSIBLE_JSON_LINES_PIPE"]
-        self.named_pipe = open(named_pipe_file, 'w')
+        self.address = os.environ["ANSIBLE_JSON_LINES_ADDRESS"]
         super(CallbackModule, self).__init__()
 
-    # This gets called when the playbook ends. Close the pipe.
+    # This gets called when the playbook ends. Close the connection.
     def v2_playbook_on_stats(self, stats):
         self._on_runner_result(self.PLAYBOOK_END, None)
-        self.named_pipe.close()
+        self._close()
 
     # def v2_on_any(self, *args, **kwargs):
     #     self.on_any(args, kwargs)
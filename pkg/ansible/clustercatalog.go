@@ -70,6 +70,10 @@ type ClusterCatalog struct {
 	DiagnosticsDirectory string `yaml:"diagnostics_dir"`
 	DiagnosticsDateTime  string `yaml:"diagnostics_date_time"`
 
+	// dry run vars
+	DryRunDirectory string   `yaml:"dry_run_dir,omitempty"`
+	DryRunTemplates []string `yaml:"dry_run_templates,omitempty"`
+
 	DockerDirectLVMEnabled                 bool   `yaml:"docker_direct_lvm_enabled"`
 	DockerDirectLVMBlockDevicePath         string `yaml:"docker_direct_lvm_block_device_path"`
 	DockerDirectLVMDeferredDeletionEnabled bool   `yaml:"docker_direct_lvm_deferred_deletion_enabled"`
@@ -79,6 +83,29 @@ type ClusterCatalog struct {
 	CloudProvider string `yaml:"cloud_provider"`
 	CloudConfig   string `yaml:"cloud_config_local"`
 
+	OIDC struct {
+		IssuerURL     string `yaml:"issuer_url"`
+		ClientID      string `yaml:"client_id"`
+		UsernameClaim string `yaml:"username_claim"`
+		GroupsClaim   string `yaml:"groups_claim"`
+		CAFile        string `yaml:"ca_file_local"`
+	}
+
+	Audit struct {
+		Enabled           bool
+		PolicyFile        string `yaml:"policy_file_local"`
+		LogPath           string `yaml:"log_path"`
+		LogMaxAge         int    `yaml:"log_max_age"`
+		LogMaxSize        int    `yaml:"log_max_size"`
+		LogMaxBackups     int    `yaml:"log_max_backups"`
+		WebhookConfigFile string `yaml:"webhook_config_file_local"`
+	}
+
+	EncryptionAtRest struct {
+		Enabled        bool
+		ConfigChecksum string `yaml:"config_checksum"`
+	} `yaml:"encryption_at_rest"`
+
 	DNS struct {
 		Enabled bool
 	}
@@ -126,6 +153,10 @@ type ClusterCatalog struct {
 
 	NodeLabels         map[string][]string          `yaml:"node_labels"`
 	KubeletNodeOptions map[string]map[string]string `yaml:"kubelet_node_overrides"`
+
+	APIServerNodeOptions             map[string]map[string]string `yaml:"kubernetes_api_server_node_option_overrides"`
+	KubeControllerManagerNodeOptions map[string]map[string]string `yaml:"kube_controller_manager_node_option_overrides"`
+	KubeSchedulerNodeOptions         map[string]map[string]string `yaml:"kube_scheduler_node_option_overrides"`
 }
 
 type NFSVolume struct {
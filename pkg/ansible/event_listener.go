@@ -0,0 +1,176 @@
+package ansible
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the prefixes of the event listener address passed to the json_lines callback
+	unixAddressPrefix = "unix:"
+	tcpAddressPrefix  = "tcp:"
+
+	// how long to keep accepting the connections that are pending when the
+	// listener is closed
+	acceptDrainTimeout = 100 * time.Millisecond
+	// how long to wait for the callback connections to be closed after
+	// the ansible process has exited
+	eventDrainTimeout = 10 * time.Second
+)
+
+// eventListener accepts connections from the json_lines Ansible callback and
+// streams the JSON lines it receives. The callback reconnects if the connection
+// is lost, so more than one connection can be accepted during a single run.
+type eventListener struct {
+	listener net.Listener
+	address  string
+
+	pr *io.PipeReader
+	pw *io.PipeWriter
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+	connsWG sync.WaitGroup
+
+	// closed when the listener stops accepting connections
+	served   chan struct{}
+	closeErr error
+}
+
+// newEventListener listens on a unix socket in the temp directory. If unix
+// sockets are not supported, it falls back to listening on a loopback TCP port.
+func newEventListener() (*eventListener, error) {
+	var l net.Listener
+	var address string
+	sock := filepath.Join(os.TempDir(), fmt.Sprintf("ket-events-%d.sock", rand.Int()))
+	l, err := net.Listen("unix", sock)
+	if err == nil {
+		address = unixAddressPrefix + sock
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("error creating ansible event listener: %v", err)
+		}
+		address = tcpAddressPrefix + l.Addr().String()
+	}
+	pr, pw := io.Pipe()
+	el := &eventListener{
+		listener: l,
+		address:  address,
+		pr:       pr,
+		pw:       pw,
+		conns:    map[net.Conn]struct{}{},
+		served:   make(chan struct{}),
+	}
+	go el.serve()
+	return el, nil
+}
+
+// Address returns the address the callback should connect to, in the
+// form "unix:/path/to/socket" or "tcp:127.0.0.1:port"
+func (el *eventListener) Address() string {
+	return el.address
+}
+
+// Reader returns the stream of JSON lines received from all connections
+func (el *eventListener) Reader() io.Reader {
+	return el.pr
+}
+
+// serve accepts connections until the listener is closed. The connections are
+// streamed in the order they were accepted, as the callback only reconnects
+// after the previous connection is broken.
+func (el *eventListener) serve() {
+	defer close(el.served)
+	prev := make(chan struct{})
+	close(prev)
+	for {
+		conn, err := el.listener.Accept()
+		if err != nil {
+			// the accept deadline was reached, or the listener was closed.
+			// closing a unix listener also removes the socket file
+			if cerr := el.listener.Close(); cerr != nil && !strings.Contains(cerr.Error(), "use of closed network connection") {
+				el.closeErr = cerr
+			}
+			return
+		}
+		el.connsMu.Lock()
+		el.conns[conn] = struct{}{}
+		el.connsWG.Add(1)
+		el.connsMu.Unlock()
+		done := make(chan struct{})
+		go el.handle(conn, prev, done)
+		prev = done
+	}
+}
+
+// handle copies the complete lines read from the connection to the stream.
+// A partial line left by a broken connection is dropped, as the callback
+// sends the whole event again after reconnecting.
+func (el *eventListener) handle(conn net.Conn, prev <-chan struct{}, done chan<- struct{}) {
+	defer func() {
+		conn.Close()
+		el.connsMu.Lock()
+		delete(el.conns, conn)
+		el.connsMu.Unlock()
+		close(done)
+		el.connsWG.Done()
+	}()
+	// wait for the previous connection to be streamed
+	<-prev
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		if _, err = el.pw.Write(line); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops accepting connections and waits for the open connections to
+// be closed by the callback, before closing the stream. Connections that are
+// still open after the drain timeout are closed.
+func (el *eventListener) Close() error {
+	// connections made right before the callback exited might not have been
+	// accepted yet, so keep accepting for a little while
+	if l, ok := el.listener.(interface {
+		SetDeadline(time.Time) error
+	}); ok {
+		l.SetDeadline(time.Now().Add(acceptDrainTimeout))
+	} else {
+		el.listener.Close()
+	}
+	<-el.served
+
+	drained := make(chan struct{})
+	go func() {
+		el.connsWG.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(eventDrainTimeout):
+		el.connsMu.Lock()
+		for c := range el.conns {
+			c.Close()
+		}
+		el.connsMu.Unlock()
+		<-drained
+	}
+	el.pw.Close()
+	if el.closeErr != nil {
+		return fmt.Errorf("error closing ansible event listener: %v", el.closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package ansible
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func dialEventListener(t *testing.T, address string) net.Conn {
+	var conn net.Conn
+	var err error
+	switch {
+	case strings.HasPrefix(address, unixAddressPrefix):
+		conn, err = net.Dial("unix", strings.TrimPrefix(address, unixAddressPrefix))
+	case strings.HasPrefix(address, tcpAddressPrefix):
+		conn, err = net.Dial("tcp", strings.TrimPrefix(address, tcpAddressPrefix))
+	default:
+		t.Fatalf("unexpected listener address %q", address)
+	}
+	if err != nil {
+		t.Fatalf("error connecting to event listener: %v", err)
+	}
+	return conn
+}
+
+func TestEventListenerReconnect(t *testing.T) {
+	el, err := newEventListener()
+	if err != nil {
+		t.Fatalf("error creating event listener: %v", err)
+	}
+	events := EventStream(el.Reader())
+
+	// the first connection is lost in the middle of an event
+	conn := dialEventListener(t, el.Address())
+	conn.Write([]byte(`{"eventType":"PLAY_START", "eventData": {"name":"first"}}` + "\n"))
+	conn.Write([]byte(`{"eventType":"PLAY_START", "eventData": {"na`))
+	conn.Close()
+
+	// the callback reconnects and sends the event again
+	conn = dialEventListener(t, el.Address())
+	conn.Write([]byte(`{"eventType":"PLAY_START", "eventData": {"name":"second"}}` + "\n"))
+	conn.Write([]byte(`{"eventType":"PLAY_START", "eventData": {"name":"third"}}` + "\n"))
+	conn.Close()
+
+	var names []string
+	done := make(chan struct{})
+	go func() {
+		for e := range events {
+			names = append(names, e.(*PlayStartEvent).Name)
+		}
+		close(done)
+	}()
+	if err = el.Close(); err != nil {
+		t.Errorf("unexpected error closing listener: %v", err)
+	}
+	<-done
+
+	if strings.Join(names, ",") != "first,second,third" {
+		t.Errorf("expected events first,second,third but got %v", names)
+	}
+}
+
+func TestEventListenerCleansUpSocket(t *testing.T) {
+	el, err := newEventListener()
+	if err != nil {
+		t.Fatalf("error creating event listener: %v", err)
+	}
+	if !strings.HasPrefix(el.Address(), unixAddressPrefix) {
+		t.Skip("unix sockets are not supported")
+	}
+	sock := strings.TrimPrefix(el.Address(), unixAddressPrefix)
+	if _, err = os.Stat(sock); err != nil {
+		t.Fatalf("expected socket to exist: %v", err)
+	}
+	if err = el.Close(); err != nil {
+		t.Errorf("unexpected error closing listener: %v", err)
+	}
+	if _, err = os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("expected socket %q to be removed", sock)
+	}
+}
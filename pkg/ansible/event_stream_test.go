@@ -2,6 +2,9 @@ package ansible
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -74,3 +77,84 @@ someBadStuffHere...
 		t.Errorf("got %d events, but expected %d", gotEvents, expectedGoodEvents)
 	}
 }
+
+// replays event streams recorded from the json_lines callback
+func TestEventStreamReplay(t *testing.T) {
+	tests := []struct {
+		file           string
+		expectedEvents []string
+	}{
+		{
+			file: "playbook-success.jsonl",
+			expectedEvents: []string{
+				"Playbook Start",
+				"Play Start",
+				"Task Start",
+				"Runner OK",
+				"Task Start",
+				"Runner Item OK",
+				"Runner OK",
+				"Play Start",
+				"Task Start",
+				"Runner Item Retry",
+				"Runner OK",
+				"Handler Task Start",
+				"Runner OK",
+				"Playbook End",
+			},
+		},
+		{
+			file: "playbook-failed.jsonl",
+			expectedEvents: []string{
+				"Playbook Start",
+				"Play Start",
+				"Task Start",
+				"Runner OK",
+				"Runner Unreachable",
+				"Task Start",
+				"Runner Item Failed",
+				"Runner Failed",
+				"Runner Skipped",
+				"Playbook End",
+			},
+		},
+	}
+	for _, test := range tests {
+		f, err := os.Open(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatalf("error opening recorded event stream: %v", err)
+		}
+		var got []string
+		for e := range EventStream(f) {
+			got = append(got, e.Type())
+		}
+		f.Close()
+		if !reflect.DeepEqual(got, test.expectedEvents) {
+			t.Errorf("%s: expected events %v, but got %v", test.file, test.expectedEvents, got)
+		}
+	}
+}
+
+func TestEventStreamReplayEventData(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "playbook-failed.jsonl"))
+	if err != nil {
+		t.Fatalf("error opening recorded event stream: %v", err)
+	}
+	defer f.Close()
+	for e := range EventStream(f) {
+		switch event := e.(type) {
+		case *PlaybookStartEvent:
+			if event.Name != "kubernetes.yaml" || event.Count != 1 {
+				t.Errorf("unexpected playbook start event: %+v", event)
+			}
+		case *RunnerUnreachableEvent:
+			if event.Host != "worker02" {
+				t.Errorf("expected unreachable host to be worker02, but got %q", event.Host)
+			}
+		case *RunnerItemFailedEvent:
+			if event.Result.Item != "docker-engine" || event.IgnoreErrors {
+				t.Errorf("unexpected item failed event: %+v", event)
+			}
+		}
+	}
+}
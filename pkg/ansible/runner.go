@@ -5,13 +5,11 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"strings"
-	"syscall"
-	"time"
 )
 
 const (
@@ -19,8 +17,15 @@ const (
 	RawFormat = OutputFormat("raw")
 	// JSONLinesFormat is a JSON Lines representation of Ansible events
 	JSONLinesFormat = OutputFormat("json_lines")
+	// JSONFormat is a normalized JSON representation of Ansible events,
+	// meant to be consumed by other programs
+	JSONFormat = OutputFormat("json")
 )
 
+// EventsFilename is the name of the file in the run directory where the
+// JSON lines sent by the json_lines callback are recorded
+const EventsFilename = "events.jsonl"
+
 // OutputFormat is used for controlling the STDOUT format of the Ansible runner
 type OutputFormat string
 
@@ -30,7 +35,8 @@ type Runner interface {
 	// It returns a read-only channel that must be consumed for the playbook execution to proceed.
 	StartPlaybook(playbookFile string, inventory Inventory, cc ClusterCatalog) (<-chan Event, error)
 	// WaitPlaybook blocks until the execution of the playbook is complete. If an error occurred,
-	// it is returned. Otherwise, returns nil to signal the completion of the playbook.
+	// it is returned. Otherwise, returns nil to signal the completion of the playbook. The
+	// event channel is closed once all the events have been received by the consumer.
 	WaitPlaybook() error
 	// StartPlaybookOnNode runs the playbook asynchronously with the given inventory and extra vars
 	// against the specific node.
@@ -48,7 +54,6 @@ type runner struct {
 	ansibleDir   string
 	runDir       string
 	waitPlaybook func() error
-	namedPipe    string
 }
 
 // NewRunner returns a new runner for running Ansible playbooks.
@@ -79,19 +84,7 @@ func (r *runner) WaitPlaybook() error {
 	if r.waitPlaybook == nil {
 		return fmt.Errorf("wait called, but playbook not started")
 	}
-	execErr := r.waitPlaybook()
-	// Process exited, we can clean up named pipe
-	removeErr := os.Remove(r.namedPipe)
-	if removeErr != nil && execErr != nil {
-		return fmt.Errorf("an error occurred running ansible: %v. Removing named pipe at %q failed: %v", execErr, r.namedPipe, removeErr)
-	}
-	if removeErr != nil {
-		return fmt.Errorf("failed to clean up named pipe at %q: %v", r.namedPipe, removeErr)
-	}
-	if execErr != nil {
-		return fmt.Errorf("error running ansible: %v", execErr)
-	}
-	return nil
+	return r.waitPlaybook()
 }
 
 // RunPlaybook with the given inventory and extra vars
@@ -117,23 +110,19 @@ func (r *runner) startPlaybook(playbookFile string, inv Inventory, cc ClusterCat
 	if err != nil {
 		return nil, fmt.Errorf("error writing cluster catalog data to yaml: %v", err)
 	}
-	clusterCatalogFile := filepath.Join(r.ansibleDir, "clustercatalog.yaml")
+	// The cluster catalog and the inventory are written to the run directory,
+	// so that multiple playbooks can run concurrently from the same ansible
+	// directory
+	clusterCatalogFile := filepath.Join(r.runDir, "clustercatalog.yaml")
 	if err = ioutil.WriteFile(clusterCatalogFile, yamlBytes, 0644); err != nil {
 		return nil, fmt.Errorf("error writing cluster catalog file to %q: %v", clusterCatalogFile, err)
 	}
 
-	inventoryFile := filepath.Join(r.ansibleDir, "inventory.ini")
+	inventoryFile := filepath.Join(r.runDir, "inventory.ini")
 	if err := ioutil.WriteFile(inventoryFile, inv.ToINI(), 0644); err != nil {
 		return nil, fmt.Errorf("error writing inventory file to %q: %v", inventoryFile, err)
 	}
 
-	if err := copyFileContents(clusterCatalogFile, filepath.Join(r.runDir, "clustercatalog.yaml")); err != nil {
-		return nil, fmt.Errorf("error copying clustercatalog.yaml to %q: %v", r.runDir, err)
-	}
-	if err := copyFileContents(inventoryFile, filepath.Join(r.runDir, "inventory.ini")); err != nil {
-		return nil, fmt.Errorf("error copying inventory.ini to %q: %v", r.runDir, err)
-	}
-
 	cmd := exec.Command(filepath.Join(r.ansibleDir, "bin", "ansible-playbook"), "-i", inventoryFile, "-s", playbook, "--extra-vars", "@"+clusterCatalogFile)
 	cmd.Stdout = r.out
 	cmd.Stderr = r.errOut
@@ -149,53 +138,95 @@ func (r *runner) startPlaybook(playbookFile string, inv Inventory, cc ClusterCat
 	// stdout, it's going to a log file.
 	cmd.Args = append(cmd.Args, "-vvvv")
 
-	// Create named pipe
-	np, err := createTempNamedPipe()
+	// Listen for the events sent by the json_lines callback, and record
+	// them in the run directory so that the run can be replayed
+	eventsFile, err := os.Create(filepath.Join(r.runDir, EventsFilename))
+	if err != nil {
+		return nil, fmt.Errorf("error creating events file in %q: %v", r.runDir, err)
+	}
+	el, err := newEventListener()
 	if err != nil {
+		eventsFile.Close()
 		return nil, err
 	}
-	r.namedPipe = np
 
-	os.Setenv("PYTHONPATH", r.pythonPath)
-	os.Setenv("ANSIBLE_CALLBACK_PLUGINS", filepath.Join(r.ansibleDir, "playbooks", "callback"))
-	os.Setenv("ANSIBLE_CALLBACK_WHITELIST", "json_lines")
-	os.Setenv("ANSIBLE_CONFIG", filepath.Join(r.ansibleDir, "playbooks", "ansible.cfg"))
-	os.Setenv("ANSIBLE_JSON_LINES_PIPE", r.namedPipe)
+	env := []string{
+		"PYTHONPATH=" + r.pythonPath,
+		"ANSIBLE_CALLBACK_PLUGINS=" + filepath.Join(r.ansibleDir, "playbooks", "callback"),
+		"ANSIBLE_CALLBACK_WHITELIST=json_lines",
+		"ANSIBLE_CONFIG=" + filepath.Join(r.ansibleDir, "playbooks", "ansible.cfg"),
+		"ANSIBLE_JSON_LINES_ADDRESS=" + el.Address(),
+	}
+	cmd.Env = append(os.Environ(), env...)
 
 	// Print Ansible command
-	fmt.Fprintf(r.out, "export PYTHONPATH=%v\n", os.Getenv("PYTHONPATH"))
-	fmt.Fprintf(r.out, "export ANSIBLE_CALLBACK_PLUGINS=%v\n", os.Getenv("ANSIBLE_CALLBACK_PLUGINS"))
-	fmt.Fprintf(r.out, "export ANSIBLE_CALLBACK_WHITELIST=%v\n", os.Getenv("ANSIBLE_CALLBACK_WHITELIST"))
-	fmt.Fprintf(r.out, "export ANSIBLE_CONFIG=%v\n", os.Getenv("ANSIBLE_CONFIG"))
-	fmt.Fprintf(r.out, "export ANSIBLE_JSON_LINES_PIPE=%v\n", os.Getenv("ANSIBLE_JSON_LINES_PIPE"))
+	for _, e := range env {
+		fmt.Fprintf(r.out, "export %s\n", e)
+	}
 	fmt.Fprintln(r.out, strings.Join(cmd.Args, " "))
 
-	// Starts async execution of ansible, which will block until
-	// we start reading from the named pipe
-	err = cmd.Start()
-	if err != nil {
-		return nil, fmt.Errorf("error running playbook: %v", err)
-	}
-	r.waitPlaybook = cmd.Wait
+	// Catch interrupts while the playbook is running, so that they can be
+	// forwarded to ansible and the events sent before exiting are not lost
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
 
-	// Create the event stream out of the named pipe
-	eventStreamFile, err := os.OpenFile(r.namedPipe, os.O_RDWR, os.ModeNamedPipe)
-	if err != nil {
-		return nil, fmt.Errorf("error openning event stream pipe: %v", err)
+	// Starts async execution of ansible
+	if err = cmd.Start(); err != nil {
+		signal.Stop(signals)
+		el.Close()
+		eventsFile.Close()
+		return nil, fmt.Errorf("error running playbook: %v", err)
 	}
-	eventStream := EventStream(eventStreamFile)
-	return eventStream, nil
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	events, drained := forwardEvents(EventStream(io.TeeReader(el.Reader(), eventsFile)))
+	r.waitPlaybook = func() error {
+		defer signal.Stop(signals)
+		var interrupted bool
+		for {
+			select {
+			case sig := <-signals:
+				interrupted = true
+				fmt.Fprintln(r.errOut, "Interrupt received, waiting for ansible to exit")
+				if err := cmd.Process.Signal(sig); err != nil {
+					fmt.Fprintf(r.errOut, "error forwarding interrupt to ansible: %v\n", err)
+				}
+			case execErr := <-exited:
+				// Process exited, drain the remaining events and clean up the listener
+				closeErr := el.Close()
+				<-drained
+				eventsFile.Close()
+				switch {
+				case interrupted:
+					return fmt.Errorf("ansible was interrupted")
+				case execErr != nil && closeErr != nil:
+					return fmt.Errorf("an error occurred running ansible: %v. Cleaning up the event listener failed: %v", execErr, closeErr)
+				case execErr != nil:
+					return fmt.Errorf("error running ansible: %v", execErr)
+				}
+				return closeErr
+			}
+		}
+	}
+	return events, nil
 }
 
-// create a named pipe for getting json events out of ansible.
-// add random int to file name to avoid collision.
-func createTempNamedPipe() (string, error) {
-	start := time.Now()
-	np := filepath.Join(os.TempDir(), fmt.Sprintf("ansible-pipe-%d-%s", rand.Int(), start.Format("2006-01-02-15-04-05.99999")))
-	if err := syscall.Mkfifo(np, 0644); err != nil {
-		return "", fmt.Errorf("error creating named pipe %q: %v", np, err)
-	}
-	return np, nil
+// forwardEvents forwards the events to the returned channel. The drained channel
+// is closed once all events have been received by the consumer.
+func forwardEvents(in <-chan Event) (<-chan Event, <-chan struct{}) {
+	out := make(chan Event)
+	drained := make(chan struct{})
+	go func() {
+		for e := range in {
+			out <- e
+		}
+		close(out)
+		close(drained)
+	}()
+	return out, drained
 }
 
 func getPythonPath() (string, error) {
@@ -207,20 +238,3 @@ func getPythonPath() (string, error) {
 	lib64 := filepath.Join(wd, "ansible", "lib64", "python2.7", "site-packages")
 	return fmt.Sprintf("%s:%s", lib, lib64), nil
 }
-
-func copyFileContents(src, dst string) (err error) {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	if _, err = io.Copy(out, in); err != nil {
-		return err
-	}
-	return out.Sync()
-}
@@ -4,11 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/apprenda/kismatic/pkg/install"
-	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/apprenda/kismatic/pkg/kismatic"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +19,9 @@ type addWorkerOpts struct {
 	OutputFormat             string
 	Verbose                  bool
 	SkipPreFlight            bool
+	ForceUnlock              bool
+	DryRun                   bool
+	DryRunDirectory          string
 }
 
 // NewCmdAddWorker returns the command for adding workers to the cluster
@@ -48,85 +51,74 @@ func NewCmdAddWorker(out io.Writer, installOpts *installOpts) *cobra.Command {
 					newWorker.Labels[pair[0]] = pair[1]
 				}
 			}
-			return doAddWorker(out, installOpts.planFilename, opts, newWorker)
+			return doAddWorker(out, installOpts.planner(), opts, newWorker)
 		},
 	}
 	cmd.Flags().StringSliceVarP(&opts.NodeLabels, "labels", "l", []string{}, "key=value pairs separated by ','")
 	cmd.Flags().StringVar(&opts.GeneratedAssetsDirectory, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&opts.RestartServices, "restart-services", false, "force restart clusters services (Use with care)")
 	cmd.Flags().BoolVar(&opts.Verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\"|\"json\")")
 	cmd.Flags().BoolVar(&opts.SkipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	addForceUnlockFlag(cmd.Flags(), &opts.ForceUnlock)
+	addDryRunFlags(cmd.Flags(), &opts.DryRun, &opts.DryRunDirectory)
 	return cmd
 }
 
-func doAddWorker(out io.Writer, planFile string, opts *addWorkerOpts, newWorker install.Node) error {
-	planner := &install.FilePlanner{File: planFile}
+func doAddWorker(out io.Writer, planner *install.FilePlanner, opts *addWorkerOpts, newWorker install.Node) error {
 	if !planner.PlanExists() {
-		return planFileNotFoundErr{filename: planFile}
+		return planFileNotFoundErr{filename: planner.File}
 	}
-	execOpts := install.ExecutorOptions{
-		GeneratedAssetsDirectory: opts.GeneratedAssetsDirectory,
-		RestartServices:          opts.RestartServices,
-		OutputFormat:             opts.OutputFormat,
-		Verbose:                  opts.Verbose,
+	if len(planner.Overlays) > 0 {
+		return errors.New("cannot update a plan that is the result of merging overlays, add the new worker to the plan files and run \"install apply\" instead")
 	}
-	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	usesVars, err := planner.UsesVariables()
 	if err != nil {
 		return err
 	}
-	plan, err := planner.Read()
-	if err != nil {
-		return fmt.Errorf("failed to read plan file: %v", err)
-	}
-	if _, errs := install.ValidateNode(&newWorker); errs != nil {
-		util.PrintValidationErrors(out, errs)
-		return errors.New("information provided about the new worker node is invalid")
-	}
-	if _, errs := install.ValidatePlan(plan); errs != nil {
-		util.PrintValidationErrors(out, errs)
-		return errors.New("the plan file failed validation")
-	}
-	workerSSHCon := &install.SSHConnection{
-		SSHConfig: &plan.Cluster.SSH,
-		Node:      &newWorker,
+	if usesVars {
+		return errors.New("cannot update a plan that references variables, add the new worker to the plan file and run \"install apply\" instead")
 	}
-	if _, errs := install.ValidateSSHConnection(workerSSHCon, "New worker node"); errs != nil {
-		util.PrintValidationErrors(out, errs)
-		return errors.New("could not establish SSH connection to the new node")
-	}
-	if err = ensureNodeIsNew(*plan, newWorker); err != nil {
+	options, err := clientOptions(out, opts.OutputFormat)
+	if err != nil {
 		return err
 	}
-	if !opts.SkipPreFlight {
-		util.PrintHeader(out, "Running Pre-Flight Checks On New Worker", '=')
-		if err = executor.RunNewWorkerPreFlightCheck(*plan, newWorker); err != nil {
+	out = options.Log
+	generatedAssetsDir := opts.GeneratedAssetsDirectory
+	var dryRunDir string
+	if opts.DryRun {
+		if dryRunDir, err = prepareDryRun(out, opts.DryRunDirectory, opts.GeneratedAssetsDirectory); err != nil {
 			return err
 		}
+		generatedAssetsDir = dryRunDir
+		defer removeDryRunSecrets(out, dryRunDir)
 	}
-	updatedPlan, err := executor.AddWorker(plan, newWorker)
+	options.GeneratedAssetsDirectory = generatedAssetsDir
+	options.RestartServices = opts.RestartServices
+	options.Verbose = opts.Verbose
+	options.ForceUnlock = opts.ForceUnlock
+	options.DryRun = opts.DryRun
+	options.DryRunDirectory = dryRunDir
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read plan file: %v", err)
+	}
+	result, err := kismatic.New(options).AddWorker(plan, newWorker, kismatic.AddWorkerOptions{SkipPreFlight: opts.SkipPreFlight})
 	if err != nil {
 		return err
 	}
+	updatedPlan := result.Plan
+	if opts.DryRun {
+		// Record the updated plan in the bundle, and leave the plan file untouched
+		dryRunPlanner := install.FilePlanner{File: filepath.Join(dryRunDir, "kismatic-cluster.yaml")}
+		if err := dryRunPlanner.Write(updatedPlan); err != nil {
+			return fmt.Errorf("error recording the updated plan file: %v", err)
+		}
+		printDryRunComplete(out, dryRunDir)
+		return nil
+	}
 	if err := planner.Write(updatedPlan); err != nil {
 		return fmt.Errorf("error updating plan file to inlcude new worker node: %v", err)
 	}
 	return nil
 }
-
-// returns an error if the plan contains a worker that is "equivalent"
-// to the new worker that is being added
-func ensureNodeIsNew(plan install.Plan, newWorker install.Node) error {
-	for _, n := range plan.Worker.Nodes {
-		if n.Host == newWorker.Host {
-			return fmt.Errorf("according to the plan file, the host name of the new node is already being used by another worker node")
-		}
-		if n.IP == newWorker.IP {
-			return fmt.Errorf("according to the plan file, the IP of the new node is already being used by another worker node")
-		}
-		if newWorker.InternalIP != "" && n.InternalIP == newWorker.InternalIP {
-			return fmt.Errorf("according to the plan file, the internal IP of the new node is already being used by another worker node")
-		}
-	}
-	return nil
-}
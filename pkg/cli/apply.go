@@ -3,9 +3,9 @@ package cli
 import (
 	"fmt"
 	"io"
-	"os"
 
 	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -13,12 +13,13 @@ import (
 type applyCmd struct {
 	out                io.Writer
 	planner            install.Planner
-	executor           install.Executor
+	client             *kismatic.Client
 	planFile           string
 	generatedAssetsDir string
-	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	dryRun             bool
+	dryRunDir          string
 }
 
 type applyOpts struct {
@@ -27,6 +28,10 @@ type applyOpts struct {
 	verbose            bool
 	outputFormat       string
 	skipPreFlight      bool
+	profile            bool
+	forceUnlock        bool
+	dryRun             bool
+	dryRunDir          string
 }
 
 // NewCmdApply creates a cluter using the plan file
@@ -39,27 +44,37 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 			if len(args) != 0 {
 				return fmt.Errorf("Unexpected args: %v", args)
 			}
-			planner := &install.FilePlanner{File: installOpts.planFilename}
-			executorOpts := install.ExecutorOptions{
-				GeneratedAssetsDirectory: applyOpts.generatedAssetsDir,
-				RestartServices:          applyOpts.restartServices,
-				OutputFormat:             applyOpts.outputFormat,
-				Verbose:                  applyOpts.verbose,
-			}
-			executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
+			options, err := clientOptions(out, applyOpts.outputFormat)
 			if err != nil {
 				return err
 			}
+			generatedAssetsDir := applyOpts.generatedAssetsDir
+			var dryRunDir string
+			if applyOpts.dryRun {
+				if dryRunDir, err = prepareDryRun(options.Log, applyOpts.dryRunDir, applyOpts.generatedAssetsDir); err != nil {
+					return err
+				}
+				generatedAssetsDir = dryRunDir
+				defer removeDryRunSecrets(options.Log, dryRunDir)
+			}
+			options.GeneratedAssetsDirectory = generatedAssetsDir
+			options.RestartServices = applyOpts.restartServices
+			options.Verbose = applyOpts.verbose
+			options.Profile = applyOpts.profile
+			options.ForceUnlock = applyOpts.forceUnlock
+			options.DryRun = applyOpts.dryRun
+			options.DryRunDirectory = dryRunDir
 
 			applyCmd := &applyCmd{
 				out:                out,
-				planner:            planner,
-				executor:           executor,
-				planFile:           installOpts.planFilename,
-				generatedAssetsDir: applyOpts.generatedAssetsDir,
-				verbose:            applyOpts.verbose,
+				planner:            installOpts.planner(),
+				client:             kismatic.New(options),
+				planFile:           installOpts.planFilename(),
+				generatedAssetsDir: generatedAssetsDir,
 				outputFormat:       applyOpts.outputFormat,
 				skipPreFlight:      applyOpts.skipPreFlight,
+				dryRun:             applyOpts.dryRun,
+				dryRunDir:          dryRunDir,
 			}
 			return applyCmd.run()
 		},
@@ -69,66 +84,46 @@ func NewCmdApply(out io.Writer, installOpts *installOpts) *cobra.Command {
 	cmd.Flags().StringVar(&applyOpts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&applyOpts.restartServices, "restart-services", false, "force restart cluster services (Use with care)")
 	cmd.Flags().BoolVar(&applyOpts.verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.Flags().StringVarP(&applyOpts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().StringVarP(&applyOpts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\"|\"json\")")
 	cmd.Flags().BoolVar(&applyOpts.skipPreFlight, "skip-preflight", false, "skip pre-flight checks, useful when rerunning kismatic")
+	cmd.Flags().BoolVar(&applyOpts.profile, "profile", false, "print the slowest tasks and the duration of every play once the installation is done")
+	addForceUnlockFlag(cmd.Flags(), &applyOpts.forceUnlock)
+	addDryRunFlags(cmd.Flags(), &applyOpts.dryRun, &applyOpts.dryRunDir)
 
 	return cmd
 }
 
 func (c *applyCmd) run() error {
-	// Validate and run pre-flight
-	opts := &validateOpts{
-		planFile:           c.planFile,
-		verbose:            c.verbose,
-		outputFormat:       c.outputFormat,
-		skipPreFlight:      c.skipPreFlight,
-		generatedAssetsDir: c.generatedAssetsDir,
-	}
-	err := doValidate(c.out, c.planner, opts)
+	out := messagesWriter(c.out, c.outputFormat)
+	plan, err := readPlanForValidation(out, c.planner, c.planFile)
 	if err != nil {
 		return fmt.Errorf("error validating plan: %v", err)
 	}
-	plan, err := c.planner.Read()
-	if err != nil {
-		return fmt.Errorf("error reading plan file: %v", err)
-	}
-
-	// Generate certificates
-	if err := c.executor.GenerateCertificates(plan, false); err != nil {
-		return fmt.Errorf("error installing: %v", err)
+	// Validate, run pre-flight and install. The pre-flight checks are skipped
+	// during a dry run, as they install the inspector on the nodes.
+	result, err := c.client.Install(plan, kismatic.InstallOptions{SkipPreFlight: c.skipPreFlight})
+	if result != nil && result.Validation != nil && !result.Validation.Valid() {
+		return fmt.Errorf("error validating plan: %v", validationError(result.Validation))
 	}
-
-	// Generate kubeconfig
-	util.PrintHeader(c.out, "Generating Kubeconfig File", '=')
-	err = install.GenerateKubeconfig(plan, c.generatedAssetsDir)
 	if err != nil {
-		return fmt.Errorf("error generating kubeconfig file: %v", err)
-	}
-	util.PrettyPrintOk(c.out, "Generated kubeconfig file in the %q directory", c.generatedAssetsDir)
-
-	// Perform the installation
-	if err := c.executor.Install(plan); err != nil {
-		return fmt.Errorf("error installing: %v", err)
+		return err
 	}
 
-	// Run smoketest
-	// Don't run
-	if plan.NetworkConfigured() {
-		if err := c.executor.RunSmokeTest(plan); err != nil {
-			return fmt.Errorf("error running smoke test: %v", err)
-		}
+	if c.dryRun {
+		printDryRunComplete(out, c.dryRunDir)
+		return nil
 	}
 
-	util.PrintColor(c.out, util.Green, "\nThe cluster was installed successfully!\n")
-	fmt.Fprintln(c.out)
+	util.PrintColor(out, util.Green, "\nThe cluster was installed successfully!\n")
+	fmt.Fprintln(out)
 
 	msg := "- To use the generated kubeconfig file with kubectl:" +
 		"\n    * use \"./kubectl --kubeconfig %s/kubeconfig\"" +
 		"\n    * or copy the config file \"cp %[1]s/kubeconfig ~/.kube/config\"\n"
-	util.PrintColor(c.out, util.Blue, msg, c.generatedAssetsDir)
-	util.PrintColor(c.out, util.Blue, "- To view the Kubernetes dashboard: \"./kismatic dashboard\"\n")
-	util.PrintColor(c.out, util.Blue, "- To SSH into a cluster node: \"./kismatic ssh etcd|master|worker|storage|$node.host\"\n")
-	fmt.Fprintln(c.out)
+	util.PrintColor(out, util.Blue, msg, c.generatedAssetsDir)
+	util.PrintColor(out, util.Blue, "- To view the Kubernetes dashboard: \"./kismatic dashboard\"\n")
+	util.PrintColor(out, util.Blue, "- To SSH into a cluster node: \"./kismatic ssh etcd|master|worker|storage|$node.host\"\n")
+	fmt.Fprintln(out)
 
 	return nil
 }
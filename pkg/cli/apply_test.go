@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
 )
 
 func TestApplyCmdInvalidPlanFound(t *testing.T) {
@@ -16,9 +17,9 @@ func TestApplyCmdInvalidPlanFound(t *testing.T) {
 	fe := &fakeExecutor{}
 
 	applyCmd := &applyCmd{
-		out:      out,
-		planner:  fp,
-		executor: fe,
+		out:     out,
+		planner: fp,
+		client:  kismatic.New(kismatic.Options{Log: out, Executor: fe}),
 	}
 
 	err := applyCmd.run()
@@ -2,7 +2,12 @@ package cli
 
 import (
 	"fmt"
+	"io"
+	"os"
 
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
+	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/pflag"
 )
 
@@ -17,3 +22,80 @@ type planFileNotFoundErr struct {
 func (e planFileNotFoundErr) Error() string {
 	return fmt.Sprintf("Plan file not found at %q. If you don't have a plan file, you may generate one with 'kismatic install plan'", e.filename)
 }
+
+// kismaticConfig reads the kismatic config file
+func kismaticConfig() (*install.Config, error) {
+	return install.ReadConfig(install.DefaultConfigFile())
+}
+
+// addForceUnlockFlag adds the flag that removes the operation lock of the cluster
+func addForceUnlockFlag(flagSet *pflag.FlagSet, forceUnlock *bool) {
+	flagSet.BoolVar(forceUnlock, "force-unlock", false, "remove the operation lock of the cluster left behind by a run that did not complete (Use with care)")
+}
+
+// addDryRunFlags adds the flags that control the dry run of a command
+func addDryRunFlags(flagSet *pflag.FlagSet, dryRun *bool, dryRunDir *string) {
+	flagSet.BoolVar(dryRun, "dry-run", false, "render everything that would be deployed to the nodes in a local bundle, without changing the cluster")
+	flagSet.StringVar(dryRunDir, "dry-run-dir", "", "path to the directory where the dry run bundle will be written (defaults to a temporary directory)")
+}
+
+// prepareDryRun creates the directory of the dry run bundle. The bundle is used
+// as the generated assets directory during the dry run, so that the existing
+// assets are left untouched.
+func prepareDryRun(out io.Writer, dryRunDir string, generatedAssetsDir string) (string, error) {
+	bundle, err := install.PrepareDryRunDirectory(dryRunDir, generatedAssetsDir)
+	if err != nil {
+		return "", fmt.Errorf("error preparing the dry run directory: %v", err)
+	}
+	util.PrettyPrintOk(out, "Writing the dry run bundle to %q", bundle)
+	return bundle, nil
+}
+
+// removeDryRunSecrets removes the private keys and the encryption config from
+// the dry run bundle, so that it can be shared with reviewers
+func removeDryRunSecrets(out io.Writer, bundle string) {
+	if err := install.RemoveDryRunSecrets(bundle); err != nil {
+		util.PrettyPrintWarn(out, "Error removing the private keys from the dry run bundle %q: %v", bundle, err)
+	}
+}
+
+// printDryRunComplete describes the contents of the dry run bundle
+func printDryRunComplete(out io.Writer, bundle string) {
+	fmt.Fprintln(out)
+	util.PrintColor(out, util.Green, "Dry run complete. The cluster was not changed.\n")
+	fmt.Fprintln(out)
+	msg := "The dry run bundle can be found in %q:" +
+		"\n- keys: the certificates that would be deployed, without their private keys" +
+		"\n- playbooks.txt: the playbooks that would run, in order, and the nodes they would run on" +
+		"\n- tasks: the plan, inventory and cluster catalog of each playbook, and the manifests and" +
+		"\n  systemd units it would deploy, rendered for each node\n"
+	util.PrintColor(out, util.Blue, msg, bundle)
+	fmt.Fprintln(out)
+}
+
+// messagesWriter returns the writer for the output of a command that is not an
+// Ansible event. In JSON mode, stdout only contains the events so that it can be
+// parsed by other programs, and all other output is written to stderr.
+func messagesWriter(out io.Writer, outputFormat string) io.Writer {
+	if outputFormat == "json" {
+		return os.Stderr
+	}
+	return out
+}
+
+// clientOptions returns the options of the client that runs the operations of
+// a command. The Ansible output is written to out, and the messages are written
+// to the messages writer.
+func clientOptions(out io.Writer, outputFormat string) (kismatic.Options, error) {
+	config, err := kismaticConfig()
+	if err != nil {
+		return kismatic.Options{}, err
+	}
+	return kismatic.Options{
+		Out:               out,
+		Log:               messagesWriter(out, outputFormat),
+		OutputFormat:      outputFormat,
+		Webhooks:          config.Notifications.Webhooks,
+		FailureSignatures: config.FailureSignatures,
+	}, nil
+}
@@ -60,6 +60,14 @@ func (fe *fakeExecutor) UpgradeNodes(install.Plan, []install.ListableNode, bool,
 	return nil
 }
 
+func (fe *fakeExecutor) UpgradeNodeBatches(install.Plan, [][]install.ListableNode, bool) error {
+	return nil
+}
+
+func (fe *fakeExecutor) RollbackNode(install.Plan, install.ListableNode) error {
+	return nil
+}
+
 func (fe *fakeExecutor) ValidateControlPlane(install.Plan) error {
 	return nil
 }
@@ -68,6 +76,10 @@ func (fe *fakeExecutor) UpgradeDockerRegistry(install.Plan) error {
 	return nil
 }
 
+func (fe *fakeExecutor) LockCluster(install.Plan, string) (func() error, error) {
+	return func() error { return nil }, nil
+}
+
 func (fe *fakeExecutor) UpgradeClusterServices(install.Plan) error {
 	return nil
 }
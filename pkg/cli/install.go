@@ -3,11 +3,27 @@ package cli
 import (
 	"io"
 
+	"github.com/apprenda/kismatic/pkg/install"
 	"github.com/spf13/cobra"
 )
 
 type installOpts struct {
-	planFilename string
+	planFilenames []string
+	varsFilename  string
+}
+
+// planFilename returns the base plan file
+func (o *installOpts) planFilename() string {
+	return o.planFilenames[0]
+}
+
+// planner returns a planner that merges all the plan files provided by the user
+func (o *installOpts) planner() *install.FilePlanner {
+	return &install.FilePlanner{
+		File:     o.planFilenames[0],
+		Overlays: o.planFilenames[1:],
+		VarsFile: o.varsFilename,
+	}
 }
 
 // NewCmdInstall creates a new install command
@@ -30,7 +46,8 @@ func NewCmdInstall(in io.Reader, out io.Writer) *cobra.Command {
 	cmd.AddCommand(NewCmdStep(out, opts))
 
 	// PersistentFlags
-	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFilename)
+	cmd.PersistentFlags().StringArrayVarP(&opts.planFilenames, "plan-file", "f", []string{"kismatic-cluster.yaml"}, "path to the installation plan file. Can be repeated to merge overlay plan files on top of the first one")
+	cmd.PersistentFlags().StringVar(&opts.varsFilename, "vars-file", "", "path to a YAML file with the values of the ${VAR} references in the plan files")
 
 	return cmd
 }
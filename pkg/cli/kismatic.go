@@ -27,10 +27,15 @@ more documentation is availble at https://github.com/apprenda/kismatic`,
 	cmd.AddCommand(NewCmdDashboard(out))
 	cmd.AddCommand(NewCmdSSH(out))
 	cmd.AddCommand(NewCmdInfo(out))
+	cmd.AddCommand(NewCmdStatus(out))
 	cmd.AddCommand(NewCmdUpgrade(in, out))
 	cmd.AddCommand(NewCmdDiagnostic(out))
 	cmd.AddCommand(NewCmdCertificates(out))
+	cmd.AddCommand(NewCmdKubeconfig(out))
 	cmd.AddCommand(NewCmdSeedRegistry(out, stderr))
+	cmd.AddCommand(NewCmdSecrets(in, out))
+	cmd.AddCommand(NewCmdRuns(out))
+	cmd.AddCommand(NewCmdServe(out))
 
 	return cmd, nil
 }
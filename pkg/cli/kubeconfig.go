@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+type kubeconfigOpts struct {
+	planFile           string
+	generatedAssetsDir string
+}
+
+// NewCmdKubeconfig returns the kubeconfig command
+func NewCmdKubeconfig(out io.Writer) *cobra.Command {
+	opts := &kubeconfigOpts{}
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Manage the kubeconfig files of the users of the cluster",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFile)
+	cmd.PersistentFlags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.AddCommand(NewCmdKubeconfigCreate(out, opts))
+	cmd.AddCommand(NewCmdKubeconfigRevoke(out, opts))
+	return cmd
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type kubeconfigCreateOpts struct {
+	user           string
+	groups         []string
+	namespace      string
+	role           string
+	validityPeriod int
+	oidc           bool
+	clientSecret   string
+}
+
+// NewCmdKubeconfigCreate returns the command for creating the kubeconfig file of a user
+func NewCmdKubeconfigCreate(out io.Writer, kubeconfigOpts *kubeconfigOpts) *cobra.Command {
+	opts := &kubeconfigCreateOpts{}
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a kubeconfig file for a user, bound to a role",
+		Long: `Create a kubeconfig file for a user, bound to a role.
+
+A client certificate is issued for the user, signed by the cluster CA. The groups of the user
+are set as the organizations of the certificate. The user is bound to the ClusterRole given
+with --role, in the namespace given with --namespace, or in all namespaces if no namespace is given.
+
+The kubeconfig file is written to the generated assets directory, and the serial number of the
+certificate is recorded so that it can be revoked with "kismatic kubeconfig revoke".
+
+When OpenID Connect authentication is configured in the plan file, --oidc creates a kubeconfig file
+that uses the oidc auth provider instead of a client certificate. The groups of the user are read
+from the ID token. The user has to log in with the identity provider, and set the ID token and the
+refresh token of the kubeconfig file, e.g. with "kubectl config set-credentials".
+`,
+		Example: `kismatic kubeconfig create --user alice --group dev-team --namespace payments --role edit
+kismatic kubeconfig create --user alice@example.com --oidc --role view`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doKubeconfigCreate(out, kubeconfigOpts, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.user, "user", "", "name of the user, used as the common name of the client certificate")
+	cmd.Flags().StringSliceVar(&opts.groups, "group", []string{}, "group of the user, used as an organization of the client certificate. Can be repeated")
+	cmd.Flags().StringVar(&opts.namespace, "namespace", "", "namespace the user is bound to the role in. The user is bound to the role in all namespaces if empty")
+	cmd.Flags().StringVar(&opts.role, "role", "view", "name of the ClusterRole the user is bound to, e.g. \"view\", \"edit\" or \"admin\"")
+	cmd.Flags().IntVar(&opts.validityPeriod, "validity-period", 365, "number of days the client certificate is valid for")
+	cmd.Flags().BoolVar(&opts.oidc, "oidc", false, "use the OpenID Connect identity provider of the cluster instead of a client certificate")
+	cmd.Flags().StringVar(&opts.clientSecret, "oidc-client-secret", "", "client secret set in the oidc auth provider of the kubeconfig file")
+	return cmd
+}
+
+func doKubeconfigCreate(out io.Writer, kubeconfigOpts *kubeconfigOpts, opts *kubeconfigCreateOpts) error {
+	if opts.validityPeriod < 1 {
+		return fmt.Errorf("validity-period must be greater or equal to 1, got: %d", opts.validityPeriod)
+	}
+	if opts.clientSecret != "" && !opts.oidc {
+		return fmt.Errorf("--oidc-client-secret can only be used with --oidc")
+	}
+	planner := &install.FilePlanner{File: kubeconfigOpts.planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: kubeconfigOpts.planFile}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	userOpts := install.UserKubeconfigOptions{
+		User:           opts.user,
+		Groups:         opts.groups,
+		Namespace:      opts.namespace,
+		Role:           opts.role,
+		ValidityPeriod: fmt.Sprintf("%dh", opts.validityPeriod*24),
+	}
+	if opts.oidc {
+		userOpts.OIDC = &plan.Cluster.Authentication.OIDC
+		userOpts.OIDCClientSecret = opts.clientSecret
+	}
+	if err = install.ValidateUserKubeconfigOptions(userOpts); err != nil {
+		return err
+	}
+
+	pki := &install.LocalPKI{
+		CACsr:                   filepath.Join("ansible", "playbooks", "tls", "ca-csr.json"),
+		GeneratedCertsDirectory: filepath.Join(kubeconfigOpts.generatedAssetsDir, "keys"),
+		Log:                     out,
+	}
+	ca, err := pki.GetClusterCA()
+	if err != nil {
+		return err
+	}
+	client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	if err = install.ApplyUserBinding(client, userOpts); err != nil {
+		return err
+	}
+	util.PrettyPrintOk(out, "Bound user %q to role %q", opts.user, opts.role)
+
+	file, record, err := install.GenerateUserKubeconfig(plan, kubeconfigOpts.generatedAssetsDir, pki, ca, userOpts)
+	if err != nil {
+		return err
+	}
+	util.PrettyPrintOk(out, "Kubeconfig file of user %q written to %q", opts.user, file)
+	if opts.oidc {
+		fmt.Fprintln(out, "The user has to log in with the identity provider, and set the id-token and refresh-token of the kubeconfig file")
+		return nil
+	}
+	fmt.Fprintf(out, "The client certificate has serial number %s, and expires on %s\n", record.Serial, record.NotAfter.Format("2006-01-02"))
+	return nil
+}
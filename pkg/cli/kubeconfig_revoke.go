@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdKubeconfigRevoke returns the command for revoking the kubeconfig files of a user
+func NewCmdKubeconfigRevoke(out io.Writer, kubeconfigOpts *kubeconfigOpts) *cobra.Command {
+	var user string
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke the kubeconfig files of a user",
+		Long: `Revoke the kubeconfig files of a user.
+
+The bindings of the user are deleted from the cluster, and the serial numbers of the user's client
+certificates are recorded as revoked.
+
+Kubernetes does not check the revocation of client certificates. The certificates are still valid
+until they expire, but the user is no longer bound to a role. Any role bound to the groups of the
+user still applies. The ID tokens of OIDC users have to be revoked with the identity provider.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			if user == "" {
+				return fmt.Errorf("the user must be given with --user")
+			}
+			return doKubeconfigRevoke(out, kubeconfigOpts, user)
+		},
+	}
+	cmd.Flags().StringVar(&user, "user", "", "name of the user")
+	return cmd
+}
+
+func doKubeconfigRevoke(out io.Writer, kubeconfigOpts *kubeconfigOpts, user string) error {
+	planner := &install.FilePlanner{File: kubeconfigOpts.planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: kubeconfigOpts.planFile}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	records, err := install.ReadUserKubeconfigRecords(kubeconfigOpts.generatedAssetsDir)
+	if err != nil {
+		return err
+	}
+	client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+	for _, r := range records {
+		if r.User != user || r.Revoked {
+			continue
+		}
+		if err := install.DeleteUserBinding(client, r); err != nil {
+			return err
+		}
+	}
+	revoked, err := install.RevokeUserKubeconfigs(kubeconfigOpts.generatedAssetsDir, user, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, r := range revoked {
+		if r.AuthProvider != "" {
+			util.PrettyPrintOk(out, "Revoked the %s kubeconfig of user %q", r.AuthProvider, user)
+			continue
+		}
+		util.PrettyPrintOk(out, "Revoked the certificate with serial number %s of user %q", r.Serial, user)
+	}
+	return nil
+}
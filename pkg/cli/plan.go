@@ -3,14 +3,27 @@ package cli
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 
 	"github.com/apprenda/kismatic/pkg/install"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
 )
 
+type planOpts struct {
+	render         bool
+	nonInteractive bool
+	answersFile    string
+	inventoryFile  string
+	template       install.PlanTemplateOptions
+}
+
 // NewCmdPlan creates a new install plan command
 func NewCmdPlan(in io.Reader, out io.Writer, options *installOpts) *cobra.Command {
+	opts := &planOpts{}
+	templateFlags := pflag.NewFlagSet("plan-template", pflag.ContinueOnError)
 	cmd := &cobra.Command{
 		Use:   "plan",
 		Short: "plan your Kubernetes cluster and generate a plan file",
@@ -18,62 +31,168 @@ func NewCmdPlan(in io.Reader, out io.Writer, options *installOpts) *cobra.Comman
 			if len(args) != 0 {
 				return fmt.Errorf("Unexpected args: %v", args)
 			}
-			planner := &install.FilePlanner{File: options.planFilename}
-			return doPlan(in, out, planner, options.planFilename)
+			if opts.render {
+				return doRenderPlan(out, options.planner())
+			}
+			if opts.answersFile != "" {
+				if err := readPlanAnswers(opts.answersFile, &opts.template, templateFlags); err != nil {
+					return err
+				}
+			}
+			if opts.inventoryFile != "" {
+				inv, err := install.ReadNodeInventory(opts.inventoryFile)
+				if err != nil {
+					return err
+				}
+				mergeNodeInventory(&opts.template.Nodes, inv)
+			}
+			planner := &install.FilePlanner{File: options.planFilename()}
+			return doPlan(in, out, planner, options.planFilename(), opts)
 		},
 	}
+	addPlanTemplateFlags(templateFlags, &opts.template)
+	cmd.Flags().AddFlagSet(templateFlags)
+	cmd.Flags().BoolVar(&opts.render, "render", false, "print the plan that results from merging all plan files and substituting variables")
+	cmd.Flags().BoolVar(&opts.nonInteractive, "non-interactive", false, "do not prompt for input, use the answers file, flags and defaults instead")
+	cmd.Flags().StringVar(&opts.answersFile, "answers-file", "", "path to a YAML file with the answers used to generate the plan file. Flags take precedence over the answers file")
+	cmd.Flags().StringVar(&opts.inventoryFile, "inventory", "", "path to an Ansible INI inventory, or a CSV file with host,ip,internal_ip,role columns, used to fill in the nodes")
+
+	cmd.AddCommand(NewCmdPlanMigrate(out, options))
 
 	return cmd
 }
 
-func doPlan(in io.Reader, out io.Writer, planner install.Planner, planFile string) error {
-	fmt.Fprintln(out, "Plan your Kubernetes cluster:")
+func addPlanTemplateFlags(f *pflag.FlagSet, t *install.PlanTemplateOptions) {
+	f.StringVar(&t.ClusterName, "cluster-name", "", "name of the cluster (default \"kubernetes\")")
+	f.StringVar(&t.AdminPassword, "admin-password", "", "password of the admin user (default is a randomly generated password)")
+	f.BoolVar(&t.DisablePackageInstallation, "disable-package-installation", false, "do not install the required packages on the nodes")
+	f.BoolVar(&t.DisconnectedInstallation, "disconnected-installation", false, "the nodes are disconnected from the internet")
+	f.IntVar(&t.EtcdNodes, "etcd-nodes", 0, "number of etcd nodes (default 3)")
+	f.IntVar(&t.MasterNodes, "master-nodes", 0, "number of master nodes (default 2)")
+	f.IntVar(&t.WorkerNodes, "worker-nodes", 0, "number of worker nodes (default 3)")
+	f.IntVar(&t.IngressNodes, "ingress-nodes", 0, "number of ingress nodes")
+	f.IntVar(&t.StorageNodes, "storage-nodes", 0, "number of storage nodes")
+	f.IntVar(&t.NFSVolumes, "nfs-volumes", 0, "number of existing NFS volumes to be attached")
+	f.StringVar(&t.SSHUser, "ssh-user", "", "user for accessing the nodes over SSH (default \"kismaticuser\")")
+	f.StringVar(&t.SSHKey, "ssh-key", "", "absolute path to the SSH private key used to access the nodes")
+	f.IntVar(&t.SSHPort, "ssh-port", 0, "port for accessing the nodes over SSH (default 22)")
+	f.StringVar(&t.PodCIDRBlock, "pod-cidr", "", "CIDR block of the pod network (default \"172.16.0.0/16\")")
+	f.StringVar(&t.ServiceCIDRBlock, "service-cidr", "", "CIDR block of the service network (default \"172.20.0.0/16\")")
+	f.BoolVar(&t.UpdateHostsFiles, "update-hosts-files", false, "update the hosts file of the nodes to include all other nodes")
+	f.StringVar(&t.HTTPProxy, "http-proxy", "", "proxy server to use for HTTP connections")
+	f.StringVar(&t.HTTPSProxy, "https-proxy", "", "proxy server to use for HTTPS connections")
+	f.StringVar(&t.NoProxy, "no-proxy", "", "comma-separated list of hosts that should not go through the proxy")
+	f.StringVar(&t.LoadBalancedFQDN, "load-balanced-fqdn", "", "FQDN of the load balancer in front of the master nodes (default is the master's IP when there is a single master)")
+	f.StringVar(&t.LoadBalancedShortName, "load-balanced-short-name", "", "short name of the load balancer in front of the master nodes (default is the master's IP when there is a single master)")
+	f.StringVar(&t.CloudProvider, "cloud-provider", "", "Kubernetes cloud provider")
+	f.StringVar(&t.CloudConfig, "cloud-config", "", "path to the cloud provider config file")
+	f.StringVar(&t.DockerDirectLVMBlockDevice, "docker-direct-lvm-block-device", "", "block device used to configure docker's devicemapper in direct-lvm mode")
+	f.StringVar(&t.DockerRegistryAddress, "docker-registry-address", "", "IP or hostname of a private container image registry")
+	f.IntVar(&t.DockerRegistryPort, "docker-registry-port", 0, "port of the private container image registry (default 8443)")
+	f.StringVar(&t.DockerRegistryCAPath, "docker-registry-ca", "", "absolute path to the CA of the private container image registry")
+	f.StringVar(&t.DockerRegistryUsername, "docker-registry-username", "", "username of the private container image registry")
+	f.StringVar(&t.DockerRegistryPassword, "docker-registry-password", "", "password of the private container image registry")
+	f.StringVar(&t.CNIProvider, "cni-provider", "", "CNI provider (options \"calico\"|\"weave\"|\"contiv\"|\"custom\") (default \"calico\")")
+	f.StringVar(&t.CalicoMode, "calico-mode", "", "Calico mode (options \"overlay\"|\"routed\") (default \"overlay\")")
+	f.BoolVar(&t.DisableDNS, "disable-dns", false, "disable the DNS add-on")
+	f.BoolVar(&t.DisableHeapster, "disable-heapster", false, "disable the Heapster add-on")
+	f.BoolVar(&t.DisableDashboard, "disable-dashboard", false, "disable the Dashboard add-on")
+	f.BoolVar(&t.DisablePackageManager, "disable-package-manager", false, "disable the package manager add-on")
+}
 
-	etcdNodes, err := util.PromptForInt(in, out, "Number of etcd nodes", 3)
+// reads the answers file into the template options. The flags that were set
+// by the user take precedence over the answers.
+func readPlanAnswers(file string, t *install.PlanTemplateOptions, templateFlags *pflag.FlagSet) error {
+	d, err := ioutil.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("Error reading number of etcd nodes: %v", err)
+		return fmt.Errorf("could not read answers file: %v", err)
 	}
-	if etcdNodes <= 0 {
-		return fmt.Errorf("The number of etcd nodes must be greater than zero")
+	changed := map[string]string{}
+	templateFlags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			changed[f.Name] = f.Value.String()
+		}
+	})
+	if err = yaml.Unmarshal(d, t); err != nil {
+		return fmt.Errorf("failed to unmarshal answers file: %v", err)
 	}
+	for name, val := range changed {
+		if err = templateFlags.Set(name, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	masterNodes, err := util.PromptForInt(in, out, "Number of master nodes", 2)
-	if err != nil {
-		return fmt.Errorf("Error reading number of master nodes: %v", err)
+// the nodes of the inventory replace the nodes of the roles that are
+// defined in the inventory
+func mergeNodeInventory(nodes *install.NodeInventory, inv *install.NodeInventory) {
+	if len(inv.Etcd) > 0 {
+		nodes.Etcd = inv.Etcd
 	}
-	if masterNodes <= 0 {
-		return fmt.Errorf("The number of master nodes must be greater than zero")
+	if len(inv.Master) > 0 {
+		nodes.Master = inv.Master
+	}
+	if len(inv.Worker) > 0 {
+		nodes.Worker = inv.Worker
+	}
+	if len(inv.Ingress) > 0 {
+		nodes.Ingress = inv.Ingress
+	}
+	if len(inv.Storage) > 0 {
+		nodes.Storage = inv.Storage
 	}
+}
 
-	workerNodes, err := util.PromptForInt(in, out, "Number of worker nodes", 3)
+func doRenderPlan(out io.Writer, planner install.Planner) error {
+	if !planner.PlanExists() {
+		return fmt.Errorf("plan does not exist")
+	}
+	plan, err := planner.Read()
 	if err != nil {
-		return fmt.Errorf("Error reading number of worker nodes: %v", err)
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	return install.WritePlan(out, plan)
+}
+
+func doPlan(in io.Reader, out io.Writer, planner install.Planner, planFile string, opts *planOpts) error {
+	t := opts.template
+	if opts.nonInteractive {
+		if t.EtcdNodes == 0 {
+			t.EtcdNodes = 3
+		}
+		if t.MasterNodes == 0 {
+			t.MasterNodes = 2
+		}
+		if t.WorkerNodes == 0 {
+			t.WorkerNodes = 3
+		}
+	} else {
+		if err := promptForPlan(in, out, &t); err != nil {
+			return err
+		}
 	}
+	etcdNodes := nodeCount(t.Nodes.Etcd, t.EtcdNodes)
+	if etcdNodes <= 0 {
+		return fmt.Errorf("The number of etcd nodes must be greater than zero")
+	}
+	masterNodes := nodeCount(t.Nodes.Master, t.MasterNodes)
+	if masterNodes <= 0 {
+		return fmt.Errorf("The number of master nodes must be greater than zero")
+	}
+	workerNodes := nodeCount(t.Nodes.Worker, t.WorkerNodes)
 	if workerNodes <= 0 {
 		return fmt.Errorf("The number of worker nodes must be greater than zero")
 	}
-
-	ingressNodes, err := util.PromptForInt(in, out, "Number of ingress nodes (optional, set to 0 if not required)", 2)
-	if err != nil {
-		return fmt.Errorf("Error reading number of ingress nodes: %v", err)
-	}
+	ingressNodes := nodeCount(t.Nodes.Ingress, t.IngressNodes)
 	if ingressNodes < 0 {
 		return fmt.Errorf("The number of ingress nodes must be greater than or equal to zero")
 	}
-
-	storageNodes, err := util.PromptForInt(in, out, "Number of storage nodes (optional, set to 0 if not required)", 0)
-	if err != nil {
-		return fmt.Errorf("Error reading number of storage nodes: %v", err)
-	}
+	storageNodes := nodeCount(t.Nodes.Storage, t.StorageNodes)
 	if storageNodes < 0 {
 		return fmt.Errorf("The number of storage nodes must be greater than or equal to zero")
 	}
-
-	nfsVolumes, err := util.PromptForInt(in, out, "Number of existing NFS volumes to be attached", 0)
-	if err != nil {
-		return fmt.Errorf("Error reading number of nfs volumes: %v", err)
-	}
-	if nfsVolumes < 0 {
+	if t.NFSVolumes < 0 {
 		return fmt.Errorf("The number of nfs volumes must be greater than or equal to zero")
 	}
 
@@ -84,21 +203,134 @@ func doPlan(in io.Reader, out io.Writer, planner install.Planner, planFile strin
 	fmt.Fprintf(out, "- %d worker nodes\n", workerNodes)
 	fmt.Fprintf(out, "- %d ingress nodes\n", ingressNodes)
 	fmt.Fprintf(out, "- %d storage nodes\n", storageNodes)
-	fmt.Fprintf(out, "- %d nfs volumes\n", nfsVolumes)
+	fmt.Fprintf(out, "- %d nfs volumes\n", t.NFSVolumes)
 	fmt.Fprintln(out)
 
-	planTemplate := install.PlanTemplateOptions{
-		EtcdNodes:    etcdNodes,
-		MasterNodes:  masterNodes,
-		WorkerNodes:  workerNodes,
-		IngressNodes: ingressNodes,
-		StorageNodes: storageNodes,
-		NFSVolumes:   nfsVolumes,
-	}
-	if err = install.WritePlanTemplate(planTemplate, planner); err != nil {
+	if err := install.WritePlanTemplate(t, planner); err != nil {
 		return fmt.Errorf("error planning installation: %v", err)
 	}
 	fmt.Fprintf(out, "Wrote plan file template to %q\n", planFile)
-	fmt.Fprintf(out, "Edit the plan file to further describe your cluster. Once ready, execute the \"install validate\" command to proceed.\n")
+
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if ok, errs := install.ValidatePlan(plan); !ok {
+		fmt.Fprintln(out, "The plan file is missing the following information:")
+		util.PrintValidationErrors(out, errs)
+		if opts.nonInteractive {
+			return fmt.Errorf("the generated plan file is not valid")
+		}
+		fmt.Fprintf(out, "Edit the plan file to further describe your cluster. Once ready, execute the \"install validate\" command to proceed.\n")
+		return nil
+	}
+	fmt.Fprintf(out, "The plan file is complete. Execute the \"install validate\" command to proceed.\n")
+	return nil
+}
+
+// prompts the user for the information that was not provided
+// through the answers file, the inventory or the flags
+func promptForPlan(in io.Reader, out io.Writer, t *install.PlanTemplateOptions) error {
+	fmt.Fprintln(out, "Plan your Kubernetes cluster:")
+
+	var err error
+	if len(t.Nodes.Etcd) == 0 {
+		t.EtcdNodes, err = util.PromptForInt(in, out, "Number of etcd nodes", intOrDefault(t.EtcdNodes, 3))
+		if err != nil {
+			return fmt.Errorf("Error reading number of etcd nodes: %v", err)
+		}
+		if t.EtcdNodes <= 0 {
+			return fmt.Errorf("The number of etcd nodes must be greater than zero")
+		}
+	}
+
+	if len(t.Nodes.Master) == 0 {
+		t.MasterNodes, err = util.PromptForInt(in, out, "Number of master nodes", intOrDefault(t.MasterNodes, 2))
+		if err != nil {
+			return fmt.Errorf("Error reading number of master nodes: %v", err)
+		}
+		if t.MasterNodes <= 0 {
+			return fmt.Errorf("The number of master nodes must be greater than zero")
+		}
+	}
+
+	if len(t.Nodes.Worker) == 0 {
+		t.WorkerNodes, err = util.PromptForInt(in, out, "Number of worker nodes", intOrDefault(t.WorkerNodes, 3))
+		if err != nil {
+			return fmt.Errorf("Error reading number of worker nodes: %v", err)
+		}
+		if t.WorkerNodes <= 0 {
+			return fmt.Errorf("The number of worker nodes must be greater than zero")
+		}
+	}
+
+	if len(t.Nodes.Ingress) == 0 {
+		t.IngressNodes, err = util.PromptForInt(in, out, "Number of ingress nodes (optional, set to 0 if not required)", intOrDefault(t.IngressNodes, 2))
+		if err != nil {
+			return fmt.Errorf("Error reading number of ingress nodes: %v", err)
+		}
+		if t.IngressNodes < 0 {
+			return fmt.Errorf("The number of ingress nodes must be greater than or equal to zero")
+		}
+	}
+
+	if len(t.Nodes.Storage) == 0 {
+		t.StorageNodes, err = util.PromptForInt(in, out, "Number of storage nodes (optional, set to 0 if not required)", t.StorageNodes)
+		if err != nil {
+			return fmt.Errorf("Error reading number of storage nodes: %v", err)
+		}
+		if t.StorageNodes < 0 {
+			return fmt.Errorf("The number of storage nodes must be greater than or equal to zero")
+		}
+	}
+
+	t.NFSVolumes, err = util.PromptForInt(in, out, "Number of existing NFS volumes to be attached", t.NFSVolumes)
+	if err != nil {
+		return fmt.Errorf("Error reading number of nfs volumes: %v", err)
+	}
+	if t.NFSVolumes < 0 {
+		return fmt.Errorf("The number of nfs volumes must be greater than or equal to zero")
+	}
+
+	if t.CNIProvider == "" {
+		t.CNIProvider, err = util.PromptForString(in, out, "CNI provider", "calico", []string{"calico", "weave", "contiv", "custom"})
+		if err != nil {
+			return fmt.Errorf("Error reading CNI provider: %v", err)
+		}
+	}
+
+	prompts := []struct {
+		prompt       string
+		value        *string
+		defaultValue string
+	}{
+		{"SSH user", &t.SSHUser, "kismaticuser"},
+		{"Absolute path to the SSH private key", &t.SSHKey, "kismaticuser.key"},
+		{"Pod network CIDR block", &t.PodCIDRBlock, "172.16.0.0/16"},
+		{"Service network CIDR block", &t.ServiceCIDRBlock, "172.20.0.0/16"},
+	}
+	for _, p := range prompts {
+		if *p.value != "" {
+			continue
+		}
+		*p.value, err = util.PromptForInput(in, out, p.prompt, p.defaultValue)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %v", p.prompt, err)
+		}
+	}
 	return nil
 }
+
+func nodeCount(nodes []install.Node, count int) int {
+	if len(nodes) > 0 {
+		return len(nodes)
+	}
+	return count
+}
+
+func intOrDefault(i, def int) int {
+	if i == 0 {
+		return def
+	}
+	return i
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdPlanMigrate creates a new install plan migrate command
+func NewCmdPlanMigrate(out io.Writer, options *installOpts) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "migrate the plan file to the latest plan version",
+		Long: `Migrate the plan file to the latest plan version.
+
+Plan files of previous versions are migrated in memory every time they are read.
+This command writes the migrated plan back to the plan file, and keeps a copy
+of the original file with a ".bak" extension. Variable references and secret
+references are kept as they are, and no defaults are added to the plan.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			if len(options.planFilenames) > 1 {
+				return fmt.Errorf("plan overlays cannot be migrated together, migrate each plan file separately")
+			}
+			return doPlanMigrate(out, options.planner())
+		},
+	}
+	return cmd
+}
+
+func doPlanMigrate(out io.Writer, planner *install.FilePlanner) error {
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: planner.File}
+	}
+	from, err := install.ReadPlanVersion(planner.File)
+	if err != nil {
+		return err
+	}
+	if from == install.CurrentPlanVersion {
+		fmt.Fprintf(out, "Plan file %q is already at the latest version (%d)\n", planner.File, from)
+		return nil
+	}
+	// migrate the plan before making a backup, to fail early on unsupported versions
+	migrated, err := install.MigratePlanFile(planner.File)
+	if err != nil {
+		return err
+	}
+	orig, err := ioutil.ReadFile(planner.File)
+	if err != nil {
+		return fmt.Errorf("could not read plan file: %v", err)
+	}
+	backup := planner.File + ".bak"
+	if err = ioutil.WriteFile(backup, orig, 0644); err != nil {
+		return fmt.Errorf("error writing backup of the plan file: %v", err)
+	}
+	if err = ioutil.WriteFile(planner.File, migrated, 0644); err != nil {
+		return fmt.Errorf("error writing plan file: %v", err)
+	}
+	fmt.Fprintf(out, "Migrated plan file %q from version %d to version %d. The original file was saved to %q\n", planner.File, from, install.CurrentPlanVersion, backup)
+	return nil
+}
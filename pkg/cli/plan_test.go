@@ -3,8 +3,13 @@ package cli
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
 )
 
 func TestPlanCmdPlanNotFound(t *testing.T) {
@@ -80,7 +85,7 @@ func TestPlanCmdPlanNotFound(t *testing.T) {
 			exists: true,
 		}
 
-		err := doPlan(test.in, out, fp, "")
+		err := doPlan(test.in, out, fp, "", &planOpts{})
 
 		if err != nil && !test.shouldError {
 			t.Errorf("unexpected error running command: %v", err)
@@ -101,3 +106,145 @@ func TestPlanCmdPlanNotFound(t *testing.T) {
 		}
 	}
 }
+
+func TestPlanCmdNonInteractive(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-plan-non-interactive")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	sshKey := filepath.Join(tmpDir, "ssh.key")
+	if err = ioutil.WriteFile(sshKey, []byte("key"), 0600); err != nil {
+		t.Fatalf("error writing ssh key: %v", err)
+	}
+
+	opts := &planOpts{nonInteractive: true}
+	opts.template.SSHKey = sshKey
+	opts.template.CNIProvider = "weave"
+	opts.template.Nodes.Etcd = []install.Node{{Host: "etcd01", IP: "10.0.0.1"}}
+	opts.template.Nodes.Master = []install.Node{{Host: "master01", IP: "10.0.0.2"}}
+	opts.template.Nodes.Worker = []install.Node{{Host: "worker01", IP: "10.0.0.3"}, {Host: "worker02", IP: "10.0.0.4"}}
+
+	out := &bytes.Buffer{}
+	fp := &fakePlanner{exists: true}
+	if err = doPlan(&bytes.Buffer{}, out, fp, "", opts); err != nil {
+		t.Fatalf("unexpected error running command: %v\n%s", err, out.String())
+	}
+	p := fp.plan
+	if p.Worker.ExpectedCount != 2 || len(p.Worker.Nodes) != 2 {
+		t.Errorf("expected 2 worker nodes, got %d", p.Worker.ExpectedCount)
+	}
+	if p.Master.LoadBalancedFQDN != "10.0.0.2" {
+		t.Errorf("expected load balanced FQDN to be the master's IP, but got %q", p.Master.LoadBalancedFQDN)
+	}
+	if p.AddOns.CNI.Provider != "weave" {
+		t.Errorf("expected CNI provider to be weave, but got %q", p.AddOns.CNI.Provider)
+	}
+
+	// missing information results in an error
+	opts = &planOpts{nonInteractive: true}
+	fp = &fakePlanner{exists: true}
+	if err = doPlan(&bytes.Buffer{}, out, fp, "", opts); err == nil {
+		t.Errorf("expected an error generating an incomplete plan, but got nil")
+	}
+
+	// with more than one master, the load balancer must be provided
+	opts = &planOpts{nonInteractive: true}
+	opts.template.SSHKey = sshKey
+	opts.template.Nodes.Etcd = []install.Node{{Host: "etcd01", IP: "10.0.0.1"}}
+	opts.template.Nodes.Master = []install.Node{{Host: "master01", IP: "10.0.0.2"}, {Host: "master02", IP: "10.0.0.5"}}
+	opts.template.Nodes.Worker = []install.Node{{Host: "worker01", IP: "10.0.0.3"}}
+	fp = &fakePlanner{exists: true}
+	out = &bytes.Buffer{}
+	if err = doPlan(&bytes.Buffer{}, out, fp, "", opts); err == nil {
+		t.Errorf("expected an error generating a plan with two masters and no load balancer, but got nil")
+	}
+	if fp.plan.Master.LoadBalancedFQDN != "" || fp.plan.Master.LoadBalancedShortName != "" {
+		t.Errorf("expected the load balancer to be left empty, but got %q and %q", fp.plan.Master.LoadBalancedFQDN, fp.plan.Master.LoadBalancedShortName)
+	}
+	opts.template.LoadBalancedFQDN = "lb.example.com"
+	opts.template.LoadBalancedShortName = "lb"
+	fp = &fakePlanner{exists: true}
+	if err = doPlan(&bytes.Buffer{}, out, fp, "", opts); err != nil {
+		t.Errorf("unexpected error generating a plan with a load balancer: %v\n%s", err, out.String())
+	}
+}
+
+func TestPlanMigrate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ket-test-plan-migrate")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "kismatic-cluster.yaml")
+	orig := "cluster:\n  allow_package_installation: false\n  networking:\n    type: routed\n"
+	if err = ioutil.WriteFile(file, []byte(orig), 0644); err != nil {
+		t.Fatalf("error writing plan file: %v", err)
+	}
+	planner := &install.FilePlanner{File: file}
+	out := &bytes.Buffer{}
+	if err = doPlanMigrate(out, planner); err != nil {
+		t.Fatalf("unexpected error migrating plan: %v", err)
+	}
+
+	backup, err := ioutil.ReadFile(file + ".bak")
+	if err != nil {
+		t.Fatalf("error reading backup: %v", err)
+	}
+	if string(backup) != orig {
+		t.Errorf("expected the backup to contain the original plan, but got:\n%s", backup)
+	}
+	version, err := install.ReadPlanVersion(file)
+	if err != nil {
+		t.Fatalf("error reading plan version: %v", err)
+	}
+	if version != install.CurrentPlanVersion {
+		t.Errorf("expected plan version %d, but got %d", install.CurrentPlanVersion, version)
+	}
+	p, err := planner.Read()
+	if err != nil {
+		t.Fatalf("error reading migrated plan: %v", err)
+	}
+	if !p.Cluster.DisablePackageInstallation || p.AddOns.CNI.Options.Calico.Mode != "routed" {
+		t.Errorf("deprecated fields were not migrated: %+v", p)
+	}
+
+	// migrating again is a no-op
+	out.Reset()
+	if err = doPlanMigrate(out, planner); err != nil {
+		t.Fatalf("unexpected error migrating plan: %v", err)
+	}
+	if !strings.Contains(out.String(), "already at the latest version") {
+		t.Errorf("expected plan to be at the latest version, got: %s", out.String())
+	}
+}
+
+func TestPlanMigrateKeepsReferences(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ket-test-plan-migrate-refs")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "kismatic-cluster.yaml")
+	orig := "cluster:\n  name: ${KET_TEST_UNDEFINED_CLUSTER_NAME}\n  admin_password: env:KET_TEST_UNDEFINED_PASSWORD\n  allow_package_installation: false\n"
+	if err = ioutil.WriteFile(file, []byte(orig), 0644); err != nil {
+		t.Fatalf("error writing plan file: %v", err)
+	}
+	planner := &install.FilePlanner{File: file}
+	if err = doPlanMigrate(&bytes.Buffer{}, planner); err != nil {
+		t.Fatalf("unexpected error migrating plan: %v", err)
+	}
+	migrated, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("error reading migrated plan: %v", err)
+	}
+	for _, s := range []string{"name: ${KET_TEST_UNDEFINED_CLUSTER_NAME}", "admin_password: env:KET_TEST_UNDEFINED_PASSWORD", "disable_package_installation: true"} {
+		if !strings.Contains(string(migrated), s) {
+			t.Errorf("expected the migrated plan to contain %q, but got:\n%s", s, migrated)
+		}
+	}
+	// defaults are not added to the plan
+	if strings.Contains(string(migrated), "heapster") {
+		t.Errorf("expected the migrated plan to not contain defaults, but got:\n%s", migrated)
+	}
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdRuns creates a new runs command
+func NewCmdRuns(out io.Writer) *cobra.Command {
+	var runsDir string
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "browse the history of the installation, upgrade and maintenance runs",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&runsDir, "runs-dir", "runs", "path to the directory where the runs are recorded")
+
+	cmd.AddCommand(NewCmdRunsList(out, &runsDir))
+	cmd.AddCommand(NewCmdRunsShow(out, &runsDir))
+	cmd.AddCommand(NewCmdRunsLogs(out, &runsDir))
+	cmd.AddCommand(NewCmdRunsPrune(out, &runsDir))
+
+	return cmd
+}
+
+// readRunArg returns the run with the given ID. The ID "latest" refers
+// to the most recent run.
+func readRunArg(runsDir string, id string) (*install.Run, error) {
+	if id != "latest" {
+		return install.ReadRun(runsDir, id)
+	}
+	runs, err := install.ListRuns(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no runs were found in %q", runsDir)
+	}
+	return &runs[0], nil
+}
+
+func formatRunDuration(d time.Duration) string {
+	return (d / time.Second * time.Second).String()
+}
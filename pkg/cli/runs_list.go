@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type runsListOpts struct {
+	outputFormat string
+}
+
+type runListItem struct {
+	ID              string    `json:"id"`
+	Task            string    `json:"task"`
+	Status          string    `json:"status"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	PlanHash        string    `json:"planHash"`
+	Directory       string    `json:"directory"`
+}
+
+// NewCmdRunsList creates a new runs list command
+func NewCmdRunsList(out io.Writer, runsDir *string) *cobra.Command {
+	opts := &runsListOpts{}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the recorded runs, newest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doRunsList(out, *runsDir, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"json")`)
+	return cmd
+}
+
+func doRunsList(out io.Writer, runsDir string, opts *runsListOpts) error {
+	if opts.outputFormat != "simple" && opts.outputFormat != "json" {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	runs, err := install.ListRuns(runsDir)
+	if err != nil {
+		return err
+	}
+	if opts.outputFormat == "json" {
+		items := []runListItem{}
+		for _, r := range runs {
+			items = append(items, runListItem{
+				ID:              r.ID,
+				Task:            r.Task,
+				Status:          string(r.Status),
+				Start:           r.Start,
+				DurationSeconds: r.Duration().Seconds(),
+				PlanHash:        r.PlanHash,
+				Directory:       r.Directory,
+			})
+		}
+		b, err := json.MarshalIndent(items, "", "    ")
+		if err != nil {
+			return fmt.Errorf("error marshaling runs: %v", err)
+		}
+		fmt.Fprintln(out, string(b))
+		return nil
+	}
+	if len(runs) == 0 {
+		fmt.Fprintf(out, "No runs were found in %q\n", runsDir)
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprint(w, "ID\tStatus\tStarted\tDuration\tPlan\n")
+	for _, r := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ID, r.Status, r.Start.Format("2006-01-02 15:04:05"), formatRunDuration(r.Duration()), r.PlanHash)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type runsLogsOpts struct {
+	host   string
+	tail   int
+	follow bool
+}
+
+// NewCmdRunsLogs creates a new runs logs command
+func NewCmdRunsLogs(out io.Writer, runsDir *string) *cobra.Command {
+	opts := &runsLogsOpts{}
+	cmd := &cobra.Command{
+		Use:   "logs RUN",
+		Short: "print the Ansible log of a run",
+		Long: `Print the Ansible log of a run, optionally filtered by host.
+
+RUN is the ID of the run, as shown by "kismatic runs list", or "latest" for the most recent run.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doRunsLogs(out, *runsDir, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.host, "host", "", "only print the lines that refer to this host")
+	cmd.Flags().IntVar(&opts.tail, "tail", 0, "only print the last N lines")
+	cmd.Flags().BoolVar(&opts.follow, "follow", false, "keep printing the lines that are added to the log")
+	return cmd
+}
+
+func doRunsLogs(out io.Writer, runsDir string, id string, opts *runsLogsOpts) error {
+	run, err := readRunArg(runsDir, id)
+	if err != nil {
+		return err
+	}
+	match := func(string) bool { return true }
+	if opts.host != "" {
+		re, err := runHostRegexp(run, opts.host)
+		if err != nil {
+			return err
+		}
+		match = re.MatchString
+	}
+	f, err := os.Open(filepath.Join(run.Directory, "ansible.log"))
+	if err != nil {
+		return fmt.Errorf("could not read the log of the run: %v", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var tail []string
+	var partial string
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			partial = line
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the log of the run: %v", err)
+		}
+		if !match(line) {
+			continue
+		}
+		if opts.tail <= 0 {
+			fmt.Fprint(out, line)
+			continue
+		}
+		tail = append(tail, line)
+		if len(tail) > opts.tail {
+			tail = tail[1:]
+		}
+	}
+	for _, line := range tail {
+		fmt.Fprint(out, line)
+	}
+	if !opts.follow {
+		if partial != "" && match(partial) {
+			fmt.Fprintln(out, partial)
+		}
+		return nil
+	}
+	// keep reading the lines as they are written to the log
+	for {
+		line, err := r.ReadString('\n')
+		partial += line
+		if err == io.EOF {
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the log of the run: %v", err)
+		}
+		if match(partial) {
+			fmt.Fprint(out, partial)
+		}
+		partial = ""
+	}
+}
+
+// runHostRegexp returns an expression that matches the log lines that refer
+// to the host, either by name or by the IP address in the run's inventory
+func runHostRegexp(run *install.Run, host string) (*regexp.Regexp, error) {
+	terms := []string{regexp.QuoteMeta(host)}
+	inv, err := install.ReadNodeInventory(filepath.Join(run.Directory, "inventory.ini"))
+	if err == nil {
+		for _, nodes := range [][]install.Node{inv.Etcd, inv.Master, inv.Worker, inv.Ingress, inv.Storage} {
+			for _, n := range nodes {
+				if n.Host == host && n.IP != "" && n.IP != host {
+					terms = append(terms, regexp.QuoteMeta(n.IP))
+					break
+				}
+			}
+		}
+	}
+	return regexp.Compile(`(^|[^\w.-])(` + strings.Join(terms, "|") + `)([^\w.-]|$)`)
+}
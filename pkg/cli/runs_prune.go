@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type runsPruneOpts struct {
+	olderThan time.Duration
+	keep      int
+}
+
+// NewCmdRunsPrune creates a new runs prune command
+func NewCmdRunsPrune(out io.Writer, runsDir *string) *cobra.Command {
+	opts := &runsPruneOpts{}
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "remove old runs from the runs directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doRunsPrune(out, *runsDir, opts, time.Now())
+		},
+	}
+	cmd.Flags().DurationVar(&opts.olderThan, "older-than", 0, "remove the runs that started longer ago than this duration, e.g. 720h")
+	cmd.Flags().IntVar(&opts.keep, "keep", 0, "keep only this number of the most recent runs")
+	return cmd
+}
+
+func doRunsPrune(out io.Writer, runsDir string, opts *runsPruneOpts, now time.Time) error {
+	if opts.olderThan <= 0 && opts.keep <= 0 {
+		return errors.New("at least one of --older-than or --keep must be set")
+	}
+	removed, err := install.PruneRuns(runsDir, opts.olderThan, opts.keep, now)
+	for _, r := range removed {
+		fmt.Fprintf(out, "Removed run %s\n", r.ID)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Removed %d run(s)\n", len(removed))
+	return nil
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdRunsShow creates a new runs show command
+func NewCmdRunsShow(out io.Writer, runsDir *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show RUN",
+		Short: "show the per-host task summary of a run",
+		Long: `Show the per-host task summary of a run, by replaying the events that were recorded during the run.
+
+RUN is the ID of the run, as shown by "kismatic runs list", or "latest" for the most recent run.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doRunsShow(out, *runsDir, args[0])
+		},
+	}
+	return cmd
+}
+
+func doRunsShow(out io.Writer, runsDir string, id string) error {
+	run, err := readRunArg(runsDir, id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Run:       %s\n", run.ID)
+	fmt.Fprintf(out, "Status:    %s\n", run.Status)
+	fmt.Fprintf(out, "Started:   %s\n", run.Start.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, "Duration:  %s\n", formatRunDuration(run.Duration()))
+	fmt.Fprintf(out, "Plan:      %s\n", run.PlanHash)
+	fmt.Fprintf(out, "Directory: %s\n", run.Directory)
+	if run.Status == install.RunUnknown {
+		fmt.Fprintln(out, "\nThe events of this run were not recorded, see the ansible.log file in the run directory.")
+		return nil
+	}
+
+	summaries, err := install.RunHostSummaries(run)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprint(w, "Host\tOK\tFailed\tIgnored\tSkipped\tUnreachable\n")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", s.Host, s.OK, s.Failed, s.Ignored, s.Skipped, s.Unreachable)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	var printedFailures bool
+	for _, s := range summaries {
+		for _, t := range s.FailedTasks {
+			if !printedFailures {
+				fmt.Fprintln(out)
+				printedFailures = true
+			}
+			fmt.Fprintf(out, "%s failed task: %s\n", s.Host, t)
+		}
+	}
+	if summary, err := ioutil.ReadFile(filepath.Join(run.Directory, "failure-summary.txt")); err == nil {
+		fmt.Fprintf(out, "\n%s", summary)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunsLogsHostFilter(t *testing.T) {
+	runsDir, err := ioutil.TempDir("", "test-runs-logs")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(runsDir)
+	dir := filepath.Join(runsDir, "apply", "2017-05-01-10-00-00")
+	if err = os.MkdirAll(dir, 0777); err != nil {
+		t.Fatalf("error creating run dir: %v", err)
+	}
+	inventory := `[worker]
+"worker1" ansible_host="10.0.0.1" internal_ipv4="10.0.0.1"
+"worker10" ansible_host="10.0.0.10" internal_ipv4="10.0.0.10"
+`
+	log := `2017-05-01 10:00:00.000+0000 - TASK [docker : install docker] ****
+2017-05-01 10:00:01.000+0000 - <10.0.0.1> ESTABLISH SSH CONNECTION FOR USER: root
+2017-05-01 10:00:01.000+0000 - <10.0.0.10> ESTABLISH SSH CONNECTION FOR USER: root
+2017-05-01 10:00:02.000+0000 - ok: [worker10]
+2017-05-01 10:00:02.000+0000 - fatal: [worker1]: FAILED! => {"changed": false}
+`
+	if err = ioutil.WriteFile(filepath.Join(dir, "inventory.ini"), []byte(inventory), 0644); err != nil {
+		t.Fatalf("error writing inventory: %v", err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "ansible.log"), []byte(log), 0644); err != nil {
+		t.Fatalf("error writing log: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err = doRunsLogs(out, runsDir, "latest", &runsLogsOpts{host: "worker1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `2017-05-01 10:00:01.000+0000 - <10.0.0.1> ESTABLISH SSH CONNECTION FOR USER: root
+2017-05-01 10:00:02.000+0000 - fatal: [worker1]: FAILED! => {"changed": false}
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err = doRunsLogs(out, runsDir, "apply/2017-05-01-10-00-00", &runsLogsOpts{tail: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "2017-05-01 10:00:02.000+0000 - fatal: [worker1]: FAILED! => {\"changed\": false}\n" {
+		t.Errorf("unexpected tail output: %q", out.String())
+	}
+}
@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdSecrets creates a new secrets command
+func NewCmdSecrets(in io.Reader, out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage the secrets referenced in the plan file, and the encryption of the cluster's Secrets",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(NewCmdSecretsEncrypt(in, out))
+	cmd.AddCommand(NewCmdSecretsRotateEncryptionKey(out))
+
+	return cmd
+}
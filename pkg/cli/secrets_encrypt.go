@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/spf13/cobra"
+)
+
+type secretsEncryptOpts struct {
+	keyFile string
+}
+
+// NewCmdSecretsEncrypt creates a new secrets encrypt command
+func NewCmdSecretsEncrypt(in io.Reader, out io.Writer) *cobra.Command {
+	opts := &secretsEncryptOpts{}
+	cmd := &cobra.Command{
+		Use:   "encrypt [SECRET]",
+		Short: "Encrypt a secret so that it can be referenced in the plan file. Reads the secret from stdin if not provided",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			var secret string
+			if len(args) == 1 {
+				secret = args[0]
+			} else {
+				s := bufio.NewScanner(in)
+				s.Scan()
+				if s.Err() != nil {
+					return fmt.Errorf("error reading secret: %v", s.Err())
+				}
+				secret = s.Text()
+			}
+			return doSecretsEncrypt(out, secret, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.keyFile, "key-file", install.DefaultSecretsKeyFile(), "path to the key used to encrypt secrets. A new key is generated if the file does not exist")
+	return cmd
+}
+
+func doSecretsEncrypt(out io.Writer, secret string, opts *secretsEncryptOpts) error {
+	if secret == "" {
+		return fmt.Errorf("the secret cannot be empty")
+	}
+	key, err := install.ReadOrCreateSecretsKey(opts.keyFile)
+	if err != nil {
+		return err
+	}
+	ref, err := install.EncryptSecret(key, secret)
+	if err != nil {
+		return fmt.Errorf("error encrypting secret: %v", err)
+	}
+	fmt.Fprintln(out, ref)
+	return nil
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type secretsRotateEncryptionKeyOpts struct {
+	planFile           string
+	generatedAssetsDir string
+	timeout            time.Duration
+	verbose            bool
+	outputFormat       string
+	forceUnlock        bool
+}
+
+// NewCmdSecretsRotateEncryptionKey returns the command for rotating the key that encrypts Secrets in etcd
+func NewCmdSecretsRotateEncryptionKey(out io.Writer) *cobra.Command {
+	opts := &secretsRotateEncryptionKeyOpts{}
+	cmd := &cobra.Command{
+		Use:   "rotate-encryption-key",
+		Short: "Rotate the key used by the API server to encrypt Secrets in etcd",
+		Long: `Rotate the key used by the API server to encrypt Secrets in etcd.
+
+The key is rotated in steps, so that every API server can read all Secrets during the rotation:
+  1. A new key is added to the encryption config, and the API servers are restarted
+  2. The new key is used to encrypt Secrets, and the API servers are restarted
+  3. All Secrets are rewritten, so that they are encrypted with the new key
+  4. The old key is removed from the encryption config, and the API servers are restarted
+
+The new key uses the encryption provider set in the plan file. If the rotation fails, it can
+be run again to resume it.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doSecretsRotateEncryptionKey(out, opts)
+		},
+	}
+	addPlanFileFlag(cmd.Flags(), &opts.planFile)
+	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "how long to wait for the API servers to restart with the new encryption config")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"raw")`)
+	addForceUnlockFlag(cmd.Flags(), &opts.forceUnlock)
+	return cmd
+}
+
+func doSecretsRotateEncryptionKey(out io.Writer, opts *secretsRotateEncryptionKeyOpts) (err error) {
+	planner := &install.FilePlanner{File: opts.planFile}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFile}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if !plan.Cluster.EncryptionAtRest.Enabled {
+		return fmt.Errorf("encryption at rest is not enabled in the plan file")
+	}
+	execOpts := install.ExecutorOptions{
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		OutputFormat:             opts.outputFormat,
+		Verbose:                  opts.verbose,
+		ForceUnlock:              opts.forceUnlock,
+	}
+	executor, err := install.NewExecutor(out, os.Stderr, execOpts)
+	if err != nil {
+		return err
+	}
+	// the lock is held until the rotation is done, so that no other run
+	// deploys the encryption config of an unfinished rotation
+	release, err := executor.LockCluster(*plan, "rotate-encryption-key")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if releaseErr := release(); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+	kubeClient, err := install.NewClusterClient(plan, opts.generatedAssetsDir)
+	if err != nil {
+		return err
+	}
+	sshClient, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
+	if err != nil {
+		return fmt.Errorf("error getting SSH client: %v", err)
+	}
+
+	// writes the keys, and restarts the API servers with the new encryption config
+	configure := func(keys []install.EncryptionKey) error {
+		if err := install.WriteEncryptionKeys(opts.generatedAssetsDir, keys); err != nil {
+			return err
+		}
+		if err := executor.RunPlay("_kube-apiserver.yaml", plan); err != nil {
+			return err
+		}
+		return install.WaitForEncryptionConfig(plan, opts.generatedAssetsDir, kubeClient, opts.timeout)
+	}
+
+	keys, err := install.ReadEncryptionKeys(opts.generatedAssetsDir)
+	if err != nil {
+		return err
+	}
+	util.PrintHeader(out, "Adding New Encryption Key", '=')
+	if keys, err = install.AddEncryptionKey(keys, plan.Cluster.EncryptionAtRest.Provider); err != nil {
+		return err
+	}
+	if err = configure(keys); err != nil {
+		return err
+	}
+	util.PrintHeader(out, "Encrypting Secrets With New Key", '=')
+	keys = install.PromoteEncryptionKey(keys)
+	if err = configure(keys); err != nil {
+		return err
+	}
+	util.PrintHeader(out, "Rewriting Secrets", '=')
+	if err = install.RewriteSecrets(sshClient); err != nil {
+		return err
+	}
+	util.PrettyPrintOk(out, "Rewrote all Secrets with key %q", keys[0].Name)
+	util.PrintHeader(out, "Retiring Old Encryption Keys", '=')
+	if err = configure(install.RetireEncryptionKeys(keys)); err != nil {
+		return err
+	}
+	util.PrintColor(out, util.Green, "\nThe encryption key was rotated successfully\n\n")
+	return nil
+}
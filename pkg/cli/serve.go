@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+type serveOpts struct {
+	listenAddress string
+	dataDir       string
+	tokenFile     string
+	tlsCertFile   string
+	tlsKeyFile    string
+	verbose       bool
+	allowedDirs   []string
+}
+
+// NewCmdServe creates a new serve command
+func NewCmdServe(out io.Writer) *cobra.Command {
+	opts := &serveOpts{}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "serve an HTTP API for managing the lifecycle of clusters",
+		Long: `Serve an HTTP API for managing the lifecycle of clusters.
+
+Plans are submitted to the server, which validates, installs, adds workers to and upgrades
+the clusters as asynchronous jobs. The plans, the generated assets and the history of the jobs
+are stored in the data directory.
+
+The plans can only reference files of the server, such as SSH keys, that are in the
+clusters/<cluster>/files directory of the data directory, or in a directory set with --allowed-dir.
+Secret references to the environment of the server, plan variables and encrypted secrets are
+not allowed.
+
+Every client that has the token has full access to all the clusters of the server.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doServe(out, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.listenAddress, "listen-address", "127.0.0.1:8080", "the address the server listens on")
+	cmd.Flags().StringVar(&opts.dataDir, "data-dir", "kismatic-server", "path to the directory where the plans and the history of the jobs are stored")
+	cmd.Flags().StringVar(&opts.tokenFile, "token-file", "", "path to a file that contains the bearer token required to use the API")
+	cmd.Flags().StringVar(&opts.tlsCertFile, "tls-cert-file", "", "path to the TLS certificate of the server")
+	cmd.Flags().StringVar(&opts.tlsKeyFile, "tls-key-file", "", "path to the TLS private key of the server")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "include the output of every ansible task in the output of the jobs")
+	cmd.Flags().StringSliceVar(&opts.allowedDirs, "allowed-dir", []string{}, "path to a directory that the plans of all clusters can reference files in, e.g. a directory of shared SSH keys. Can be repeated")
+	return cmd
+}
+
+func doServe(out io.Writer, opts *serveOpts) error {
+	if (opts.tlsCertFile == "") != (opts.tlsKeyFile == "") {
+		return errors.New("both --tls-cert-file and --tls-key-file are required to serve over TLS")
+	}
+	var token string
+	if opts.tokenFile != "" {
+		b, err := ioutil.ReadFile(opts.tokenFile)
+		if err != nil {
+			return fmt.Errorf("error reading token file: %v", err)
+		}
+		token = strings.TrimSpace(string(b))
+		if token == "" {
+			return fmt.Errorf("the token file %q is empty", opts.tokenFile)
+		}
+	}
+	s, err := server.New(server.Options{
+		Directory:          opts.dataDir,
+		Token:              token,
+		Verbose:            opts.verbose,
+		AllowedDirectories: opts.allowedDirs,
+		Log:                out,
+	})
+	if err != nil {
+		return fmt.Errorf("error starting server: %v", err)
+	}
+	if token == "" {
+		fmt.Fprintln(out, "Warning: authentication is disabled, use --token-file to require a token")
+	}
+	fmt.Fprintf(out, "Serving the cluster API on %s\n", opts.listenAddress)
+	if opts.tlsCertFile != "" {
+		return http.ListenAndServeTLS(opts.listenAddress, opts.tlsCertFile, opts.tlsKeyFile, s.Handler())
+	}
+	return http.ListenAndServe(opts.listenAddress, s.Handler())
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// certificates that expire within this duration are reported
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+type statusOpts struct {
+	planFilename       string
+	outputFormat       string
+	generatedAssetsDir string
+}
+
+// NewCmdStatus returns the status command
+func NewCmdStatus(out io.Writer) *cobra.Command {
+	opts := &statusOpts{}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Display the health of the nodes and components of the cluster",
+		Long: `Display the health of the nodes and components of the cluster.
+
+For every node, the state of the docker, kubelet and kube-proxy services, the Ready condition
+of the Kubernetes node and the phase of the pod network pods are reported. On etcd nodes, the
+health of the etcd member and whether it is the leader are reported. On master nodes, the health
+endpoints of the API server, the controller manager and the scheduler are checked. The earliest
+expiring certificate of every node is reported as well.
+
+The status is gathered from all nodes in parallel, by connecting to each node via ssh.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doStatus(out, opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.planFilename, "plan-file", "f", "kismatic-cluster.yaml", "path to the installation plan file")
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"json")`)
+	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
+	return cmd
+}
+
+func doStatus(out io.Writer, opts *statusOpts) error {
+	if opts.outputFormat != "simple" && opts.outputFormat != "json" {
+		return fmt.Errorf("output format %q is not supported", opts.outputFormat)
+	}
+	planner := &install.FilePlanner{File: opts.planFilename}
+	if !planner.PlanExists() {
+		return planFileNotFoundErr{filename: opts.planFilename}
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file: %v", err)
+	}
+	if ok, errs := install.ValidateNodes(plan.GetUniqueNodes()); !ok {
+		util.PrintValidationErrors(out, errs)
+		return fmt.Errorf("error validating nodes")
+	}
+
+	// the status of the nodes is still reported when the cluster cannot be queried
+	kubeClient, kubeErr := install.NewClusterClient(plan, opts.generatedAssetsDir)
+	status := install.GetClusterStatus(plan, kubeClient)
+
+	if opts.outputFormat == "json" {
+		b, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling struct: %v", err)
+		}
+		fmt.Fprintln(out, string(b))
+	} else {
+		if kubeErr != nil {
+			util.PrettyPrintWarn(out, "Could not query the Kubernetes API: %v", kubeErr)
+		}
+		printClusterStatus(out, status, time.Now())
+	}
+	for _, n := range status.Nodes {
+		if !n.Healthy() {
+			return errors.New("unhealthy nodes were found in the cluster")
+		}
+	}
+	return nil
+}
+
+type statusCell struct {
+	text  string
+	color *color.Color
+}
+
+func okCell(text string, ok bool) statusCell {
+	if ok {
+		return statusCell{text: text, color: util.Green}
+	}
+	return statusCell{text: text, color: util.Red}
+}
+
+var noCell = statusCell{text: "-"}
+
+func componentCell(components []install.ComponentStatus, name string) statusCell {
+	for _, c := range components {
+		if c.Name == name {
+			return okCell(c.Status, c.Healthy)
+		}
+	}
+	return noCell
+}
+
+func printClusterStatus(out io.Writer, status install.ClusterStatus, now time.Time) {
+	headers := []string{"Name", "Roles", "Ready", "Docker", "Kubelet", "Kube-Proxy", "Etcd", "API Server", "Controller Mgr", "Scheduler", "Network", "Cert Expiry"}
+	rows := [][]statusCell{}
+	for _, n := range status.Nodes {
+		row := []statusCell{
+			okCell(n.Node.Host, n.Healthy()),
+			{text: strings.Join(n.Roles, ",")},
+			noCell,
+			componentCell(n.Services, "docker"),
+			componentCell(n.Services, "kubelet"),
+			componentCell(n.Services, "kube-proxy"),
+			noCell,
+			componentCell(n.Components, "kube-apiserver"),
+			componentCell(n.Components, "kube-controller-manager"),
+			componentCell(n.Components, "kube-scheduler"),
+			noCell,
+			noCell,
+		}
+		if n.Ready != "" {
+			row[2] = okCell(n.Ready, n.Ready == "True")
+		}
+		if n.Etcd != nil {
+			switch {
+			case !n.Etcd.Healthy:
+				row[6] = okCell("unhealthy", false)
+			case n.Etcd.Leader:
+				row[6] = okCell("leader", true)
+			default:
+				row[6] = okCell("healthy", true)
+			}
+		}
+		if len(n.NetworkPods) > 0 {
+			phases := []string{}
+			running := true
+			for _, p := range n.NetworkPods {
+				phases = append(phases, p.Phase)
+				running = running && p.Phase == "Running"
+			}
+			row[10] = okCell(strings.Join(phases, ","), running)
+		}
+		if c := n.EarliestCertificateExpiry(); c != nil {
+			row[11] = okCell(c.NotAfter.Format("2006-01-02"), c.NotAfter.Sub(now) > certificateExpiryWarning)
+		}
+		rows = append(rows, row)
+	}
+
+	// the widths are computed on the text, as the color codes are not printed
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = len(h)
+	}
+	for _, row := range rows {
+		for i, c := range row {
+			if len(c.text) > widths[i] {
+				widths[i] = len(c.text)
+			}
+		}
+	}
+	for i, h := range headers {
+		fmt.Fprint(out, h+strings.Repeat(" ", widths[i]-len(h)+3))
+	}
+	fmt.Fprintln(out)
+	for _, row := range rows {
+		for i, c := range row {
+			text := c.text
+			if c.color != nil {
+				text = c.color.SprintFunc()(c.text)
+			}
+			fmt.Fprint(out, text+strings.Repeat(" ", widths[i]-len(c.text)+3))
+		}
+		fmt.Fprintln(out)
+	}
+
+	// details of the problems found on the nodes
+	problems := false
+	for _, n := range status.Nodes {
+		details := append([]string{}, n.Errors...)
+		for _, c := range append(append([]install.ComponentStatus{}, n.Services...), n.Components...) {
+			if !c.Healthy {
+				details = append(details, fmt.Sprintf("%s is %s", c.Name, c.Status))
+			}
+		}
+		for _, p := range n.NetworkPods {
+			if p.Phase != "Running" {
+				details = append(details, fmt.Sprintf("pod %s/%s is %s", p.Namespace, p.Name, p.Phase))
+			}
+		}
+		for _, c := range n.Certificates {
+			if c.NotAfter.Sub(now) <= certificateExpiryWarning {
+				details = append(details, fmt.Sprintf("certificate %s expires on %s", c.File, c.NotAfter.Format("2006-01-02")))
+			}
+		}
+		if len(details) == 0 {
+			continue
+		}
+		if !problems {
+			fmt.Fprintln(out)
+			problems = true
+		}
+		util.PrintColor(out, util.Red, "%s:\n", n.Node.Host)
+		for _, d := range details {
+			fmt.Fprintf(out, "- %s\n", d)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+func TestPrintClusterStatus(t *testing.T) {
+	now := time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)
+	status := install.ClusterStatus{
+		Nodes: []install.NodeStatus{
+			{
+				Node:     install.Node{Host: "master1"},
+				Roles:    []string{"etcd", "master"},
+				Ready:    "True",
+				Services: []install.ComponentStatus{{Name: "docker", Healthy: true, Status: "active"}, {Name: "kubelet", Healthy: true, Status: "active"}},
+				Components: []install.ComponentStatus{
+					{Name: "kube-apiserver", Healthy: true, Status: "healthy"},
+					{Name: "kube-scheduler", Healthy: false, Status: "not responding"},
+				},
+				Etcd:         &install.EtcdMemberStatus{Healthy: true, Leader: true},
+				Certificates: []install.CertificateStatus{{File: "/etc/kubernetes/pki/ca.pem", NotAfter: now.Add(24 * time.Hour)}},
+			},
+			{
+				Node:        install.Node{Host: "worker1"},
+				Roles:       []string{"worker"},
+				Ready:       "True",
+				NetworkPods: []install.NetworkPodStatus{{Namespace: "kube-system", Name: "calico-node-abcde", Phase: "Running"}},
+			},
+		},
+	}
+	out := &bytes.Buffer{}
+	printClusterStatus(out, status, now)
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[0], "Name      Roles         Ready") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "master1   etcd,master   True") || !strings.Contains(lines[1], "leader") || !strings.Contains(lines[1], "2017-10-02") {
+		t.Errorf("unexpected master row %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "Running") {
+		t.Errorf("unexpected worker row %q", lines[2])
+	}
+	for _, expected := range []string{"master1:", "- kube-scheduler is not responding", "- certificate /etc/kubernetes/pki/ca.pem expires on 2017-10-02"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected the output to contain %q, but got:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "worker1:") {
+		t.Errorf("expected no problems reported for worker1, but got:\n%s", out.String())
+	}
+}
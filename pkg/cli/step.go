@@ -22,13 +22,13 @@ type stepCmd struct {
 	restartServices    bool
 	verbose            bool
 	outputFormat       string
+	forceUnlock        bool
 }
 
 // NewCmdStep returns the step command
 func NewCmdStep(out io.Writer, opts *installOpts) *cobra.Command {
 	stepCmd := &stepCmd{
-		out:      out,
-		planFile: opts.planFilename,
+		out: out,
 	}
 	cmd := &cobra.Command{
 		Use:   "step PLAY_NAME",
@@ -37,19 +37,26 @@ func NewCmdStep(out io.Writer, opts *installOpts) *cobra.Command {
 			if len(args) != 1 {
 				return cmd.Usage()
 			}
+			config, err := kismaticConfig()
+			if err != nil {
+				return err
+			}
 			execOpts := install.ExecutorOptions{
 				GeneratedAssetsDirectory: stepCmd.generatedAssetsDir,
 				RestartServices:          stepCmd.restartServices,
 				OutputFormat:             stepCmd.outputFormat,
 				Verbose:                  stepCmd.verbose,
+				Webhooks:                 config.Notifications.Webhooks,
+				FailureSignatures:        config.FailureSignatures,
+				ForceUnlock:              stepCmd.forceUnlock,
 			}
 			executor, err := install.NewExecutor(out, os.Stderr, execOpts)
 			if err != nil {
 				return err
 			}
 			stepCmd.task = args[0]
-			stepCmd.planFile = opts.planFilename
-			stepCmd.planner = &install.FilePlanner{File: stepCmd.planFile}
+			stepCmd.planFile = opts.planFilename()
+			stepCmd.planner = opts.planner()
 			stepCmd.executor = executor
 			return stepCmd.run()
 		},
@@ -57,7 +64,8 @@ func NewCmdStep(out io.Writer, opts *installOpts) *cobra.Command {
 	cmd.Flags().StringVar(&stepCmd.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&stepCmd.restartServices, "restart-services", false, "force restart cluster services (Use with care)")
 	cmd.Flags().BoolVar(&stepCmd.verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.Flags().StringVarP(&stepCmd.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.Flags().StringVarP(&stepCmd.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\"|\"json\")")
+	addForceUnlockFlag(cmd.Flags(), &stepCmd.forceUnlock)
 	return cmd
 }
 
@@ -76,10 +84,11 @@ func (c stepCmd) run() error {
 	if err != nil {
 		return fmt.Errorf("error reading plan file: %v", err)
 	}
-	util.PrintHeader(c.out, "Running Task", '=')
+	out := messagesWriter(c.out, c.outputFormat)
+	util.PrintHeader(out, "Running Task", '=')
 	if err := c.executor.RunPlay(c.task, plan); err != nil {
 		return err
 	}
-	util.PrintColor(c.out, util.Green, "\nTask completed successfully\n\n")
+	util.PrintColor(out, util.Green, "\nTask completed successfully\n\n")
 	return nil
 }
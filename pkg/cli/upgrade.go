@@ -4,11 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"strings"
+	"time"
 
-	"github.com/apprenda/kismatic/pkg/data"
 	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -24,7 +24,14 @@ type upgradeOpts struct {
 	restartServices    bool
 	partialAllowed     bool
 	maxParallelWorkers int
+	forceUnlock        bool
 	dryRun             bool
+	dryRunDir          string
+	fromPlan           string
+	waves              string
+	healthProbes       []string
+	gateTimeout        time.Duration
+	onGateFailure      string
 }
 
 // NewCmdUpgrade returns the upgrade command
@@ -52,16 +59,19 @@ Nodes in the cluster are upgraded in the following order:
 
 	cmd.PersistentFlags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.PersistentFlags().BoolVar(&opts.verbose, "verbose", false, "enable verbose logging from the installation")
-	cmd.PersistentFlags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\")")
+	cmd.PersistentFlags().StringVarP(&opts.outputFormat, "output", "o", "simple", "installation output format (options \"simple\"|\"raw\"|\"json\")")
 	cmd.PersistentFlags().BoolVar(&opts.skipPreflight, "skip-preflight", false, "skip upgrade pre-flight checks")
 	cmd.PersistentFlags().BoolVar(&opts.restartServices, "restart-services", false, "force restart cluster services (Use with care)")
 	cmd.PersistentFlags().BoolVar(&opts.partialAllowed, "partial-ok", false, "allow the upgrade of ready nodes, and skip nodes that have been deemed unready for upgrade")
-	cmd.PersistentFlags().BoolVar(&opts.dryRun, "dry-run", false, "simulate the upgrade, but don't actually upgrade the cluster")
+	addForceUnlockFlag(cmd.PersistentFlags(), &opts.forceUnlock)
+	addDryRunFlags(cmd.PersistentFlags(), &opts.dryRun, &opts.dryRunDir)
 	addPlanFileFlag(cmd.PersistentFlags(), &opts.planFile)
 
 	// Subcommands
 	cmd.AddCommand(NewCmdUpgradeOffline(in, out, &opts))
 	cmd.AddCommand(NewCmdUpgradeOnline(in, out, &opts))
+	cmd.AddCommand(NewCmdUpgradePlan(out, &opts))
+	cmd.AddCommand(NewCmdUpgradeRollback(out, &opts))
 	return cmd
 }
 
@@ -101,6 +111,17 @@ be printed, and the upgrade will not proceed.
 
 If the node under upgrade is a Kubernetes node, it is cordoned and drained of workloads
 before any changes are applied.
+
+An upgrade plan computed with "kismatic upgrade plan" can be executed verbatim using the
+--from-plan flag. The safety checks are not run again, and the nodes are upgraded in the
+batches of the upgrade plan.
+
+The worker nodes can be upgraded in waves using the --waves flag, e.g. "--waves 1,25%,50%"
+upgrades a canary node first, then waves of 25% and 50% of the remaining workers. The last wave
+size is repeated until all workers are upgraded. After every wave, the health gates are checked:
+the upgraded nodes must be Ready, all pods on them must be running, the smoke test must pass and
+the --health-probe URLs must return a 2xx status code. When a gate fails, the upgrade is paused
+or aborted, depending on --on-gate-failure.
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.online = true
@@ -108,6 +129,11 @@ before any changes are applied.
 		},
 	}
 	cmd.PersistentFlags().BoolVar(&opts.ignoreSafetyChecks, "ignore-safety-checks", false, "ignore upgrade safety checks and continue with the upgrade")
+	cmd.Flags().StringVar(&opts.fromPlan, "from-plan", "", "path to an upgrade plan computed with \"kismatic upgrade plan\" to execute")
+	cmd.Flags().StringVar(&opts.waves, "waves", "", "comma-separated sizes of the waves in which worker nodes are upgraded, as counts or percentages, e.g. \"1,25%,50%\"")
+	cmd.Flags().StringArrayVar(&opts.healthProbes, "health-probe", []string{}, "URL that must return a 2xx status code after every wave. Can be repeated")
+	cmd.Flags().DurationVar(&opts.gateTimeout, "gate-timeout", 5*time.Minute, "how long to wait for the health gates to pass after every wave")
+	cmd.Flags().StringVar(&opts.onGateFailure, "on-gate-failure", "pause", "what to do when a health gate fails (options \"pause\"|\"abort\")")
 	return &cmd
 }
 
@@ -115,26 +141,42 @@ func doUpgrade(in io.Reader, out io.Writer, opts *upgradeOpts) error {
 	if opts.maxParallelWorkers < 1 {
 		return fmt.Errorf("max-parallel-workers must be greater or equal to 1, got: %d", opts.maxParallelWorkers)
 	}
-
-	planFile := opts.planFile
-	planner := install.FilePlanner{File: planFile}
-	executorOpts := install.ExecutorOptions{
-		GeneratedAssetsDirectory: opts.generatedAssetsDir,
-		RestartServices:          opts.restartServices,
-		OutputFormat:             opts.outputFormat,
-		Verbose:                  opts.verbose,
-		DryRun:                   opts.dryRun,
+	var waves []install.WaveSize
+	if opts.waves != "" {
+		if opts.fromPlan != "" {
+			return errors.New("--waves cannot be used with --from-plan")
+		}
+		var err error
+		if waves, err = install.ParseWaves(opts.waves); err != nil {
+			return err
+		}
+		if opts.onGateFailure != "pause" && opts.onGateFailure != "abort" {
+			return fmt.Errorf("on-gate-failure must be \"pause\" or \"abort\", got: %q", opts.onGateFailure)
+		}
 	}
-	executor, err := install.NewExecutor(out, os.Stderr, executorOpts)
+
+	options, err := clientOptions(out, opts.outputFormat)
 	if err != nil {
 		return err
 	}
-	preflightExecOpts := executorOpts
-	preflightExecOpts.DryRun = false // We always want to run preflight, even if doing a dry-run
-	preflightExec, err := install.NewPreFlightExecutor(out, os.Stderr, preflightExecOpts)
-	if err != nil {
-		return err
+	out = options.Log
+	planFile := opts.planFile
+	planner := install.FilePlanner{File: planFile}
+	generatedAssetsDir := opts.generatedAssetsDir
+	var dryRunDir string
+	if opts.dryRun {
+		if dryRunDir, err = prepareDryRun(out, opts.dryRunDir, opts.generatedAssetsDir); err != nil {
+			return err
+		}
+		generatedAssetsDir = dryRunDir
+		defer removeDryRunSecrets(out, dryRunDir)
 	}
+	options.GeneratedAssetsDirectory = generatedAssetsDir
+	options.RestartServices = opts.restartServices
+	options.Verbose = opts.verbose
+	options.ForceUnlock = opts.forceUnlock
+	options.DryRun = opts.dryRun
+	options.DryRunDirectory = dryRunDir
 	util.PrintHeader(out, "Computing upgrade plan", '=')
 
 	// Read plan file
@@ -149,68 +191,57 @@ func doUpgrade(in io.Reader, out io.Writer, opts *upgradeOpts) error {
 		return fmt.Errorf("error reading plan file %q: %v", planFile, err)
 	}
 
-	// Validate the plan file before we do anything
-	if err = validatePlan(out, plan); err != nil {
-		return err
-	}
-
-	if err = validateSSHConnectivity(out, plan); err != nil {
-		return err
-	}
-
-	// Generate new certs, or use existing ones. Always ensure that the CA exists.
-	if err = executor.GenerateCertificates(plan, true); err != nil {
-		return err
-	}
-
-	util.PrintHeader(out, "Generating Kubeconfig File", '=')
-	isDiff, err := install.RegenerateKubeconfig(plan, opts.generatedAssetsDir)
-	if err != nil {
-		return fmt.Errorf("error generating kubeconfig file: %v", err)
-	}
-
-	if isDiff {
-		util.PrettyPrintWarn(out, "An updated kubeconfig file has been generated in %q", opts.generatedAssetsDir)
-	} else {
-		util.PrettyPrintOk(out, "Found existing kubeconfig file in %q", opts.generatedAssetsDir)
-	}
-
-	// Get the cluster and node versions
-	cv, err := install.ListVersions(plan)
-	if err != nil {
-		return fmt.Errorf("error listing cluster versions: %v", err)
+	upgradeOpts := kismatic.UpgradeOptions{
+		Online:             opts.online,
+		IgnoreSafetyChecks: opts.ignoreSafetyChecks,
+		SkipPreFlight:      opts.skipPreflight,
+		PartialAllowed:     opts.partialAllowed,
+		MaxParallelWorkers: opts.maxParallelWorkers,
+		Waves:              waves,
+		HealthProbes:       opts.healthProbes,
+		GateTimeout:        opts.gateTimeout,
+		ConfirmUnsafe: func(unsafe []kismatic.NodeErrors) (bool, error) {
+			fmt.Fprintln(out)
+			ans, err := util.PromptForString(in, out, "Unsafe conditions detected, continue with the upgrade anyway?", "N", []string{"N", "y"})
+			if err != nil {
+				return false, fmt.Errorf("error getting user response: %v", err)
+			}
+			return strings.ToLower(ans) == "y", nil
+		},
+		OnGateFailure: func(wave int, gate install.HealthGate, gateErr error) (install.GateFailureAction, error) {
+			if opts.onGateFailure == "abort" {
+				return install.GateAbort, nil
+			}
+			fmt.Fprintln(out)
+			ans, err := util.PromptForString(in, out, "The upgrade is paused. Retry the health gate, continue with the next wave, or abort the upgrade?", "abort", []string{"abort", "retry", "continue"})
+			if err != nil {
+				return install.GateAbort, fmt.Errorf("error getting user response: %v", err)
+			}
+			return install.GateFailureAction(strings.ToLower(ans)), nil
+		},
 	}
-
-	// Figure out which nodes to upgrade
-	var toUpgrade []install.ListableNode
-	var toSkip []install.ListableNode
-	for _, n := range cv.Nodes {
-		if install.IsOlderVersion(n.Version) {
-			toUpgrade = append(toUpgrade, n)
-		} else {
-			toSkip = append(toSkip, n)
+	if opts.fromPlan != "" {
+		util.PrintHeader(out, "Reading upgrade plan", '=')
+		up, err := install.ReadUpgradePlan(opts.fromPlan)
+		if err != nil {
+			util.PrettyPrintErr(out, "Reading upgrade plan %q", opts.fromPlan)
+			return err
 		}
+		util.PrettyPrintOk(out, "Reading upgrade plan %q", opts.fromPlan)
+		printUpgradePlan(out, *up)
+		upgradeOpts.FromPlan = up
 	}
 
-	// Print the nodes that will be skipped
-	if len(toSkip) > 0 {
-		util.PrintHeader(out, "Skipping nodes", '=')
-		for _, n := range toSkip {
-			util.PrettyPrintOk(out, "- %q is at the target version %q", n.Node.Host, n.Version)
-		}
-		fmt.Fprintln(out)
+	result, err := kismatic.New(options).Upgrade(plan, upgradeOpts)
+	if err != nil {
+		return err
 	}
 
-	// Print message if there's no work to do
-	if len(toUpgrade) == 0 {
-		fmt.Fprintln(out, "All nodes are at the target version. Skipping node upgrades.")
-	} else {
-		if err = upgradeNodes(in, out, *plan, *opts, toUpgrade, executor, preflightExec); err != nil {
-			return err
-		}
+	if opts.dryRun {
+		printDryRunComplete(out, dryRunDir)
+		return nil
 	}
-
-	if opts.partialAllowed {
+	if !result.ClusterServicesUpgraded {
 		util.PrintColor(out, util.Green, `
 
 Partial upgrade complete.
@@ -222,151 +253,8 @@ without the "--partial-ok" flag to perform a full upgrade.
 `)
 		return nil
 	}
-
-	// Upgrade the cluster services
-	util.PrintHeader(out, "Upgrade: Cluster Services", '=')
-	if err := executor.UpgradeClusterServices(*plan); err != nil {
-		return fmt.Errorf("Failed to upgrade cluster services: %v", err)
-	}
-
-	if plan.NetworkConfigured() {
-		if err := executor.RunSmokeTest(plan); err != nil {
-			return fmt.Errorf("Smoke test failed: %v", err)
-		}
-	}
-
-	if !opts.dryRun {
-		fmt.Fprintln(out)
-		util.PrintColor(out, util.Green, "The cluster was upgraded successfully!\n")
-		fmt.Fprintln(out)
-	}
-	return nil
-}
-
-func upgradeNodes(in io.Reader, out io.Writer, plan install.Plan, opts upgradeOpts, nodesNeedUpgrade []install.ListableNode, executor install.Executor, preflightExec install.PreFlightExecutor) error {
-	// Run safety checks if doing an online upgrade
-	unsafeNodes := []install.ListableNode{}
-	if opts.online {
-		util.PrintHeader(out, "Validate Online Upgrade", '=')
-		// Use the first master node for running kubectl
-		client, err := plan.GetSSHClient(plan.Master.Nodes[0].Host)
-		if err != nil {
-			return fmt.Errorf("error getting SSH client: %v", err)
-		}
-		kubeClient := data.RemoteKubectl{SSHClient: client}
-		for _, node := range nodesNeedUpgrade {
-			util.PrettyPrint(out, "%s %v", node.Node.Host, node.Roles)
-			errs := install.DetectNodeUpgradeSafety(plan, node.Node, kubeClient)
-			if len(errs) != 0 {
-				if opts.ignoreSafetyChecks {
-					util.PrintWarn(out)
-				} else {
-					util.PrintError(out)
-				}
-				fmt.Fprintln(out)
-				for _, err := range errs {
-					fmt.Println("-", err.Error())
-				}
-				unsafeNodes = append(unsafeNodes, node)
-			} else {
-				util.PrintOkln(out)
-			}
-		}
-
-		// if --ignore-safety-checks still want to run and print the checks, just ignore them
-		if opts.ignoreSafetyChecks {
-			if len(unsafeNodes) > 0 {
-				util.PrettyPrintWarn(out, "\nIgnoring safety checks and continuing with the upgrade")
-			}
-		} else {
-			var safetyErr error
-			// If we found any unsafe nodes, and we are not doing a partial upgrade, or using --ignore-safety-checks exit.
-			if len(unsafeNodes) > 0 && !opts.partialAllowed {
-				safetyErr = errors.New("Unable to perform an online upgrade due to the unsafe conditions detected.")
-			}
-			// Block the upgrade if partial is allowed but there is an etcd or master node
-			// that cannot be upgraded
-			if opts.partialAllowed {
-				for _, n := range unsafeNodes {
-					for _, r := range n.Roles {
-						if r == "master" || r == "etcd" {
-							safetyErr = errors.New("Unable to perform an online upgrade due to the unsafe conditions detected.")
-							break
-						}
-					}
-				}
-			}
-			// did any safety checks fail
-			if safetyErr != nil {
-				fmt.Fprintln(out)
-				ans, err := util.PromptForString(in, out, "Unsafe conditions detected, continue with the upgrade anyway?", "N", []string{"N", "y"})
-				if err != nil {
-					return fmt.Errorf("error getting user response: %v", err)
-				}
-				// if not "y" fail safety checks, otherwise continue with upgrade
-				if strings.ToLower(ans) != "y" {
-					return safetyErr
-				}
-				opts.ignoreSafetyChecks = true
-				util.PrettyPrintWarn(out, "\nIgnoring safety checks and continuing with the upgrade")
-			}
-		}
-	}
-
-	// Run upgrade preflight on the nodes that are to be upgraded
-	unreadyNodes := []install.ListableNode{}
-	if !opts.skipPreflight {
-		for _, node := range nodesNeedUpgrade {
-			util.PrintHeader(out, fmt.Sprintf("Preflight Checks: %s %s", node.Node.Host, node.Roles), '=')
-			if err := preflightExec.RunUpgradePreFlightCheck(&plan, node); err != nil {
-				// return fmt.Errorf("Upgrade preflight check failed: %v", err)
-				unreadyNodes = append(unreadyNodes, node)
-			}
-		}
-	}
-
-	// Block upgrade if we found unready nodes, and we are not doing a partial upgrade
-	if len(unreadyNodes) > 0 && !opts.partialAllowed {
-		return errors.New("Errors found during preflight checks")
-	}
-
-	// Block the upgrade if partial is allowed but there is an etcd or master node
-	// that cannot be upgraded
-	if opts.partialAllowed {
-		for _, n := range unreadyNodes {
-			for _, r := range n.Roles {
-				if r == "master" || r == "etcd" {
-					return errors.New("Errors found during preflight checks")
-				}
-			}
-		}
-	}
-
-	// Filter out the nodes that are unsafe/unready
-	toUpgrade := []install.ListableNode{}
-	for _, n := range nodesNeedUpgrade {
-		upgrade := true
-		// upgrade unsafe nodes when --ignoreSafetyChecks
-		if !opts.ignoreSafetyChecks {
-			for _, unsafe := range unsafeNodes {
-				if unsafe.Node.Equal(n.Node) {
-					upgrade = false
-				}
-			}
-		}
-		for _, unready := range unreadyNodes {
-			if unready.Node.Equal(n.Node) {
-				upgrade = false
-			}
-		}
-		if upgrade {
-			toUpgrade = append(toUpgrade, n)
-		}
-	}
-
-	// Run the upgrade on the nodes that need it
-	if err := executor.UpgradeNodes(plan, toUpgrade, opts.online, opts.maxParallelWorkers); err != nil {
-		return fmt.Errorf("Failed to upgrade nodes: %v", err)
-	}
+	fmt.Fprintln(out)
+	util.PrintColor(out, util.Green, "The cluster was upgraded successfully!\n")
+	fmt.Fprintln(out)
 	return nil
 }
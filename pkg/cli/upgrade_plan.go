@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+const upgradeTargetsDir = "./ansible/playbooks/group_vars"
+
+// NewCmdUpgradePlan returns the command for computing the plan of an online upgrade
+func NewCmdUpgradePlan(out io.Writer, opts *upgradeOpts) *cobra.Command {
+	var outputFile string
+	cmd := cobra.Command{
+		Use:   "plan",
+		Short: "Compute what an online upgrade of your Kubernetes cluster will do",
+		Long: `Compute what an online upgrade of your Kubernetes cluster will do.
+
+The safety checks of the online upgrade are run against the nodes, and the nodes are
+grouped in the batches they will be upgraded in. The packages and container images that
+will change on each node are listed.
+
+The upgrade plan is written as JSON, and can be executed verbatim with
+"kismatic upgrade online --from-plan".
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("Unexpected args: %v", args)
+			}
+			return doUpgradePlan(out, opts, outputFile)
+		},
+	}
+	cmd.Flags().IntVar(&opts.maxParallelWorkers, "max-parallel-workers", 1, "the maximum number of worker nodes to be upgraded in parallel")
+	cmd.Flags().BoolVar(&opts.ignoreSafetyChecks, "ignore-safety-checks", false, "include the nodes that failed the safety checks in the upgrade")
+	cmd.Flags().StringVar(&outputFile, "output-file", "upgrade-plan.json", "path to the file where the upgrade plan is written")
+	return &cmd
+}
+
+func doUpgradePlan(out io.Writer, opts *upgradeOpts, outputFile string) error {
+	if opts.maxParallelWorkers < 1 {
+		return fmt.Errorf("max-parallel-workers must be greater or equal to 1, got: %d", opts.maxParallelWorkers)
+	}
+	util.PrintHeader(out, "Computing upgrade plan", '=')
+	planner := install.FilePlanner{File: opts.planFile}
+	if !planner.PlanExists() {
+		util.PrettyPrintErr(out, "Reading plan file")
+		return fmt.Errorf("plan file %q does not exist", opts.planFile)
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		util.PrettyPrintErr(out, "Reading plan file")
+		return fmt.Errorf("error reading plan file %q: %v", opts.planFile, err)
+	}
+	util.PrettyPrintOk(out, "Reading plan file")
+	if err = validatePlan(out, plan); err != nil {
+		return err
+	}
+	if err = validateSSHConnectivity(out, plan); err != nil {
+		return err
+	}
+	targets, err := install.ReadUpgradeTargets(upgradeTargetsDir)
+	if err != nil {
+		return err
+	}
+	cv, err := install.ListVersions(plan)
+	if err != nil {
+		return fmt.Errorf("error listing cluster versions: %v", err)
+	}
+
+	kubeClient, err := install.NewClusterClient(plan, opts.generatedAssetsDir)
+	if err != nil {
+		return err
+	}
+	up, err := install.ComputeUpgradePlan(*plan, cv.Nodes, kubeClient, install.UpgradePlanOptions{
+		MaxParallelWorkers: opts.maxParallelWorkers,
+		IgnoreSafetyChecks: opts.ignoreSafetyChecks,
+		PartialAllowed:     opts.partialAllowed,
+	})
+	if err != nil {
+		return err
+	}
+	for i := range up.Batches {
+		for j := range up.Batches[i] {
+			n := &up.Batches[i][j]
+			node, err := findPlanNode(*plan, n.Host, n.IP)
+			if err != nil {
+				return err
+			}
+			if n.Packages, n.Images, err = install.ListVersionChanges(*plan, node, *targets); err != nil {
+				return err
+			}
+		}
+	}
+
+	printUpgradePlan(out, *up)
+	if err := install.WriteUpgradePlan(outputFile, *up); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "The upgrade plan was written to %q\n", outputFile)
+	if up.Blocked != "" {
+		return errors.New(up.Blocked)
+	}
+	fmt.Fprintf(out, "Run \"kismatic upgrade online --from-plan %s\" to perform the upgrade\n", outputFile)
+	return nil
+}
+
+func findPlanNode(plan install.Plan, host, ip string) (install.Node, error) {
+	for _, n := range plan.GetUniqueNodes() {
+		if n.Host == host && n.IP == ip {
+			return n, nil
+		}
+	}
+	return install.Node{}, fmt.Errorf("node %q was not found in the plan file", host)
+}
+
+func printUpgradePlan(out io.Writer, up install.UpgradePlan) {
+	util.PrintHeader(out, "Upgrade Plan", '=')
+	if len(up.Batches) == 0 {
+		fmt.Fprintln(out, "All nodes are at the target version. No nodes will be upgraded.")
+	}
+	for i, batch := range up.Batches {
+		fmt.Fprintf(out, "Batch %d:\n", i+1)
+		for _, n := range batch {
+			fmt.Fprintf(out, "  %s %v: %s -> %s\n", n.Host, n.Roles, n.Version, up.KismaticVersion)
+			for _, p := range n.Packages {
+				fmt.Fprintf(out, "    - package %s: %s -> %s\n", p.Name, p.From, p.To)
+			}
+			for _, img := range n.Images {
+				fmt.Fprintf(out, "    - image %s: %s -> %s\n", img.Name, img.From, img.To)
+			}
+		}
+	}
+	if len(up.Unsafe) > 0 {
+		fmt.Fprintln(out)
+		if up.IgnoreSafetyChecks {
+			fmt.Fprintln(out, "Unsafe nodes (upgraded, the safety checks are ignored):")
+		} else {
+			fmt.Fprintln(out, "Unsafe nodes (not upgraded):")
+		}
+		for _, n := range up.Unsafe {
+			fmt.Fprintf(out, "  %s %v\n", n.Host, n.Roles)
+			for _, e := range n.SafetyErrors {
+				fmt.Fprintf(out, "    - %s\n", e)
+			}
+		}
+	}
+	if len(up.UpToDate) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Nodes at the target version:")
+		for _, n := range up.UpToDate {
+			fmt.Fprintf(out, "  %s %v\n", n.Host, n.Roles)
+		}
+	}
+	fmt.Fprintln(out)
+	if up.PartialAllowed {
+		fmt.Fprintln(out, "The cluster services will not be upgraded, as this is a partial upgrade.")
+	} else {
+		fmt.Fprintln(out, "The cluster services will be upgraded after the nodes.")
+	}
+	if up.Blocked != "" {
+		util.PrintColor(out, util.Red, "%s\n", up.Blocked)
+	}
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
+	"github.com/apprenda/kismatic/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdUpgradeRollback returns the command for rolling back the upgrade of a node
+func NewCmdUpgradeRollback(out io.Writer, opts *upgradeOpts) *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "rollback NODE",
+		Short: "Roll back the upgrade of a node",
+		Long: `Roll back the upgrade of a node.
+
+Before a node is upgraded, a snapshot of its package versions, pod manifests, configuration
+files and version file is saved on the node. The rollback restores the snapshot, restarts
+the services and uncordons the node, which is left at the version it had before the upgrade.
+
+The rollback is meant for nodes that failed to upgrade. The cluster services are not rolled back.
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return cmd.Usage()
+			}
+			return doUpgradeRollback(out, opts, args[0])
+		},
+	}
+	return &cmd
+}
+
+func doUpgradeRollback(out io.Writer, opts *upgradeOpts, host string) error {
+	planner := install.FilePlanner{File: opts.planFile}
+	if !planner.PlanExists() {
+		return fmt.Errorf("plan file %q does not exist", opts.planFile)
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		return fmt.Errorf("error reading plan file %q: %v", opts.planFile, err)
+	}
+	options, err := clientOptions(out, opts.outputFormat)
+	if err != nil {
+		return err
+	}
+	out = options.Log
+	generatedAssetsDir := opts.generatedAssetsDir
+	var dryRunDir string
+	if opts.dryRun {
+		if dryRunDir, err = prepareDryRun(out, opts.dryRunDir, opts.generatedAssetsDir); err != nil {
+			return err
+		}
+		generatedAssetsDir = dryRunDir
+		defer removeDryRunSecrets(out, dryRunDir)
+	}
+	options.GeneratedAssetsDirectory = generatedAssetsDir
+	options.Verbose = opts.verbose
+	options.ForceUnlock = opts.forceUnlock
+	options.DryRun = opts.dryRun
+	options.DryRunDirectory = dryRunDir
+	result, err := kismatic.New(options).Rollback(plan, host)
+	if err != nil {
+		return err
+	}
+	if opts.dryRun {
+		printDryRunComplete(out, dryRunDir)
+		return nil
+	}
+	fmt.Fprintln(out)
+	util.PrintColor(out, util.Green, "The node %q was rolled back to version %s\n", host, result.Node.Version)
+	fmt.Fprintln(out)
+	return nil
+}
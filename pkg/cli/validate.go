@@ -3,11 +3,9 @@ package cli
 import (
 	"fmt"
 	"io"
-	"path/filepath"
-
-	"os"
 
 	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
 	"github.com/apprenda/kismatic/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -30,8 +28,8 @@ func NewCmdValidate(out io.Writer, installOpts *installOpts) *cobra.Command {
 			if len(args) != 0 {
 				return fmt.Errorf("Unexpected args: %v", args)
 			}
-			planner := &install.FilePlanner{File: installOpts.planFilename}
-			opts.planFile = installOpts.planFilename
+			planner := installOpts.planner()
+			opts.planFile = installOpts.planFilename()
 			return doValidate(out, planner, opts)
 		},
 	}
@@ -43,74 +41,56 @@ func NewCmdValidate(out io.Writer, installOpts *installOpts) *cobra.Command {
 }
 
 func doValidate(out io.Writer, planner install.Planner, opts *validateOpts) error {
-	util.PrintHeader(out, "Validating", '=')
-	// Check if plan file exists
-	if !planner.PlanExists() {
-		util.PrettyPrintErr(out, "Reading installation plan file [ERROR]")
-		fmt.Fprintln(out, "Run \"kismatic install plan\" to generate it")
-		return fmt.Errorf("plan does not exist")
-	}
-	plan, err := planner.Read()
+	// the pre-flight executor writes the Ansible events to stdout, everything else is a message
+	stdout := out
+	out = messagesWriter(out, opts.outputFormat)
+	plan, err := readPlanForValidation(out, planner, opts.planFile)
 	if err != nil {
-		util.PrettyPrintErr(out, "Reading installation plan file %q", opts.planFile)
-		return fmt.Errorf("error reading plan file: %v", err)
-	}
-	util.PrettyPrintOk(out, "Reading installation plan file %q", opts.planFile)
-
-	// Validate plan file
-	if err := validatePlan(out, plan); err != nil {
-		return err
-	}
-
-	// Validate SSH connections
-	if err := validateSSHConnectivity(out, plan); err != nil {
 		return err
 	}
-
-	// get a new pki
-	pki, err := newPKI(out, opts)
+	client := kismatic.New(kismatic.Options{
+		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		Verbose:                  opts.verbose,
+		OutputFormat:             opts.outputFormat,
+		Out:                      stdout,
+		Log:                      out,
+	})
+	result, err := client.Validate(plan, kismatic.ValidateOptions{SkipPreFlight: opts.skipPreFlight})
 	if err != nil {
 		return err
 	}
-	// Validate Certificates
-	ok, errs := install.ValidateCertificates(plan, pki)
-	if !ok {
-		util.PrettyPrintErr(out, "Validating cluster certificates")
-		util.PrintValidationErrors(out, errs)
-		return fmt.Errorf("Cluster certificates validation error prevents installation from proceeding")
-	}
+	return validationError(result)
+}
 
-	if opts.skipPreFlight {
-		return nil
-	}
-	// Run pre-flight
-	options := install.ExecutorOptions{
-		OutputFormat: opts.outputFormat,
-		Verbose:      opts.verbose,
+// readPlanForValidation prints the header of the validation, and reads the plan
+func readPlanForValidation(out io.Writer, planner install.Planner, planFile string) (*install.Plan, error) {
+	util.PrintHeader(out, "Validating", '=')
+	// Check if plan file exists
+	if !planner.PlanExists() {
+		util.PrettyPrintErr(out, "Reading installation plan file [ERROR]")
+		fmt.Fprintln(out, "Run \"kismatic install plan\" to generate it")
+		return nil, fmt.Errorf("plan does not exist")
 	}
-	e, err := install.NewPreFlightExecutor(out, os.Stderr, options)
+	plan, err := planner.Read()
 	if err != nil {
-		return err
-	}
-	if err = e.RunPreFlightCheck(plan); err != nil {
-		return err
+		util.PrettyPrintErr(out, "Reading installation plan file %q", planFile)
+		return nil, fmt.Errorf("error reading plan file: %v", err)
 	}
-	return nil
+	util.PrettyPrintOk(out, "Reading installation plan file %q", planFile)
+	return plan, nil
 }
 
-// TODO this should really not be here
-func newPKI(stdout io.Writer, options *validateOpts) (*install.LocalPKI, error) {
-	ansibleDir := "ansible"
-	if options.generatedAssetsDir == "" {
-		return nil, fmt.Errorf("GeneratedAssetsDirectory option cannot be empty")
-	}
-	certsDir := filepath.Join(options.generatedAssetsDir, "keys")
-	pki := &install.LocalPKI{
-		CACsr: filepath.Join(ansibleDir, "playbooks", "tls", "ca-csr.json"),
-		GeneratedCertsDirectory: certsDir,
-		Log: stdout,
+// validationError returns the error of the first validation check that failed
+func validationError(result *kismatic.ValidationResult) error {
+	switch {
+	case len(result.PlanErrors) > 0:
+		return fmt.Errorf("Plan file validation error prevents installation from proceeding")
+	case len(result.SSHErrors) > 0:
+		return fmt.Errorf("SSH connectivity validation error prevents installation from proceeding")
+	case len(result.CertificateErrors) > 0:
+		return fmt.Errorf("Cluster certificates validation error prevents installation from proceeding")
 	}
-	return pki, nil
+	return result.PreFlightError
 }
 
 func validatePlan(out io.Writer, plan *install.Plan) error {
@@ -22,6 +22,9 @@ type volumeAddOptions struct {
 	generatedAssetsDir string
 	reclaimPolicy      string
 	accessModes        string
+	forceUnlock        bool
+	dryRun             bool
+	dryRunDir          string
 }
 
 // NewCmdVolumeAdd returns the command for adding storage volumes
@@ -51,6 +54,8 @@ This function requires a target cluster that has storage nodes.`,
 	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().StringVar(&opts.reclaimPolicy, "reclaim-policy", "Retain", "Persistent volume reclaim policy (options Retain|Recycle|Delete)")
 	cmd.Flags().StringVar(&opts.accessModes, "access-modes", "ReadWriteMany", "Comma-separated list of access modes for the persistent volume (options ReadWriteOnce|ReadOnlyMany|ReadWriteMany)")
+	addForceUnlockFlag(cmd.Flags(), &opts.forceUnlock)
+	addDryRunFlags(cmd.Flags(), &opts.dryRun, &opts.dryRunDir)
 	return cmd
 }
 
@@ -80,11 +85,23 @@ func doVolumeAdd(out io.Writer, opts volumeAddOptions, planFile string, args []s
 	if !planner.PlanExists() {
 		return planFileNotFoundErr{filename: planFile}
 	}
+	generatedAssetsDir := opts.generatedAssetsDir
+	var dryRunDir string
+	if opts.dryRun {
+		if dryRunDir, err = prepareDryRun(out, opts.dryRunDir, opts.generatedAssetsDir); err != nil {
+			return err
+		}
+		generatedAssetsDir = dryRunDir
+		defer removeDryRunSecrets(out, dryRunDir)
+	}
 	execOpts := install.ExecutorOptions{
 		OutputFormat: opts.outputFormat,
 		Verbose:      opts.verbose,
 		// Need to refactor executor code... this will do for now as we don't need the generated assets dir in this command
-		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		GeneratedAssetsDirectory: generatedAssetsDir,
+		ForceUnlock:              opts.forceUnlock,
+		DryRun:                   opts.dryRun,
+		DryRunDirectory:          dryRunDir,
 	}
 	exec, err := install.NewExecutor(out, out, execOpts)
 	if err != nil {
@@ -101,7 +118,7 @@ func doVolumeAdd(out io.Writer, opts volumeAddOptions, planFile string, args []s
 		verbose:            opts.verbose,
 		planFile:           planFile,
 		skipPreFlight:      true,
-		generatedAssetsDir: opts.generatedAssetsDir,
+		generatedAssetsDir: generatedAssetsDir,
 	}
 	if err := doValidate(out, planner, vopts); err != nil {
 		return err
@@ -129,6 +146,10 @@ func doVolumeAdd(out io.Writer, opts volumeAddOptions, planFile string, args []s
 	if err := exec.AddVolume(plan, v); err != nil {
 		return fmt.Errorf("error adding new volume: %v", err)
 	}
+	if opts.dryRun {
+		printDryRunComplete(out, dryRunDir)
+		return nil
+	}
 
 	fmt.Fprintln(out)
 	fmt.Fprintln(out, "Successfully added the persistent volume to the kubernetes cluster.")
@@ -16,6 +16,7 @@ type volumeDeleteOptions struct {
 	outputFormat       string
 	generatedAssetsDir string
 	force              bool
+	forceUnlock        bool
 }
 
 // NewCmdVolumeDelete returns the command for deleting storage volumes
@@ -44,6 +45,7 @@ WARNING all data in the volume will be lost.`,
 	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options simple|raw)`)
 	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	cmd.Flags().BoolVar(&opts.force, "force", false, `do not prompt`)
+	addForceUnlockFlag(cmd.Flags(), &opts.forceUnlock)
 	return cmd
 }
 
@@ -67,6 +69,7 @@ func doVolumeDelete(out io.Writer, opts volumeDeleteOptions, planFile string, ar
 		Verbose:      opts.verbose,
 		// Need to refactor executor code... this will do for now as we don't need the generated assets dir in this command
 		GeneratedAssetsDirectory: opts.generatedAssetsDir,
+		ForceUnlock:              opts.forceUnlock,
 	}
 	exec, err := install.NewExecutor(out, out, execOpts)
 	if err != nil {
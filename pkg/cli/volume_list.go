@@ -13,7 +13,8 @@ import (
 )
 
 type volumeListOptions struct {
-	outputFormat string
+	outputFormat       string
+	generatedAssetsDir string
 }
 
 // NewCmdVolumeList returns the command for listgin storage volumes
@@ -31,6 +32,7 @@ This function requires a target cluster that has storage nodes.`,
 	}
 
 	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "simple", `output format (options "simple"|"json")`)
+	cmd.Flags().StringVar(&opts.generatedAssetsDir, "generated-assets-dir", "generated", "path to the directory where assets generated during the installation process will be stored")
 	return cmd
 }
 
@@ -58,12 +60,11 @@ func doVolumeList(out io.Writer, opts volumeListOptions, planFile string, args [
 	}
 	glusterClient := data.RemoteGlusterCLI{SSHClient: clientStorage}
 
-	// find master node
-	clientMaster, err := plan.GetSSHClient("master")
+	// use the API server, or kubectl on the master node if it is not reachable
+	kubernetesClient, err := install.NewClusterClient(plan, opts.generatedAssetsDir)
 	if err != nil {
 		return err
 	}
-	kubernetesClient := data.RemoteKubectl{SSHClient: clientMaster}
 
 	resp, err := buildResponse(glusterClient, kubernetesClient)
 	if err != nil {
@@ -48,6 +48,21 @@ type StatefulSetGetter interface {
 	GetStatefulSet(namespace, name string) (*StatefulSet, error)
 }
 
+// DeploymentGetter gets a deployment
+type DeploymentGetter interface {
+	GetDeployment(namespace, name string) (*Deployment, error)
+}
+
+// NodeGetter gets a node
+type NodeGetter interface {
+	GetNode(name string) (*Node, error)
+}
+
+// PodDisruptionBudgetLister lists the pod disruption budgets of all namespaces
+type PodDisruptionBudgetLister interface {
+	ListPodDisruptionBudgets() (*PodDisruptionBudgetList, error)
+}
+
 type KubernetesClient interface {
 	PodLister
 	PVLister
@@ -210,6 +225,56 @@ func (k RemoteKubectl) GetStatefulSet(namespace, name string) (*StatefulSet, err
 	return &s, nil
 }
 
+// GetDeployment returns the deployment with the given name in the given namespace.
+// If not found, returns an error.
+func (k RemoteKubectl) GetDeployment(namespace, name string) (*Deployment, error) {
+	cmd := fmt.Sprintf("sudo kubectl get deployment --namespace %s -o json %s", namespace, name)
+	raw, err := k.SSHClient.Output(true, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Deployment: %v", err)
+	}
+	if isNoResourcesResponse(raw) {
+		return nil, fmt.Errorf("Deployment %s/%s was not found", namespace, name)
+	}
+	var d Deployment
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		return nil, fmt.Errorf("error unmarshalling Deployment: %v", err)
+	}
+	return &d, nil
+}
+
+// GetNode returns the node with the given name. If not found, returns an error.
+func (k RemoteKubectl) GetNode(name string) (*Node, error) {
+	raw, err := k.SSHClient.Output(true, fmt.Sprintf("sudo kubectl get node -o json %s", name))
+	if err != nil {
+		return nil, fmt.Errorf("error getting Node: %v", err)
+	}
+	if isNoResourcesResponse(raw) {
+		return nil, fmt.Errorf("Node %s was not found", name)
+	}
+	var n Node
+	if err := json.Unmarshal([]byte(raw), &n); err != nil {
+		return nil, fmt.Errorf("error unmarshalling Node: %v", err)
+	}
+	return &n, nil
+}
+
+// ListPodDisruptionBudgets returns the PodDisruptionBudgets of all namespaces
+func (k RemoteKubectl) ListPodDisruptionBudgets() (*PodDisruptionBudgetList, error) {
+	raw, err := k.SSHClient.Output(true, "sudo kubectl get pdb --all-namespaces=true -o json")
+	if err != nil {
+		return nil, fmt.Errorf("error getting PodDisruptionBudgets: %v", err)
+	}
+	if isNoResourcesResponse(raw) {
+		return &PodDisruptionBudgetList{}, nil
+	}
+	var l PodDisruptionBudgetList
+	if err := json.Unmarshal([]byte(raw), &l); err != nil {
+		return nil, fmt.Errorf("error unmarshalling PodDisruptionBudgets: %v", err)
+	}
+	return &l, nil
+}
+
 // kubectl will print this message when no resources are returned
 func isNoResourcesResponse(s string) bool {
 	if strings.Contains(strings.TrimSpace(s), "No resources found") {
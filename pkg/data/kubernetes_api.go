@@ -0,0 +1,322 @@
+package data
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ClusterClient gets the Kubernetes resources that Kismatic inspects
+type ClusterClient interface {
+	PodLister
+	PVLister
+	PersistentVolumeGetter
+	PersistentVolumeClaimGetter
+	DaemonSetGetter
+	ReplicationControllerGetter
+	ReplicaSetGetter
+	StatefulSetGetter
+	DeploymentGetter
+	NodeGetter
+	PodDisruptionBudgetLister
+}
+
+// APIClient is a Kubernetes client that calls the API server over HTTPS,
+// using the credentials of a kubeconfig file.
+type APIClient struct {
+	Server     string
+	HTTPClient *http.Client
+}
+
+// kubeconfig is the subset of the kubeconfig file that is used by the APIClient
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// NewAPIClient returns a client for the API server of the current context
+// of the kubeconfig file
+func NewAPIClient(kubeconfigFile string) (*APIClient, error) {
+	raw, err := ioutil.ReadFile(kubeconfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kubeconfig file: %v", err)
+	}
+	var kc kubeconfig
+	if err = yaml.Unmarshal(raw, &kc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling kubeconfig file: %v", err)
+	}
+	var clusterName, userName string
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("context %q was not found in the kubeconfig file", kc.CurrentContext)
+	}
+
+	tlsConfig := &tls.Config{}
+	var server string
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		server = c.Cluster.Server
+		if c.Cluster.CertificateAuthorityData != "" {
+			ca, err := base64.StdEncoding.DecodeString(c.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding the certificate authority of cluster %q: %v", clusterName, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("invalid certificate authority for cluster %q", clusterName)
+			}
+		}
+	}
+	if server == "" {
+		return nil, fmt.Errorf("cluster %q was not found in the kubeconfig file", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.ClientCertificateData != "" {
+			cert, err := base64.StdEncoding.DecodeString(u.User.ClientCertificateData)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding the client certificate of user %q: %v", userName, err)
+			}
+			key, err := base64.StdEncoding.DecodeString(u.User.ClientKeyData)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding the client key of user %q: %v", userName, err)
+			}
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate for user %q: %v", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &APIClient{
+		Server:     server,
+		HTTPClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// notFoundErr is returned when the API server responds with 404
+type notFoundErr struct {
+	kind string
+	name string
+}
+
+func (e notFoundErr) Error() string {
+	return fmt.Sprintf("%s %s was not found", e.kind, e.name)
+}
+
+// apiStatusErr is returned when the API server responds with an unexpected status code
+type apiStatusErr struct {
+	kind   string
+	status int
+	body   string
+}
+
+func (e apiStatusErr) Error() string {
+	return fmt.Sprintf("error getting %s: the API server returned status %d: %s", e.kind, e.status, e.body)
+}
+
+// get unmarshals the resource at the given path of the API server
+func (c APIClient) get(path, kind, name string, v interface{}) error {
+	resp, err := c.HTTPClient.Get(c.Server + path)
+	if err != nil {
+		return fmt.Errorf("error getting %s: %v", kind, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", kind, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return notFoundErr{kind: kind, name: name}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return apiStatusErr{kind: kind, status: resp.StatusCode, body: string(body)}
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error unmarshalling %s: %v", kind, err)
+	}
+	return nil
+}
+
+// Reachable returns an error if the API server cannot be reached
+func (c APIClient) Reachable() error {
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	return c.get("/version", "version", "", &version)
+}
+
+// ListPersistentVolumes returns PersistentVolume data
+func (c APIClient) ListPersistentVolumes() (*PersistentVolumeList, error) {
+	var l PersistentVolumeList
+	if err := c.get("/api/v1/persistentvolumes", "persistent volume data", "", &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ListPods returns the Pods of all namespaces
+func (c APIClient) ListPods() (*PodList, error) {
+	var l PodList
+	if err := c.get("/api/v1/pods", "pod data", "", &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetDaemonSet returns the DaemonSet with the given namespace and name. If not found,
+// returns an error.
+func (c APIClient) GetDaemonSet(namespace, name string) (*DaemonSet, error) {
+	var d DaemonSet
+	path := fmt.Sprintf("/apis/extensions/v1beta1/namespaces/%s/daemonsets/%s", namespace, name)
+	if err := c.get(path, "DaemonSet", namespace+"/"+name, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetReplicationController returns the ReplicationController with the given name in the given namespace.
+// If not found, returns an error.
+func (c APIClient) GetReplicationController(namespace, name string) (*ReplicationController, error) {
+	var r ReplicationController
+	path := fmt.Sprintf("/api/v1/namespaces/%s/replicationcontrollers/%s", namespace, name)
+	if err := c.get(path, "ReplicationController", namespace+"/"+name, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetReplicaSet returns the ReplicaSet with the given name in the given namespace.
+// If not found, returns an error.
+func (c APIClient) GetReplicaSet(namespace, name string) (*ReplicaSet, error) {
+	var r ReplicaSet
+	path := fmt.Sprintf("/apis/extensions/v1beta1/namespaces/%s/replicasets/%s", namespace, name)
+	if err := c.get(path, "ReplicaSet", namespace+"/"+name, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetPersistentVolume returns the persistent volume with the given name.
+// If not found, returns an error.
+func (c APIClient) GetPersistentVolume(name string) (*PersistentVolume, error) {
+	var p PersistentVolume
+	if err := c.get("/api/v1/persistentvolumes/"+name, "PersistentVolume", name, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPersistentVolumeClaim returns the persistent volume claim with the given name and namespace.
+// If not found, returns an error.
+func (c APIClient) GetPersistentVolumeClaim(namespace, name string) (*PersistentVolumeClaim, error) {
+	var p PersistentVolumeClaim
+	path := fmt.Sprintf("/api/v1/namespaces/%s/persistentvolumeclaims/%s", namespace, name)
+	if err := c.get(path, "PersistentVolumeClaim", namespace+"/"+name, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetStatefulSet returns the stateful set with the given name in the given namespace.
+// If not found, returns an error.
+func (c APIClient) GetStatefulSet(namespace, name string) (*StatefulSet, error) {
+	var s StatefulSet
+	path := fmt.Sprintf("/apis/apps/v1beta1/namespaces/%s/statefulsets/%s", namespace, name)
+	if err := c.get(path, "StatefulSet", namespace+"/"+name, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetDeployment returns the deployment with the given name in the given namespace.
+// If not found, returns an error.
+func (c APIClient) GetDeployment(namespace, name string) (*Deployment, error) {
+	var d Deployment
+	path := fmt.Sprintf("/apis/extensions/v1beta1/namespaces/%s/deployments/%s", namespace, name)
+	if err := c.get(path, "Deployment", namespace+"/"+name, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetNode returns the node with the given name. If not found, returns an error.
+func (c APIClient) GetNode(name string) (*Node, error) {
+	var n Node
+	if err := c.get("/api/v1/nodes/"+name, "Node", name, &n); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// ListPodDisruptionBudgets returns the PodDisruptionBudgets of all namespaces
+func (c APIClient) ListPodDisruptionBudgets() (*PodDisruptionBudgetList, error) {
+	var l PodDisruptionBudgetList
+	if err := c.get("/apis/policy/v1beta1/poddisruptionbudgets", "PodDisruptionBudgets", "", &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// NewClusterClient returns a client that calls the API server directly, using
+// the kubeconfig file. The client falls back to running kubectl over SSH only
+// when the API server cannot be reached from this machine.
+func NewClusterClient(kubeconfigFile string, sshClient ssh.Client) (ClusterClient, error) {
+	api, err := NewAPIClient(kubeconfigFile)
+	if err == nil {
+		err = api.Reachable()
+		if err == nil {
+			return api, nil
+		}
+		// the API server responded, so the error is not solved by using kubectl
+		switch err.(type) {
+		case apiStatusErr, notFoundErr:
+			return nil, err
+		}
+	}
+	if sshClient == nil {
+		return nil, fmt.Errorf("the API server is not reachable: %v", err)
+	}
+	return RemoteKubectl{SSHClient: sshClient}, nil
+}
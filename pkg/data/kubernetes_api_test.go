@@ -0,0 +1,141 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeSSHClient struct {
+	output string
+}
+
+func (f fakeSSHClient) Output(pty bool, args ...string) (string, error) {
+	return f.output, nil
+}
+
+func (f fakeSSHClient) Shell(pty bool, args ...string) error {
+	return nil
+}
+
+func writeKubeconfig(t *testing.T, dir string, server *httptest.Server, url string) string {
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: %s
+    server: %s
+  name: test
+contexts:
+- context:
+    cluster: test
+    user: admin
+  name: test-admin
+current-context: test-admin
+kind: Config
+users:
+- name: admin
+  user: {}
+`, base64.StdEncoding.EncodeToString(ca), url)
+	file := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(file, []byte(kubeconfig), 0644); err != nil {
+		t.Fatalf("error writing kubeconfig: %v", err)
+	}
+	return file
+}
+
+func newTestAPIServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"gitVersion": "v1.8.0"}`)
+	})
+	mux.HandleFunc("/api/v1/pods", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items": [{"metadata": {"name": "foo", "namespace": "bar"}, "spec": {"nodeName": "worker1"}, "status": {"phase": "Running"}}]}`)
+	})
+	mux.HandleFunc("/api/v1/nodes/worker1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"metadata": {"name": "worker1"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}`)
+	})
+	return httptest.NewTLSServer(mux)
+}
+
+func TestAPIClient(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "kubernetes-api-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewAPIClient(writeKubeconfig(t, dir, server, server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pods, err := c.ListPods()
+	if err != nil {
+		t.Fatalf("unexpected error listing pods: %v", err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Name != "foo" || pods.Items[0].Spec.NodeName != "worker1" || pods.Items[0].Status.Phase != "Running" {
+		t.Errorf("unexpected pods: %+v", pods.Items)
+	}
+	node, err := c.GetNode("worker1")
+	if err != nil {
+		t.Fatalf("unexpected error getting node: %v", err)
+	}
+	if !node.Ready() {
+		t.Error("expected the node to be ready")
+	}
+	if _, err = c.GetDaemonSet("kube-system", "calico-node"); err == nil || !strings.Contains(err.Error(), "was not found") {
+		t.Errorf("expected a not found error, but got %v", err)
+	}
+}
+
+func TestNewClusterClient(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "kubernetes-api-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	sshClient := fakeSSHClient{}
+
+	c, err := NewClusterClient(writeKubeconfig(t, dir, server, server.URL), sshClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := c.(*APIClient); !ok {
+		t.Errorf("expected the API client when the API server is reachable, but got %T", c)
+	}
+
+	// the API server does not respond on the path of the URL
+	c, err = NewClusterClient(writeKubeconfig(t, dir, server, server.URL+"/missing"), sshClient)
+	if err == nil {
+		t.Errorf("expected an error when the API server responds with an error, but got %T", c)
+	}
+
+	unreachable := httptest.NewTLSServer(http.NotFoundHandler())
+	unreachable.Close()
+	c, err = NewClusterClient(writeKubeconfig(t, dir, server, unreachable.URL), sshClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := c.(RemoteKubectl); !ok {
+		t.Errorf("expected kubectl over SSH when the API server is unreachable, but got %T", c)
+	}
+
+	c, err = NewClusterClient(filepath.Join(dir, "does-not-exist"), sshClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := c.(RemoteKubectl); !ok {
+		t.Errorf("expected kubectl over SSH when there is no kubeconfig file, but got %T", c)
+	}
+}
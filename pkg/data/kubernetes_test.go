@@ -0,0 +1,45 @@
+package data
+
+import "testing"
+
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := map[string]string{"app": "web", "tier": "frontend"}
+	tests := []struct {
+		selector *LabelSelector
+		matches  bool
+	}{
+		{selector: nil, matches: false},
+		{selector: &LabelSelector{}, matches: true},
+		{selector: &LabelSelector{MatchLabels: map[string]string{"app": "web"}}, matches: true},
+		{selector: &LabelSelector{MatchLabels: map[string]string{"app": "db"}}, matches: false},
+		{selector: &LabelSelector{MatchLabels: map[string]string{"app": "web", "env": "prod"}}, matches: false},
+		{selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "tier", Operator: "In", Values: []string{"backend", "frontend"}}}}, matches: true},
+		{selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "tier", Operator: "NotIn", Values: []string{"frontend"}}}}, matches: false},
+		{selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "NotIn", Values: []string{"prod"}}}}, matches: true},
+		{selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "Exists"}}}, matches: true},
+		{selector: &LabelSelector{MatchExpressions: []LabelSelectorRequirement{{Key: "app", Operator: "DoesNotExist"}}}, matches: false},
+		{selector: &LabelSelector{MatchLabels: map[string]string{"app": "web"}, MatchExpressions: []LabelSelectorRequirement{{Key: "env", Operator: "Exists"}}}, matches: false},
+	}
+	for i, test := range tests {
+		if m := test.selector.Matches(labels); m != test.matches {
+			t.Errorf("test %d: expected match to be %v, but got %v", i, test.matches, m)
+		}
+	}
+}
+
+func TestControllerRef(t *testing.T) {
+	controller := true
+	m := ObjectMeta{
+		OwnerReferences: []OwnerReference{
+			{Kind: "ConfigMap", Name: "config"},
+			{Kind: "ReplicaSet", Name: "web-12345", Controller: &controller},
+		},
+	}
+	ref := m.ControllerRef()
+	if ref == nil || ref.Kind != "ReplicaSet" || ref.Name != "web-12345" {
+		t.Errorf("expected the ReplicaSet to be the controller, but got %+v", ref)
+	}
+	if ref := (ObjectMeta{OwnerReferences: m.OwnerReferences[:1]}).ControllerRef(); ref != nil {
+		t.Errorf("expected no controller, but got %+v", ref)
+	}
+}
@@ -6,14 +6,44 @@ type PodList struct {
 
 type Pod struct {
 	ObjectMeta `json:"metadata,omitempty"`
-	Spec       PodSpec `json:"spec,omitempty"`
+	Spec       PodSpec   `json:"spec,omitempty"`
+	Status     PodStatus `json:"status,omitempty"`
+}
+
+// PodStatus represents information about the status of a pod.
+type PodStatus struct {
+	// Current condition of the pod, one of Pending, Running, Succeeded, Failed or Unknown.
+	Phase string `json:"phase,omitempty"`
 }
 
 type ObjectMeta struct {
-	Annotations map[string]string `json:"annotations,omitempty"`
-	Name        string            `json:"name,omitempty"`
-	Namespace   string            `json:"namespace,omitempty"`
-	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	OwnerReferences []OwnerReference  `json:"ownerReferences,omitempty"`
+}
+
+// OwnerReference contains enough information to let you identify an owning
+// object. The owning object must be in the same namespace as the dependent.
+type OwnerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	// If true, this reference points to the managing controller.
+	Controller *bool `json:"controller,omitempty"`
+}
+
+// ControllerRef returns the reference to the managing controller of the object,
+// or nil if the object is not managed by a controller.
+func (m ObjectMeta) ControllerRef() *OwnerReference {
+	for i := range m.OwnerReferences {
+		if ref := m.OwnerReferences[i]; ref.Controller != nil && *ref.Controller {
+			return &ref
+		}
+	}
+	return nil
 }
 
 // ObjectReference contains enough information to let you inspect or modify the referred object.
@@ -234,3 +264,147 @@ type StatefulSetStatus struct {
 	// Replicas is the number of actual replicas.
 	Replicas int32
 }
+
+// Deployment enables declarative updates for Pods and ReplicaSets.
+type Deployment struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+
+	// Status is the most recently observed status of the Deployment.
+	Status DeploymentStatus `json:"status,omitempty"`
+}
+
+// DeploymentStatus is the most recently observed status of the Deployment.
+type DeploymentStatus struct {
+	// Replicas is the total number of non-terminated pods targeted by this deployment.
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+// PodDisruptionBudgetList is a collection of PodDisruptionBudgets.
+type PodDisruptionBudgetList struct {
+	TypeMeta `json:",inline"`
+	ListMeta `json:"metadata,omitempty"`
+	Items    []PodDisruptionBudget `json:"items"`
+}
+
+// PodDisruptionBudget is an object to define the max disruption that can be caused to a collection of pods
+type PodDisruptionBudget struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Spec       PodDisruptionBudgetSpec   `json:"spec,omitempty"`
+	Status     PodDisruptionBudgetStatus `json:"status,omitempty"`
+}
+
+// PodDisruptionBudgetSpec is a description of a PodDisruptionBudget.
+type PodDisruptionBudgetSpec struct {
+	// Label query over pods whose evictions are managed by the disruption
+	// budget.
+	Selector *LabelSelector `json:"selector,omitempty"`
+}
+
+// PodDisruptionBudgetStatus represents information about the status of a
+// PodDisruptionBudget. Status may trail the actual state of a system.
+type PodDisruptionBudgetStatus struct {
+	// Number of pod disruptions that are currently allowed.
+	PodDisruptionsAllowed int32 `json:"disruptionsAllowed"`
+	// current number of healthy pods
+	CurrentHealthy int32 `json:"currentHealthy"`
+	// minimum desired number of healthy pods
+	DesiredHealthy int32 `json:"desiredHealthy"`
+	// total number of pods counted by this disruption budget
+	ExpectedPods int32 `json:"expectedPods"`
+}
+
+// A LabelSelector is a label query over a set of resources. The result of matchLabels and
+// matchExpressions are ANDed. An empty label selector matches all objects. A null
+// label selector matches no objects.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// A LabelSelectorRequirement is a selector that contains values, a key, and an operator that
+// relates the key and values.
+type LabelSelectorRequirement struct {
+	Key string `json:"key"`
+	// Operator is one of In, NotIn, Exists and DoesNotExist.
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// Matches returns true if the labels satisfy the selector
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return false
+	}
+	for k, v := range s.MatchLabels {
+		if actual, ok := labels[k]; !ok || actual != v {
+			return false
+		}
+	}
+	for _, r := range s.MatchExpressions {
+		value, exists := labels[r.Key]
+		switch r.Operator {
+		case "In":
+			if !exists || !contains(r.Values, value) {
+				return false
+			}
+		case "NotIn":
+			if exists && contains(r.Values, value) {
+				return false
+			}
+		case "Exists":
+			if !exists {
+				return false
+			}
+		case "DoesNotExist":
+			if exists {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Node is a worker node in Kubernetes.
+type Node struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Status     NodeStatus `json:"status,omitempty"`
+}
+
+// NodeStatus is information about the current status of a node.
+type NodeStatus struct {
+	Conditions []NodeCondition `json:"conditions,omitempty"`
+}
+
+// NodeCondition contains condition information for a node.
+type NodeCondition struct {
+	// Type of node condition, e.g. Ready
+	Type string `json:"type"`
+	// Status of the condition, one of True, False, Unknown.
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Ready returns true if the node reports the Ready condition
+func (n Node) Ready() bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
@@ -19,7 +19,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 	updatedPlan := addWorkerToPlan(*originalPlan, newWorker)
 
 	// Generate node certificates
-	util.PrintHeader(ae.stdout, "Generating Certificate For Worker Node", '=')
+	util.PrintHeader(ae.messagesOut(), "Generating Certificate For Worker Node", '=')
 	ca, err := ae.pki.GetClusterCA()
 	if err != nil {
 		return nil, err
@@ -34,7 +34,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ansible vars: %v", err)
 	}
-	util.PrintHeader(ae.stdout, "Adding Worker Node to Cluster", '=')
+	util.PrintHeader(ae.messagesOut(), "Adding Worker Node to Cluster", '=')
 	t := task{
 		name:           "add-worker",
 		playbook:       "kubernetes-worker.yaml",
@@ -50,7 +50,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 
 	// We need to run ansible against all hosts to update the hosts files
 	if updatedPlan.Cluster.Networking.UpdateHostsFiles {
-		util.PrintHeader(ae.stdout, "Updating Hosts Files On All Nodes", '=')
+		util.PrintHeader(ae.messagesOut(), "Updating Hosts Files On All Nodes", '=')
 		t = task{
 			name:           "add-worker-update-hosts",
 			playbook:       "_hosts.yaml",
@@ -65,7 +65,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 	}
 
 	// Verify that the node registered with API server
-	util.PrintHeader(ae.stdout, "Running New Worker Smoke Test", '=')
+	util.PrintHeader(ae.messagesOut(), "Running New Worker Smoke Test", '=')
 	cc.WorkerNode = newWorker.Host
 	t = task{
 		name:           "add-worker-smoke-test",
@@ -82,7 +82,7 @@ func (ae *ansibleExecutor) AddWorker(originalPlan *Plan, newWorker Node) (*Plan,
 
 	// Allow access to new worker to any storage volumes defined
 	if len(originalPlan.Storage.Nodes) > 0 {
-		util.PrintHeader(ae.stdout, "Updating Allowed IPs On Storage Volumes", '=')
+		util.PrintHeader(ae.messagesOut(), "Updating Allowed IPs On Storage Volumes", '=')
 		t = task{
 			name:           "add-worker-update-volumes",
 			playbook:       "_volume-update-allowed.yaml",
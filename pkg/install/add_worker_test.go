@@ -1,9 +1,11 @@
 package install
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/apprenda/kismatic/pkg/ansible"
@@ -229,6 +231,45 @@ func TestAddWorkerRestartServicesEnabled(t *testing.T) {
 	}
 }
 
+func TestAddWorkerJSONOutputWritesMessagesToErrOut(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	e := ansibleExecutor{
+		certsDir:            mustGetTempDir(t),
+		options:             ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:              stdout,
+		errOut:              errOut,
+		consoleOutputFormat: ansible.JSONFormat,
+		pki: &fakePKI{
+			caExists: true,
+		},
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+	}
+	originalPlan := &Plan{
+		Master: MasterNodeGroup{
+			Nodes: []Node{{InternalIP: "10.10.2.20"}},
+		},
+		Worker: NodeGroup{
+			ExpectedCount: 1,
+			Nodes:         []Node{{Host: "existingWorker"}},
+		},
+		Cluster: Cluster{
+			Networking: NetworkConfig{
+				ServiceCIDRBlock: "10.0.0.0/16",
+			},
+		},
+	}
+	if _, err := e.AddWorker(originalPlan, Node{Host: "test"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("expected stdout to only contain events, but got:\n%s", stdout.String())
+	}
+	if !strings.Contains(errOut.String(), "Adding Worker Node to Cluster") {
+		t.Errorf("expected the headers to be written to errOut, but got:\n%s", errOut.String())
+	}
+}
+
 func TestAddWorkerHostsFilesDNSEnabled(t *testing.T) {
 	fakeRunner := fakeRunner{}
 	e := ansibleExecutor{
@@ -315,12 +356,23 @@ type fakeRunner struct {
 
 func (f *fakeRunner) StartPlaybook(playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog) (<-chan ansible.Event, error) {
 	f.allNodesPlaybooks = append(f.allNodesPlaybooks, playbookFile)
-	return f.eventChan, f.err
+	return f.events(), f.err
 }
 func (f *fakeRunner) WaitPlaybook() error { return f.err }
 func (f *fakeRunner) StartPlaybookOnNode(playbookFile string, inventory ansible.Inventory, cc ansible.ClusterCatalog, node ...string) (<-chan ansible.Event, error) {
 	f.incomingCatalog = cc
-	return f.eventChan, f.err
+	return f.events(), f.err
+}
+
+// events returns the event channel of the runner, or a closed channel if
+// it has none, like the stream of a playbook that did not send any event
+func (f *fakeRunner) events() <-chan ansible.Event {
+	if f.eventChan != nil {
+		return f.eventChan
+	}
+	c := make(chan ansible.Event)
+	close(c)
+	return c
 }
 
 func fakeRunnerExplainer(execError error) func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
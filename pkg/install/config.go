@@ -0,0 +1,69 @@
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apprenda/kismatic/pkg/install/explain"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigFileEnvVar is the environment variable that can be used to override
+// the location of the kismatic config file
+const ConfigFileEnvVar = "KISMATIC_CONFIG"
+
+// Config is the configuration of kismatic that is not specific to a cluster
+type Config struct {
+	// Notifications about the progress of long-running operations
+	Notifications Notifications `yaml:"notifications"`
+	// FailureSignatures of known failures, that are explained when a task
+	// fails. They take precedence over the default failure signatures.
+	FailureSignatures []explain.FailureSignature `yaml:"failure_signatures"`
+}
+
+// Notifications configuration
+type Notifications struct {
+	// Webhooks that are notified when an operation starts, fails and completes
+	Webhooks []explain.Webhook `yaml:"webhooks"`
+}
+
+// DefaultConfigFile returns the location of the kismatic config file
+func DefaultConfigFile() string {
+	if f := os.Getenv(ConfigFileEnvVar); f != "" {
+		return f
+	}
+	home := os.Getenv("HOME")
+	return filepath.Join(home, ".kismatic", "config.yaml")
+}
+
+// ReadConfig reads the kismatic config file. An empty config is returned if
+// the file does not exist.
+func ReadConfig(file string) (*Config, error) {
+	c := &Config{}
+	d, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %v", err)
+	}
+	if err = yaml.Unmarshal(d, c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config file %q: %v", file, err)
+	}
+	for i, w := range c.Notifications.Webhooks {
+		if w.URL == "" {
+			return nil, fmt.Errorf("config file %q: notifications.webhooks[%d].url is required", file, i)
+		}
+		switch w.Format {
+		case "", explain.WebhookFormatGeneric, explain.WebhookFormatSlack:
+		default:
+			return nil, fmt.Errorf("config file %q: notifications.webhooks[%d].format %q is not supported, use %q or %q", file, i, w.Format, explain.WebhookFormatGeneric, explain.WebhookFormatSlack)
+		}
+	}
+	if _, err = explain.NewFailureCatalog(c.FailureSignatures); err != nil {
+		return nil, fmt.Errorf("config file %q: %v", file, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,57 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-read-config")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	file := filepath.Join(tmpDir, "config.yaml")
+
+	// a missing config file is an empty config
+	c, err := ReadConfig(file)
+	if err != nil {
+		t.Fatalf("unexpected error reading missing config: %v", err)
+	}
+	if len(c.Notifications.Webhooks) != 0 {
+		t.Errorf("expected no webhooks, got %v", c.Notifications.Webhooks)
+	}
+
+	tests := []struct {
+		config   string
+		valid    bool
+		webhooks int
+	}{
+		{
+			config:   "notifications:\n  webhooks:\n  - url: http://localhost/hook\n  - url: http://localhost/slack\n    format: slack\n",
+			valid:    true,
+			webhooks: 2,
+		},
+		{
+			config: "notifications:\n  webhooks:\n  - format: slack\n",
+		},
+		{
+			config: "notifications:\n  webhooks:\n  - url: http://localhost/hook\n    format: email\n",
+		},
+	}
+	for i, test := range tests {
+		if err = ioutil.WriteFile(file, []byte(test.config), 0644); err != nil {
+			t.Fatalf("error writing config: %v", err)
+		}
+		c, err = ReadConfig(file)
+		if test.valid != (err == nil) {
+			t.Errorf("test %d: expected valid to be %v, but got error %v", i, test.valid, err)
+			continue
+		}
+		if err == nil && len(c.Notifications.Webhooks) != test.webhooks {
+			t.Errorf("test %d: expected %d webhooks, got %d", i, test.webhooks, len(c.Notifications.Webhooks))
+		}
+	}
+}
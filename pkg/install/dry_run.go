@@ -0,0 +1,195 @@
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+const (
+	// dryRunPlaybook renders templates against the local machine
+	dryRunPlaybook = "dry-run.yaml"
+	// dryRunPlaybookList is the file in the dry run directory that lists
+	// the playbooks that would run, in order
+	dryRunPlaybookList = "playbooks.txt"
+)
+
+// dryRunTemplates are the groups of templates that are rendered during the
+// dry run of each playbook. Playbooks that are not listed do not deploy
+// any templates to the nodes.
+var dryRunTemplates = map[string][]string{
+	"kubernetes.yaml":               {"etcd", "master", "node", "cluster-services"},
+	"kubernetes-worker.yaml":        {"node"},
+	"upgrade-nodes.yaml":            {"etcd", "master", "node"},
+	"upgrade-cluster-services.yaml": {"cluster-services"},
+	"volume-add.yaml":               {"volume"},
+}
+
+// dryRun records the task in the dry run directory instead of running it.
+// The plan, the inventory and the cluster catalog of the task are written to
+// a directory of their own, along with the templates that the playbook would
+// deploy, rendered for each node. The templates are rendered by running
+// ansible against the local machine, the nodes are not contacted.
+func (ae *ansibleExecutor) dryRun(t task) error {
+	ae.dryRunTasks++
+	taskDir := filepath.Join(ae.options.DryRunDirectory, "tasks", fmt.Sprintf("%02d-%s", ae.dryRunTasks, t.name))
+	if err := os.MkdirAll(taskDir, 0777); err != nil {
+		return fmt.Errorf("error creating dry run directory for %q: %v", t.name, err)
+	}
+	fp := FilePlanner{File: filepath.Join(taskDir, "kismatic-cluster.yaml")}
+	if err := fp.Write(&t.plan); err != nil {
+		return fmt.Errorf("error recording plan file to %s: %v", fp.File, err)
+	}
+	inventoryFile := filepath.Join(taskDir, "inventory.ini")
+	if err := ioutil.WriteFile(inventoryFile, t.inventory.ToINI(), 0644); err != nil {
+		return fmt.Errorf("error writing inventory file to %q: %v", inventoryFile, err)
+	}
+	ccBytes, err := t.clusterCatalog.ToYAML()
+	if err != nil {
+		return err
+	}
+	ccFile := filepath.Join(taskDir, "clustercatalog.yaml")
+	if err = ioutil.WriteFile(ccFile, ccBytes, 0644); err != nil {
+		return fmt.Errorf("error writing cluster catalog file to %q: %v", ccFile, err)
+	}
+	if err = ae.recordDryRunPlaybook(taskDir, t); err != nil {
+		return err
+	}
+
+	templates, ok := dryRunTemplates[t.playbook]
+	if !ok {
+		util.PrettyPrintOk(ae.messagesOut(), "Recorded playbook %q in %q", t.playbook, taskDir)
+		return nil
+	}
+	return ae.renderTemplates(t, taskDir, templates)
+}
+
+// recordDryRunPlaybook appends the playbook of the task, and the nodes it
+// would run on, to the list of playbooks of the dry run
+func (ae *ansibleExecutor) recordDryRunPlaybook(taskDir string, t task) error {
+	listFile := filepath.Join(ae.options.DryRunDirectory, dryRunPlaybookList)
+	f, err := os.OpenFile(listFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening playbook list %q: %v", listFile, err)
+	}
+	defer f.Close()
+	nodes := "all"
+	if len(t.limit) > 0 {
+		nodes = strings.Join(t.limit, ",")
+	}
+	if _, err = fmt.Fprintf(f, "%s\t%s\t%s\n", filepath.Base(taskDir), t.playbook, nodes); err != nil {
+		return fmt.Errorf("error writing playbook list %q: %v", listFile, err)
+	}
+	return nil
+}
+
+// renderTemplates renders the given groups of templates into the "rendered"
+// directory of the task, in a directory per node
+func (ae *ansibleExecutor) renderTemplates(t task, taskDir string, templates []string) error {
+	renderedDir, err := filepath.Abs(filepath.Join(taskDir, "rendered"))
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path to %s: %v", filepath.Join(taskDir, "rendered"), err)
+	}
+	// the ansible log and the files recorded by the runner are kept apart
+	// from the files of the task
+	runDirectory := filepath.Join(taskDir, "render")
+	if err = os.MkdirAll(runDirectory, 0777); err != nil {
+		return fmt.Errorf("error creating directory %q: %v", runDirectory, err)
+	}
+	ansibleLogFilename := filepath.Join(runDirectory, "ansible.log")
+	ansibleLogFile, err := os.Create(ansibleLogFilename)
+	if err != nil {
+		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
+	}
+	defer ansibleLogFile.Close()
+
+	cc := t.clusterCatalog
+	cc.DryRunDirectory = renderedDir
+	cc.DryRunTemplates = templates
+	runner, explainer, err := ae.ansibleRunnerWithExplainer(ae.defaultExplainer(), ansibleLogFile, runDirectory)
+	if err != nil {
+		return err
+	}
+	var eventStream <-chan ansible.Event
+	if len(t.limit) != 0 {
+		eventStream, err = runner.StartPlaybookOnNode(dryRunPlaybook, t.inventory, cc, t.limit...)
+	} else {
+		eventStream, err = runner.StartPlaybook(dryRunPlaybook, t.inventory, cc)
+	}
+	if err != nil {
+		return fmt.Errorf("error running ansible playbook: %v", err)
+	}
+	explained := explainer.ExplainAsync(eventStream)
+	err = runner.WaitPlaybook()
+	<-explained
+	if err != nil {
+		return fmt.Errorf("error rendering the templates of playbook %q: %v. The ansible log can be found in %q", t.playbook, err, ansibleLogFilename)
+	}
+	util.PrettyPrintOk(ae.messagesOut(), "Rendered the templates of playbook %q in %q", t.playbook, renderedDir)
+	return nil
+}
+
+// PrepareDryRunDirectory creates the directory where the dry run bundle is
+// written, in a temporary directory if dir is empty. The existing certificates
+// in the generated assets directory are copied to the bundle, so that they are
+// reused as they would be in a real run. The private keys and the encryption
+// config must be removed with RemoveDryRunSecrets once the dry run is done.
+func PrepareDryRunDirectory(dir string, generatedAssetsDir string) (string, error) {
+	var err error
+	if dir == "" {
+		dir, err = ioutil.TempDir("", "kismatic-dry-run-")
+		if err != nil {
+			return "", fmt.Errorf("error creating temporary directory: %v", err)
+		}
+	}
+	keysDir := filepath.Join(dir, "keys")
+	if err = os.MkdirAll(keysDir, 0700); err != nil {
+		return "", fmt.Errorf("error creating directory %q: %v", keysDir, err)
+	}
+	existingKeysDir := filepath.Join(generatedAssetsDir, "keys")
+	files, err := ioutil.ReadDir(existingKeysDir)
+	if os.IsNotExist(err) {
+		return dir, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading certificates directory %q: %v", existingKeysDir, err)
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(existingKeysDir, f.Name()))
+		if err != nil {
+			return "", fmt.Errorf("error reading %q: %v", f.Name(), err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(keysDir, f.Name()), b, f.Mode()); err != nil {
+			return "", fmt.Errorf("error copying %q to the dry run directory: %v", f.Name(), err)
+		}
+	}
+	return dir, nil
+}
+
+// RemoveDryRunSecrets removes the private keys, including the key of the
+// Certificate Authority, and the encryption config from the dry run bundle,
+// so that the bundle can be shared with reviewers.
+func RemoveDryRunSecrets(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(info.Name(), "-key.pem") || info.Name() == encryptionConfigFilename {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("error removing %q from the dry run directory: %v", path, err)
+			}
+		}
+		return nil
+	})
+}
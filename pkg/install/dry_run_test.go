@@ -0,0 +1,148 @@
+package install
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+func TestDryRunRecordsTaskAndRendersTemplates(t *testing.T) {
+	dryRunDir := mustGetTempDir(t)
+	defer os.RemoveAll(dryRunDir)
+	runner := fakeRunner{}
+	e := ansibleExecutor{
+		options:             ExecutorOptions{DryRun: true, DryRunDirectory: dryRunDir},
+		stdout:              ioutil.Discard,
+		consoleOutputFormat: ansible.RawFormat,
+		runnerExplainerFactory: func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+			return &runner, &explain.AnsibleEventStreamExplainer{}, nil
+		},
+	}
+	plan := Plan{}
+	plan.Cluster.Name = "test"
+	tsk := task{
+		name:      "add-worker",
+		playbook:  "kubernetes-worker.yaml",
+		plan:      plan,
+		inventory: ansible.Inventory{Roles: []ansible.Role{{Name: "worker", Nodes: []ansible.Node{{Host: "worker01"}}}}},
+		limit:     []string{"worker01"},
+	}
+	if err := e.execute(tsk); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	taskDir := filepath.Join(dryRunDir, "tasks", "01-add-worker")
+	for _, f := range []string{"kismatic-cluster.yaml", "inventory.ini", "clustercatalog.yaml"} {
+		if _, err := os.Stat(filepath.Join(taskDir, f)); err != nil {
+			t.Errorf("expected %s to be recorded: %v", f, err)
+		}
+	}
+	playbooks, err := ioutil.ReadFile(filepath.Join(dryRunDir, dryRunPlaybookList))
+	if err != nil {
+		t.Fatalf("error reading playbook list: %v", err)
+	}
+	if expected := "01-add-worker\tkubernetes-worker.yaml\tworker01\n"; string(playbooks) != expected {
+		t.Errorf("expected playbook list %q, but got %q", expected, string(playbooks))
+	}
+	expectedRenderedDir, _ := filepath.Abs(filepath.Join(taskDir, "rendered"))
+	if runner.incomingCatalog.DryRunDirectory != expectedRenderedDir {
+		t.Errorf("expected templates to be rendered in %q, but got %q", expectedRenderedDir, runner.incomingCatalog.DryRunDirectory)
+	}
+	if !reflect.DeepEqual(runner.incomingCatalog.DryRunTemplates, []string{"node"}) {
+		t.Errorf("expected the node templates to be rendered, but got %v", runner.incomingCatalog.DryRunTemplates)
+	}
+}
+
+func TestDryRunPlaybookWithoutTemplates(t *testing.T) {
+	dryRunDir := mustGetTempDir(t)
+	defer os.RemoveAll(dryRunDir)
+	runner := fakeRunner{}
+	e := ansibleExecutor{
+		options:             ExecutorOptions{DryRun: true, DryRunDirectory: dryRunDir},
+		stdout:              ioutil.Discard,
+		consoleOutputFormat: ansible.RawFormat,
+		runnerExplainerFactory: func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error) {
+			return &runner, &explain.AnsibleEventStreamExplainer{}, nil
+		},
+	}
+	for _, playbook := range []string{"kubernetes.yaml", "smoketest.yaml"} {
+		if err := e.execute(task{name: strings.TrimSuffix(playbook, ".yaml"), playbook: playbook}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(runner.allNodesPlaybooks, []string{dryRunPlaybook}) {
+		t.Errorf("expected only the templates of kubernetes.yaml to be rendered, but ran %v", runner.allNodesPlaybooks)
+	}
+	playbooks, err := ioutil.ReadFile(filepath.Join(dryRunDir, dryRunPlaybookList))
+	if err != nil {
+		t.Fatalf("error reading playbook list: %v", err)
+	}
+	expected := "01-kubernetes\tkubernetes.yaml\tall\n02-smoketest\tsmoketest.yaml\tall\n"
+	if string(playbooks) != expected {
+		t.Errorf("expected playbook list %q, but got %q", expected, string(playbooks))
+	}
+}
+
+func TestPrepareDryRunDirectoryCopiesCertificates(t *testing.T) {
+	generatedDir := mustGetTempDir(t)
+	defer os.RemoveAll(generatedDir)
+	if err := os.MkdirAll(filepath.Join(generatedDir, "keys"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(generatedDir, "keys", "ca.pem"), []byte("ca"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := PrepareDryRunDirectory("", generatedDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "keys", "ca.pem"))
+	if err != nil {
+		t.Fatalf("expected the CA to be copied to the dry run directory: %v", err)
+	}
+	if string(b) != "ca" {
+		t.Errorf("unexpected contents of the copied CA: %q", string(b))
+	}
+}
+
+func TestRemoveDryRunSecrets(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	rendered := filepath.Join(dir, "tasks", "01-apply", "rendered", "master1")
+	if err := os.MkdirAll(filepath.Join(dir, "keys"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(rendered, 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]bool{
+		filepath.Join(dir, "keys", "ca.pem"):                 true,
+		filepath.Join(dir, "keys", "ca-key.pem"):             false,
+		filepath.Join(dir, "keys", "master1-key.pem"):        false,
+		filepath.Join(dir, "keys", "encryption-config.yaml"): false,
+		filepath.Join(rendered, "encryption-config.yaml"):    false,
+		filepath.Join(rendered, "kube-apiserver.yaml"):       true,
+		filepath.Join(dir, "playbooks.txt"):                  true,
+	}
+	for f := range files {
+		if err := ioutil.WriteFile(f, []byte("contents"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RemoveDryRunSecrets(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for f, kept := range files {
+		if _, err := os.Stat(f); (err == nil) != kept {
+			t.Errorf("expected %q to be kept: %v, but got %v", f, kept, err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package install
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	encryptionConfigFilename           = "encryption-config.yaml"
+	encryptionConfigChecksumAnnotation = "kismatic/encryption-config-checksum"
+	defaultEncryptionProvider          = "aescbc"
+)
+
+func encryptionProviders() []string {
+	return []string{"aescbc", "secretbox"}
+}
+
+// encryptionConfig is the EncryptionConfig of the API server
+type encryptionConfig struct {
+	Kind       string                `yaml:"kind"`
+	APIVersion string                `yaml:"apiVersion"`
+	Resources  []encryptionResources `yaml:"resources"`
+}
+
+type encryptionResources struct {
+	Resources []string             `yaml:"resources"`
+	Providers []encryptionProvider `yaml:"providers"`
+}
+
+type encryptionProvider struct {
+	AESCBC    *encryptionKeys `yaml:"aescbc,omitempty"`
+	Secretbox *encryptionKeys `yaml:"secretbox,omitempty"`
+	Identity  *struct{}       `yaml:"identity,omitempty"`
+}
+
+type encryptionKeys struct {
+	Keys []encryptionKey `yaml:"keys"`
+}
+
+// EncryptionKey is a key of the EncryptionConfig
+type EncryptionKey struct {
+	// Provider of the key, aescbc or secretbox
+	Provider string
+	// Name of the key
+	Name string
+	// Secret is the base64 encoded key
+	Secret string
+}
+
+type encryptionKey struct {
+	Name   string `yaml:"name"`
+	Secret string `yaml:"secret"`
+}
+
+// EncryptionConfigFile returns the path of the EncryptionConfig in the generated assets directory
+func EncryptionConfigFile(generatedAssetsDir string) string {
+	return filepath.Join(generatedAssetsDir, "keys", encryptionConfigFilename)
+}
+
+// newEncryptionKey returns a random 32 byte key of the provider, or of the default
+// provider if empty. The key is named after the number of the key, so that newer
+// keys can be told apart.
+func newEncryptionKey(provider string, number int) (*EncryptionKey, error) {
+	if provider == "" {
+		provider = defaultEncryptionProvider
+	}
+	if !util.Contains(provider, encryptionProviders()) {
+		return nil, fmt.Errorf("%q is not a valid encryption provider. Options are %v", provider, encryptionProviders())
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("error generating encryption key: %v", err)
+	}
+	return &EncryptionKey{Provider: provider, Name: "key" + strconv.Itoa(number), Secret: base64.StdEncoding.EncodeToString(secret)}, nil
+}
+
+// keyNumber returns the number of the key, or 0 if the key was not named by KET
+func keyNumber(k EncryptionKey) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(k.Name, "key"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// marshalEncryptionConfig returns the EncryptionConfig of the keys. The first key
+// is used to encrypt Secrets, and all keys are used to decrypt them. The identity
+// provider is always last, so that Secrets that were stored before encryption was
+// enabled can still be read.
+func marshalEncryptionConfig(keys []EncryptionKey) ([]byte, error) {
+	providers := []encryptionProvider{}
+	index := map[string]int{}
+	for _, k := range keys {
+		i, ok := index[k.Provider]
+		if !ok {
+			var p encryptionProvider
+			switch k.Provider {
+			case "aescbc":
+				p.AESCBC = &encryptionKeys{}
+			case "secretbox":
+				p.Secretbox = &encryptionKeys{}
+			default:
+				return nil, fmt.Errorf("%q is not a valid encryption provider. Options are %v", k.Provider, encryptionProviders())
+			}
+			i = len(providers)
+			index[k.Provider] = i
+			providers = append(providers, p)
+		}
+		key := encryptionKey{Name: k.Name, Secret: k.Secret}
+		if providers[i].AESCBC != nil {
+			providers[i].AESCBC.Keys = append(providers[i].AESCBC.Keys, key)
+		} else {
+			providers[i].Secretbox.Keys = append(providers[i].Secretbox.Keys, key)
+		}
+	}
+	providers = append(providers, encryptionProvider{Identity: &struct{}{}})
+	config := encryptionConfig{
+		Kind:       "EncryptionConfig",
+		APIVersion: "v1",
+		Resources:  []encryptionResources{{Resources: []string{"secrets"}, Providers: providers}},
+	}
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling encryption config: %v", err)
+	}
+	return b, nil
+}
+
+// unmarshalEncryptionConfig returns the keys of the EncryptionConfig, in the order
+// they are tried by the API server
+func unmarshalEncryptionConfig(b []byte) ([]EncryptionKey, error) {
+	config := encryptionConfig{}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("error unmarshalling encryption config: %v", err)
+	}
+	keys := []EncryptionKey{}
+	for _, r := range config.Resources {
+		for _, p := range r.Providers {
+			if p.AESCBC != nil {
+				for _, k := range p.AESCBC.Keys {
+					keys = append(keys, EncryptionKey{Provider: "aescbc", Name: k.Name, Secret: k.Secret})
+				}
+			}
+			if p.Secretbox != nil {
+				for _, k := range p.Secretbox.Keys {
+					keys = append(keys, EncryptionKey{Provider: "secretbox", Name: k.Name, Secret: k.Secret})
+				}
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("encryption config does not contain any key")
+	}
+	return keys, nil
+}
+
+// ReadEncryptionKeys returns the keys of the EncryptionConfig in the generated assets directory
+func ReadEncryptionKeys(generatedAssetsDir string) ([]EncryptionKey, error) {
+	file := EncryptionConfigFile(generatedAssetsDir)
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encryption config %q: %v", file, err)
+	}
+	return unmarshalEncryptionConfig(b)
+}
+
+// WriteEncryptionKeys writes the EncryptionConfig of the keys to the generated assets directory
+func WriteEncryptionKeys(generatedAssetsDir string, keys []EncryptionKey) error {
+	b, err := marshalEncryptionConfig(keys)
+	if err != nil {
+		return err
+	}
+	file := EncryptionConfigFile(generatedAssetsDir)
+	// the config contains the keys that encrypt the Secrets of the cluster
+	if err := ioutil.WriteFile(file, b, 0600); err != nil {
+		return fmt.Errorf("error writing encryption config %q: %v", file, err)
+	}
+	return nil
+}
+
+// validateEncryptionNotDisabled returns an error if encryption at rest is
+// disabled in the plan, but the EncryptionConfig of the cluster exists. The
+// API servers cannot read the Secrets that were encrypted without it.
+func validateEncryptionNotDisabled(p *Plan, generatedAssetsDir string) error {
+	if p.Cluster.EncryptionAtRest.Enabled {
+		return nil
+	}
+	file := EncryptionConfigFile(generatedAssetsDir)
+	if _, err := os.Stat(file); err != nil {
+		return nil
+	}
+	return fmt.Errorf("encryption at rest cannot be disabled, the Secrets of the cluster are encrypted with the keys of %q. "+
+		"Set cluster.encryption_at_rest.enabled to true in the plan file", file)
+}
+
+// GenerateEncryptionConfig generates the EncryptionConfig of the cluster with a new
+// key of the plan's provider, if it does not exist already
+func GenerateEncryptionConfig(p *Plan, generatedAssetsDir string) error {
+	if _, err := os.Stat(EncryptionConfigFile(generatedAssetsDir)); err == nil {
+		return nil
+	}
+	key, err := newEncryptionKey(p.Cluster.EncryptionAtRest.Provider, 1)
+	if err != nil {
+		return err
+	}
+	return WriteEncryptionKeys(generatedAssetsDir, []EncryptionKey{*key})
+}
+
+// encryptionConfigChecksum returns the checksum of the EncryptionConfig, that
+// is set on the API server pods so that they are restarted when the config changes
+func encryptionConfigChecksum(generatedAssetsDir string) (string, error) {
+	b, err := ioutil.ReadFile(EncryptionConfigFile(generatedAssetsDir))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// AddEncryptionKey adds a new key of the provider to the keys, after the key that is
+// used to encrypt Secrets. The API servers can decrypt Secrets with the new key once
+// they are restarted, before any of them encrypts Secrets with it. When a key was already
+// added by a rotation that did not complete, the keys are returned unchanged.
+func AddEncryptionKey(keys []EncryptionKey, provider string) ([]EncryptionKey, error) {
+	if len(keys) > 1 {
+		return keys, nil
+	}
+	max := 0
+	for _, k := range keys {
+		if n := keyNumber(k); n > max {
+			max = n
+		}
+	}
+	key, err := newEncryptionKey(provider, max+1)
+	if err != nil {
+		return nil, err
+	}
+	return append([]EncryptionKey{keys[0], *key}, keys[1:]...), nil
+}
+
+// newestEncryptionKey returns the index of the key with the highest number
+func newestEncryptionKey(keys []EncryptionKey) int {
+	newest := 0
+	for i, k := range keys {
+		if keyNumber(k) > keyNumber(keys[newest]) {
+			newest = i
+		}
+	}
+	return newest
+}
+
+// PromoteEncryptionKey moves the newest key first, so that it is used to encrypt Secrets
+func PromoteEncryptionKey(keys []EncryptionKey) []EncryptionKey {
+	newest := newestEncryptionKey(keys)
+	promoted := []EncryptionKey{keys[newest]}
+	for i, k := range keys {
+		if i != newest {
+			promoted = append(promoted, k)
+		}
+	}
+	return promoted
+}
+
+// RetireEncryptionKeys removes all keys but the one that is used to encrypt Secrets
+func RetireEncryptionKeys(keys []EncryptionKey) []EncryptionKey {
+	return keys[:1]
+}
+
+// WaitForEncryptionConfig waits until the API servers of all master nodes run with
+// the EncryptionConfig in the generated assets directory
+func WaitForEncryptionConfig(p *Plan, generatedAssetsDir string, podLister data.PodLister, timeout time.Duration) error {
+	checksum, err := encryptionConfigChecksum(generatedAssetsDir)
+	if err != nil {
+		return fmt.Errorf("error reading encryption config: %v", err)
+	}
+	return waitFor(timeout, 5*time.Second, func() error {
+		return apiServersConfigured(p, podLister, checksum)
+	})
+}
+
+// apiServersConfigured returns an error if the API server pod of a master node is
+// not running with the EncryptionConfig of the checksum
+func apiServersConfigured(p *Plan, podLister data.PodLister, checksum string) error {
+	pods, err := podLister.ListPods()
+	if err != nil {
+		return err
+	}
+	for _, n := range p.Master.Nodes {
+		configured := false
+		for _, pod := range pods.Items {
+			if pod.Namespace != "kube-system" || pod.Labels["component"] != "kube-apiserver" || !strings.EqualFold(pod.Spec.NodeName, n.Host) {
+				continue
+			}
+			configured = pod.Annotations[encryptionConfigChecksumAnnotation] == checksum && pod.Status.Phase == "Running"
+		}
+		if !configured {
+			return fmt.Errorf("the API server of node %q is not running with the new encryption config", n.Host)
+		}
+	}
+	return nil
+}
+
+// RewriteSecrets replaces all Secrets of the cluster with kubectl over SSH,
+// so that they are encrypted with the key that is used to encrypt Secrets
+func RewriteSecrets(client ssh.Client) error {
+	cmd := "sudo kubectl get secrets --all-namespaces -o json | sudo kubectl replace -f -"
+	if out, err := client.Output(true, cmd); err != nil {
+		return fmt.Errorf("error rewriting secrets: %v: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package install
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/data"
+)
+
+func TestMarshalEncryptionConfig(t *testing.T) {
+	keys := []EncryptionKey{
+		{Provider: "secretbox", Name: "key2", Secret: "c2Vjb25k"},
+		{Provider: "aescbc", Name: "key1", Secret: "Zmlyc3Q="},
+	}
+	b, err := marshalEncryptionConfig(keys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `kind: EncryptionConfig
+apiVersion: v1
+resources:
+- resources:
+  - secrets
+  providers:
+  - secretbox:
+      keys:
+      - name: key2
+        secret: c2Vjb25k
+  - aescbc:
+      keys:
+      - name: key1
+        secret: Zmlyc3Q=
+  - identity: {}
+`
+	if string(b) != expected {
+		t.Errorf("expected encryption config:\n%s\nbut got:\n%s", expected, b)
+	}
+	read, err := unmarshalEncryptionConfig(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertEqual(t, read, keys)
+
+	if _, err := marshalEncryptionConfig([]EncryptionKey{{Provider: "aesgcm", Name: "key1"}}); err == nil {
+		t.Error("expected an error for an unsupported provider")
+	}
+	if _, err := unmarshalEncryptionConfig([]byte("kind: EncryptionConfig\n")); err == nil {
+		t.Error("expected an error for a config without keys")
+	}
+}
+
+func TestGenerateEncryptionConfig(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "keys"), 0700); err != nil {
+		t.Fatalf("error creating keys dir: %v", err)
+	}
+	p := &Plan{Cluster: Cluster{EncryptionAtRest: EncryptionAtRest{Enabled: true}}}
+	if err := GenerateEncryptionConfig(p, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys, err := ReadEncryptionKeys(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Provider != "aescbc" || keys[0].Name != "key1" {
+		t.Fatalf("expected a single aescbc key, but got %+v", keys)
+	}
+	if secret, err := base64.StdEncoding.DecodeString(keys[0].Secret); err != nil || len(secret) != 32 {
+		t.Errorf("expected a base64 encoded 32 byte key, but got %q", keys[0].Secret)
+	}
+	if info, err := os.Stat(EncryptionConfigFile(dir)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the encryption config to be only readable by the owner, but got %v", info.Mode())
+	}
+
+	// the existing config is kept
+	before, _ := ioutil.ReadFile(EncryptionConfigFile(dir))
+	p.Cluster.EncryptionAtRest.Provider = "secretbox"
+	if err := GenerateEncryptionConfig(p, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, _ := ioutil.ReadFile(EncryptionConfigFile(dir))
+	if string(before) != string(after) {
+		t.Error("expected the existing encryption config to be kept")
+	}
+}
+
+func TestEncryptionCannotBeDisabled(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "keys"), 0700); err != nil {
+		t.Fatalf("error creating keys dir: %v", err)
+	}
+	p := &Plan{}
+	if err := validateEncryptionNotDisabled(p, dir); err != nil {
+		t.Errorf("unexpected error when encryption was never enabled: %v", err)
+	}
+	p.Cluster.EncryptionAtRest.Enabled = true
+	if err := GenerateEncryptionConfig(p, dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := validateEncryptionNotDisabled(p, dir); err != nil {
+		t.Errorf("unexpected error when encryption is enabled: %v", err)
+	}
+	p.Cluster.EncryptionAtRest.Enabled = false
+	if err := validateEncryptionNotDisabled(p, dir); err == nil {
+		t.Error("expected an error disabling encryption once the encryption config exists")
+	}
+	e := ansibleExecutor{options: ExecutorOptions{GeneratedAssetsDirectory: dir}}
+	if _, err := e.buildClusterCatalog(p); err == nil {
+		t.Error("expected the playbooks not to run with encryption disabled")
+	}
+}
+
+func TestRotateEncryptionKeys(t *testing.T) {
+	keys := []EncryptionKey{{Provider: "aescbc", Name: "key1", Secret: "Zmlyc3Q="}}
+	keys, err := AddEncryptionKey(keys, "secretbox")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Name != "key1" || keys[1].Name != "key2" || keys[1].Provider != "secretbox" {
+		t.Fatalf("expected the new key after the current key, but got %+v", keys)
+	}
+	// a rotation that did not complete is resumed with the key that was added
+	resumed, err := AddEncryptionKey(keys, "secretbox")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertEqual(t, resumed, keys)
+
+	keys = PromoteEncryptionKey(keys)
+	if keys[0].Name != "key2" || keys[1].Name != "key1" {
+		t.Fatalf("expected the new key to be first, but got %+v", keys)
+	}
+	assertEqual(t, PromoteEncryptionKey(keys), keys)
+
+	keys = RetireEncryptionKeys(keys)
+	if len(keys) != 1 || keys[0].Name != "key2" {
+		t.Fatalf("expected only the new key, but got %+v", keys)
+	}
+
+	if _, err := AddEncryptionKey(keys, "aesgcm"); err == nil {
+		t.Error("expected an error for an unsupported provider")
+	}
+}
+
+type fakePodLister data.PodList
+
+func (f *fakePodLister) ListPods() (*data.PodList, error) {
+	l := data.PodList(*f)
+	return &l, nil
+}
+
+func TestAPIServersConfigured(t *testing.T) {
+	p := &Plan{Master: MasterNodeGroup{Nodes: []Node{{Host: "Master1"}, {Host: "master2"}}}}
+	apiServer := func(node, checksum, phase string) data.Pod {
+		return data.Pod{
+			ObjectMeta: data.ObjectMeta{
+				Name:        "kube-apiserver-" + node,
+				Namespace:   "kube-system",
+				Labels:      map[string]string{"component": "kube-apiserver"},
+				Annotations: map[string]string{encryptionConfigChecksumAnnotation: checksum},
+			},
+			Spec:   data.PodSpec{NodeName: node},
+			Status: data.PodStatus{Phase: phase},
+		}
+	}
+	pods := &fakePodLister{Items: []data.Pod{apiServer("master1", "new", "Running"), apiServer("master2", "old", "Running")}}
+	if err := apiServersConfigured(p, pods, "new"); err == nil || !strings.Contains(err.Error(), "master2") {
+		t.Errorf("expected an error for master2, but got %v", err)
+	}
+	pods.Items[1] = apiServer("master2", "new", "Pending")
+	if err := apiServersConfigured(p, pods, "new"); err == nil {
+		t.Error("expected an error when the API server is not running")
+	}
+	pods.Items[1] = apiServer("master2", "new", "Running")
+	if err := apiServersConfigured(p, pods, "new"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRewriteSecrets(t *testing.T) {
+	client := &recordingSSHClient{}
+	if err := RewriteSecrets(client); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "sudo kubectl get secrets --all-namespaces -o json | sudo kubectl replace -f -"
+	if len(client.commands) != 1 || client.commands[0] != expected {
+		t.Errorf("expected command %q, but got %v", expected, client.commands)
+	}
+}
@@ -1,6 +1,7 @@
 package install
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -37,8 +38,15 @@ type Executor interface {
 	AddVolume(*Plan, StorageVolume) error
 	DeleteVolume(*Plan, string) error
 	UpgradeNodes(plan Plan, nodesToUpgrade []ListableNode, onlineUpgrade bool, maxParallelWorkers int) error
+	UpgradeNodeBatches(plan Plan, batches [][]ListableNode, onlineUpgrade bool) error
+	RollbackNode(plan Plan, node ListableNode) error
 	ValidateControlPlane(plan Plan) error
 	UpgradeClusterServices(plan Plan) error
+	// LockCluster takes the operation lock of the cluster for an operation
+	// that runs several tasks, so that no other run can start in between.
+	// The tasks run without taking the lock again until the returned
+	// function releases it.
+	LockCluster(plan Plan, operation string) (func() error, error)
 }
 
 // DiagnosticsExecutor will run diagnostics on the nodes after an install
@@ -62,8 +70,25 @@ type ExecutorOptions struct {
 	RunsDirectory string
 	// DiagnosticsDirecty is where the doDiagnostics information about the cluster will be dumped
 	DiagnosticsDirecty string
-	// DryRun determines if the executor should actually run the task
+	// DryRun records the tasks, and renders the templates they would deploy,
+	// in the DryRunDirectory instead of running them against the nodes
 	DryRun bool
+	// DryRunDirectory is where the tasks are recorded when DryRun is set
+	DryRunDirectory string
+	// Webhooks are notified when a task starts, fails and completes
+	Webhooks []explain.Webhook
+	// FailureSignatures are matched against failed tasks, in addition to
+	// the default failure signatures
+	FailureSignatures []explain.FailureSignature
+	// Profile prints the slowest tasks and the duration of every play
+	// once a task is done
+	Profile bool
+	// ForceUnlock removes the operation lock of the cluster, that is left
+	// behind by a run that did not complete
+	ForceUnlock bool
+	// EventCallback is called with every ansible event, tagged with the
+	// name of the task that is running
+	EventCallback func(explain.JSONEvent)
 }
 
 // NewExecutor returns an executor for performing installations according to the installation plan.
@@ -72,33 +97,37 @@ func NewExecutor(stdout io.Writer, errOut io.Writer, options ExecutorOptions) (E
 	if options.GeneratedAssetsDirectory == "" {
 		return nil, fmt.Errorf("GeneratedAssetsDirectory option cannot be empty")
 	}
+	if options.DryRun && options.DryRunDirectory == "" {
+		return nil, fmt.Errorf("DryRunDirectory option cannot be empty when DryRun is set")
+	}
 	if options.RunsDirectory == "" {
 		options.RunsDirectory = "./runs"
 	}
 
 	// Setup the console output format
-	var outFormat ansible.OutputFormat
-	switch options.OutputFormat {
-	case "raw":
-		outFormat = ansible.RawFormat
-	case "simple":
-		outFormat = ansible.JSONLinesFormat
-	default:
-		return nil, fmt.Errorf("Output format %q is not supported", options.OutputFormat)
+	outFormat, err := consoleOutputFormat(options.OutputFormat)
+	if err != nil {
+		return nil, err
 	}
 	certsDir := filepath.Join(options.GeneratedAssetsDirectory, "keys")
+	pkiLog := stdout
+	if outFormat == ansible.JSONFormat {
+		pkiLog = errOut
+	}
 	pki := &LocalPKI{
 		CACsr: filepath.Join(ansibleDir, "playbooks", "tls", "ca-csr.json"),
 		GeneratedCertsDirectory: certsDir,
-		Log: stdout,
+		Log: pkiLog,
 	}
 	return &ansibleExecutor{
 		options:             options,
 		stdout:              stdout,
+		errOut:              errOut,
 		consoleOutputFormat: outFormat,
 		ansibleDir:          ansibleDir,
 		certsDir:            certsDir,
 		pki:                 pki,
+		locker:              newOperationLocker(options.GeneratedAssetsDirectory, options.ForceUnlock),
 	}, nil
 }
 
@@ -109,19 +138,15 @@ func NewPreFlightExecutor(stdout io.Writer, errOut io.Writer, options ExecutorOp
 		options.RunsDirectory = "./runs"
 	}
 	// Setup the console output format
-	var outFormat ansible.OutputFormat
-	switch options.OutputFormat {
-	case "raw":
-		outFormat = ansible.RawFormat
-	case "simple":
-		outFormat = ansible.JSONLinesFormat
-	default:
-		return nil, fmt.Errorf("Output format %q is not supported", options.OutputFormat)
+	outFormat, err := consoleOutputFormat(options.OutputFormat)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ansibleExecutor{
 		options:             options,
 		stdout:              stdout,
+		errOut:              errOut,
 		consoleOutputFormat: outFormat,
 		ansibleDir:          ansibleDir,
 	}, nil
@@ -142,31 +167,48 @@ func NewDiagnosticsExecutor(stdout io.Writer, errOut io.Writer, options Executor
 	}
 
 	// Setup the console output format
-	var outFormat ansible.OutputFormat
-	switch options.OutputFormat {
-	case "raw":
-		outFormat = ansible.RawFormat
-	case "simple":
-		outFormat = ansible.JSONLinesFormat
-	default:
-		return nil, fmt.Errorf("Output format %q is not supported", options.OutputFormat)
+	outFormat, err := consoleOutputFormat(options.OutputFormat)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ansibleExecutor{
 		options:             options,
 		stdout:              stdout,
+		errOut:              errOut,
 		consoleOutputFormat: outFormat,
 		ansibleDir:          ansibleDir,
 	}, nil
 }
 
+// consoleOutputFormat returns the ansible output format for the given
+// executor output format
+func consoleOutputFormat(format string) (ansible.OutputFormat, error) {
+	switch format {
+	case "raw":
+		return ansible.RawFormat, nil
+	case "simple":
+		return ansible.JSONLinesFormat, nil
+	case "json":
+		return ansible.JSONFormat, nil
+	default:
+		return "", fmt.Errorf("Output format %q is not supported", format)
+	}
+}
+
 type ansibleExecutor struct {
 	options             ExecutorOptions
 	stdout              io.Writer
+	errOut              io.Writer
 	consoleOutputFormat ansible.OutputFormat
 	ansibleDir          string
 	certsDir            string
 	pki                 PKI
+	// number of tasks recorded in the dry run directory
+	dryRunTasks int
+	// takes the operation lock of the cluster before the tasks that modify
+	// it. Locking is disabled when nil.
+	locker *operationLocker
 
 	// Hook for testing purposes.. default implementation is used at runtime
 	runnerExplainerFactory func(explain.AnsibleEventExplainer, io.Writer) (ansible.Runner, *explain.AnsibleEventStreamExplainer, error)
@@ -187,13 +229,45 @@ type task struct {
 	plan Plan
 	// run the task on specific nodes
 	limit []string
+	// the task does not modify the cluster, and runs without taking the
+	// operation lock
+	readOnly bool
+}
+
+// LockCluster takes the operation lock of the cluster for the whole operation.
+// Nothing is locked during a dry run.
+func (ae *ansibleExecutor) LockCluster(plan Plan, operation string) (func() error, error) {
+	if ae.options.DryRun || ae.locker == nil {
+		return func() error { return nil }, nil
+	}
+	return ae.locker.hold(plan, operation)
 }
 
 // execute will run the given task, and setup all what's needed for us to run ansible.
+// The operation lock of the cluster is held while the task runs, unless the task
+// is read-only, or the lock is already held for the whole operation.
 func (ae *ansibleExecutor) execute(t task) error {
 	if ae.options.DryRun {
-		return nil
+		return ae.dryRun(t)
+	}
+	if t.readOnly || ae.locker == nil {
+		return ae.run(t)
 	}
+	release, err := ae.locker.lock(t.plan, t.name)
+	if err != nil {
+		return err
+	}
+	err = ae.run(t)
+	if releaseErr := release(); releaseErr != nil {
+		if err != nil {
+			return fmt.Errorf("%v. %v", err, releaseErr)
+		}
+		return releaseErr
+	}
+	return err
+}
+
+func (ae *ansibleExecutor) run(t task) error {
 	runDirectory, err := ae.createRunDirectory(t.name)
 	if err != nil {
 		return fmt.Errorf("error creating working directory for %q: %v", t.name, err)
@@ -210,7 +284,32 @@ func (ae *ansibleExecutor) execute(t task) error {
 	if err != nil {
 		return fmt.Errorf("error creating ansible log file %q: %v", ansibleLogFilename, err)
 	}
-	runner, explainer, err := ae.ansibleRunnerWithExplainer(t.explainer, ansibleLogFile, runDirectory)
+	eventExplainer := t.explainer
+	if ae.consoleOutputFormat == ansible.JSONFormat {
+		// the JSON events are tagged with the name of the task
+		eventExplainer = explain.JSONExplainer(ae.stdout, t.name)
+	}
+	if ae.options.EventCallback != nil {
+		eventExplainer = explain.MultiExplainer(eventExplainer, explain.CallbackExplainer(t.name, ae.options.EventCallback))
+	}
+	if len(ae.options.Webhooks) > 0 {
+		errOut := ae.errOut
+		if errOut == nil {
+			errOut = ioutil.Discard
+		}
+		webhookExplainer := explain.WebhookExplainer(ae.options.Webhooks, t.plan.Cluster.Name, t.name, runDirectory, errOut)
+		// deliver the queued notifications before the run returns
+		defer webhookExplainer.Flush()
+		eventExplainer = explain.MultiExplainer(eventExplainer, webhookExplainer)
+	}
+	catalog, err := ae.failureCatalog()
+	if err != nil {
+		return err
+	}
+	failureExplainer := explain.NewFailureSummaryExplainer(catalog)
+	timingExplainer := explain.NewTimingExplainer()
+	eventExplainer = explain.MultiExplainer(eventExplainer, failureExplainer, timingExplainer)
+	runner, explainer, err := ae.ansibleRunnerWithExplainer(eventExplainer, ansibleLogFile, runDirectory)
 	if err != nil {
 		return err
 	}
@@ -227,23 +326,84 @@ func (ae *ansibleExecutor) execute(t task) error {
 	}
 	// Ansible blocks until explainer starts reading from stream. Start
 	// explainer in a separate go routine
-	go explainer.Explain(eventStream)
+	explained := explainer.ExplainAsync(eventStream)
 
-	// Wait until ansible exits
-	if err = runner.WaitPlaybook(); err != nil {
+	// Wait until ansible exits, and the explainers have processed all the
+	// events, before reading their state
+	err = runner.WaitPlaybook()
+	<-explained
+	if timingsErr := ae.writeTimings(timingExplainer, t.name, runDirectory); timingsErr != nil {
+		if err != nil {
+			return fmt.Errorf("error running playbook: %v. %v", err, timingsErr)
+		}
+		return timingsErr
+	}
+	if err != nil {
+		if summaryErr := ae.writeFailureSummary(failureExplainer, runDirectory); summaryErr != nil {
+			return fmt.Errorf("error running playbook: %v. %v", err, summaryErr)
+		}
 		return fmt.Errorf("error running playbook: %v", err)
 	}
 	return nil
 }
 
+// writeTimings records the timings of the run in the run directory, and
+// prints the profile if requested
+func (ae *ansibleExecutor) writeTimings(timingExplainer *explain.TimingExplainer, taskName string, runDirectory string) error {
+	timings := timingExplainer.Timings()
+	b, err := json.MarshalIndent(timings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling timings: %v", err)
+	}
+	timingsFile := filepath.Join(runDirectory, "timings.json")
+	if err = ioutil.WriteFile(timingsFile, b, 0644); err != nil {
+		return fmt.Errorf("error writing timings file %q: %v", timingsFile, err)
+	}
+	if ae.options.Profile {
+		fmt.Fprintf(ae.messagesOut(), "\nProfile of %q\n", taskName)
+		return explain.WriteProfile(ae.messagesOut(), timings, 20)
+	}
+	return nil
+}
+
+// failureCatalog returns the catalog of known failures. The signatures set in
+// the options take precedence over the default ones.
+func (ae *ansibleExecutor) failureCatalog() (*explain.FailureCatalog, error) {
+	signatures := []explain.FailureSignature{}
+	signatures = append(signatures, ae.options.FailureSignatures...)
+	signatures = append(signatures, explain.DefaultFailureSignatures...)
+	return explain.NewFailureCatalog(signatures)
+}
+
+// writeFailureSummary explains the known failures that occurred during the run,
+// and records the explanation in the run directory
+func (ae *ansibleExecutor) writeFailureSummary(failureExplainer *explain.FailureSummaryExplainer, runDirectory string) error {
+	if len(failureExplainer.Failures()) == 0 {
+		return nil
+	}
+	fmt.Fprintln(ae.messagesOut())
+	failureExplainer.WriteSummary(ae.messagesOut())
+	summaryFile := filepath.Join(runDirectory, "failure-summary.txt")
+	f, err := os.Create(summaryFile)
+	if err != nil {
+		return fmt.Errorf("error creating failure summary file %q: %v", summaryFile, err)
+	}
+	defer f.Close()
+	failureExplainer.WriteSummary(f)
+	return nil
+}
+
 // GenerateCertificatesprivate generates keys and certificates for the cluster, if needed
 func (ae *ansibleExecutor) GenerateCertificates(p *Plan, useExistingCA bool) error {
+	if err := validateEncryptionNotDisabled(p, ae.options.GeneratedAssetsDirectory); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(ae.certsDir, 0777); err != nil {
 		return fmt.Errorf("error creating directory %s for storing TLS assets: %v", ae.certsDir, err)
 	}
 
 	// Generate cluster Certificate Authority
-	util.PrintHeader(ae.stdout, "Configuring Certificates", '=')
+	util.PrintHeader(ae.messagesOut(), "Configuring Certificates", '=')
 
 	var caCert *tls.CA
 	var err error
@@ -273,7 +433,13 @@ func (ae *ansibleExecutor) GenerateCertificates(p *Plan, useExistingCA bool) err
 		return fmt.Errorf("error generating certificates for the cluster: %v", err)
 	}
 
-	util.PrettyPrintOk(ae.stdout, "Cluster certificates can be found in the %q directory", ae.options.GeneratedAssetsDirectory)
+	if p.Cluster.EncryptionAtRest.Enabled {
+		if err = GenerateEncryptionConfig(p, ae.options.GeneratedAssetsDirectory); err != nil {
+			return fmt.Errorf("error generating encryption config for the cluster: %v", err)
+		}
+	}
+
+	util.PrettyPrintOk(ae.messagesOut(), "Cluster certificates can be found in the %q directory", ae.options.GeneratedAssetsDirectory)
 	return nil
 }
 
@@ -292,7 +458,7 @@ func (ae *ansibleExecutor) Install(p *Plan) error {
 		clusterCatalog: *cc,
 		explainer:      ae.defaultExplainer(),
 	}
-	util.PrintHeader(ae.stdout, "Installing Cluster", '=')
+	util.PrintHeader(ae.messagesOut(), "Installing Cluster", '=')
 	return ae.execute(t)
 }
 
@@ -308,8 +474,9 @@ func (ae *ansibleExecutor) RunSmokeTest(p *Plan) error {
 		plan:           *p,
 		inventory:      buildInventoryFromPlan(p),
 		clusterCatalog: *cc,
+		readOnly:       true,
 	}
-	util.PrintHeader(ae.stdout, "Running Smoke Test", '=')
+	util.PrintHeader(ae.messagesOut(), "Running Smoke Test", '=')
 	return ae.execute(t)
 }
 
@@ -330,6 +497,7 @@ func (ae *ansibleExecutor) RunPreFlightCheck(p *Plan) error {
 		clusterCatalog: *cc,
 		explainer:      ae.preflightExplainer(),
 		plan:           *p,
+		readOnly:       true,
 	}
 	return ae.execute(t)
 }
@@ -354,6 +522,7 @@ func (ae *ansibleExecutor) RunNewWorkerPreFlightCheck(p Plan, node Node) error {
 		explainer:      ae.preflightExplainer(),
 		plan:           p,
 		limit:          []string{node.Host},
+		readOnly:       true,
 	}
 	return ae.execute(t)
 }
@@ -376,6 +545,7 @@ func (ae *ansibleExecutor) RunUpgradePreFlightCheck(p *Plan, node ListableNode)
 		inventory:      inventory,
 		clusterCatalog: *cc,
 		limit:          []string{node.Node.Host},
+		readOnly:       true,
 	}
 	return ae.execute(t)
 }
@@ -449,7 +619,7 @@ func (ae *ansibleExecutor) AddVolume(plan *Plan, volume StorageVolume) error {
 		clusterCatalog: *cc,
 		explainer:      ae.defaultExplainer(),
 	}
-	util.PrintHeader(ae.stdout, "Add Persistent Storage Volume", '=')
+	util.PrintHeader(ae.messagesOut(), "Add Persistent Storage Volume", '=')
 	return ae.execute(t)
 }
 
@@ -470,7 +640,7 @@ func (ae *ansibleExecutor) DeleteVolume(plan *Plan, name string) error {
 		clusterCatalog: *cc,
 		explainer:      ae.defaultExplainer(),
 	}
-	util.PrintHeader(ae.stdout, "Delete Persistent Storage Volume", '=')
+	util.PrintHeader(ae.messagesOut(), "Delete Persistent Storage Volume", '=')
 	return ae.execute(t)
 }
 
@@ -484,61 +654,15 @@ func (ae *ansibleExecutor) DeleteVolume(plan *Plan, name string) error {
 // the etcd components and the master components will be upgraded when we are in the upgrade etcd nodes
 // phase.
 func (ae *ansibleExecutor) UpgradeNodes(plan Plan, nodesToUpgrade []ListableNode, onlineUpgrade bool, maxParallelWorkers int) error {
-	// Nodes can have multiple roles. For this reason, we need to keep track of which nodes
-	// have been upgraded to avoid re-upgrading them.
-	upgradedNodes := map[string]bool{}
-	// Upgrade etcd nodes
-	for _, nodeToUpgrade := range nodesToUpgrade {
-		for _, role := range nodeToUpgrade.Roles {
-			if role == "etcd" {
-				node := nodeToUpgrade
-				if err := ae.upgradeNodes(plan, onlineUpgrade, node); err != nil {
-					return fmt.Errorf("error upgrading node %q: %v", node.Node.Host, err)
-				}
-				upgradedNodes[node.Node.IP] = true
-				break
-			}
-		}
-	}
-
-	// Upgrade master nodes
-	for _, nodeToUpgrade := range nodesToUpgrade {
-		if upgradedNodes[nodeToUpgrade.Node.IP] == true {
-			continue
-		}
-		for _, role := range nodeToUpgrade.Roles {
-			if role == "master" {
-				node := nodeToUpgrade
-				if err := ae.upgradeNodes(plan, onlineUpgrade, node); err != nil {
-					return fmt.Errorf("error upgrading node %q: %v", node.Node.Host, err)
-				}
-				upgradedNodes[node.Node.IP] = true
-				break
-			}
-		}
-	}
+	return ae.UpgradeNodeBatches(plan, UpgradeBatches(nodesToUpgrade, maxParallelWorkers), onlineUpgrade)
+}
 
-	var limitNodes []ListableNode
-	// Upgrade the rest of the nodes
-	for n, nodeToUpgrade := range nodesToUpgrade {
-		if upgradedNodes[nodeToUpgrade.Node.IP] == true {
-			continue
-		}
-		for _, role := range nodeToUpgrade.Roles {
-			if role != "etcd" && role != "master" {
-				node := nodeToUpgrade
-				limitNodes = append(limitNodes, node)
-				// don't forget to run the remaining nodes if its < maxParallelWorkers
-				if len(limitNodes) == maxParallelWorkers || n == len(nodesToUpgrade)-1 {
-					if err := ae.upgradeNodes(plan, onlineUpgrade, limitNodes...); err != nil {
-						return fmt.Errorf("error upgrading node %q: %v", node.Node.Host, err)
-					}
-					// empty the slice
-					limitNodes = limitNodes[:0]
-				}
-				upgradedNodes[node.Node.IP] = true
-				break
-			}
+// UpgradeNodeBatches upgrades the batches of nodes in order. The nodes of a
+// batch are upgraded in parallel.
+func (ae *ansibleExecutor) UpgradeNodeBatches(plan Plan, batches [][]ListableNode, onlineUpgrade bool) error {
+	for _, batch := range batches {
+		if err := ae.upgradeNodes(plan, onlineUpgrade, batch...); err != nil {
+			return fmt.Errorf("error upgrading node %q: %v", batch[len(batch)-1].Node.Host, err)
 		}
 	}
 	return nil
@@ -567,11 +691,32 @@ func (ae *ansibleExecutor) upgradeNodes(plan Plan, onlineUpgrade bool, nodes ...
 		limit:          limit,
 	}
 	if len(limit) == 1 {
-		util.PrintHeader(ae.stdout, fmt.Sprintf("Upgrade Node: %s %s", limit, nodes[0].Roles), '=')
+		util.PrintHeader(ae.messagesOut(), fmt.Sprintf("Upgrade Node: %s %s", limit, nodes[0].Roles), '=')
 	} else { // print the roles for multiple nodes
-		util.PrintHeader(ae.stdout, "Upgrade Nodes:", '=')
-		util.PrintTable(ae.stdout, nodeRoles)
+		util.PrintHeader(ae.messagesOut(), "Upgrade Nodes:", '=')
+		util.PrintTable(ae.messagesOut(), nodeRoles)
+	}
+	return ae.execute(t)
+}
+
+// RollbackNode restores the snapshot taken before the node was upgraded, and
+// uncordons the node
+func (ae *ansibleExecutor) RollbackNode(plan Plan, node ListableNode) error {
+	inventory := buildInventoryFromPlan(&plan)
+	cc, err := ae.buildClusterCatalog(&plan)
+	if err != nil {
+		return err
+	}
+	t := task{
+		name:           "upgrade-rollback",
+		playbook:       "upgrade-rollback.yaml",
+		inventory:      inventory,
+		clusterCatalog: *cc,
+		plan:           plan,
+		explainer:      ae.defaultExplainer(),
+		limit:          []string{node.Node.Host},
 	}
+	util.PrintHeader(ae.messagesOut(), fmt.Sprintf("Roll Back Node: %s %s", node.Node.Host, node.Roles), '=')
 	return ae.execute(t)
 }
 
@@ -588,6 +733,7 @@ func (ae *ansibleExecutor) ValidateControlPlane(plan Plan) error {
 		clusterCatalog: *cc,
 		plan:           plan,
 		explainer:      ae.defaultExplainer(),
+		readOnly:       true,
 	}
 	return ae.execute(t)
 }
@@ -626,6 +772,7 @@ func (ae *ansibleExecutor) DiagnoseNodes(plan Plan) error {
 		clusterCatalog: *cc,
 		plan:           plan,
 		explainer:      ae.defaultExplainer(),
+		readOnly:       true,
 	}
 	return ae.execute(t)
 }
@@ -720,6 +867,60 @@ func (ae *ansibleExecutor) buildClusterCatalog(p *Plan) (*ansible.ClusterCatalog
 	cc.CloudProvider = p.Cluster.CloudProvider.Provider
 	cc.CloudConfig = p.Cluster.CloudProvider.Config
 
+	if oidc := p.Cluster.Authentication.OIDC; oidc.IssuerURL != "" {
+		cc.OIDC.IssuerURL = oidc.IssuerURL
+		cc.OIDC.ClientID = oidc.ClientID
+		cc.OIDC.UsernameClaim = oidc.UsernameClaim
+		cc.OIDC.GroupsClaim = oidc.GroupsClaim
+		if oidc.CAFile != "" {
+			// absolute path required for ansible
+			caFile, err := filepath.Abs(oidc.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to determine absolute path to %s: %v", oidc.CAFile, err)
+			}
+			cc.OIDC.CAFile = caFile
+		}
+	}
+
+	if audit := p.Cluster.Audit; audit.Enabled {
+		cc.Audit.Enabled = true
+		cc.Audit.LogPath = audit.LogPath
+		cc.Audit.LogMaxAge = audit.LogMaxAge
+		cc.Audit.LogMaxSize = audit.LogMaxSize
+		cc.Audit.LogMaxBackups = audit.LogMaxBackups
+		if audit.WebhookConfigFile == "" && audit.LogPath == "" {
+			cc.Audit.LogPath = defaultAuditLogPath
+		}
+		// absolute paths required for ansible
+		if audit.PolicyFile != "" {
+			policyFile, err := filepath.Abs(audit.PolicyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to determine absolute path to %s: %v", audit.PolicyFile, err)
+			}
+			cc.Audit.PolicyFile = policyFile
+		}
+		if audit.WebhookConfigFile != "" {
+			webhookConfigFile, err := filepath.Abs(audit.WebhookConfigFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to determine absolute path to %s: %v", audit.WebhookConfigFile, err)
+			}
+			cc.Audit.WebhookConfigFile = webhookConfigFile
+		}
+	}
+
+	if err := validateEncryptionNotDisabled(p, ae.options.GeneratedAssetsDirectory); err != nil {
+		return nil, err
+	}
+	if p.Cluster.EncryptionAtRest.Enabled {
+		cc.EncryptionAtRest.Enabled = true
+		// the config does not exist before the certificates are generated
+		checksum, err := encryptionConfigChecksum(ae.options.GeneratedAssetsDirectory)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading encryption config: %v", err)
+		}
+		cc.EncryptionAtRest.ConfigChecksum = checksum
+	}
+
 	// add_ons
 	cc.RunPodValidation = p.NetworkConfigured()
 	// CNI
@@ -781,12 +982,22 @@ func (ae *ansibleExecutor) buildClusterCatalog(p *Plan) (*ansible.ClusterCatalog
 		cc.KubeletNodeOptions[n.Host] = n.KubeletOptions.Overrides
 	}
 
+	// setup control plane node overrides
+	cc.APIServerNodeOptions = make(map[string]map[string]string)
+	cc.KubeControllerManagerNodeOptions = make(map[string]map[string]string)
+	cc.KubeSchedulerNodeOptions = make(map[string]map[string]string)
+	for _, n := range p.Master.Nodes {
+		cc.APIServerNodeOptions[n.Host] = n.APIServerOptions.Overrides
+		cc.KubeControllerManagerNodeOptions[n.Host] = n.KubeControllerManagerOptions.Overrides
+		cc.KubeSchedulerNodeOptions[n.Host] = n.KubeSchedulerOptions.Overrides
+	}
+
 	return &cc, nil
 }
 
 func (ae *ansibleExecutor) createRunDirectory(runName string) (string, error) {
 	start := time.Now()
-	runDirectory := filepath.Join(ae.options.RunsDirectory, runName, start.Format("2006-01-02-15-04-05"))
+	runDirectory := filepath.Join(ae.options.RunsDirectory, runName, start.Format(runTimestampFormat))
 	if err := os.MkdirAll(runDirectory, 0777); err != nil {
 		return "", fmt.Errorf("error creating directory: %v", err)
 	}
@@ -801,7 +1012,7 @@ func (ae *ansibleExecutor) ansibleRunnerWithExplainer(explainer explain.AnsibleE
 	// Setup sink for ansible stdout
 	var ansibleOut io.Writer
 	switch ae.consoleOutputFormat {
-	case ansible.JSONLinesFormat:
+	case ansible.JSONLinesFormat, ansible.JSONFormat:
 		ansibleOut = timestampWriter(ansibleLog)
 	case ansible.RawFormat:
 		ansibleOut = io.MultiWriter(ae.stdout, timestampWriter(ansibleLog))
@@ -820,12 +1031,25 @@ func (ae *ansibleExecutor) ansibleRunnerWithExplainer(explainer explain.AnsibleE
 	return runner, streamExplainer, nil
 }
 
+// messagesOut returns the writer for the output that is not an Ansible event.
+// In JSON mode, stdout only contains the events so that it can be parsed by
+// other programs, and the messages are written to errOut.
+func (ae *ansibleExecutor) messagesOut() io.Writer {
+	if ae.consoleOutputFormat != ansible.JSONFormat {
+		return ae.stdout
+	}
+	if ae.errOut == nil {
+		return ioutil.Discard
+	}
+	return ae.errOut
+}
+
 func (ae *ansibleExecutor) defaultExplainer() explain.AnsibleEventExplainer {
 	var out io.Writer
 	switch ae.consoleOutputFormat {
 	case ansible.JSONLinesFormat:
 		out = ae.stdout
-	case ansible.RawFormat:
+	case ansible.RawFormat, ansible.JSONFormat:
 		out = ioutil.Discard
 	}
 	return explain.DefaultExplainer(ae.options.Verbose, out)
@@ -836,7 +1060,7 @@ func (ae *ansibleExecutor) preflightExplainer() explain.AnsibleEventExplainer {
 	switch ae.consoleOutputFormat {
 	case ansible.JSONLinesFormat:
 		out = ae.stdout
-	case ansible.RawFormat:
+	case ansible.RawFormat, ansible.JSONFormat:
 		out = ioutil.Discard
 	}
 	return explain.PreflightExplainer(ae.options.Verbose, out)
@@ -16,7 +16,33 @@ func (e *AnsibleEventStreamExplainer) Explain(events <-chan ansible.Event) error
 	return nil
 }
 
+// ExplainAsync explains the incoming ansible event stream in a separate go
+// routine. The returned channel is closed once all the events of the stream
+// have been explained.
+func (e *AnsibleEventStreamExplainer) ExplainAsync(events <-chan ansible.Event) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		e.Explain(events)
+		close(done)
+	}()
+	return done
+}
+
 // AnsibleEventExplainer explains a single event
 type AnsibleEventExplainer interface {
 	ExplainEvent(e ansible.Event)
 }
+
+// MultiExplainer returns an explainer that passes every event to all the
+// given explainers, in order
+func MultiExplainer(explainers ...AnsibleEventExplainer) AnsibleEventExplainer {
+	return multiExplainer(explainers)
+}
+
+type multiExplainer []AnsibleEventExplainer
+
+func (m multiExplainer) ExplainEvent(e ansible.Event) {
+	for _, exp := range m {
+		exp.ExplainEvent(e)
+	}
+}
@@ -0,0 +1,32 @@
+package explain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+type slowExplainer struct {
+	explained int
+}
+
+func (e *slowExplainer) ExplainEvent(ansible.Event) {
+	time.Sleep(10 * time.Millisecond)
+	e.explained++
+}
+
+func TestExplainAsyncWaitsForAllEvents(t *testing.T) {
+	exp := &slowExplainer{}
+	streamExplainer := &AnsibleEventStreamExplainer{EventExplainer: exp}
+	events := make(chan ansible.Event)
+	done := streamExplainer.ExplainAsync(events)
+	for i := 0; i < 3; i++ {
+		events <- &ansible.PlaybookEndEvent{}
+	}
+	close(events)
+	<-done
+	if exp.explained != 3 {
+		t.Errorf("expected 3 events to be explained, but got %d", exp.explained)
+	}
+}
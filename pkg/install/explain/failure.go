@@ -0,0 +1,184 @@
+package explain
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+// FailureSignature describes a known failure, and how to resolve it
+type FailureSignature struct {
+	// Name of the failure
+	Name string `yaml:"name"`
+	// Task is a regular expression matched against the name of the failed
+	// ansible task. An empty expression matches all tasks.
+	Task string `yaml:"task"`
+	// Output is a regular expression matched against the message, stdout
+	// and stderr of the failed task.
+	Output string `yaml:"output"`
+	// Explanation of the failure in terms of the cluster
+	Explanation string `yaml:"explanation"`
+	// Suggestion of how to resolve the failure, usually a kismatic command
+	Suggestion string `yaml:"suggestion"`
+}
+
+// DefaultFailureSignatures are the failures that are known to happen when
+// installing or upgrading a cluster
+var DefaultFailureSignatures = []FailureSignature{
+	{
+		Name:        "yum-lock",
+		Output:      `(?i)(another app is currently holding the yum lock|existing lock /var/run/yum\.pid)`,
+		Explanation: "Another process is holding the yum lock on the node. This is usually an automatic update that is running in the background.",
+		Suggestion:  `Wait for the other yum process to finish, then run "kismatic install apply" again`,
+	},
+	{
+		Name:        "apt-lock",
+		Output:      `(?i)could not get lock /var/lib/dpkg/lock`,
+		Explanation: "Another process is holding the dpkg lock on the node. This is usually an automatic update that is running in the background.",
+		Suggestion:  `Wait for the other apt process to finish, then run "kismatic install apply" again`,
+	},
+	{
+		Name:        "registry-unauthorized",
+		Task:        `(?i)(docker|image|pull|registry|seed)`,
+		Output:      `(?i)(401 unauthorized|unauthorized: authentication required|unauthorized: incorrect username or password)`,
+		Explanation: "The container image registry rejected the credentials of the node.",
+		Suggestion:  `Verify the docker_registry username and password in the plan file, then run "kismatic install apply" again`,
+	},
+	{
+		Name:        "etcd-cluster-id-mismatch",
+		Task:        `(?i)etcd`,
+		Output:      `(?i)cluster ?id mismatch`,
+		Explanation: "The etcd member belongs to a different etcd cluster. This usually happens when the etcd data directory was left over from a previous installation.",
+		Suggestion:  `Remove the etcd data directory (/var/lib/etcd_k8s and /var/lib/etcd_networking) from the node, then run "kismatic install step _etcd-k8s.yaml"`,
+	},
+	{
+		Name:        "apiserver-port-in-use",
+		Task:        `(?i)(api ?server|master|kube)`,
+		Output:      `(?i)(6443.*address already in use|address already in use.*6443)`,
+		Explanation: "The port of the Kubernetes API server is already in use by another process on the node.",
+		Suggestion:  `Stop the process that is listening on port 6443, then run "kismatic install validate" to verify the node is ready`,
+	},
+	{
+		Name:        "disk-full",
+		Output:      `(?i)no space left on device`,
+		Explanation: "The node ran out of disk space.",
+		Suggestion:  `Free up disk space on the node, then run "kismatic install validate" to verify the node is ready`,
+	},
+}
+
+type compiledSignature struct {
+	FailureSignature
+	task   *regexp.Regexp
+	output *regexp.Regexp
+}
+
+// FailureCatalog matches failed tasks against known failure signatures
+type FailureCatalog struct {
+	signatures []compiledSignature
+}
+
+// NewFailureCatalog returns a catalog containing the given signatures.
+// Signatures are matched in order, and the first match wins.
+func NewFailureCatalog(signatures []FailureSignature) (*FailureCatalog, error) {
+	c := &FailureCatalog{}
+	for _, s := range signatures {
+		if s.Output == "" {
+			return nil, fmt.Errorf("failure signature %q: output expression is required", s.Name)
+		}
+		output, err := regexp.Compile(s.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failure signature %q: invalid output expression: %v", s.Name, err)
+		}
+		task, err := regexp.Compile(s.Task)
+		if err != nil {
+			return nil, fmt.Errorf("failure signature %q: invalid task expression: %v", s.Name, err)
+		}
+		c.signatures = append(c.signatures, compiledSignature{FailureSignature: s, task: task, output: output})
+	}
+	return c, nil
+}
+
+// Match returns the signature that matches the failed task, if any
+func (c *FailureCatalog) Match(task, output string) (*FailureSignature, bool) {
+	for _, s := range c.signatures {
+		if s.task.MatchString(task) && s.output.MatchString(output) {
+			sig := s.FailureSignature
+			return &sig, true
+		}
+	}
+	return nil, false
+}
+
+// KnownFailure is a failed task that matched a failure signature
+type KnownFailure struct {
+	Host      string
+	Task      string
+	Signature FailureSignature
+}
+
+// FailureSummaryExplainer collects the failed tasks that match a known failure
+// signature, so that they can be explained once the playbook is done
+type FailureSummaryExplainer struct {
+	catalog     *FailureCatalog
+	currentTask string
+	failures    []KnownFailure
+}
+
+// NewFailureSummaryExplainer returns an explainer that matches failed tasks
+// against the catalog
+func NewFailureSummaryExplainer(catalog *FailureCatalog) *FailureSummaryExplainer {
+	return &FailureSummaryExplainer{catalog: catalog}
+}
+
+// ExplainEvent matches the failed tasks against the catalog
+func (e *FailureSummaryExplainer) ExplainEvent(ansibleEvent ansible.Event) {
+	switch event := ansibleEvent.(type) {
+	case *ansible.TaskStartEvent:
+		e.currentTask = event.Name
+	case *ansible.HandlerTaskStartEvent:
+		e.currentTask = event.Name
+	case *ansible.RunnerFailedEvent:
+		if !event.IgnoreErrors {
+			e.match(event.Host, event.Result.Message, event.Result.Stdout, event.Result.Stderr)
+		}
+	case *ansible.RunnerItemFailedEvent:
+		if !event.IgnoreErrors {
+			e.match(event.Host, event.Result.Message, event.Result.Stdout, event.Result.Stderr)
+		}
+	}
+}
+
+func (e *FailureSummaryExplainer) match(host, message, stdout, stderr string) {
+	sig, ok := e.catalog.Match(e.currentTask, message+"\n"+stdout+"\n"+stderr)
+	if !ok {
+		return
+	}
+	// The same failure can be reported for every item of a task
+	for _, f := range e.failures {
+		if f.Host == host && f.Signature.Name == sig.Name {
+			return
+		}
+	}
+	e.failures = append(e.failures, KnownFailure{Host: host, Task: e.currentTask, Signature: *sig})
+}
+
+// Failures returns the known failures that were found
+func (e *FailureSummaryExplainer) Failures() []KnownFailure {
+	return e.failures
+}
+
+// WriteSummary writes the explanation of the known failures that were found
+func (e *FailureSummaryExplainer) WriteSummary(out io.Writer) {
+	if len(e.failures) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "The following known failures were detected:")
+	for _, f := range e.failures {
+		fmt.Fprintf(out, "- %s: task %q failed: %s\n", f.Host, f.Task, f.Signature.Explanation)
+		if f.Signature.Suggestion != "" {
+			fmt.Fprintf(out, "  Suggestion: %s\n", f.Signature.Suggestion)
+		}
+	}
+}
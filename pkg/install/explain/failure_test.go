@@ -0,0 +1,118 @@
+package explain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestDefaultFailureSignatures(t *testing.T) {
+	catalog, err := NewFailureCatalog(DefaultFailureSignatures)
+	if err != nil {
+		t.Fatalf("error creating catalog: %v", err)
+	}
+	tests := []struct {
+		task     string
+		output   string
+		expected string
+	}{
+		{
+			task:     "install kubernetes packages",
+			output:   "Existing lock /var/run/yum.pid: another copy is running as pid 1234.",
+			expected: "yum-lock",
+		},
+		{
+			task:     "install docker",
+			output:   "E: Could not get lock /var/lib/dpkg/lock - open (11: Resource temporarily unavailable)",
+			expected: "apt-lock",
+		},
+		{
+			task:     "pull kube-proxy image",
+			output:   "Error response from daemon: Get https://registry:8443/v2/kube-proxy/manifests/v1.6.0: unauthorized: authentication required",
+			expected: "registry-unauthorized",
+		},
+		{
+			task:     "verify etcd is healthy",
+			output:   "rafthttp: request cluster ID mismatch (got 1b3a88599e79f82b want 8a9b2d1f5e6c7d3e)",
+			expected: "etcd-cluster-id-mismatch",
+		},
+		{
+			task:     "start kube-apiserver",
+			output:   "failed to listen on 0.0.0.0:6443: listen tcp 0.0.0.0:6443: bind: address already in use",
+			expected: "apiserver-port-in-use",
+		},
+		{
+			task:   "verify etcd is healthy",
+			output: "connection refused",
+		},
+		{
+			// the task does not match the signature
+			task:   "copy certificates",
+			output: "unauthorized: authentication required",
+		},
+	}
+	for _, test := range tests {
+		sig, ok := catalog.Match(test.task, test.output)
+		if test.expected == "" {
+			if ok {
+				t.Errorf("task %q: expected no match, but got %q", test.task, sig.Name)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("task %q: expected %q to match, but got no match", test.task, test.expected)
+			continue
+		}
+		if sig.Name != test.expected {
+			t.Errorf("task %q: expected %q to match, but got %q", test.task, test.expected, sig.Name)
+		}
+	}
+}
+
+func TestNewFailureCatalogInvalidSignature(t *testing.T) {
+	if _, err := NewFailureCatalog([]FailureSignature{{Name: "bad", Output: "("}}); err == nil {
+		t.Errorf("expected an error with an invalid output expression")
+	}
+	if _, err := NewFailureCatalog([]FailureSignature{{Name: "empty"}}); err == nil {
+		t.Errorf("expected an error with an empty output expression")
+	}
+}
+
+func TestFailureSummaryExplainer(t *testing.T) {
+	catalog, err := NewFailureCatalog(DefaultFailureSignatures)
+	if err != nil {
+		t.Fatalf("error creating catalog: %v", err)
+	}
+	exp := NewFailureSummaryExplainer(catalog)
+
+	taskStart := &ansible.TaskStartEvent{}
+	taskStart.Name = "install docker"
+	itemFailed := &ansible.RunnerItemFailedEvent{}
+	itemFailed.Host = "worker01"
+	itemFailed.Result.Stderr = "E: Could not get lock /var/lib/dpkg/lock"
+	ignored := &ansible.RunnerFailedEvent{}
+	ignored.Host = "worker02"
+	ignored.IgnoreErrors = true
+	ignored.Result.Stderr = "E: Could not get lock /var/lib/dpkg/lock"
+	unknown := &ansible.RunnerFailedEvent{}
+	unknown.Host = "worker03"
+	unknown.Result.Message = "something unexpected"
+
+	for _, e := range []ansible.Event{taskStart, itemFailed, itemFailed, ignored, unknown} {
+		exp.ExplainEvent(e)
+	}
+	failures := exp.Failures()
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 known failure, but got %d: %+v", len(failures), failures)
+	}
+	if failures[0].Host != "worker01" || failures[0].Task != "install docker" || failures[0].Signature.Name != "apt-lock" {
+		t.Errorf("unexpected known failure: %+v", failures[0])
+	}
+	out := &bytes.Buffer{}
+	exp.WriteSummary(out)
+	if !strings.Contains(out.String(), "worker01") || !strings.Contains(out.String(), "Suggestion:") {
+		t.Errorf("unexpected summary:\n%s", out.String())
+	}
+}
@@ -0,0 +1,142 @@
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+// JSONEvent is the normalized representation of an ansible event that is
+// written by the JSON explainer
+type JSONEvent struct {
+	// Timestamp is when the event was explained, in RFC3339 format
+	Timestamp string `json:"timestamp"`
+	// Type of the event, e.g. "play_start" or "runner_failed"
+	Type string `json:"type"`
+	// Task is the name of the KET task that produced the event, e.g. "apply"
+	Task string `json:"task"`
+	// Playbook that is running
+	Playbook string `json:"playbook,omitempty"`
+	// Play that is running
+	Play string `json:"play,omitempty"`
+	// AnsibleTask is the name of the ansible task that is running
+	AnsibleTask string `json:"ansible_task,omitempty"`
+	// Host the event refers to
+	Host string `json:"host,omitempty"`
+	// Message returned by the runner
+	Message string `json:"message,omitempty"`
+	// Item the event refers to, when the task runs over a list of items
+	Item string `json:"item,omitempty"`
+	// Stdout captured when the command was run
+	Stdout string `json:"stdout,omitempty"`
+	// Stderr captured when the command was run
+	Stderr string `json:"stderr,omitempty"`
+	// Attempt is the number of attempts of a task that is being retried
+	Attempt int `json:"attempt,omitempty"`
+	// MaxRetries is the maximum number of retries of a task
+	MaxRetries int `json:"max_retries,omitempty"`
+	// IgnoreErrors is true if the failure of the task is ignored
+	IgnoreErrors bool `json:"ignore_errors,omitempty"`
+}
+
+// JSONExplainer returns an explainer that writes every ansible event as a
+// JSON line, tagged with the name of the KET task that is running
+func JSONExplainer(out io.Writer, task string) AnsibleEventExplainer {
+	return &jsonExplainer{
+		task: task,
+		now:  time.Now,
+		emit: func(je JSONEvent) {
+			b, err := json.Marshal(je)
+			if err != nil {
+				fmt.Fprintf(out, "error marshaling %s event: %v\n", je.Type, err)
+				return
+			}
+			fmt.Fprintln(out, string(b))
+		},
+	}
+}
+
+// CallbackExplainer returns an explainer that calls the callback with the
+// normalized representation of every ansible event, tagged with the name of
+// the KET task that is running
+func CallbackExplainer(task string, callback func(JSONEvent)) AnsibleEventExplainer {
+	return &jsonExplainer{
+		task: task,
+		now:  time.Now,
+		emit: callback,
+	}
+}
+
+type jsonExplainer struct {
+	task     string
+	now      func() time.Time
+	emit     func(JSONEvent)
+	playbook string
+	play     string
+	current  string
+}
+
+// ExplainEvent normalizes the ansible event, and emits it
+func (e *jsonExplainer) ExplainEvent(ansibleEvent ansible.Event) {
+	je := JSONEvent{}
+	switch event := ansibleEvent.(type) {
+	case *ansible.PlaybookStartEvent:
+		e.playbook = event.Name
+		je.Type = "playbook_start"
+	case *ansible.PlaybookEndEvent:
+		je.Type = "playbook_end"
+	case *ansible.PlayStartEvent:
+		e.play = event.Name
+		e.current = ""
+		je.Type = "play_start"
+	case *ansible.TaskStartEvent:
+		e.current = event.Name
+		je.Type = "task_start"
+	case *ansible.HandlerTaskStartEvent:
+		e.current = event.Name
+		je.Type = "handler_task_start"
+	case *ansible.RunnerOKEvent:
+		je = runnerJSONEvent("runner_ok", event.Host, event.Result.Message, event.IgnoreErrors)
+	case *ansible.RunnerSkippedEvent:
+		je = runnerJSONEvent("runner_skipped", event.Host, event.Result.Message, event.IgnoreErrors)
+	case *ansible.RunnerUnreachableEvent:
+		je = runnerJSONEvent("runner_unreachable", event.Host, event.Result.Message, event.IgnoreErrors)
+	case *ansible.RunnerFailedEvent:
+		je = runnerJSONEvent("runner_failed", event.Host, event.Result.Message, event.IgnoreErrors)
+		je.Stdout = event.Result.Stdout
+		je.Stderr = event.Result.Stderr
+	case *ansible.RunnerItemOKEvent:
+		je = runnerJSONEvent("runner_item_ok", event.Host, event.Result.Message, event.IgnoreErrors)
+		je.Item = event.Result.Item
+	case *ansible.RunnerItemFailedEvent:
+		je = runnerJSONEvent("runner_item_failed", event.Host, event.Result.Message, event.IgnoreErrors)
+		je.Item = event.Result.Item
+		je.Stdout = event.Result.Stdout
+		je.Stderr = event.Result.Stderr
+	case *ansible.RunnerItemRetryEvent:
+		je = runnerJSONEvent("runner_item_retry", event.Host, event.Result.Message, event.IgnoreErrors)
+		je.Item = event.Result.Item
+		je.Attempt = event.Result.Attempts
+		je.MaxRetries = event.Result.MaxRetries
+	default:
+		return
+	}
+	je.Timestamp = e.now().UTC().Format(time.RFC3339Nano)
+	je.Task = e.task
+	je.Playbook = e.playbook
+	je.Play = e.play
+	je.AnsibleTask = e.current
+	e.emit(je)
+}
+
+func runnerJSONEvent(eventType, host, message string, ignoreErrors bool) JSONEvent {
+	return JSONEvent{
+		Type:         eventType,
+		Host:         host,
+		Message:      message,
+		IgnoreErrors: ignoreErrors,
+	}
+}
@@ -0,0 +1,86 @@
+package explain
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestJSONExplainer(t *testing.T) {
+	out := &bytes.Buffer{}
+	exp := JSONExplainer(out, "apply").(*jsonExplainer)
+	exp.now = func() time.Time { return time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC) }
+
+	playbookStart := &ansible.PlaybookStartEvent{}
+	playbookStart.Name = "kubernetes.yaml"
+	playStart := &ansible.PlayStartEvent{}
+	playStart.Name = "worker"
+	taskStart := &ansible.TaskStartEvent{}
+	taskStart.Name = "install docker"
+	failed := &ansible.RunnerFailedEvent{}
+	failed.Host = "worker01"
+	failed.Result.Message = "package not found"
+	failed.Result.Stderr = "some error"
+	retry := &ansible.RunnerItemRetryEvent{}
+	retry.Host = "worker02"
+	retry.Result.Attempts = 2
+	retry.Result.MaxRetries = 5
+
+	for _, e := range []ansible.Event{playbookStart, playStart, taskStart, failed, retry, &ansible.PlaybookEndEvent{}} {
+		exp.ExplainEvent(e)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 JSON lines, but got %d:\n%s", len(lines), out.String())
+	}
+	var got JSONEvent
+	if err := json.Unmarshal([]byte(lines[3]), &got); err != nil {
+		t.Fatalf("error unmarshaling event: %v", err)
+	}
+	expected := JSONEvent{
+		Timestamp:   "2017-05-01T10:00:00Z",
+		Type:        "runner_failed",
+		Task:        "apply",
+		Playbook:    "kubernetes.yaml",
+		Play:        "worker",
+		AnsibleTask: "install docker",
+		Host:        "worker01",
+		Message:     "package not found",
+		Stderr:      "some error",
+	}
+	if got != expected {
+		t.Errorf("expected event\n%+v\nbut got\n%+v", expected, got)
+	}
+	if err := json.Unmarshal([]byte(lines[4]), &got); err != nil {
+		t.Fatalf("error unmarshaling event: %v", err)
+	}
+	if got.Type != "runner_item_retry" || got.Attempt != 2 || got.MaxRetries != 5 {
+		t.Errorf("unexpected retry event: %+v", got)
+	}
+}
+
+func TestCallbackExplainer(t *testing.T) {
+	events := []JSONEvent{}
+	exp := CallbackExplainer("upgrade", func(e JSONEvent) { events = append(events, e) })
+
+	taskStart := &ansible.TaskStartEvent{}
+	taskStart.Name = "drain node"
+	ok := &ansible.RunnerOKEvent{}
+	ok.Host = "worker01"
+	for _, e := range []ansible.Event{taskStart, ok} {
+		exp.ExplainEvent(e)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, but got %d", len(events))
+	}
+	got := events[1]
+	if got.Type != "runner_ok" || got.Task != "upgrade" || got.AnsibleTask != "drain node" || got.Host != "worker01" {
+		t.Errorf("unexpected event %+v", got)
+	}
+}
@@ -0,0 +1,203 @@
+package explain
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+// Timings of a playbook run
+type Timings struct {
+	Playbook        string       `json:"playbook"`
+	Start           time.Time    `json:"start"`
+	End             time.Time    `json:"end"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	Plays           []PlayTiming `json:"plays"`
+	Tasks           []TaskTiming `json:"tasks"`
+	// Hosts contains the total time spent running tasks on each host
+	Hosts []HostTiming `json:"hosts"`
+}
+
+// PlayTiming is the duration of a play
+type PlayTiming struct {
+	Name            string    `json:"name"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// TaskTiming is the duration of a task, and the time it took on each host
+type TaskTiming struct {
+	Play            string       `json:"play"`
+	Name            string       `json:"name"`
+	Start           time.Time    `json:"start"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	Hosts           []HostTiming `json:"hosts"`
+}
+
+// HostTiming is the time it took to run a task on a host
+type HostTiming struct {
+	Host            string  `json:"host"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Status of the task on the host. Not set in the per-host totals.
+	Status string `json:"status,omitempty"`
+}
+
+// TimingExplainer records the duration of the plays and tasks of a playbook,
+// and of each task on every host. The durations are measured from the time
+// the events are received.
+type TimingExplainer struct {
+	now     func() time.Time
+	timings Timings
+	ended   bool
+	// index of the current play and task, -1 if none
+	play int
+	task int
+}
+
+// NewTimingExplainer returns a new timing explainer
+func NewTimingExplainer() *TimingExplainer {
+	return &TimingExplainer{now: time.Now, play: -1, task: -1}
+}
+
+// ExplainEvent records the time of the event
+func (e *TimingExplainer) ExplainEvent(ansibleEvent ansible.Event) {
+	now := e.now()
+	switch event := ansibleEvent.(type) {
+	case *ansible.PlaybookStartEvent:
+		e.timings.Playbook = event.Name
+		e.timings.Start = now
+	case *ansible.PlayStartEvent:
+		e.finishTask(now)
+		e.finishPlay(now)
+		e.timings.Plays = append(e.timings.Plays, PlayTiming{Name: event.Name, Start: now})
+		e.play = len(e.timings.Plays) - 1
+	case *ansible.TaskStartEvent:
+		e.startTask(event.Name, now)
+	case *ansible.HandlerTaskStartEvent:
+		e.startTask(event.Name, now)
+	case *ansible.RunnerOKEvent:
+		e.hostDone(event.Host, "ok", now)
+	case *ansible.RunnerFailedEvent:
+		e.hostDone(event.Host, "failed", now)
+	case *ansible.RunnerSkippedEvent:
+		e.hostDone(event.Host, "skipped", now)
+	case *ansible.RunnerUnreachableEvent:
+		e.hostDone(event.Host, "unreachable", now)
+	case *ansible.PlaybookEndEvent:
+		e.finishTask(now)
+		e.finishPlay(now)
+		e.timings.End = now
+		e.ended = true
+	}
+}
+
+func (e *TimingExplainer) startTask(name string, now time.Time) {
+	e.finishTask(now)
+	var play string
+	if e.play >= 0 {
+		play = e.timings.Plays[e.play].Name
+	}
+	e.timings.Tasks = append(e.timings.Tasks, TaskTiming{Play: play, Name: name, Start: now})
+	e.task = len(e.timings.Tasks) - 1
+}
+
+func (e *TimingExplainer) hostDone(host, status string, now time.Time) {
+	if e.task < 0 {
+		return
+	}
+	t := &e.timings.Tasks[e.task]
+	t.Hosts = append(t.Hosts, HostTiming{Host: host, Status: status, DurationSeconds: now.Sub(t.Start).Seconds()})
+}
+
+func (e *TimingExplainer) finishTask(now time.Time) {
+	if e.task < 0 {
+		return
+	}
+	t := &e.timings.Tasks[e.task]
+	t.DurationSeconds = now.Sub(t.Start).Seconds()
+	e.task = -1
+}
+
+func (e *TimingExplainer) finishPlay(now time.Time) {
+	if e.play < 0 {
+		return
+	}
+	p := &e.timings.Plays[e.play]
+	p.DurationSeconds = now.Sub(p.Start).Seconds()
+	e.play = -1
+}
+
+// Timings returns the recorded timings. If the playbook did not end, the
+// current play and task end now.
+func (e *TimingExplainer) Timings() Timings {
+	if !e.ended {
+		now := e.now()
+		e.finishTask(now)
+		e.finishPlay(now)
+		e.timings.End = now
+		e.ended = true
+	}
+	t := e.timings
+	t.DurationSeconds = t.End.Sub(t.Start).Seconds()
+	totals := map[string]float64{}
+	for _, task := range t.Tasks {
+		for _, h := range task.Hosts {
+			totals[h.Host] += h.DurationSeconds
+		}
+	}
+	t.Hosts = []HostTiming{}
+	for host, d := range totals {
+		t.Hosts = append(t.Hosts, HostTiming{Host: host, DurationSeconds: d})
+	}
+	sort.Slice(t.Hosts, func(i, j int) bool {
+		return t.Hosts[i].DurationSeconds > t.Hosts[j].DurationSeconds
+	})
+	return t
+}
+
+// WriteProfile writes the slowest tasks, the duration of every play and the
+// total time spent on each host
+func WriteProfile(out io.Writer, t Timings, top int) error {
+	tasks := make([]TaskTiming, len(t.Tasks))
+	copy(tasks, t.Tasks)
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].DurationSeconds > tasks[j].DurationSeconds
+	})
+	if len(tasks) > top {
+		tasks = tasks[:top]
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "Slowest Tasks\n")
+	fmt.Fprint(w, "Duration\tPlay\tTask\tSlowest Host\n")
+	for _, task := range tasks {
+		var slowest string
+		var slowestDuration float64
+		for _, h := range task.Hosts {
+			if h.DurationSeconds >= slowestDuration {
+				slowest, slowestDuration = h.Host, h.DurationSeconds
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", formatSeconds(task.DurationSeconds), task.Play, task.Name, slowest)
+	}
+	fmt.Fprint(w, "\nPlays\n")
+	fmt.Fprint(w, "Duration\tPlay\n")
+	for _, p := range t.Plays {
+		fmt.Fprintf(w, "%s\t%s\n", formatSeconds(p.DurationSeconds), p.Name)
+	}
+	fmt.Fprint(w, "\nHosts\n")
+	fmt.Fprint(w, "Total Task Time\tHost\n")
+	for _, h := range t.Hosts {
+		fmt.Fprintf(w, "%s\t%s\n", formatSeconds(h.DurationSeconds), h.Host)
+	}
+	fmt.Fprintf(w, "\nTotal: %s\n", formatSeconds(t.DurationSeconds))
+	return w.Flush()
+}
+
+func formatSeconds(s float64) string {
+	d := time.Duration(s * float64(time.Second))
+	return (d / time.Millisecond * time.Millisecond).String()
+}
@@ -0,0 +1,136 @@
+package explain
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestTimingExplainer(t *testing.T) {
+	start := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	var elapsed time.Duration
+	exp := NewTimingExplainer()
+	exp.now = func() time.Time { return start.Add(elapsed) }
+
+	playbookStart := &ansible.PlaybookStartEvent{}
+	playbookStart.Name = "kubernetes.yaml"
+	etcdPlay := &ansible.PlayStartEvent{}
+	etcdPlay.Name = "etcd"
+	workerPlay := &ansible.PlayStartEvent{}
+	workerPlay.Name = "worker"
+	installEtcd := &ansible.TaskStartEvent{}
+	installEtcd.Name = "install etcd"
+	installDocker := &ansible.TaskStartEvent{}
+	installDocker.Name = "install docker"
+	etcdOK := &ansible.RunnerOKEvent{}
+	etcdOK.Host = "etcd01"
+	worker1OK := &ansible.RunnerOKEvent{}
+	worker1OK.Host = "worker01"
+	worker2Failed := &ansible.RunnerFailedEvent{}
+	worker2Failed.Host = "worker02"
+
+	events := []struct {
+		at    time.Duration
+		event ansible.Event
+	}{
+		{0, playbookStart},
+		{0, etcdPlay},
+		{1 * time.Second, installEtcd},
+		{4 * time.Second, etcdOK},
+		{5 * time.Second, workerPlay},
+		{5 * time.Second, installDocker},
+		{15 * time.Second, worker1OK},
+		{35 * time.Second, worker2Failed},
+		{40 * time.Second, &ansible.PlaybookEndEvent{}},
+	}
+	for _, e := range events {
+		elapsed = e.at
+		exp.ExplainEvent(e.event)
+	}
+
+	timings := exp.Timings()
+	if timings.Playbook != "kubernetes.yaml" {
+		t.Errorf("expected playbook kubernetes.yaml, but got %q", timings.Playbook)
+	}
+	if timings.DurationSeconds != 40 {
+		t.Errorf("expected total duration of 40s, but got %v", timings.DurationSeconds)
+	}
+	if len(timings.Plays) != 2 {
+		t.Fatalf("expected 2 plays, but got %d", len(timings.Plays))
+	}
+	if timings.Plays[0].DurationSeconds != 5 || timings.Plays[1].DurationSeconds != 35 {
+		t.Errorf("unexpected play durations: %+v", timings.Plays)
+	}
+	if len(timings.Tasks) != 2 {
+		t.Fatalf("expected 2 tasks, but got %d", len(timings.Tasks))
+	}
+	docker := timings.Tasks[1]
+	if docker.Play != "worker" || docker.DurationSeconds != 35 {
+		t.Errorf("unexpected timing of the docker task: %+v", docker)
+	}
+	expectedHosts := []HostTiming{
+		{Host: "worker01", DurationSeconds: 10, Status: "ok"},
+		{Host: "worker02", DurationSeconds: 30, Status: "failed"},
+	}
+	if len(docker.Hosts) != len(expectedHosts) {
+		t.Fatalf("expected %d hosts, but got %+v", len(expectedHosts), docker.Hosts)
+	}
+	for i, h := range expectedHosts {
+		if docker.Hosts[i] != h {
+			t.Errorf("expected host timing %+v, but got %+v", h, docker.Hosts[i])
+		}
+	}
+	// per-host totals are sorted from the slowest host
+	expectedTotals := []HostTiming{
+		{Host: "worker02", DurationSeconds: 30},
+		{Host: "worker01", DurationSeconds: 10},
+		{Host: "etcd01", DurationSeconds: 3},
+	}
+	for i, h := range expectedTotals {
+		if timings.Hosts[i] != h {
+			t.Errorf("expected host total %+v, but got %+v", h, timings.Hosts[i])
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteProfile(out, timings, 1); err != nil {
+		t.Fatalf("unexpected error writing profile: %v", err)
+	}
+	profile := out.String()
+	if !strings.Contains(profile, "install docker") || strings.Contains(profile, "install etcd") {
+		t.Errorf("expected only the slowest task in the profile, but got:\n%s", profile)
+	}
+	for _, s := range []string{"35s", "worker02", "Total: 40s"} {
+		if !strings.Contains(profile, s) {
+			t.Errorf("expected profile to contain %q, but got:\n%s", s, profile)
+		}
+	}
+}
+
+func TestTimingExplainerInterruptedPlaybook(t *testing.T) {
+	start := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	var elapsed time.Duration
+	exp := NewTimingExplainer()
+	exp.now = func() time.Time { return start.Add(elapsed) }
+
+	play := &ansible.PlayStartEvent{}
+	play.Name = "etcd"
+	task := &ansible.TaskStartEvent{}
+	task.Name = "install etcd"
+	exp.ExplainEvent(&ansible.PlaybookStartEvent{})
+	exp.ExplainEvent(play)
+	elapsed = 2 * time.Second
+	exp.ExplainEvent(task)
+
+	elapsed = 10 * time.Second
+	timings := exp.Timings()
+	if timings.DurationSeconds != 10 {
+		t.Errorf("expected total duration of 10s, but got %v", timings.DurationSeconds)
+	}
+	if timings.Tasks[0].DurationSeconds != 8 {
+		t.Errorf("expected the running task to end when the timings are read, but got %+v", timings.Tasks[0])
+	}
+}
@@ -0,0 +1,251 @@
+package explain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+const (
+	// WebhookFormatGeneric posts the notification as a JSON object
+	WebhookFormatGeneric = "generic"
+	// WebhookFormatSlack posts the notification as a Slack incoming webhook message
+	WebhookFormatSlack = "slack"
+
+	webhookTimeout = 10 * time.Second
+	// notifications that do not fit in the queue are dropped, so that a slow
+	// webhook cannot hold up the run
+	webhookQueueSize = 100
+	// how long Flush waits for the queued notifications to be delivered
+	webhookFlushTimeout = 30 * time.Second
+)
+
+// Webhook is an HTTP endpoint that is notified about the progress of
+// long-running operations
+type Webhook struct {
+	// URL the notifications are posted to
+	URL string `yaml:"url"`
+	// Format of the payload, either "generic" or "slack". Defaults to "generic".
+	Format string `yaml:"format"`
+	// Headers that are added to the requests, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+}
+
+// WebhookNotification is the payload posted to generic webhooks
+type WebhookNotification struct {
+	// Event is one of "started", "failed", "unreachable" or "completed"
+	Event string `json:"event"`
+	// Timestamp of the notification, in RFC3339 format
+	Timestamp string `json:"timestamp"`
+	// Cluster is the name of the cluster
+	Cluster string `json:"cluster"`
+	// Task is the name of the KET task, e.g. "apply"
+	Task string `json:"task"`
+	// RunDirectory contains the logs and the plan of the run
+	RunDirectory string `json:"run_directory"`
+	// Playbook that is running
+	Playbook string `json:"playbook,omitempty"`
+	// Host that failed or is unreachable
+	Host string `json:"host,omitempty"`
+	// AnsibleTask that failed
+	AnsibleTask string `json:"ansible_task,omitempty"`
+	// Message returned by the failed task
+	Message string `json:"message,omitempty"`
+	// Success is set on completion, and is false if any task failed
+	Success *bool `json:"success,omitempty"`
+	// Failures contains all failures, and is set on completion
+	Failures []WebhookFailure `json:"failures,omitempty"`
+}
+
+// WebhookFailure is a task that failed on a host
+type WebhookFailure struct {
+	Host        string `json:"host"`
+	AnsibleTask string `json:"ansible_task"`
+	Message     string `json:"message"`
+}
+
+// WebhookExplainer returns an explainer that notifies the webhooks when the
+// playbook starts, when a task fails or a host is unreachable, and when the
+// playbook completes. The notifications are delivered in order by a separate
+// go routine, so that the events are not held up by the webhooks. Flush must
+// be called once the event stream has been explained. Errors delivering the
+// notifications are written to errOut.
+func WebhookExplainer(webhooks []Webhook, cluster, task, runDirectory string, errOut io.Writer) *WebhookNotifier {
+	e := &WebhookNotifier{
+		webhooks:     webhooks,
+		cluster:      cluster,
+		task:         task,
+		runDirectory: runDirectory,
+		errOut:       errOut,
+		client:       &http.Client{Timeout: webhookTimeout},
+		now:          time.Now,
+		flushTimeout: webhookFlushTimeout,
+		queue:        make(chan WebhookNotification, webhookQueueSize),
+		delivered:    make(chan struct{}),
+		abandoned:    make(chan struct{}),
+	}
+	go e.deliver()
+	return e
+}
+
+// WebhookNotifier is an explainer that notifies webhooks about the progress of a playbook
+type WebhookNotifier struct {
+	webhooks     []Webhook
+	cluster      string
+	task         string
+	runDirectory string
+	errOut       io.Writer
+	client       *http.Client
+	now          func() time.Time
+	flushTimeout time.Duration
+
+	playbook    string
+	currentTask string
+	failures    []WebhookFailure
+
+	queue     chan WebhookNotification
+	delivered chan struct{}
+	abandoned chan struct{}
+	flushOnce sync.Once
+}
+
+// Flush waits until the queued notifications have been delivered, or until
+// the flush timeout expires. The notifications that were not delivered by
+// then are dropped.
+func (e *WebhookNotifier) Flush() {
+	e.flushOnce.Do(func() {
+		close(e.queue)
+		select {
+		case <-e.delivered:
+		case <-time.After(e.flushTimeout):
+			close(e.abandoned)
+			util.PrettyPrintWarn(e.errOut, "Timed out sending notifications to the webhooks, the remaining notifications were dropped")
+		}
+	})
+}
+
+// ExplainEvent notifies the webhooks about the relevant events
+func (e *WebhookNotifier) ExplainEvent(ansibleEvent ansible.Event) {
+	switch event := ansibleEvent.(type) {
+	case *ansible.PlaybookStartEvent:
+		e.playbook = event.Name
+		e.notify(e.newNotification("started"))
+	case *ansible.TaskStartEvent:
+		e.currentTask = event.Name
+	case *ansible.HandlerTaskStartEvent:
+		e.currentTask = event.Name
+	case *ansible.RunnerFailedEvent:
+		if event.IgnoreErrors {
+			return
+		}
+		e.hostFailed("failed", event.Host, event.Result.Message)
+	case *ansible.RunnerUnreachableEvent:
+		e.hostFailed("unreachable", event.Host, event.Result.Message)
+	case *ansible.PlaybookEndEvent:
+		n := e.newNotification("completed")
+		success := len(e.failures) == 0
+		n.Success = &success
+		n.Failures = e.failures
+		e.notify(n)
+	}
+}
+
+func (e *WebhookNotifier) hostFailed(eventName, host, message string) {
+	f := WebhookFailure{Host: host, AnsibleTask: e.currentTask, Message: message}
+	e.failures = append(e.failures, f)
+	n := e.newNotification(eventName)
+	n.Host = f.Host
+	n.AnsibleTask = f.AnsibleTask
+	n.Message = f.Message
+	e.notify(n)
+}
+
+func (e *WebhookNotifier) newNotification(event string) WebhookNotification {
+	return WebhookNotification{
+		Event:        event,
+		Timestamp:    e.now().UTC().Format(time.RFC3339),
+		Cluster:      e.cluster,
+		Task:         e.task,
+		RunDirectory: e.runDirectory,
+		Playbook:     e.playbook,
+	}
+}
+
+// notify queues the notification, or drops it if the queue is full
+func (e *WebhookNotifier) notify(n WebhookNotification) {
+	select {
+	case e.queue <- n:
+	default:
+		util.PrettyPrintWarn(e.errOut, "Dropped %q notification, too many notifications are waiting to be sent to the webhooks", n.Event)
+	}
+}
+
+// deliver posts the queued notifications to all webhooks, in order
+func (e *WebhookNotifier) deliver() {
+	defer close(e.delivered)
+	for n := range e.queue {
+		select {
+		case <-e.abandoned:
+			return
+		default:
+		}
+		for _, w := range e.webhooks {
+			if err := e.post(w, n); err != nil {
+				util.PrettyPrintWarn(e.errOut, "Error sending notification to %s: %v", w.URL, err)
+			}
+		}
+	}
+}
+
+func (e *WebhookNotifier) post(w Webhook, n WebhookNotification) error {
+	var payload interface{} = n
+	if w.Format == WebhookFormatSlack {
+		payload = map[string]string{"text": slackMessage(n)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling notification: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	return nil
+}
+
+func slackMessage(n WebhookNotification) string {
+	prefix := fmt.Sprintf("kismatic %s on cluster %q", n.Task, n.Cluster)
+	switch n.Event {
+	case "started":
+		return fmt.Sprintf("%s started", prefix)
+	case "failed":
+		return fmt.Sprintf("%s: task %q failed on %s: %s", prefix, n.AnsibleTask, n.Host, n.Message)
+	case "unreachable":
+		return fmt.Sprintf("%s: %s is unreachable", prefix, n.Host)
+	case "completed":
+		if n.Success != nil && *n.Success {
+			return fmt.Sprintf("%s completed successfully", prefix)
+		}
+		return fmt.Sprintf("%s completed with %d failure(s). Logs are in %s", prefix, len(n.Failures), n.RunDirectory)
+	}
+	return fmt.Sprintf("%s: %s", prefix, n.Event)
+}
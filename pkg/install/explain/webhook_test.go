@@ -0,0 +1,127 @@
+package explain
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+func TestWebhookExplainer(t *testing.T) {
+	var received []WebhookNotification
+	var slackMessages []string
+	var authHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders = append(authHeaders, r.Header.Get("Authorization"))
+		if r.URL.Path == "/slack" {
+			m := map[string]string{}
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				t.Errorf("error decoding slack payload: %v", err)
+			}
+			slackMessages = append(slackMessages, m["text"])
+			return
+		}
+		n := WebhookNotification{}
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("error decoding payload: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer server.Close()
+
+	webhooks := []Webhook{
+		{URL: server.URL + "/generic", Headers: map[string]string{"Authorization": "Bearer token"}},
+		{URL: server.URL + "/slack", Format: WebhookFormatSlack},
+	}
+	errOut := &bytes.Buffer{}
+	exp := WebhookExplainer(webhooks, "prod", "apply", "runs/apply", errOut)
+
+	playbookStart := &ansible.PlaybookStartEvent{}
+	playbookStart.Name = "kubernetes.yaml"
+	taskStart := &ansible.TaskStartEvent{}
+	taskStart.Name = "install docker"
+	ignored := &ansible.RunnerFailedEvent{}
+	ignored.Host = "worker01"
+	ignored.IgnoreErrors = true
+	failed := &ansible.RunnerFailedEvent{}
+	failed.Host = "worker02"
+	failed.Result.Message = "package not found"
+	ok := &ansible.RunnerOKEvent{}
+	ok.Host = "worker03"
+
+	for _, e := range []ansible.Event{playbookStart, taskStart, ignored, failed, ok, &ansible.PlaybookEndEvent{}} {
+		exp.ExplainEvent(e)
+	}
+	exp.Flush()
+
+	if errOut.Len() != 0 {
+		t.Errorf("unexpected errors sending notifications: %s", errOut.String())
+	}
+	if len(received) != 3 {
+		t.Fatalf("expected 3 notifications, but got %d: %+v", len(received), received)
+	}
+	if received[0].Event != "started" || received[0].Cluster != "prod" || received[0].Task != "apply" {
+		t.Errorf("unexpected start notification: %+v", received[0])
+	}
+	f := received[1]
+	if f.Event != "failed" || f.Host != "worker02" || f.AnsibleTask != "install docker" || f.Message != "package not found" || f.RunDirectory != "runs/apply" {
+		t.Errorf("unexpected failure notification: %+v", f)
+	}
+	c := received[2]
+	if c.Event != "completed" || c.Success == nil || *c.Success || len(c.Failures) != 1 || c.Failures[0].Host != "worker02" {
+		t.Errorf("unexpected completion notification: %+v", c)
+	}
+	if authHeaders[0] != "Bearer token" {
+		t.Errorf("expected the configured headers to be sent, got %q", authHeaders[0])
+	}
+	if len(slackMessages) != 3 || !strings.Contains(slackMessages[1], `task "install docker" failed on worker02`) {
+		t.Errorf("unexpected slack messages: %v", slackMessages)
+	}
+}
+
+func TestWebhookExplainerDeliveryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	errOut := &bytes.Buffer{}
+	exp := WebhookExplainer([]Webhook{{URL: server.URL}}, "prod", "apply", "runs/apply", errOut)
+	exp.ExplainEvent(&ansible.PlaybookStartEvent{})
+	exp.Flush()
+	if !strings.Contains(errOut.String(), "500") {
+		t.Errorf("expected the delivery error to be reported, got %q", errOut.String())
+	}
+}
+
+func TestWebhookExplainerDoesNotBlockEvents(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	errOut := &bytes.Buffer{}
+	exp := WebhookExplainer([]Webhook{{URL: server.URL}}, "prod", "apply", "runs/apply", errOut)
+	exp.flushTimeout = 100 * time.Millisecond
+
+	explained := make(chan struct{})
+	go func() {
+		exp.ExplainEvent(&ansible.PlaybookStartEvent{})
+		exp.ExplainEvent(&ansible.PlaybookEndEvent{})
+		close(explained)
+	}()
+	select {
+	case <-explained:
+	case <-time.After(time.Second):
+		t.Fatal("explaining the events was blocked by the webhook")
+	}
+	exp.Flush()
+	if !strings.Contains(errOut.String(), "Timed out sending notifications") {
+		t.Errorf("expected the flush timeout to be reported, got %q", errOut.String())
+	}
+}
@@ -39,3 +39,63 @@ func (options *APIServerOptions) validate() (bool, []error) {
 
 	return v.valid()
 }
+
+// kubeAPIServerOIDCOptions are set when OpenID Connect authentication is configured
+var kubeAPIServerOIDCOptions = []string{
+	"oidc-ca-file",
+	"oidc-client-id",
+	"oidc-groups-claim",
+	"oidc-issuer-url",
+	"oidc-username-claim",
+}
+
+// kubeAPIServerAuditOptions are set when audit is enabled
+var kubeAPIServerAuditOptions = []string{
+	"audit-log-maxage",
+	"audit-log-maxbackup",
+	"audit-log-maxsize",
+	"audit-log-path",
+	"audit-policy-file",
+	"audit-webhook-config-file",
+}
+
+// managedAPIServerOptions returns the API server options that are set from
+// sections of the plan, and that cannot be overridden
+func managedAPIServerOptions(c *Cluster) []string {
+	options := []string{}
+	if c.Authentication.OIDC.IssuerURL != "" {
+		options = append(options, kubeAPIServerOIDCOptions...)
+	}
+	if c.Audit.Enabled {
+		options = append(options, kubeAPIServerAuditOptions...)
+	}
+	if c.EncryptionAtRest.Enabled {
+		options = append(options, "experimental-encryption-provider-config")
+	}
+	return options
+}
+
+// validateManagedAPIServerOptions returns an error if the cluster or a master
+// node overrides API server options that are set from sections of the plan
+func validateManagedAPIServerOptions(p *Plan) []error {
+	managed := managedAPIServerOptions(&p.Cluster)
+	conflicts := func(overrides map[string]string) []string {
+		found := []string{}
+		for _, o := range managed {
+			if _, ok := overrides[o]; ok {
+				found = append(found, o)
+			}
+		}
+		return found
+	}
+	errs := []error{}
+	if found := conflicts(p.Cluster.APIServerOptions.Overrides); len(found) > 0 {
+		errs = append(errs, fmt.Errorf("Kube ApiServer Option(s) [%v] cannot be overridden, as they are configured by the plan", strings.Join(found, ", ")))
+	}
+	for _, n := range p.Master.Nodes {
+		if found := conflicts(n.APIServerOptions.Overrides); len(found) > 0 {
+			errs = append(errs, fmt.Errorf("Kube ApiServer Option(s) [%v] of node %q cannot be overridden, as they are configured by the plan", strings.Join(found, ", "), n.Host))
+		}
+	}
+	return errs
+}
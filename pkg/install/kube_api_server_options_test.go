@@ -1,6 +1,7 @@
 package install
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -70,3 +71,40 @@ func assertEqual(t *testing.T, a, b interface{}) {
 		t.Errorf("%v != %v", a, b)
 	}
 }
+
+func TestValidateManagedAPIServerOptions(t *testing.T) {
+	p := &Plan{
+		Cluster: Cluster{
+			APIServerOptions: APIServerOptions{Overrides: map[string]string{"oidc-issuer-url": "https://accounts.example.com", "v": "2"}},
+		},
+		Master: MasterNodeGroup{
+			Nodes: []Node{{Host: "master1", APIServerOptions: APIServerOptions{Overrides: map[string]string{"oidc-groups-claim": "groups"}}}},
+		},
+	}
+	// the overrides are allowed when OIDC authentication is not configured in the plan
+	if errs := validateManagedAPIServerOptions(p); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	p.Cluster.Authentication.OIDC = OIDCAuthentication{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes"}
+	errs := validateManagedAPIServerOptions(p)
+	assertEqual(t, errs, []error{
+		errors.New("Kube ApiServer Option(s) [oidc-issuer-url] cannot be overridden, as they are configured by the plan"),
+		errors.New("Kube ApiServer Option(s) [oidc-groups-claim] of node \"master1\" cannot be overridden, as they are configured by the plan"),
+	})
+}
+
+func TestManagedAPIServerOptionsAudit(t *testing.T) {
+	c := &Cluster{}
+	assertEqual(t, managedAPIServerOptions(c), []string{})
+	c.Audit.Enabled = true
+	options := managedAPIServerOptions(c)
+	for _, o := range []string{"audit-policy-file", "audit-log-path", "audit-webhook-config-file"} {
+		found := false
+		for _, m := range options {
+			found = found || m == o
+		}
+		if !found {
+			t.Errorf("expected %q to be managed when audit is enabled, but got %v", o, options)
+		}
+	}
+}
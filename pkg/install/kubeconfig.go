@@ -3,11 +3,12 @@ package install
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"text/template"
 
+	"github.com/apprenda/kismatic/pkg/data"
 	"github.com/apprenda/kismatic/pkg/util"
 )
 
@@ -22,6 +23,20 @@ type ConfigOptions struct {
 	Context string
 	Cert    string
 	Key     string
+	// Namespace is the default namespace of the context. Optional.
+	Namespace string
+	// OIDC is the configuration of the oidc auth provider of the user.
+	// The client certificate is used when nil.
+	OIDC *OIDCConfigOptions
+}
+
+// OIDCConfigOptions is the configuration of the oidc auth provider of a kubeconfig user
+type OIDCConfigOptions struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// CA is the base64 encoded CA of the identity provider. Optional.
+	CA string
 }
 
 var kubeconfigTemplate = `apiVersion: v1
@@ -34,6 +49,9 @@ contexts:
 - context:
     cluster: {{.Cluster}}
     user: {{.User}}
+{{- if .Namespace}}
+    namespace: {{.Namespace}}
+{{- end}}
   name: {{.Context}}
 current-context: {{.Context}}
 kind: Config
@@ -41,10 +59,37 @@ preferences: {}
 users:
 - name: {{.User}}
   user:
+{{- if .OIDC}}
+    auth-provider:
+      name: oidc
+      config:
+        client-id: {{.OIDC.ClientID}}
+{{- if .OIDC.ClientSecret}}
+        client-secret: {{.OIDC.ClientSecret}}
+{{- end}}
+{{- if .OIDC.CA}}
+        idp-certificate-authority-data: {{.OIDC.CA}}
+{{- end}}
+        idp-issuer-url: {{.OIDC.IssuerURL}}
+{{- else}}
     client-certificate-data: {{.Cert}}
     client-key-data: {{.Key}}
+{{- end}}
 `
 
+// renderKubeconfig processes the kubeconfig template with the options
+func renderKubeconfig(configOptions ConfigOptions) ([]byte, error) {
+	tmpl, err := template.New("kubeconfig").Parse(kubeconfigTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config template: %v", err)
+	}
+	var kubeconfig bytes.Buffer
+	if err = tmpl.Execute(&kubeconfig, configOptions); err != nil {
+		return nil, fmt.Errorf("error processing config template: %v", err)
+	}
+	return kubeconfig.Bytes(), nil
+}
+
 // GenerateKubeconfig generate a kubeconfig file for a specific user
 func GenerateKubeconfig(p *Plan, generatedAssetsDir string) error {
 	user := "admin"
@@ -70,20 +115,14 @@ func GenerateKubeconfig(p *Plan, generatedAssetsDir string) error {
 		return fmt.Errorf("error reading certificate key file for kubeconfig: %v", err)
 	}
 
-	// Process template file
-	tmpl, err := template.New("kubeconfig").Parse(kubeconfigTemplate)
-	if err != nil {
-		return fmt.Errorf("error reading config template: %v", err)
-	}
-	configOptions := ConfigOptions{caEncoded, server, cluster, user, context, certEncoded, keyEncoded}
-	var kubeconfig bytes.Buffer
-	err = tmpl.Execute(&kubeconfig, configOptions)
+	configOptions := ConfigOptions{CA: caEncoded, Server: server, Cluster: cluster, User: user, Context: context, Cert: certEncoded, Key: keyEncoded}
+	kubeconfig, err := renderKubeconfig(configOptions)
 	if err != nil {
-		return fmt.Errorf("error processing config template: %v", err)
+		return err
 	}
 	// Write config file
 	kubeconfigFile := filepath.Join(generatedAssetsDir, kubeconfigFilename)
-	err = ioutil.WriteFile(kubeconfigFile, kubeconfig.Bytes(), 0644)
+	err = ioutil.WriteFile(kubeconfigFile, kubeconfig, 0644)
 	if err != nil {
 		return fmt.Errorf("error writing kubeconfig file: %v", err)
 	}
@@ -127,3 +166,15 @@ func RegenerateKubeconfig(p *Plan, generatedAssetsDir string) (bool, error) {
 
 	return true, nil
 }
+
+// NewClusterClient returns a client of the Kubernetes cluster. The client calls
+// the API server with the admin kubeconfig file in the generated assets directory,
+// and falls back to running kubectl on the first master node when the API server
+// is not reachable from this machine.
+func NewClusterClient(p *Plan, generatedAssetsDir string) (data.ClusterClient, error) {
+	client, err := p.GetSSHClient(p.Master.Nodes[0].Host)
+	if err != nil {
+		return nil, fmt.Errorf("error getting SSH client: %v", err)
+	}
+	return data.NewClusterClient(filepath.Join(generatedAssetsDir, kubeconfigFilename), client)
+}
@@ -0,0 +1,336 @@
+package install
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+	"github.com/apprenda/kismatic/pkg/tls"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+const userKubeconfigRecordsFilename = "kubeconfig-users.json"
+
+var userNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._@-]*$`)
+
+// UserKubeconfigOptions are the options of a user's kubeconfig
+type UserKubeconfigOptions struct {
+	// User is the name of the user, and the common name of the client certificate
+	User string
+	// Groups of the user, set as the organizations of the client certificate
+	Groups []string
+	// Namespace the user is bound to. The user is bound to the role in all namespaces if empty.
+	Namespace string
+	// Role is the name of the ClusterRole the user is bound to, e.g. "view", "edit" or "admin"
+	Role string
+	// ValidityPeriod of the client certificate, e.g. "8760h"
+	ValidityPeriod string
+	// OIDC is the OpenID Connect configuration of the cluster. When set, the kubeconfig
+	// uses the oidc auth provider instead of a client certificate.
+	OIDC *OIDCAuthentication
+	// OIDCClientSecret is the client secret set in the oidc auth provider. Optional.
+	OIDCClientSecret string
+}
+
+// UserKubeconfigRecord records a kubeconfig issued to a user
+type UserKubeconfigRecord struct {
+	User      string
+	Groups    []string
+	Namespace string
+	Role      string
+	// Binding is the name of the RoleBinding or ClusterRoleBinding of the user
+	Binding string
+	// AuthProvider is the auth provider of the kubeconfig, empty when a client certificate is used
+	AuthProvider string `json:",omitempty"`
+	// Serial is the serial number of the client certificate
+	Serial    string
+	NotAfter  time.Time
+	Revoked   bool
+	RevokedAt *time.Time `json:",omitempty"`
+}
+
+// ValidateUserKubeconfigOptions returns an error if the options are not valid
+func ValidateUserKubeconfigOptions(opts UserKubeconfigOptions) error {
+	if !userNameRegexp.MatchString(opts.User) {
+		return fmt.Errorf("invalid user %q: must start with a letter or a number, and only contain letters, numbers, '.', '_', '@' or '-'", opts.User)
+	}
+	if opts.Role == "" {
+		return fmt.Errorf("role cannot be empty")
+	}
+	if opts.OIDC != nil {
+		if opts.OIDC.IssuerURL == "" {
+			return fmt.Errorf("OIDC authentication is not configured in the plan file")
+		}
+		if len(opts.Groups) > 0 {
+			return fmt.Errorf("groups cannot be set for OIDC users, as they are read from the %q claim of the ID token", opts.OIDC.GroupsClaim)
+		}
+		return nil
+	}
+	for _, g := range opts.Groups {
+		if g == adminGroup {
+			return fmt.Errorf("group %q cannot be used, as it grants full access to the cluster", adminGroup)
+		}
+	}
+	if _, err := time.ParseDuration(opts.ValidityPeriod); err != nil {
+		return fmt.Errorf("%q is not a valid duration for certificate expiry", opts.ValidityPeriod)
+	}
+	return nil
+}
+
+// userBindingName returns the name of the binding of the user. The user name
+// is lowercased and its '@' and '_' replaced to be a valid object name, so a
+// hash of the exact user name is appended to keep the names of different
+// users, such as "Alice" and "alice", from colliding.
+func userBindingName(user string) string {
+	r := strings.NewReplacer("@", "-", "_", "-")
+	sum := sha256.Sum256([]byte(user))
+	return fmt.Sprintf("kismatic-user-%s-%x", r.Replace(strings.ToLower(user)), sum[:4])
+}
+
+// userSubject returns the name of the user as authenticated by the API server.
+// The API server prefixes OIDC usernames with the issuer URL, unless the email claim is used.
+func userSubject(opts UserKubeconfigOptions) string {
+	if opts.OIDC == nil || opts.OIDC.UsernameClaim == "email" {
+		return opts.User
+	}
+	return opts.OIDC.IssuerURL + "#" + opts.User
+}
+
+// userBindingManifest returns the RoleBinding, or the ClusterRoleBinding if the
+// namespace is empty, that binds the user to the ClusterRole
+func userBindingManifest(opts UserKubeconfigOptions) string {
+	kind := "ClusterRoleBinding"
+	metadata := fmt.Sprintf("  name: %s\n", userBindingName(opts.User))
+	if opts.Namespace != "" {
+		kind = "RoleBinding"
+		metadata += fmt.Sprintf("  namespace: %s\n", opts.Namespace)
+	}
+	return fmt.Sprintf(`apiVersion: rbac.authorization.k8s.io/v1beta1
+kind: %s
+metadata:
+%s  labels:
+    kismatic/user-kubeconfig: "true"
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: %s
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: User
+  name: %s
+`, kind, metadata, opts.Role, userSubject(opts))
+}
+
+// ApplyUserBinding creates or updates the binding of the user by running kubectl over SSH
+func ApplyUserBinding(client ssh.Client, opts UserKubeconfigOptions) error {
+	manifest := base64.StdEncoding.EncodeToString([]byte(userBindingManifest(opts)))
+	cmd := fmt.Sprintf("echo %s | base64 -d | sudo kubectl apply -f -", manifest)
+	if out, err := client.Output(true, cmd); err != nil {
+		return fmt.Errorf("error creating the binding of user %q: %v: %s", opts.User, err, out)
+	}
+	return nil
+}
+
+// DeleteUserBinding deletes the binding of the user by running kubectl over SSH
+func DeleteUserBinding(client ssh.Client, record UserKubeconfigRecord) error {
+	cmd := fmt.Sprintf("sudo kubectl delete clusterrolebinding %s --ignore-not-found", record.Binding)
+	if record.Namespace != "" {
+		cmd = fmt.Sprintf("sudo kubectl delete rolebinding %s --namespace %s --ignore-not-found", record.Binding, record.Namespace)
+	}
+	if out, err := client.Output(true, cmd); err != nil {
+		return fmt.Errorf("error deleting the binding of user %q: %v: %s", record.User, err, out)
+	}
+	return nil
+}
+
+// GenerateUserKubeconfig issues a client certificate for the user, signed by the
+// cluster CA, and writes the user's kubeconfig file to the generated assets directory.
+// The certificate is recorded, so that it can be revoked later on.
+func GenerateUserKubeconfig(p *Plan, generatedAssetsDir string, pki *LocalPKI, ca *tls.CA, opts UserKubeconfigOptions) (string, *UserKubeconfigRecord, error) {
+	if err := ValidateUserKubeconfigOptions(opts); err != nil {
+		return "", nil, err
+	}
+	if opts.OIDC != nil {
+		return generateUserOIDCKubeconfig(p, generatedAssetsDir, pki, opts)
+	}
+	certName := "user-" + opts.User
+	if _, err := pki.GenerateCertificate(certName, opts.ValidityPeriod, opts.User, nil, opts.Groups, ca, true); err != nil {
+		return "", nil, err
+	}
+	certFile := filepath.Join(pki.GeneratedCertsDirectory, certName+".pem")
+	cert, err := readCertificate(certFile)
+	if err != nil {
+		return "", nil, err
+	}
+
+	caEncoded, err := util.Base64String(filepath.Join(pki.GeneratedCertsDirectory, "ca.pem"))
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading ca file for kubeconfig: %v", err)
+	}
+	certEncoded, err := util.Base64String(certFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading certificate file for kubeconfig: %v", err)
+	}
+	keyEncoded, err := util.Base64String(filepath.Join(pki.GeneratedCertsDirectory, certName+"-key.pem"))
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading certificate key file for kubeconfig: %v", err)
+	}
+	kubeconfig, err := renderKubeconfig(ConfigOptions{
+		CA:        caEncoded,
+		Server:    "https://" + p.Master.LoadBalancedFQDN + ":6443",
+		Cluster:   p.Cluster.Name,
+		User:      opts.User,
+		Context:   p.Cluster.Name + "-" + opts.User,
+		Cert:      certEncoded,
+		Key:       keyEncoded,
+		Namespace: opts.Namespace,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	record := &UserKubeconfigRecord{
+		User:      opts.User,
+		Groups:    opts.Groups,
+		Namespace: opts.Namespace,
+		Role:      opts.Role,
+		Binding:   userBindingName(opts.User),
+		Serial:    cert.SerialNumber.String(),
+		NotAfter:  cert.NotAfter,
+	}
+	return writeUserKubeconfig(generatedAssetsDir, kubeconfig, record)
+}
+
+// generateUserOIDCKubeconfig writes the kubeconfig file of a user that authenticates
+// with the oidc auth provider. The user has to log in with the identity provider
+// to set the ID token and the refresh token of the kubeconfig.
+func generateUserOIDCKubeconfig(p *Plan, generatedAssetsDir string, pki *LocalPKI, opts UserKubeconfigOptions) (string, *UserKubeconfigRecord, error) {
+	caEncoded, err := util.Base64String(filepath.Join(pki.GeneratedCertsDirectory, "ca.pem"))
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading ca file for kubeconfig: %v", err)
+	}
+	oidc := &OIDCConfigOptions{
+		IssuerURL:    opts.OIDC.IssuerURL,
+		ClientID:     opts.OIDC.ClientID,
+		ClientSecret: opts.OIDCClientSecret,
+	}
+	if opts.OIDC.CAFile != "" {
+		if oidc.CA, err = util.Base64String(opts.OIDC.CAFile); err != nil {
+			return "", nil, fmt.Errorf("error reading OIDC CA file for kubeconfig: %v", err)
+		}
+	}
+	kubeconfig, err := renderKubeconfig(ConfigOptions{
+		CA:        caEncoded,
+		Server:    "https://" + p.Master.LoadBalancedFQDN + ":6443",
+		Cluster:   p.Cluster.Name,
+		User:      opts.User,
+		Context:   p.Cluster.Name + "-" + opts.User,
+		Namespace: opts.Namespace,
+		OIDC:      oidc,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	record := &UserKubeconfigRecord{
+		User:         opts.User,
+		Namespace:    opts.Namespace,
+		Role:         opts.Role,
+		Binding:      userBindingName(opts.User),
+		AuthProvider: "oidc",
+	}
+	return writeUserKubeconfig(generatedAssetsDir, kubeconfig, record)
+}
+
+// writeUserKubeconfig writes the kubeconfig file of the user, and records it
+func writeUserKubeconfig(generatedAssetsDir string, kubeconfig []byte, record *UserKubeconfigRecord) (string, *UserKubeconfigRecord, error) {
+	kubeconfigFile := filepath.Join(generatedAssetsDir, kubeconfigFilename+"-"+record.User)
+	// the kubeconfig contains the user's private key or client secret
+	if err := ioutil.WriteFile(kubeconfigFile, kubeconfig, 0600); err != nil {
+		return "", nil, fmt.Errorf("error writing kubeconfig file: %v", err)
+	}
+	records, err := ReadUserKubeconfigRecords(generatedAssetsDir)
+	if err != nil {
+		return "", nil, err
+	}
+	if err = WriteUserKubeconfigRecords(generatedAssetsDir, append(records, *record)); err != nil {
+		return "", nil, err
+	}
+	return kubeconfigFile, record, nil
+}
+
+func readCertificate(file string) (*x509.Certificate, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificate %q: %v", file, err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("certificate %q is not PEM encoded", file)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate %q: %v", file, err)
+	}
+	return cert, nil
+}
+
+// ReadUserKubeconfigRecords returns the records of the kubeconfig files issued to users
+func ReadUserKubeconfigRecords(generatedAssetsDir string) ([]UserKubeconfigRecord, error) {
+	file := filepath.Join(generatedAssetsDir, userKubeconfigRecordsFilename)
+	raw, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return []UserKubeconfigRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %v", file, err)
+	}
+	records := []UserKubeconfigRecord{}
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, fmt.Errorf("error unmarshalling %q: %v", file, err)
+	}
+	return records, nil
+}
+
+// WriteUserKubeconfigRecords writes the records of the kubeconfig files issued to users
+func WriteUserKubeconfigRecords(generatedAssetsDir string, records []UserKubeconfigRecord) error {
+	file := filepath.Join(generatedAssetsDir, userKubeconfigRecordsFilename)
+	raw, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling user kubeconfig records: %v", err)
+	}
+	if err := ioutil.WriteFile(file, raw, 0644); err != nil {
+		return fmt.Errorf("error writing %q: %v", file, err)
+	}
+	return nil
+}
+
+// RevokeUserKubeconfigs marks the kubeconfig files issued to the user as revoked,
+// and returns the records that were revoked
+func RevokeUserKubeconfigs(generatedAssetsDir string, user string, now time.Time) ([]UserKubeconfigRecord, error) {
+	records, err := ReadUserKubeconfigRecords(generatedAssetsDir)
+	if err != nil {
+		return nil, err
+	}
+	revoked := []UserKubeconfigRecord{}
+	for i := range records {
+		if records[i].User != user || records[i].Revoked {
+			continue
+		}
+		records[i].Revoked = true
+		records[i].RevokedAt = &now
+		revoked = append(revoked, records[i])
+	}
+	if len(revoked) == 0 {
+		return nil, fmt.Errorf("no kubeconfig issued to user %q was found", user)
+	}
+	return revoked, WriteUserKubeconfigRecords(generatedAssetsDir, records)
+}
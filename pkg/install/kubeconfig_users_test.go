@@ -0,0 +1,208 @@
+package install
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingSSHClient struct {
+	commands []string
+}
+
+func (c *recordingSSHClient) Output(pty bool, args ...string) (string, error) {
+	c.commands = append(c.commands, strings.Join(args, " "))
+	return "", nil
+}
+
+func (c *recordingSSHClient) Shell(pty bool, args ...string) error {
+	return nil
+}
+
+func TestValidateUserKubeconfigOptions(t *testing.T) {
+	valid := UserKubeconfigOptions{User: "alice@example.com", Groups: []string{"dev-team"}, Role: "edit", ValidityPeriod: "8760h"}
+	if err := ValidateUserKubeconfigOptions(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	invalid := []UserKubeconfigOptions{
+		{User: "", Role: "edit", ValidityPeriod: "8760h"},
+		{User: "../alice", Role: "edit", ValidityPeriod: "8760h"},
+		{User: "alice", Role: "", ValidityPeriod: "8760h"},
+		{User: "alice", Role: "edit", ValidityPeriod: "1y"},
+		{User: "alice", Groups: []string{"system:masters"}, Role: "edit", ValidityPeriod: "8760h"},
+		{User: "alice", Role: "edit", OIDC: &OIDCAuthentication{}},
+		{User: "alice", Groups: []string{"dev-team"}, Role: "edit", OIDC: &OIDCAuthentication{IssuerURL: "https://accounts.example.com"}},
+	}
+	for _, opts := range invalid {
+		if err := ValidateUserKubeconfigOptions(opts); err == nil {
+			t.Errorf("expected an error for options %+v", opts)
+		}
+	}
+}
+
+func TestUserBindingNamesAreUnique(t *testing.T) {
+	users := []string{"alice", "Alice", "alice_x", "alice-x", "alice@x"}
+	names := map[string]string{}
+	for _, u := range users {
+		name := userBindingName(u)
+		if other, ok := names[name]; ok {
+			t.Errorf("expected users %q and %q to have different binding names, but both got %q", other, u, name)
+		}
+		names[name] = u
+		if name != userBindingName(u) {
+			t.Errorf("expected the binding name of %q to be stable", u)
+		}
+	}
+}
+
+func TestApplyUserBinding(t *testing.T) {
+	tests := []struct {
+		opts     UserKubeconfigOptions
+		expected []string
+	}{
+		{
+			opts:     UserKubeconfigOptions{User: "alice@example.com", Namespace: "payments", Role: "edit"},
+			expected: []string{"kind: RoleBinding", "name: kismatic-user-alice-example.com-", "namespace: payments", "kind: ClusterRole\n  name: edit", "kind: User\n  name: alice@example.com"},
+		},
+		{
+			opts:     UserKubeconfigOptions{User: "bob", Role: "view"},
+			expected: []string{"kind: ClusterRoleBinding", "name: kismatic-user-bob-", "kind: ClusterRole\n  name: view"},
+		},
+		{
+			opts:     UserKubeconfigOptions{User: "carol", Role: "view", OIDC: &OIDCAuthentication{IssuerURL: "https://accounts.example.com"}},
+			expected: []string{"name: kismatic-user-carol-", "kind: User\n  name: https://accounts.example.com#carol"},
+		},
+		{
+			opts:     UserKubeconfigOptions{User: "carol@example.com", Role: "view", OIDC: &OIDCAuthentication{IssuerURL: "https://accounts.example.com", UsernameClaim: "email"}},
+			expected: []string{"kind: User\n  name: carol@example.com"},
+		},
+	}
+	for _, test := range tests {
+		client := &recordingSSHClient{}
+		if err := ApplyUserBinding(client, test.opts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(client.commands) != 1 {
+			t.Fatalf("expected a single command, but got %v", client.commands)
+		}
+		fields := strings.Fields(client.commands[0])
+		manifest, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			t.Fatalf("error decoding the manifest: %v", err)
+		}
+		for _, e := range test.expected {
+			if !strings.Contains(string(manifest), e) {
+				t.Errorf("expected the manifest to contain %q, but got:\n%s", e, manifest)
+			}
+		}
+		if test.opts.Namespace == "" && strings.Contains(string(manifest), "namespace:") {
+			t.Errorf("expected no namespace in the ClusterRoleBinding, but got:\n%s", manifest)
+		}
+	}
+}
+
+func TestRevokeUserKubeconfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig-users-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err = RevokeUserKubeconfigs(dir, "alice", time.Now()); err == nil {
+		t.Error("expected an error when no kubeconfig was issued to the user")
+	}
+	records := []UserKubeconfigRecord{
+		{User: "alice", Namespace: "payments", Binding: "kismatic-user-alice", Serial: "1"},
+		{User: "bob", Binding: "kismatic-user-bob", Serial: "2"},
+		{User: "alice", Namespace: "payments", Binding: "kismatic-user-alice", Serial: "3"},
+	}
+	if err = WriteUserKubeconfigRecords(dir, records); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	revoked, err := RevokeUserKubeconfigs(dir, "alice", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revoked) != 2 || revoked[0].Serial != "1" || revoked[1].Serial != "3" {
+		t.Errorf("expected the certificates of alice to be revoked, but got %+v", revoked)
+	}
+	read, err := ReadUserKubeconfigRecords(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, r := range read {
+		if r.Revoked != (r.User == "alice") || (r.Revoked && r.RevokedAt == nil) {
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+	if _, err = RevokeUserKubeconfigs(dir, "alice", time.Now()); err == nil {
+		t.Error("expected an error when the kubeconfigs of the user are already revoked")
+	}
+
+	client := &recordingSSHClient{}
+	if err := DeleteUserBinding(client, records[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := DeleteUserBinding(client, records[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"sudo kubectl delete rolebinding kismatic-user-alice --namespace payments --ignore-not-found",
+		"sudo kubectl delete clusterrolebinding kismatic-user-bob --ignore-not-found",
+	}
+	for i, e := range expected {
+		if client.commands[i] != e {
+			t.Errorf("expected command %q, but got %q", e, client.commands[i])
+		}
+	}
+}
+
+func TestRenderKubeconfig(t *testing.T) {
+	kubeconfig, err := renderKubeconfig(ConfigOptions{CA: "Y2E+/w==", Server: "https://10.0.0.1:6443", Cluster: "test", User: "alice", Context: "test-alice", Cert: "Y2VydA==", Key: "a2V5", Namespace: "payments"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, e := range []string{"certificate-authority-data: Y2E+/w==\n", "    user: alice\n    namespace: payments\n  name: test-alice\n"} {
+		if !strings.Contains(string(kubeconfig), e) {
+			t.Errorf("expected the kubeconfig to contain %q, but got:\n%s", e, kubeconfig)
+		}
+	}
+	kubeconfig, err = renderKubeconfig(ConfigOptions{CA: "Y2E=", Server: "https://10.0.0.1:6443", Cluster: "test", User: "admin", Context: "test-admin", Cert: "Y2VydA==", Key: "a2V5"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(kubeconfig), "namespace") {
+		t.Errorf("expected no namespace in the kubeconfig, but got:\n%s", kubeconfig)
+	}
+}
+
+func TestRenderOIDCKubeconfig(t *testing.T) {
+	kubeconfig, err := renderKubeconfig(ConfigOptions{
+		CA:      "Y2E=",
+		Server:  "https://10.0.0.1:6443",
+		Cluster: "test",
+		User:    "alice",
+		Context: "test-alice",
+		OIDC:    &OIDCConfigOptions{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes", CA: "aWRwLWNh"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `  user:
+    auth-provider:
+      name: oidc
+      config:
+        client-id: kubernetes
+        idp-certificate-authority-data: aWRwLWNh
+        idp-issuer-url: https://accounts.example.com
+`
+	if !strings.HasSuffix(string(kubeconfig), expected) {
+		t.Errorf("expected the kubeconfig to end with:\n%s\nbut got:\n%s", expected, kubeconfig)
+	}
+	if strings.Contains(string(kubeconfig), "client-certificate-data") || strings.Contains(string(kubeconfig), "client-secret") {
+		t.Errorf("expected no client certificate nor client secret in the kubeconfig, but got:\n%s", kubeconfig)
+	}
+}
@@ -0,0 +1,257 @@
+package install
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ssh"
+)
+
+const (
+	// the name of the lock file in the generated assets directory
+	operationLockFilename = "operation.lock"
+	// the lock file on the first master node
+	remoteOperationLockFile = "/var/lib/kismatic/operation.lock"
+	// printed by the remote lock command when the lock is held by another run
+	remoteLockHeldMarker = "KISMATIC-LOCK-HELD"
+)
+
+// LockInfo describes the run that holds the operation lock of a cluster
+type LockInfo struct {
+	// Holder of the lock, in the form user@hostname
+	Holder string `json:"holder"`
+	// Command that is running
+	Command string `json:"command"`
+	// Task that is running
+	Task string `json:"task"`
+	// Started is when the lock was taken
+	Started time.Time `json:"started"`
+}
+
+// LockHeldError is returned when the operation lock of the cluster is held
+// by another run
+type LockHeldError struct {
+	// Location of the lock that is held
+	Location string
+	// Info about the holder of the lock
+	Info LockInfo
+}
+
+func (e LockHeldError) Error() string {
+	return fmt.Sprintf("the cluster is locked by %s, who has been running %q (task %q) since %s. "+
+		"The lock is held in %s. If no other run is in progress, use --force-unlock to remove the lock",
+		e.Info.Holder, e.Info.Command, e.Info.Task, e.Info.Started.Format(time.RFC1123), e.Location)
+}
+
+// operationLock is an exclusive lock
+type operationLock interface {
+	// Acquire the lock. A LockHeldError is returned if the lock is held.
+	Acquire(info LockInfo) error
+	// Release the lock
+	Release() error
+}
+
+// operationLocker takes the operation lock of a cluster before a task that
+// modifies the cluster. The lock is held both in the generated assets
+// directory and on the first master node, so that runs from other machines
+// are also detected. The lock can also be held for a whole operation, in
+// which case the tasks run without taking it again.
+type operationLocker struct {
+	generatedAssetsDir string
+	// forceUnlock removes the existing locks the first time a lock is taken
+	forceUnlock bool
+	// held is true while the lock is held for a whole operation
+	held bool
+
+	// Hook for testing purposes. The SSH lock is used at runtime.
+	remoteLock func(p Plan) (operationLock, error)
+}
+
+func newOperationLocker(generatedAssetsDir string, forceUnlock bool) *operationLocker {
+	return &operationLocker{
+		generatedAssetsDir: generatedAssetsDir,
+		forceUnlock:        forceUnlock,
+		remoteLock:         newSSHLock,
+	}
+}
+
+// hold takes the lock for a whole operation. The tasks that run until the
+// returned function releases it do not take the lock again.
+func (l *operationLocker) hold(p Plan, operation string) (func() error, error) {
+	release, err := l.lock(p, operation)
+	if err != nil {
+		return nil, err
+	}
+	l.held = true
+	return func() error {
+		l.held = false
+		return release()
+	}, nil
+}
+
+// lock takes the local and the remote lock for the task. The returned
+// function releases both. Nothing is done while the lock is held for the
+// whole operation.
+func (l *operationLocker) lock(p Plan, taskName string) (func() error, error) {
+	if l.held {
+		return func() error { return nil }, nil
+	}
+	locks := []operationLock{&fileLock{file: filepath.Join(l.generatedAssetsDir, operationLockFilename)}}
+	if len(p.Master.Nodes) > 0 {
+		remote, err := l.remoteLock(p)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, remote)
+	}
+	if l.forceUnlock {
+		for _, lock := range locks {
+			if err := lock.Release(); err != nil {
+				return nil, fmt.Errorf("error removing the operation lock: %v", err)
+			}
+		}
+		l.forceUnlock = false
+	}
+
+	info := LockInfo{
+		Holder:  lockHolder(),
+		Command: lockCommand(),
+		Task:    taskName,
+		Started: time.Now(),
+	}
+	var acquired []operationLock
+	release := func() error {
+		var errs []string
+		for _, lock := range acquired {
+			if err := lock.Release(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("error releasing the operation lock: %s", strings.Join(errs, "; "))
+		}
+		return nil
+	}
+	for _, lock := range locks {
+		if err := lock.Acquire(info); err != nil {
+			release()
+			return nil, err
+		}
+		acquired = append(acquired, lock)
+	}
+	return release, nil
+}
+
+func lockHolder() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name + "@" + host
+}
+
+func lockCommand() string {
+	if len(os.Args) == 0 {
+		return ""
+	}
+	return strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " ")
+}
+
+// fileLock is a lock file on the local file system
+type fileLock struct {
+	file string
+}
+
+func (l *fileLock) Acquire(info LockInfo) error {
+	if err := os.MkdirAll(filepath.Dir(l.file), 0755); err != nil {
+		return fmt.Errorf("error creating directory for the lock file: %v", err)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("error marshaling lock info: %v", err)
+	}
+	f, err := os.OpenFile(l.file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		held := LockHeldError{Location: l.file}
+		existing, err := ioutil.ReadFile(l.file)
+		if err != nil {
+			return fmt.Errorf("error reading lock file %q: %v", l.file, err)
+		}
+		if err := json.Unmarshal(existing, &held.Info); err != nil {
+			return fmt.Errorf("error reading lock file %q: %v", l.file, err)
+		}
+		return held
+	}
+	if err != nil {
+		return fmt.Errorf("error creating lock file %q: %v", l.file, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("error writing lock file %q: %v", l.file, err)
+	}
+	return nil
+}
+
+func (l *fileLock) Release() error {
+	if err := os.Remove(l.file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing lock file %q: %v", l.file, err)
+	}
+	return nil
+}
+
+// sshLock is a lock file on a node, that is created over SSH
+type sshLock struct {
+	host   string
+	client ssh.Client
+}
+
+func newSSHLock(p Plan) (operationLock, error) {
+	host := p.Master.Nodes[0].Host
+	client, err := p.GetSSHClient(host)
+	if err != nil {
+		return nil, err
+	}
+	return &sshLock{host: host, client: client}, nil
+}
+
+func (l *sshLock) Acquire(info LockInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("error marshaling lock info: %v", err)
+	}
+	// noclobber makes the shell fail if the lock file exists
+	cmd := fmt.Sprintf(`sudo sh -c 'mkdir -p %s && (set -C; echo %s | base64 -d > %s) 2>/dev/null || { echo %s; cat %s; exit 1; }'`,
+		filepath.Dir(remoteOperationLockFile), base64.StdEncoding.EncodeToString(data), remoteOperationLockFile,
+		remoteLockHeldMarker, remoteOperationLockFile)
+	out, err := l.client.Output(true, cmd)
+	if err == nil {
+		return nil
+	}
+	i := strings.Index(out, remoteLockHeldMarker)
+	if i < 0 {
+		return fmt.Errorf("error creating lock file on node %q: %v: %s", l.host, err, out)
+	}
+	held := LockHeldError{Location: fmt.Sprintf("%s on node %q", remoteOperationLockFile, l.host)}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out[i+len(remoteLockHeldMarker):])), &held.Info); err != nil {
+		return fmt.Errorf("error reading lock file on node %q: %v", l.host, err)
+	}
+	return held
+}
+
+func (l *sshLock) Release() error {
+	if out, err := l.client.Output(true, "sudo rm -f "+remoteOperationLockFile); err != nil {
+		return fmt.Errorf("error removing lock file on node %q: %v: %s", l.host, err, out)
+	}
+	return nil
+}
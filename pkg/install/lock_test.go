@@ -0,0 +1,175 @@
+package install
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+type fakeLock struct {
+	held     *LockInfo
+	released bool
+}
+
+func (l *fakeLock) Acquire(info LockInfo) error {
+	if l.held != nil {
+		return LockHeldError{Location: "fake", Info: *l.held}
+	}
+	l.held = &info
+	return nil
+}
+
+func (l *fakeLock) Release() error {
+	l.held = nil
+	l.released = true
+	return nil
+}
+
+func newTestLocker(t *testing.T, remote *fakeLock) *operationLocker {
+	return &operationLocker{
+		generatedAssetsDir: mustGetTempDir(t),
+		remoteLock:         func(Plan) (operationLock, error) { return remote, nil },
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	lock := &fileLock{file: filepath.Join(mustGetTempDir(t), "generated", operationLockFilename)}
+	holder := LockInfo{Holder: "alice@workstation", Command: "kismatic upgrade online", Task: "upgrade-nodes", Started: time.Now()}
+	if err := lock.Acquire(holder); err != nil {
+		t.Fatalf("unexpected error acquiring the lock: %v", err)
+	}
+	err := lock.Acquire(LockInfo{Holder: "bob@laptop", Command: "kismatic install add-worker"})
+	held, ok := err.(LockHeldError)
+	if !ok {
+		t.Fatalf("expected a LockHeldError, but got %v", err)
+	}
+	if held.Info.Holder != "alice@workstation" || held.Info.Command != "kismatic upgrade online" {
+		t.Errorf("expected the error to name the holder of the lock, but got %+v", held.Info)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("unexpected error releasing the lock: %v", err)
+	}
+	if err := lock.Acquire(holder); err != nil {
+		t.Errorf("unexpected error acquiring the released lock: %v", err)
+	}
+}
+
+func TestOperationLockerHeldRemotely(t *testing.T) {
+	remote := &fakeLock{held: &LockInfo{Holder: "alice@workstation"}}
+	l := newTestLocker(t, remote)
+	p := Plan{Master: MasterNodeGroup{Nodes: []Node{{Host: "master1"}}}}
+	if _, err := l.lock(p, "apply"); err == nil {
+		t.Fatal("expected an error when the lock is held on the master node")
+	}
+	// the local lock is released when the remote lock cannot be acquired
+	local := &fileLock{file: filepath.Join(l.generatedAssetsDir, operationLockFilename)}
+	if err := local.Acquire(LockInfo{}); err != nil {
+		t.Errorf("expected the local lock to be released, but got %v", err)
+	}
+}
+
+func TestOperationLockerForceUnlock(t *testing.T) {
+	remote := &fakeLock{held: &LockInfo{Holder: "alice@workstation"}}
+	l := newTestLocker(t, remote)
+	l.forceUnlock = true
+	local := &fileLock{file: filepath.Join(l.generatedAssetsDir, operationLockFilename)}
+	if err := local.Acquire(LockInfo{Holder: "alice@workstation"}); err != nil {
+		t.Fatalf("unexpected error acquiring the lock: %v", err)
+	}
+	p := Plan{Master: MasterNodeGroup{Nodes: []Node{{Host: "master1"}}}}
+	release, err := l.lock(p, "apply")
+	if err != nil {
+		t.Fatalf("expected the locks to be removed, but got %v", err)
+	}
+	if remote.held == nil || remote.held.Task != "apply" {
+		t.Errorf("expected the remote lock to be held by this run, but got %+v", remote.held)
+	}
+	if err := release(); err != nil {
+		t.Fatalf("unexpected error releasing the lock: %v", err)
+	}
+	if remote.held != nil {
+		t.Error("expected the remote lock to be released")
+	}
+	// the locks are only removed once
+	remote.held = &LockInfo{Holder: "bob@laptop"}
+	if _, err := l.lock(p, "apply"); err == nil {
+		t.Error("expected the lock of another run not to be removed")
+	}
+}
+
+func TestExecuteHoldsLockForMutatingTasks(t *testing.T) {
+	remote := &fakeLock{held: &LockInfo{Holder: "alice@workstation", Command: "kismatic upgrade online"}}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		locker:                 newTestLocker(t, remote),
+	}
+	p := Plan{Master: MasterNodeGroup{Nodes: []Node{{Host: "master1"}}}}
+	err := e.execute(task{name: "apply", playbook: "kubernetes.yaml", plan: p})
+	if _, ok := err.(LockHeldError); !ok {
+		t.Errorf("expected a LockHeldError, but got %v", err)
+	}
+	if err := e.execute(task{name: "preflight", playbook: "preflight.yaml", plan: p, readOnly: true}); err != nil {
+		t.Errorf("expected read-only tasks to run without the lock, but got %v", err)
+	}
+
+	remote.held = nil
+	if err := e.execute(task{name: "apply", playbook: "kubernetes.yaml", plan: p}); err != nil {
+		t.Errorf("unexpected error running the task: %v", err)
+	}
+	if !remote.released || remote.held != nil {
+		t.Error("expected the lock to be released once the task is done")
+	}
+}
+
+func TestLockClusterHoldsLockForOperation(t *testing.T) {
+	remote := &fakeLock{}
+	e := ansibleExecutor{
+		options:                ExecutorOptions{RunsDirectory: mustGetTempDir(t)},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+		locker:                 newTestLocker(t, remote),
+	}
+	p := Plan{Master: MasterNodeGroup{Nodes: []Node{{Host: "master1"}}}}
+	release, err := e.LockCluster(p, "upgrade")
+	if err != nil {
+		t.Fatalf("unexpected error taking the lock: %v", err)
+	}
+	if remote.held == nil || remote.held.Task != "upgrade" {
+		t.Fatalf("expected the lock to be held by the operation, but got %+v", remote.held)
+	}
+	// the tasks of the operation run with the lock of the operation
+	for _, name := range []string{"upgrade-nodes", "upgrade-cluster-services"} {
+		if err := e.execute(task{name: name, playbook: "kubernetes.yaml", plan: p}); err != nil {
+			t.Errorf("unexpected error running task %q: %v", name, err)
+		}
+		if remote.held == nil || remote.held.Task != "upgrade" {
+			t.Errorf("expected the lock to stay held after task %q, but got %+v", name, remote.held)
+		}
+	}
+	// another run cannot take the lock in the meantime
+	other := newOperationLocker(e.locker.generatedAssetsDir, false)
+	other.remoteLock = e.locker.remoteLock
+	if _, err := other.lock(p, "apply"); err == nil {
+		t.Error("expected another run not to take the lock of the operation")
+	}
+	if err := release(); err != nil {
+		t.Fatalf("unexpected error releasing the lock: %v", err)
+	}
+	if remote.held != nil {
+		t.Error("expected the lock to be released once the operation is done")
+	}
+	// the tasks take the lock again once the operation is done
+	if err := e.execute(task{name: "apply", playbook: "kubernetes.yaml", plan: p}); err != nil {
+		t.Errorf("unexpected error running the task: %v", err)
+	}
+	if !remote.released || remote.held != nil {
+		t.Error("expected the task to take and release the lock")
+	}
+}
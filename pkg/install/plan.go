@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -21,18 +22,59 @@ import (
 const (
 	ket133PackageManagerProvider = "helm"
 	defaultCAExpiry              = "17520h"
+	defaultAuditLogPath          = "/var/log/kubernetes/audit.log"
 )
 
 // PlanTemplateOptions contains the options that are desired when generating
-// a plan file template.
+// a plan file template. Options that are not set are given sensible defaults.
 type PlanTemplateOptions struct {
-	EtcdNodes     int
-	MasterNodes   int
-	WorkerNodes   int
-	IngressNodes  int
-	StorageNodes  int
-	NFSVolumes    int
-	AdminPassword string
+	EtcdNodes     int    `yaml:"etcd_nodes"`
+	MasterNodes   int    `yaml:"master_nodes"`
+	WorkerNodes   int    `yaml:"worker_nodes"`
+	IngressNodes  int    `yaml:"ingress_nodes"`
+	StorageNodes  int    `yaml:"storage_nodes"`
+	NFSVolumes    int    `yaml:"nfs_volumes"`
+	AdminPassword string `yaml:"admin_password"`
+
+	ClusterName                string `yaml:"cluster_name"`
+	DisablePackageInstallation bool   `yaml:"disable_package_installation"`
+	DisconnectedInstallation   bool   `yaml:"disconnected_installation"`
+
+	SSHUser string `yaml:"ssh_user"`
+	SSHKey  string `yaml:"ssh_key"`
+	SSHPort int    `yaml:"ssh_port"`
+
+	PodCIDRBlock     string `yaml:"pod_cidr_block"`
+	ServiceCIDRBlock string `yaml:"service_cidr_block"`
+	UpdateHostsFiles bool   `yaml:"update_hosts_files"`
+	HTTPProxy        string `yaml:"http_proxy"`
+	HTTPSProxy       string `yaml:"https_proxy"`
+	NoProxy          string `yaml:"no_proxy"`
+
+	LoadBalancedFQDN      string `yaml:"load_balanced_fqdn"`
+	LoadBalancedShortName string `yaml:"load_balanced_short_name"`
+
+	CloudProvider string `yaml:"cloud_provider"`
+	CloudConfig   string `yaml:"cloud_config"`
+
+	DockerDirectLVMBlockDevice string `yaml:"docker_direct_lvm_block_device"`
+
+	DockerRegistryAddress  string `yaml:"docker_registry_address"`
+	DockerRegistryPort     int    `yaml:"docker_registry_port"`
+	DockerRegistryCAPath   string `yaml:"docker_registry_ca"`
+	DockerRegistryUsername string `yaml:"docker_registry_username"`
+	DockerRegistryPassword string `yaml:"docker_registry_password"`
+
+	CNIProvider           string `yaml:"cni_provider"`
+	CalicoMode            string `yaml:"calico_mode"`
+	DisableDNS            bool   `yaml:"disable_dns"`
+	DisableHeapster       bool   `yaml:"disable_heapster"`
+	DisableDashboard      bool   `yaml:"disable_dashboard"`
+	DisablePackageManager bool   `yaml:"disable_package_manager"`
+
+	// Nodes of the cluster. When the nodes of a role are provided,
+	// the node count of the role is ignored.
+	Nodes NodeInventory `yaml:"nodes"`
 }
 
 // PlanReadWriter is capable of reading/writing a Plan
@@ -50,13 +92,26 @@ type Planner interface {
 // FilePlanner is a file-based installation planner
 type FilePlanner struct {
 	File string
+	// Overlays are plan files that are merged, in order, on top of File.
+	// Node lists are merged using the node's host.
+	Overlays []string
+	// VarsFile is a YAML file with the values of the ${VAR} references
+	// used in the plan files. Environment variables take precedence.
+	VarsFile string
+	// SecretsKeyFile is the key used to decrypt encrypted secrets.
+	// Defaults to DefaultSecretsKeyFile() when empty.
+	SecretsKeyFile string
 }
 
 // Read the plan from the file system
 func (fp *FilePlanner) Read() (*Plan, error) {
-	d, err := ioutil.ReadFile(fp.File)
+	vars, err := readPlanVars(fp.VarsFile)
+	if err != nil {
+		return nil, err
+	}
+	d, err := readMergedPlan(append([]string{fp.File}, fp.Overlays...), vars)
 	if err != nil {
-		return nil, fmt.Errorf("could not read file: %v", err)
+		return nil, err
 	}
 
 	p := &Plan{}
@@ -64,8 +119,10 @@ func (fp *FilePlanner) Read() (*Plan, error) {
 		return nil, fmt.Errorf("failed to unmarshal plan: %v", err)
 	}
 
-	// read deprecated fields and set it the new version of the cluster file
-	readDeprecatedFields(p)
+	// replace secret references with the actual secrets
+	if err = resolveSecrets(p, fp.SecretsKeyFile); err != nil {
+		return nil, err
+	}
 
 	// set nil values to defaults
 	setDefaults(p)
@@ -73,37 +130,16 @@ func (fp *FilePlanner) Read() (*Plan, error) {
 	return p, nil
 }
 
-func readDeprecatedFields(p *Plan) {
-	// only set if not already being set by the user
-	// package_manager moved from features: to add_ons: after KET v1.3.3
-	if p.Features != nil && p.Features.PackageManager != nil {
-		p.AddOns.PackageManager.Disable = !p.Features.PackageManager.Enabled
-		// KET v1.3.3 did not have a provider field
-		p.AddOns.PackageManager.Provider = ket133PackageManagerProvider
-	}
-	// allow_package_installation renamed to disable_package_installation after KET v1.4.0
-	if p.Cluster.AllowPackageInstallation != nil {
-		p.Cluster.DisablePackageInstallation = !*p.Cluster.AllowPackageInstallation
-	}
-
-	// Only read the deprecated dashboard field if the new one is not set
-	if p.AddOns.DashboardDeprecated != nil && p.AddOns.Dashboard == nil {
-		p.AddOns.Dashboard = &Dashboard{
-			Disable: p.AddOns.DashboardDeprecated.Disable,
-		}
+func setDefaults(p *Plan) {
+	if p.PlanVersion == 0 {
+		p.PlanVersion = CurrentPlanVersion
 	}
-}
 
-func setDefaults(p *Plan) {
 	if p.AddOns.CNI == nil {
 		p.AddOns.CNI = &CNI{}
 		p.AddOns.CNI.Provider = cniProviderCalico
 		p.AddOns.CNI.Options.Calico.Mode = "overlay"
 		p.AddOns.CNI.Options.Calico.LogLevel = "info"
-		// read KET <v1.5.0 plan option
-		if p.Cluster.Networking.Type != "" {
-			p.AddOns.CNI.Options.Calico.Mode = p.Cluster.Networking.Type
-		}
 	}
 	if p.AddOns.CNI.Options.Calico.LogLevel == "" {
 		p.AddOns.CNI.Options.Calico.LogLevel = "info"
@@ -115,19 +151,12 @@ func setDefaults(p *Plan) {
 	if p.AddOns.HeapsterMonitoring.Options.Heapster.Replicas == 0 {
 		p.AddOns.HeapsterMonitoring.Options.Heapster.Replicas = 2
 	}
-	// read field from KET < v1.5.0
-	if p.AddOns.HeapsterMonitoring.Options.HeapsterReplicas != 0 {
-		p.AddOns.HeapsterMonitoring.Options.Heapster.Replicas = p.AddOns.HeapsterMonitoring.Options.HeapsterReplicas
-	}
 	if p.AddOns.HeapsterMonitoring.Options.Heapster.Sink == "" {
 		p.AddOns.HeapsterMonitoring.Options.Heapster.Sink = "influxdb:http://heapster-influxdb.kube-system.svc:8086"
 	}
 	if p.AddOns.HeapsterMonitoring.Options.Heapster.ServiceType == "" {
 		p.AddOns.HeapsterMonitoring.Options.Heapster.ServiceType = "ClusterIP"
 	}
-	if p.AddOns.HeapsterMonitoring.Options.InfluxDBPVCName != "" {
-		p.AddOns.HeapsterMonitoring.Options.InfluxDB.PVCName = p.AddOns.HeapsterMonitoring.Options.InfluxDBPVCName
-	}
 
 	if p.Cluster.Certificates.CAExpiry == "" {
 		p.Cluster.Certificates.CAExpiry = defaultCAExpiry
@@ -142,29 +171,51 @@ var yamlKeyRE = regexp.MustCompile(`[^a-zA-Z]*([a-z_\-A-Z]+)[ ]*:`)
 
 // Write the plan to the file system
 func (fp *FilePlanner) Write(p *Plan) error {
-	// make a copy of the global comment map
-	oneTimeComments := map[string][]string{}
-	for k, v := range commentMap {
-		oneTimeComments[k] = v
+	if len(fp.Overlays) > 0 {
+		return errors.New("cannot write a plan that is the result of merging overlays, the plan files must be updated manually")
 	}
-	bytez, marshalErr := yaml.Marshal(p)
-	if marshalErr != nil {
-		return fmt.Errorf("error marshalling plan to yaml: %v", marshalErr)
+	usesVars, err := fp.UsesVariables()
+	if err != nil {
+		return err
+	}
+	if usesVars {
+		return errors.New("cannot write a plan that references variables, the plan file must be updated manually")
 	}
-
 	f, err := os.Create(fp.File)
 	if err != nil {
 		return fmt.Errorf("error making plan file: %v", err)
 	}
 	defer f.Close()
+	return WritePlan(f, p)
+}
+
+// WritePlan writes the plan as YAML to the writer, including the comments
+// that describe the plan fields. Secrets that were read from a reference
+// are written as the reference.
+func WritePlan(f io.Writer, p *Plan) error {
+	bytez, marshalErr := yaml.Marshal(withSecretRefs(p))
+	if marshalErr != nil {
+		return fmt.Errorf("error marshalling plan to yaml: %v", marshalErr)
+	}
+	return writeCommentedYAML(f, bytez)
+}
 
+// writeCommentedYAML writes the YAML document to the writer, adding the
+// comments of the plan fields it contains
+func writeCommentedYAML(f io.Writer, bytez []byte) error {
+	// make a copy of the global comment map
+	oneTimeComments := map[string][]string{}
+	for k, v := range commentMap {
+		oneTimeComments[k] = v
+	}
 	// the stack keeps track of the object we are in
 	// for example, when we are inside cluster.networking, looking at the key 'foo'
 	// the stack will have [cluster, networking, foo]
 	s := newStack()
 	scanner := bufio.NewScanner(bytes.NewReader(bytez))
 	prevIndent := -1
-	addNewLineBeforeComment := true
+	// no new line before the comment of the first field
+	addNewLineBeforeComment := false
 	for scanner.Scan() {
 		text := scanner.Text()
 		matched := yamlKeyRE.FindStringSubmatch(text)
@@ -174,7 +225,7 @@ func (fp *FilePlanner) Write(p *Plan) error {
 			// Add a new line if we are leaving a major indentation block
 			// (leaving a struct)..
 			if indent < prevIndent {
-				f.WriteString("\n")
+				io.WriteString(f, "\n")
 				// suppress the new line that would be added if this
 				// field has a comment
 				addNewLineBeforeComment = false
@@ -193,7 +244,7 @@ func (fp *FilePlanner) Write(p *Plan) error {
 
 			// Full key match (e.g. "cluster.networking.pod_cidr")
 			if thiscomment, ok := oneTimeComments[strings.Join(s.s, ".")]; ok {
-				if _, err := f.WriteString(getCommentedLine(text, thiscomment, addNewLineBeforeComment)); err != nil {
+				if _, err := io.WriteString(f, getCommentedLine(text, thiscomment, addNewLineBeforeComment)); err != nil {
 					return err
 				}
 				delete(oneTimeComments, matched[1])
@@ -202,7 +253,7 @@ func (fp *FilePlanner) Write(p *Plan) error {
 			}
 		}
 		// we don't want to comment this line... just print it out
-		if _, err := f.WriteString(text + "\n"); err != nil {
+		if _, err := io.WriteString(f, text+"\n"); err != nil {
 			return err
 		}
 		addNewLineBeforeComment = true
@@ -240,6 +291,24 @@ func countLeadingSpace(s string) int {
 	return i
 }
 
+// UsesVariables returns true if the plan file exists and one of its values
+// references a ${VAR}. Writing such a plan would replace the references with
+// their values.
+func (fp *FilePlanner) UsesVariables() (bool, error) {
+	d, err := ioutil.ReadFile(fp.File)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not read file: %v", err)
+	}
+	var doc interface{}
+	if err = yaml.Unmarshal(d, &doc); err != nil {
+		return false, fmt.Errorf("failed to unmarshal %q: %v", fp.File, err)
+	}
+	return planReferencesVars(doc), nil
+}
+
 // PlanExists return true if the plan exists on the file system
 func (fp *FilePlanner) PlanExists() bool {
 	_, err := os.Stat(fp.File)
@@ -266,84 +335,122 @@ func WritePlanTemplate(planTemplateOpts PlanTemplateOptions, w PlanReadWriter) e
 // template options
 func buildPlanFromTemplateOptions(templateOpts PlanTemplateOptions) Plan {
 	p := Plan{}
-	p.Cluster.Name = "kubernetes"
+	p.PlanVersion = CurrentPlanVersion
+	p.Cluster.Name = stringOrDefault(templateOpts.ClusterName, "kubernetes")
 	p.Cluster.AdminPassword = templateOpts.AdminPassword
-	p.Cluster.DisablePackageInstallation = false
-	p.Cluster.DisconnectedInstallation = false
+	p.Cluster.DisablePackageInstallation = templateOpts.DisablePackageInstallation
+	p.Cluster.DisconnectedInstallation = templateOpts.DisconnectedInstallation
 
 	// Set SSH defaults
-	p.Cluster.SSH.User = "kismaticuser"
-	p.Cluster.SSH.Key = "kismaticuser.key"
-	p.Cluster.SSH.Port = 22
+	p.Cluster.SSH.User = stringOrDefault(templateOpts.SSHUser, "kismaticuser")
+	p.Cluster.SSH.Key = stringOrDefault(templateOpts.SSHKey, "kismaticuser.key")
+	p.Cluster.SSH.Port = intOrDefault(templateOpts.SSHPort, 22)
 
 	// Set Networking defaults
-	p.Cluster.Networking.PodCIDRBlock = "172.16.0.0/16"
-	p.Cluster.Networking.ServiceCIDRBlock = "172.20.0.0/16"
-	p.Cluster.Networking.UpdateHostsFiles = false
+	p.Cluster.Networking.PodCIDRBlock = stringOrDefault(templateOpts.PodCIDRBlock, "172.16.0.0/16")
+	p.Cluster.Networking.ServiceCIDRBlock = stringOrDefault(templateOpts.ServiceCIDRBlock, "172.20.0.0/16")
+	p.Cluster.Networking.UpdateHostsFiles = templateOpts.UpdateHostsFiles
+	p.Cluster.Networking.HTTPProxy = templateOpts.HTTPProxy
+	p.Cluster.Networking.HTTPSProxy = templateOpts.HTTPSProxy
+	p.Cluster.Networking.NoProxy = templateOpts.NoProxy
 
 	// Set Certificate defaults
 	p.Cluster.Certificates.Expiry = "17520h"
 	p.Cluster.Certificates.CAExpiry = defaultCAExpiry
 
+	// Cloud provider
+	p.Cluster.CloudProvider.Provider = templateOpts.CloudProvider
+	p.Cluster.CloudProvider.Config = templateOpts.CloudConfig
+
+	// Docker
+	if templateOpts.DockerDirectLVMBlockDevice != "" {
+		p.Docker.Storage.DirectLVM.Enabled = true
+		p.Docker.Storage.DirectLVM.BlockDevice = templateOpts.DockerDirectLVMBlockDevice
+	}
+
 	// Set DockerRegistry defaults
-	p.DockerRegistry.Port = 8443
+	p.DockerRegistry.Address = templateOpts.DockerRegistryAddress
+	p.DockerRegistry.Port = intOrDefault(templateOpts.DockerRegistryPort, 8443)
+	p.DockerRegistry.CAPath = templateOpts.DockerRegistryCAPath
+	p.DockerRegistry.Username = templateOpts.DockerRegistryUsername
+	p.DockerRegistry.Password = templateOpts.DockerRegistryPassword
 
 	// Add-Ons
 	// CNI
 	p.AddOns.CNI = &CNI{}
-	p.AddOns.CNI.Provider = cniProviderCalico
-	p.AddOns.CNI.Options.Calico.Mode = "overlay"
+	p.AddOns.CNI.Provider = stringOrDefault(templateOpts.CNIProvider, cniProviderCalico)
+	p.AddOns.CNI.Options.Calico.Mode = stringOrDefault(templateOpts.CalicoMode, "overlay")
 	p.AddOns.CNI.Options.Calico.LogLevel = "info"
+	// DNS
+	p.AddOns.DNS.Disable = templateOpts.DisableDNS
 	// Heapster
 	p.AddOns.HeapsterMonitoring = &HeapsterMonitoring{}
+	p.AddOns.HeapsterMonitoring.Disable = templateOpts.DisableHeapster
 	p.AddOns.HeapsterMonitoring.Options.Heapster.Replicas = 2
 	p.AddOns.HeapsterMonitoring.Options.Heapster.ServiceType = "ClusterIP"
 	p.AddOns.HeapsterMonitoring.Options.Heapster.Sink = "influxdb:http://heapster-influxdb.kube-system.svc:8086"
 
 	// Package Manager
+	p.AddOns.PackageManager.Disable = templateOpts.DisablePackageManager
 	p.AddOns.PackageManager.Provider = "helm"
 
 	p.AddOns.Dashboard = &Dashboard{}
-	p.AddOns.Dashboard.Disable = false
+	p.AddOns.Dashboard.Disable = templateOpts.DisableDashboard
 
 	// Generate entries for all node types
-	p.Etcd.ExpectedCount = templateOpts.EtcdNodes
-	p.Master.ExpectedCount = templateOpts.MasterNodes
-	p.Worker.ExpectedCount = templateOpts.WorkerNodes
-	p.Ingress.ExpectedCount = templateOpts.IngressNodes
-	p.Storage.ExpectedCount = templateOpts.StorageNodes
+	p.Etcd.Nodes = nodesOrPlaceholders(templateOpts.Nodes.Etcd, templateOpts.EtcdNodes)
+	p.Etcd.ExpectedCount = len(p.Etcd.Nodes)
+	p.Master.Nodes = nodesOrPlaceholders(templateOpts.Nodes.Master, templateOpts.MasterNodes)
+	p.Master.ExpectedCount = len(p.Master.Nodes)
+	p.Worker.Nodes = nodesOrPlaceholders(templateOpts.Nodes.Worker, templateOpts.WorkerNodes)
+	p.Worker.ExpectedCount = len(p.Worker.Nodes)
+	p.Ingress.Nodes = nodesOrPlaceholders(templateOpts.Nodes.Ingress, templateOpts.IngressNodes)
+	p.Ingress.ExpectedCount = len(p.Ingress.Nodes)
+	p.Storage.Nodes = nodesOrPlaceholders(templateOpts.Nodes.Storage, templateOpts.StorageNodes)
+	p.Storage.ExpectedCount = len(p.Storage.Nodes)
+
+	// With a single master, the master's address can be used instead of a load balancer.
+	// With more masters, the load balancer is left empty so that the plan fails validation.
+	p.Master.LoadBalancedFQDN = templateOpts.LoadBalancedFQDN
+	p.Master.LoadBalancedShortName = templateOpts.LoadBalancedShortName
+	if len(templateOpts.Nodes.Master) == 1 {
+		p.Master.LoadBalancedFQDN = stringOrDefault(p.Master.LoadBalancedFQDN, templateOpts.Nodes.Master[0].IP)
+		p.Master.LoadBalancedShortName = stringOrDefault(p.Master.LoadBalancedShortName, templateOpts.Nodes.Master[0].IP)
+	}
 
 	for i := 0; i < templateOpts.NFSVolumes; i++ {
 		v := NFSVolume{Host: "", Path: "/"}
 		p.NFS.Volumes = append(p.NFS.Volumes, v)
 	}
 
-	n := Node{}
-	for i := 0; i < p.Etcd.ExpectedCount; i++ {
-		p.Etcd.Nodes = append(p.Etcd.Nodes, n)
-	}
+	return p
+}
 
-	for i := 0; i < p.Master.ExpectedCount; i++ {
-		p.Master.Nodes = append(p.Master.Nodes, n)
+// returns the provided nodes, or the given number of empty nodes that
+// must be filled in by the user
+func nodesOrPlaceholders(nodes []Node, count int) []Node {
+	if len(nodes) > 0 {
+		return nodes
 	}
-
-	for i := 0; i < p.Worker.ExpectedCount; i++ {
-		p.Worker.Nodes = append(p.Worker.Nodes, n)
+	var placeholders []Node
+	for i := 0; i < count; i++ {
+		placeholders = append(placeholders, Node{})
 	}
+	return placeholders
+}
 
-	if p.Ingress.ExpectedCount > 0 {
-		for i := 0; i < p.Ingress.ExpectedCount; i++ {
-			p.Ingress.Nodes = append(p.Ingress.Nodes, n)
-		}
+func stringOrDefault(s, def string) string {
+	if s == "" {
+		return def
 	}
+	return s
+}
 
-	if p.Storage.ExpectedCount > 0 {
-		for i := 0; i < p.Storage.ExpectedCount; i++ {
-			p.Storage.Nodes = append(p.Storage.Nodes, n)
-		}
+func intOrDefault(i, def int) int {
+	if i == 0 {
+		return def
 	}
-
-	return p
+	return i
 }
 
 func getKubernetesServiceIP(p *Plan) (string, error) {
@@ -391,6 +498,7 @@ func generateAlphaNumericPassword() (string, error) {
 // in the plan file. The value of the map contains the comment, split into
 // separate lines.
 var commentMap = map[string][]string{
+	"plan_version":                                       []string{"Version of the plan file format. Use \"kismatic install plan migrate\" to", "update a plan file to the latest version."},
 	"cluster.admin_password":                             []string{"This password is used to login to the Kubernetes Dashboard and can also be", "used for administration without a security certificate."},
 	"cluster.disable_package_installation":               []string{"Set to true if the nodes have the required packages installed."},
 	"cluster.disconnected_installation":                  []string{"Set to true if you are performing a disconnected installation."},
@@ -411,6 +519,15 @@ var commentMap = map[string][]string{
 	"cluster.cloud_provider":                             []string{"Kubernetes cloud provider integration"},
 	"cluster.cloud_provider.provider":                    []string{"Options: 'aws','azure','cloudstack','fake','gce','mesos','openstack',", "'ovirt','photon','rackspace','vsphere'.", "Leave empty for bare metal setups or other unsupported providers."},
 	"cluster.cloud_provider.config":                      []string{"Path to the config file, leave empty if provider does not require it."},
+	"cluster.authentication":                             []string{"Authentication of users with the Kubernetes API server."},
+	"cluster.authentication.oidc":                        []string{"OpenID Connect authentication of users. Leave issuer_url empty to disable it."},
+	"cluster.authentication.oidc.ca_file":                []string{"Path to the CA of the identity provider, leave empty to use the host's root CAs."},
+	"cluster.audit":                                      []string{"Audit logging of the requests received by the Kubernetes API server."},
+	"cluster.audit.policy_file":                          []string{"Path to the audit policy file, leave empty to use the built-in policy."},
+	"cluster.audit.log_path":                             []string{"Path of the audit log on the master nodes. Defaults to", "'/var/log/kubernetes/audit.log' when the webhook backend is not used."},
+	"cluster.audit.webhook_config_file":                  []string{"Path to the kubeconfig file of the audit webhook, leave empty to use", "the audit log file."},
+	"cluster.encryption_at_rest":                         []string{"Encryption of Secrets by the Kubernetes API server before they are stored in etcd."},
+	"cluster.encryption_at_rest.provider":                []string{"Options: 'aescbc','secretbox'. Defaults to 'aescbc'."},
 	"docker":                                             []string{"Docker daemon configuration of all cluster nodes"},
 	"etcd":                                               []string{"Etcd nodes are the ones that run the etcd distributed key-value database."},
 	"etcd.nodes":                                         []string{"Provide the hostname and IP of each node. If the node has an IP for internal", "traffic, provide it in the internalip field. Otherwise, that field can be", "left blank."},
@@ -0,0 +1,139 @@
+package install
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// NodeInventory contains the nodes of a cluster, grouped by role
+type NodeInventory struct {
+	Etcd    []Node `yaml:"etcd"`
+	Master  []Node `yaml:"master"`
+	Worker  []Node `yaml:"worker"`
+	Ingress []Node `yaml:"ingress"`
+	Storage []Node `yaml:"storage"`
+}
+
+func (inv *NodeInventory) add(role string, n Node) error {
+	switch role {
+	case "etcd":
+		inv.Etcd = append(inv.Etcd, n)
+	case "master":
+		inv.Master = append(inv.Master, n)
+	case "worker":
+		inv.Worker = append(inv.Worker, n)
+	case "ingress":
+		inv.Ingress = append(inv.Ingress, n)
+	case "storage":
+		inv.Storage = append(inv.Storage, n)
+	default:
+		return fmt.Errorf("%q is not a valid role", role)
+	}
+	return nil
+}
+
+// ReadNodeInventory reads the nodes of the cluster from an inventory file.
+// Files with a ".csv" extension are expected to contain host, ip, internal_ip
+// and role columns. Multiple roles can be separated with ";". Any other file
+// is read as an Ansible INI inventory, where the groups are the node roles.
+func ReadNodeInventory(file string) (*NodeInventory, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read inventory file: %v", err)
+	}
+	defer f.Close()
+	if strings.ToLower(filepath.Ext(file)) == ".csv" {
+		return readCSVInventory(f)
+	}
+	return readINIInventory(f)
+}
+
+func readCSVInventory(r io.Reader) (*NodeInventory, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV inventory: %v", err)
+	}
+	inv := &NodeInventory{}
+	for i, rec := range records {
+		if i == 0 && strings.ToLower(rec[0]) == "host" {
+			// skip the header
+			continue
+		}
+		if len(rec) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 columns (host, ip, internal_ip, role), but got %d", i+1, len(rec))
+		}
+		n := Node{Host: rec[0], IP: rec[1], InternalIP: rec[2]}
+		for _, role := range strings.Split(rec[3], ";") {
+			if err := inv.add(strings.TrimSpace(role), n); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+	}
+	return inv, nil
+}
+
+// reads an Ansible INI inventory. Hosts in groups that are not KET roles
+// are ignored, as well as the group variables and children.
+func readINIInventory(r io.Reader) (*NodeInventory, error) {
+	inv := &NodeInventory{}
+	s := bufio.NewScanner(r)
+	var group string
+	var lineNum int
+	for s.Scan() {
+		lineNum++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = strings.Trim(line, "[]")
+			continue
+		}
+		if !util.Contains(group, nodeRoles()) {
+			continue
+		}
+		fields := strings.Fields(line)
+		n := Node{Host: strings.Trim(fields[0], `"'`)}
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("line %d: invalid host variable %q", lineNum, f)
+			}
+			val := strings.Trim(kv[1], `"'`)
+			switch kv[0] {
+			case "ansible_host", "ansible_ssh_host":
+				n.IP = val
+			case "internal_ipv4", "internal_ip":
+				n.InternalIP = val
+			}
+		}
+		if n.IP == "" {
+			n.IP = n.Host
+		}
+		if n.InternalIP == n.IP {
+			n.InternalIP = ""
+		}
+		if err := inv.add(group, n); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("error reading INI inventory: %v", err)
+	}
+	return inv, nil
+}
+
+func nodeRoles() []string {
+	return []string{"etcd", "master", "worker", "ingress", "storage"}
+}
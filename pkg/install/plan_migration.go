@@ -0,0 +1,146 @@
+package install
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// CurrentPlanVersion is the version of the plan file that is produced by
+// this version of KET. It must be increased whenever a change to the plan
+// requires a migration.
+const CurrentPlanVersion = 1
+
+// A planMigration converts a plan document from one version to the next.
+type planMigration func(doc map[interface{}]interface{})
+
+// planMigrations contains the chain of migrations, where the migration at
+// index i converts a plan of version i to version i+1.
+var planMigrations = []planMigration{
+	migratePlanV0,
+}
+
+// ReadPlanVersion returns the version of the plan file, without
+// migrating it.
+func ReadPlanVersion(file string) (int, error) {
+	d, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, fmt.Errorf("could not read file: %v", err)
+	}
+	v := struct {
+		PlanVersion int `yaml:"plan_version"`
+	}{}
+	if err = yaml.Unmarshal(d, &v); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal plan: %v", err)
+	}
+	return v.PlanVersion, nil
+}
+
+// MigratePlanFile returns the plan file migrated to the current version.
+// The document is migrated as written, without substituting variables,
+// resolving secrets or setting defaults.
+func MigratePlanFile(file string) ([]byte, error) {
+	d, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: %v", err)
+	}
+	doc := map[interface{}]interface{}{}
+	if err = yaml.Unmarshal(d, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal plan: %v", err)
+	}
+	if err = migratePlan(doc); err != nil {
+		return nil, err
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling plan to yaml: %v", err)
+	}
+	var buf bytes.Buffer
+	if err = writeCommentedYAML(&buf, b); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// migratePlan applies all the migrations required to bring the plan
+// document to the current version.
+func migratePlan(doc map[interface{}]interface{}) error {
+	version, _ := doc["plan_version"].(int)
+	if version > CurrentPlanVersion {
+		return fmt.Errorf("plan version %d is not supported by this version of kismatic, the latest supported version is %d", version, CurrentPlanVersion)
+	}
+	for v := version; v < CurrentPlanVersion; v++ {
+		planMigrations[v](doc)
+	}
+	doc["plan_version"] = CurrentPlanVersion
+	return nil
+}
+
+// migratePlanV0 converts the fields that were deprecated before the plan was
+// versioned, and removes them from the plan.
+func migratePlanV0(doc map[interface{}]interface{}) {
+	cluster := yamlMap(doc, "cluster")
+	addOns := yamlMap(doc, "add_ons")
+
+	// package_manager moved from features: to add_ons: after KET v1.3.3
+	if features, ok := doc["features"].(map[interface{}]interface{}); ok {
+		if pm, ok := features["package_manager"].(map[interface{}]interface{}); ok {
+			enabled, _ := pm["enabled"].(bool)
+			newPM := yamlMap(addOns, "package_manager")
+			newPM["disable"] = !enabled
+			// KET v1.3.3 did not have a provider field
+			newPM["provider"] = ket133PackageManagerProvider
+		}
+	}
+	delete(doc, "features")
+
+	// allow_package_installation renamed to disable_package_installation after KET v1.4.0
+	if allow, ok := cluster["allow_package_installation"].(bool); ok {
+		cluster["disable_package_installation"] = !allow
+	}
+	delete(cluster, "allow_package_installation")
+
+	// dashbard renamed to dashboard. Only read the deprecated field if the new one is not set
+	if _, ok := addOns["dashbard"]; ok && addOns["dashboard"] == nil {
+		addOns["dashboard"] = addOns["dashbard"]
+	}
+	delete(addOns, "dashbard")
+
+	// cluster.networking.type moved to the CNI options in KET v1.5.0
+	networking := yamlMap(cluster, "networking")
+	if t, ok := networking["type"]; ok && t != "" && addOns["cni"] == nil {
+		addOns["cni"] = map[interface{}]interface{}{
+			"provider": cniProviderCalico,
+			"options": map[interface{}]interface{}{
+				"calico": map[interface{}]interface{}{"mode": t},
+			},
+		}
+	}
+	delete(networking, "type")
+
+	// heapster options were restructured in KET v1.5.0
+	if heapster, ok := addOns["heapster"].(map[interface{}]interface{}); ok {
+		if opts, ok := heapster["options"].(map[interface{}]interface{}); ok {
+			if r, ok := opts["heapster_replicas"]; ok && r != 0 {
+				yamlMap(opts, "heapster")["replicas"] = r
+			}
+			delete(opts, "heapster_replicas")
+			if pvc, ok := opts["influxdb_pvc_name"]; ok && pvc != "" {
+				yamlMap(opts, "influxdb")["pvc_name"] = pvc
+			}
+			delete(opts, "influxdb_pvc_name")
+		}
+	}
+}
+
+// yamlMap returns the map stored under key, creating it if it does not exist
+func yamlMap(m map[interface{}]interface{}, key string) map[interface{}]interface{} {
+	if v, ok := m[key].(map[interface{}]interface{}); ok {
+		return v
+	}
+	v := map[interface{}]interface{}{}
+	m[key] = v
+	return v
+}
@@ -0,0 +1,228 @@
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// the key used to match list items when merging an overlay onto a plan.
+// Node lists are merged by host, all other lists are replaced.
+const overlayMergeKey = "host"
+
+// an overlay list item that contains this key set to "delete" removes
+// the matching item from the base list
+const overlayPatchKey = "$patch"
+
+var planVarRE = regexp.MustCompile(`\$(\$?)\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// readPlanVars reads a YAML file containing a flat map of variable names to values.
+func readPlanVars(file string) (map[string]string, error) {
+	vars := map[string]string{}
+	if file == "" {
+		return vars, nil
+	}
+	d, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read vars file: %v", err)
+	}
+	if err = yaml.Unmarshal(d, &vars); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vars file %q: %v", file, err)
+	}
+	return vars, nil
+}
+
+// a variable reference that makes up a whole value is replaced by a number or
+// a boolean when the variable holds one, so that it can be used in fields that
+// are not strings. Values with leading zeros are kept as strings.
+var planVarIntRE = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+// substitutePlanVars replaces all ${VAR} references in the string values of
+// the parsed plan document. Keys, comments and values that are not strings are
+// left untouched, and the substituted values are never parsed as YAML.
+// Variables set in the environment take precedence over the ones defined in
+// vars. A literal "${VAR}" can be written as "$${VAR}".
+func substitutePlanVars(doc interface{}, vars map[string]string) (interface{}, error) {
+	var missing []string
+	res := walkPlanValues(doc, func(s string) interface{} {
+		whole := planVarRE.FindStringIndex(s)
+		res := planVarRE.ReplaceAllStringFunc(s, func(match string) string {
+			sub := planVarRE.FindStringSubmatch(match)
+			if len(sub[1]) > 0 {
+				return match[1:]
+			}
+			name := sub[2]
+			if v, ok := os.LookupEnv(name); ok {
+				return v
+			}
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			missing = append(missing, name)
+			return match
+		})
+		if whole == nil || whole[0] != 0 || whole[1] != len(s) || s[1] == '$' {
+			return res
+		}
+		if planVarIntRE.MatchString(res) {
+			if i, err := strconv.Atoi(res); err == nil {
+				return i
+			}
+		}
+		if res == "true" || res == "false" {
+			return res == "true"
+		}
+		return res
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined variables referenced in plan: %v", missing)
+	}
+	return res, nil
+}
+
+// planReferencesVars returns true if a string value of the parsed plan document
+// contains a ${VAR} reference
+func planReferencesVars(doc interface{}) bool {
+	found := false
+	walkPlanValues(doc, func(s string) interface{} {
+		for _, sub := range planVarRE.FindAllStringSubmatch(s, -1) {
+			if len(sub[1]) == 0 {
+				found = true
+			}
+		}
+		return s
+	})
+	return found
+}
+
+// walkPlanValues returns a copy of the document where every string value
+// has been replaced with the result of calling fn on it
+func walkPlanValues(doc interface{}, fn func(string) interface{}) interface{} {
+	switch d := doc.(type) {
+	case map[interface{}]interface{}:
+		res := map[interface{}]interface{}{}
+		for k, v := range d {
+			res[k] = walkPlanValues(v, fn)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(d))
+		for i, v := range d {
+			res[i] = walkPlanValues(v, fn)
+		}
+		return res
+	case string:
+		return fn(d)
+	default:
+		return doc
+	}
+}
+
+// mergePlanOverlay merges the overlay on top of the base document.
+// Maps are merged recursively, and scalar values in the overlay replace
+// the ones in the base. Lists of nodes are merged using the node's host,
+// while any other list in the overlay replaces the list in the base.
+func mergePlanOverlay(base, overlay interface{}) interface{} {
+	switch o := overlay.(type) {
+	case map[interface{}]interface{}:
+		b, ok := base.(map[interface{}]interface{})
+		if !ok {
+			return o
+		}
+		merged := map[interface{}]interface{}{}
+		for k, v := range b {
+			merged[k] = v
+		}
+		for k, v := range o {
+			merged[k] = mergePlanOverlay(b[k], v)
+		}
+		return merged
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || !keyedList(b) || !keyedList(o) {
+			return o
+		}
+		return mergeKeyedList(b, o)
+	default:
+		return overlay
+	}
+}
+
+// keyedList returns true if every item in the list is a map with a merge key
+func keyedList(l []interface{}) bool {
+	for _, item := range l {
+		m, ok := item.(map[interface{}]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m[overlayMergeKey]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeKeyedList(base, overlay []interface{}) []interface{} {
+	merged := make([]interface{}, len(base))
+	copy(merged, base)
+	for _, item := range overlay {
+		o := item.(map[interface{}]interface{})
+		key := o[overlayMergeKey]
+		idx := -1
+		for i, b := range merged {
+			if b.(map[interface{}]interface{})[overlayMergeKey] == key {
+				idx = i
+				break
+			}
+		}
+		if o[overlayPatchKey] == "delete" {
+			if idx >= 0 {
+				merged = append(merged[:idx], merged[idx+1:]...)
+			}
+			continue
+		}
+		if idx >= 0 {
+			merged[idx] = mergePlanOverlay(merged[idx], o)
+			continue
+		}
+		merged = append(merged, o)
+	}
+	return merged
+}
+
+// readMergedPlan reads the base plan and all the overlays, substitutes the
+// variables in their values, migrates them to the current plan version and returns the
+// merged YAML document
+func readMergedPlan(files []string, vars map[string]string) ([]byte, error) {
+	var merged interface{}
+	for _, file := range files {
+		d, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file: %v", err)
+		}
+		var doc interface{}
+		if err = yaml.Unmarshal(d, &doc); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %q: %v", file, err)
+		}
+		if doc, err = substitutePlanVars(doc, vars); err != nil {
+			return nil, fmt.Errorf("error processing %q: %v", file, err)
+		}
+		if doc == nil {
+			continue
+		}
+		if m, ok := doc.(map[interface{}]interface{}); ok {
+			if err = migratePlan(m); err != nil {
+				return nil, fmt.Errorf("error migrating %q: %v", file, err)
+			}
+		}
+		merged = mergePlanOverlay(merged, doc)
+	}
+	if merged == nil {
+		return []byte{}, nil
+	}
+	return yaml.Marshal(merged)
+}
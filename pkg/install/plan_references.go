@@ -0,0 +1,102 @@
+package install
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// a pathField is a plan field that holds the path of a file on the machine
+// that reads the plan
+type pathField struct {
+	name  string
+	value func(p *Plan) string
+}
+
+var pathFields = []pathField{
+	{"cluster.ssh.ssh_key", func(p *Plan) string { return p.Cluster.SSH.Key }},
+	{"cluster.cloud_provider.config", func(p *Plan) string { return p.Cluster.CloudProvider.Config }},
+	{"cluster.authentication.oidc.ca_file", func(p *Plan) string { return p.Cluster.Authentication.OIDC.CAFile }},
+	{"cluster.audit.policy_file", func(p *Plan) string { return p.Cluster.Audit.PolicyFile }},
+	{"cluster.audit.webhook_config_file", func(p *Plan) string { return p.Cluster.Audit.WebhookConfigFile }},
+	{"docker_registry.CA", func(p *Plan) string { return p.DockerRegistry.CAPath }},
+}
+
+// ValidateLocalReferences validates the references of a plan file to the
+// machine that reads it, so that a plan submitted by a remote user can only
+// use the files it is allowed to. The files of the path fields and of the
+// "file:" secret references must be inside one of the allowed directories.
+// Plan variables, "env:" secret references and encrypted secrets are not
+// allowed, as they would read the environment and the secrets key of the
+// machine. None of the references are resolved.
+func ValidateLocalReferences(data []byte, allowedDirs []string) (bool, []error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, []error{fmt.Errorf("failed to unmarshal plan: %v", err)}
+	}
+	p := &Plan{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return false, []error{fmt.Errorf("failed to unmarshal plan: %v", err)}
+	}
+	v := newValidator()
+	if planReferencesVars(doc) {
+		v.addError(fmt.Errorf("the plan cannot reference variables"))
+	}
+	for _, f := range secretFields {
+		ref := *f.value(p)
+		switch {
+		case strings.HasPrefix(ref, secretRefEnv), strings.HasPrefix(ref, secretRefEncrypted):
+			v.addError(fmt.Errorf("%s cannot be an %q or %q secret reference", f.name, secretRefEnv, secretRefEncrypted))
+		case strings.HasPrefix(ref, secretRefFile):
+			if path := strings.TrimPrefix(ref, secretRefFile); !pathInDirectories(path, allowedDirs) {
+				v.addError(fmt.Errorf("%s references the file %q, that is not in an allowed directory", f.name, path))
+			}
+		}
+	}
+	for _, f := range pathFields {
+		path := f.value(p)
+		if path == "" || isSecretRef(path) {
+			continue
+		}
+		if !pathInDirectories(path, allowedDirs) {
+			v.addError(fmt.Errorf("%s references the file %q, that is not in an allowed directory", f.name, path))
+		}
+	}
+	return v.valid()
+}
+
+// pathInDirectories returns true if the path is inside one of the directories,
+// once symbolic links are followed
+func pathInDirectories(path string, dirs []string) bool {
+	path, err := realPath(path)
+	if err != nil {
+		return false
+	}
+	for _, d := range dirs {
+		dir, err := realPath(d)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// realPath returns the absolute path, with the symbolic links resolved when
+// the file exists
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
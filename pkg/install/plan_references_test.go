@@ -0,0 +1,51 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateLocalReferences(t *testing.T) {
+	dir := mustGetTempDir(t)
+	defer os.RemoveAll(dir)
+	allowed := filepath.Join(dir, "allowed")
+	if err := os.Mkdir(allowed, 0700); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	// a link in the allowed directory to a file outside of it
+	if err := os.Symlink(filepath.Join(dir, "secret"), filepath.Join(allowed, "link")); err != nil {
+		t.Fatalf("error creating link: %v", err)
+	}
+	tests := []struct {
+		plan  string
+		valid bool
+	}{
+		{"cluster:\n  ssh:\n    ssh_key: " + allowed + "/key\n", true},
+		{"cluster:\n  ssh:\n    ssh_key: " + allowed + "/../secret\n", false},
+		{"cluster:\n  ssh:\n    ssh_key: " + allowed + "/link\n", false},
+		{"cluster:\n  ssh:\n    ssh_key: " + allowed + "\n", false},
+		{"cluster:\n  cloud_provider:\n    config: file:" + allowed + "/cloud.conf\n", true},
+		{"cluster:\n  cloud_provider:\n    config: /etc/cloud.conf\n", false},
+		{"cluster:\n  authentication:\n    oidc:\n      ca_file: /etc/ca.pem\n", false},
+		{"cluster:\n  audit:\n    policy_file: /etc/policy.yaml\n", false},
+		{"cluster:\n  audit:\n    webhook_config_file: /etc/webhook.yaml\n", false},
+		{"docker_registry:\n  CA: /etc/ca.pem\n", false},
+		{"cluster:\n  admin_password: file:/etc/passwd\n", false},
+		{"cluster:\n  admin_password: env:HOME\n", false},
+		{"cluster:\n  admin_password: enc:c2VjcmV0\n", false},
+		{"cluster:\n  admin_password: ${HOME}\n", false},
+		{"cluster:\n  admin_password: $${HOME}\n", true},
+		{"cluster:\n  admin_password: password\n", true},
+	}
+	for _, test := range tests {
+		ok, errs := ValidateLocalReferences([]byte(test.plan), []string{allowed})
+		if ok != test.valid {
+			t.Errorf("expected valid to be %v, but got %v (%v) for plan:\n%s", test.valid, ok, errs, test.plan)
+		}
+	}
+}
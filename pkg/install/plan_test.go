@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"testing"
+
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestWritePlanTemplate(t *testing.T) {
@@ -50,7 +52,7 @@ func TestWritePlanTemplate(t *testing.T) {
 			t.Fatalf("error creating temp dir: %v", err)
 		}
 		file := filepath.Join(tmp, "kismatic-cluster.yaml")
-		fp := &FilePlanner{file}
+		fp := &FilePlanner{File: file}
 		if err = WritePlanTemplate(test.template, fp); err != nil {
 			t.Fatalf("error writing plan template: %v", err)
 		}
@@ -78,16 +80,15 @@ func TestGenerateAlphaNumericPassword(t *testing.T) {
 }
 
 func TestReadWithDeprecated(t *testing.T) {
-	pm := &DeprecatedPackageManager{
-		Enabled: true,
-	}
-	p := &Plan{}
-	p.Features = &Features{
-		PackageManager: pm,
+	doc := map[interface{}]interface{}{
+		"features": map[interface{}]interface{}{
+			"package_manager": map[interface{}]interface{}{"enabled": true},
+		},
+		"cluster": map[interface{}]interface{}{
+			"allow_package_installation": false,
+		},
 	}
-	b := false
-	p.Cluster.AllowPackageInstallation = &b
-	readDeprecatedFields(p)
+	p := readMigratedPlan(t, doc)
 
 	// features.package_manager should be set to add_ons.package_manager
 	if p.AddOns.PackageManager.Disable || p.AddOns.PackageManager.Provider != "helm" {
@@ -97,6 +98,79 @@ func TestReadWithDeprecated(t *testing.T) {
 	if p.Cluster.DisablePackageInstallation != true {
 		t.Errorf("Expected cluster.allow_package_installation to be read from cluster.disable_package_installation")
 	}
+	if p.PlanVersion != CurrentPlanVersion {
+		t.Errorf("Expected plan version to be %d, but got %d", CurrentPlanVersion, p.PlanVersion)
+	}
+}
+
+func TestMigratePlanV0(t *testing.T) {
+	doc := map[interface{}]interface{}{
+		"cluster": map[interface{}]interface{}{
+			"networking": map[interface{}]interface{}{
+				"type":           "routed",
+				"pod_cidr_block": "172.16.0.0/16",
+			},
+		},
+		"add_ons": map[interface{}]interface{}{
+			"heapster": map[interface{}]interface{}{
+				"options": map[interface{}]interface{}{
+					"heapster_replicas": 3,
+					"influxdb_pvc_name": "influx",
+				},
+			},
+		},
+	}
+	p := readMigratedPlan(t, doc)
+
+	if p.AddOns.CNI == nil || p.AddOns.CNI.Provider != "calico" || p.AddOns.CNI.Options.Calico.Mode != "routed" {
+		t.Errorf("Expected add_ons.cni to be read from cluster.networking.type, got %+v", p.AddOns.CNI)
+	}
+	if p.Cluster.Networking.PodCIDRBlock != "172.16.0.0/16" {
+		t.Errorf("Expected pod_cidr_block to be preserved, got %q", p.Cluster.Networking.PodCIDRBlock)
+	}
+	if p.AddOns.HeapsterMonitoring.Options.Heapster.Replicas != 3 {
+		t.Errorf("Expected heapster replicas to be read from heapster_replicas, got %d", p.AddOns.HeapsterMonitoring.Options.Heapster.Replicas)
+	}
+	if p.AddOns.HeapsterMonitoring.Options.InfluxDB.PVCName != "influx" {
+		t.Errorf("Expected influxdb pvc name to be read from influxdb_pvc_name, got %q", p.AddOns.HeapsterMonitoring.Options.InfluxDB.PVCName)
+	}
+}
+
+func TestMigratePlanUnsupportedVersion(t *testing.T) {
+	doc := map[interface{}]interface{}{"plan_version": CurrentPlanVersion + 1}
+	if err := migratePlan(doc); err == nil {
+		t.Errorf("expected an error migrating a plan with an unsupported version")
+	}
+}
+
+func TestMigratePlanIsIdempotent(t *testing.T) {
+	doc := map[interface{}]interface{}{
+		"plan_version": CurrentPlanVersion,
+		"cluster": map[interface{}]interface{}{
+			"disable_package_installation": true,
+		},
+	}
+	p := readMigratedPlan(t, doc)
+	if !p.Cluster.DisablePackageInstallation {
+		t.Errorf("Expected cluster.disable_package_installation to be left untouched")
+	}
+}
+
+// migrates the document, and unmarshals it into a plan
+func readMigratedPlan(t *testing.T, doc map[interface{}]interface{}) *Plan {
+	if err := migratePlan(doc); err != nil {
+		t.Fatalf("unexpected error migrating plan: %v", err)
+	}
+	d, err := yaml.Marshal(doc)
+	if err != nil {
+		t.Fatalf("error marshaling plan: %v", err)
+	}
+	p := &Plan{}
+	if err = yaml.Unmarshal(d, p); err != nil {
+		t.Fatalf("error unmarshaling plan: %v", err)
+	}
+	setDefaults(p)
+	return p
 }
 
 func TestReadWithNil(t *testing.T) {
@@ -193,7 +267,7 @@ func TestReadDeprecatedDashboard(t *testing.T) {
 			t.Fatalf("error writing plan file")
 		}
 
-		planner := FilePlanner{file}
+		planner := FilePlanner{File: file}
 		plan, err := planner.Read()
 		if err != nil {
 			t.Fatalf("error reading plan file")
@@ -205,3 +279,280 @@ func TestReadDeprecatedDashboard(t *testing.T) {
 	}
 
 }
+
+func TestReadWithOverlays(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-read-with-overlays")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	base := `
+cluster:
+  name: ${CLUSTER_NAME}
+  networking:
+    pod_cidr_block: 172.16.0.0/16
+docker_registry:
+  address: ${REGISTRY}
+worker:
+  expected_count: 2
+  nodes:
+  - host: worker1
+    ip: 10.0.0.1
+  - host: worker2
+    ip: 10.0.0.2
+`
+	overlay := `
+cluster:
+  networking:
+    pod_cidr_block: 10.10.0.0/16
+worker:
+  expected_count: 2
+  nodes:
+  - host: worker1
+    ip: 192.168.0.1
+  - host: worker2
+    $patch: delete
+  - host: worker3
+    ip: 192.168.0.3
+`
+	vars := `
+CLUSTER_NAME: staging
+REGISTRY: registry.local
+`
+	files := map[string]string{"base.yaml": base, "overlay.yaml": overlay, "vars.yaml": vars}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0666); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+
+	os.Setenv("REGISTRY", "registry.example.com")
+	defer os.Unsetenv("REGISTRY")
+
+	planner := FilePlanner{
+		File:     filepath.Join(tmpDir, "base.yaml"),
+		Overlays: []string{filepath.Join(tmpDir, "overlay.yaml")},
+		VarsFile: filepath.Join(tmpDir, "vars.yaml"),
+	}
+	plan, err := planner.Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading plan: %v", err)
+	}
+	if plan.Cluster.Name != "staging" {
+		t.Errorf("expected cluster name to be read from vars file, but got %q", plan.Cluster.Name)
+	}
+	if plan.DockerRegistry.Address != "registry.example.com" {
+		t.Errorf("expected registry address to be read from the environment, but got %q", plan.DockerRegistry.Address)
+	}
+	if plan.Cluster.Networking.PodCIDRBlock != "10.10.0.0/16" {
+		t.Errorf("expected pod CIDR to be overridden by overlay, but got %q", plan.Cluster.Networking.PodCIDRBlock)
+	}
+	expectedWorkers := []Node{{Host: "worker1", IP: "192.168.0.1"}, {Host: "worker3", IP: "192.168.0.3"}}
+	if len(plan.Worker.Nodes) != len(expectedWorkers) {
+		t.Fatalf("expected %d workers, but got %d", len(expectedWorkers), len(plan.Worker.Nodes))
+	}
+	for i, n := range expectedWorkers {
+		if !plan.Worker.Nodes[i].Equal(n) {
+			t.Errorf("expected worker %d to be %v, but got %v", i, n, plan.Worker.Nodes[i])
+		}
+	}
+
+	if err = planner.Write(plan); err == nil {
+		t.Errorf("expected an error writing a plan with overlays, but got nil")
+	}
+}
+
+func TestSubstitutePlanVars(t *testing.T) {
+	tests := []struct {
+		in          string
+		vars        map[string]string
+		expected    string
+		shouldError bool
+	}{
+		{
+			in:       "name: ${NAME}",
+			vars:     map[string]string{"NAME": "foo"},
+			expected: "name: foo",
+		},
+		{
+			in:       "password: pa$$word",
+			expected: "password: pa$$word",
+		},
+		{
+			in:       "name: $${NAME}",
+			expected: "name: ${NAME}",
+		},
+		{
+			in:       "name: $NAME",
+			expected: "name: $NAME",
+		},
+		{
+			in:          "name: ${UNDEFINED_KET_TEST_VAR}",
+			shouldError: true,
+		},
+		{
+			// references in comments are ignored
+			in:       "# set ${UNDEFINED_KET_TEST_VAR} to the name\nname: foo",
+			expected: "name: foo",
+		},
+		{
+			// values are never parsed as YAML
+			in:       "password: ${PASSWORD}",
+			vars:     map[string]string{"PASSWORD": "a#b: c\nd: e"},
+			expected: "password: |-\n  a#b: c\n  d: e",
+		},
+		{
+			in:       "url: http://${HOST}:${PORT}",
+			vars:     map[string]string{"HOST": "example.com", "PORT": "8080"},
+			expected: "url: http://example.com:8080",
+		},
+		{
+			in:       "count: ${COUNT}",
+			vars:     map[string]string{"COUNT": "3"},
+			expected: "count: 3",
+		},
+		{
+			in:       "mode: ${MODE}",
+			vars:     map[string]string{"MODE": "0755"},
+			expected: `mode: "0755"`,
+		},
+		{
+			in:       "nodes:\n- host: ${HOST}",
+			vars:     map[string]string{"HOST": "node1"},
+			expected: "nodes:\n- host: node1",
+		},
+	}
+	for _, test := range tests {
+		var doc interface{}
+		if err := yaml.Unmarshal([]byte(test.in), &doc); err != nil {
+			t.Fatalf("error unmarshalling %q: %v", test.in, err)
+		}
+		res, err := substitutePlanVars(doc, test.vars)
+		if err != nil && !test.shouldError {
+			t.Errorf("unexpected error substituting %q: %v", test.in, err)
+		}
+		if err == nil && test.shouldError {
+			t.Errorf("expected an error substituting %q, but got nil", test.in)
+		}
+		if err != nil {
+			continue
+		}
+		out, err := yaml.Marshal(res)
+		if err != nil {
+			t.Fatalf("error marshalling %v: %v", res, err)
+		}
+		if string(bytes.TrimSpace(out)) != test.expected {
+			t.Errorf("expected %q, but got %q", test.expected, string(out))
+		}
+	}
+}
+
+func TestWritePlanWithVariables(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-write-plan-with-vars")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	planner := FilePlanner{File: filepath.Join(tmpDir, "kismatic-cluster.yaml")}
+	if err = ioutil.WriteFile(planner.File, []byte("cluster:\n  name: $${NAME}\n"), 0666); err != nil {
+		t.Fatalf("error writing plan: %v", err)
+	}
+	if usesVars, err := planner.UsesVariables(); err != nil || usesVars {
+		t.Errorf("expected an escaped reference not to be a variable, but got %v, %v", usesVars, err)
+	}
+	if err = ioutil.WriteFile(planner.File, []byte("cluster:\n  name: ${NAME}\n"), 0666); err != nil {
+		t.Fatalf("error writing plan: %v", err)
+	}
+	if usesVars, err := planner.UsesVariables(); err != nil || !usesVars {
+		t.Errorf("expected the plan to use variables, but got %v, %v", usesVars, err)
+	}
+	if err = planner.Write(&Plan{}); err == nil {
+		t.Errorf("expected an error writing a plan that references variables, but got nil")
+	}
+	d, err := ioutil.ReadFile(planner.File)
+	if err != nil {
+		t.Fatalf("error reading plan: %v", err)
+	}
+	if string(d) != "cluster:\n  name: ${NAME}\n" {
+		t.Errorf("expected the plan file to be left untouched, but got %q", d)
+	}
+}
+
+func TestReadNodeInventory(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-read-node-inventory")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ini := `
+[etcd]
+"etcd01" ansible_host="10.0.0.1" internal_ipv4="192.168.0.1"
+
+[master]
+master01 ansible_host=10.0.0.2
+
+[worker]
+10.0.0.3
+
+[all:vars]
+ansible_user=root
+`
+	csv := `host,ip,internal_ip,role
+etcd01,10.0.0.1,192.168.0.1,etcd
+master01,10.0.0.2,,master
+10.0.0.3,10.0.0.3,,worker;ingress
+`
+	expected := NodeInventory{
+		Etcd:   []Node{{Host: "etcd01", IP: "10.0.0.1", InternalIP: "192.168.0.1"}},
+		Master: []Node{{Host: "master01", IP: "10.0.0.2"}},
+		Worker: []Node{{Host: "10.0.0.3", IP: "10.0.0.3"}},
+	}
+	tests := []struct {
+		file            string
+		content         string
+		expectedIngress int
+	}{
+		{file: "inventory.ini", content: ini},
+		{file: "inventory.csv", content: csv, expectedIngress: 1},
+	}
+	for _, test := range tests {
+		file := filepath.Join(tmpDir, test.file)
+		if err = ioutil.WriteFile(file, []byte(test.content), 0666); err != nil {
+			t.Fatalf("error writing inventory: %v", err)
+		}
+		inv, err := ReadNodeInventory(file)
+		if err != nil {
+			t.Fatalf("%s: unexpected error reading inventory: %v", test.file, err)
+		}
+		groups := map[string][2][]Node{
+			"etcd":   {expected.Etcd, inv.Etcd},
+			"master": {expected.Master, inv.Master},
+			"worker": {expected.Worker, inv.Worker},
+		}
+		for role, g := range groups {
+			if len(g[0]) != len(g[1]) {
+				t.Errorf("%s: expected %d %s nodes, got %d", test.file, len(g[0]), role, len(g[1]))
+				continue
+			}
+			for i := range g[0] {
+				if !g[0][i].Equal(g[1][i]) {
+					t.Errorf("%s: expected %s node %v, got %v", test.file, role, g[0][i], g[1][i])
+				}
+			}
+		}
+		if len(inv.Ingress) != test.expectedIngress {
+			t.Errorf("%s: expected %d ingress nodes, got %d", test.file, test.expectedIngress, len(inv.Ingress))
+		}
+	}
+
+	file := filepath.Join(tmpDir, "bad.csv")
+	if err = ioutil.WriteFile(file, []byte("etcd01,10.0.0.1,,database\n"), 0666); err != nil {
+		t.Fatalf("error writing inventory: %v", err)
+	}
+	if _, err = ReadNodeInventory(file); err == nil {
+		t.Errorf("expected an error reading an inventory with an invalid role, but got nil")
+	}
+}
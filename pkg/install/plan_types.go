@@ -41,6 +41,9 @@ func cloudProviders() []string {
 
 // Plan is the installation plan that the user intends to execute
 type Plan struct {
+	// The version of the plan file format. Plan files of previous versions
+	// are migrated to the latest version when read.
+	PlanVersion int `yaml:"plan_version"`
 	// Kubernetes cluster configuration
 	// +required
 	Cluster Cluster
@@ -50,9 +53,6 @@ type Plan struct {
 	DockerRegistry DockerRegistry `yaml:"docker_registry"`
 	// Add on configuration
 	AddOns AddOns `yaml:"add_ons"`
-	// Feature configuration
-	// +deprecated
-	Features *Features `yaml:"features,omitempty"`
 	// Etcd nodes of the cluster
 	// +required
 	Etcd NodeGroup
@@ -68,6 +68,9 @@ type Plan struct {
 	Storage OptionalNodeGroup
 	// NFS volumes of the cluster.
 	NFS NFS
+
+	// references to the secrets that were resolved when reading the plan
+	secretRefs map[string]secretRef
 }
 
 // Cluster describes a Kubernetes cluster
@@ -77,16 +80,13 @@ type Cluster struct {
 	// +required
 	Name string
 	// The password for the admin user. This is mainly used to access the Kubernetes Dashboard.
+	// Can be a secret reference, such as `env:VAR`, `file:/path` or an `enc:` encrypted value.
 	// +required
 	AdminPassword string `yaml:"admin_password"`
 	// Whether KET should install the packages on the cluster nodes.
 	// When true, KET will not install the required packages.
 	// Instead, it will verify that the packages have been installed by the operator.
 	DisablePackageInstallation bool `yaml:"disable_package_installation"`
-	// Whether KET should install the packages on the cluster nodes.
-	// Use DisablePackageInstallation instead.
-	// +deprecated
-	AllowPackageInstallation *bool `yaml:"allow_package_installation,omitempty"`
 	// Whether the cluster nodes are disconnected from the internet.
 	// When set to `true`, internal package repositories and a container image
 	// registry are required for installation.
@@ -110,6 +110,12 @@ type Cluster struct {
 	KubeletOptions KubeletOptions `yaml:"kubelet"`
 	// The CloudProvider configuration for the cluster.
 	CloudProvider CloudProvider `yaml:"cloud_provider"`
+	// The Authentication configuration of the Kubernetes API server.
+	Authentication Authentication
+	// The Audit configuration of the Kubernetes API server.
+	Audit Audit
+	// The configuration of the encryption of Secrets before they are stored in etcd.
+	EncryptionAtRest EncryptionAtRest `yaml:"encryption_at_rest"`
 }
 
 type APIServerOptions struct {
@@ -148,11 +154,6 @@ type KubeletOptions struct {
 
 // NetworkConfig describes the cluster's networking configuration
 type NetworkConfig struct {
-	// The datapath technique that should be configured in Calico.
-	// +default=overlay
-	// +options=overlay,routed
-	// +deprecated
-	Type string `yaml:"type,omitempty"`
 	// The pod network's CIDR block. For example: `172.16.0.0/16`
 	// +required
 	PodCIDRBlock string `yaml:"pod_cidr_block"`
@@ -206,10 +207,73 @@ type CloudProvider struct {
 	// The cloud provider that should be set in the Kubernetes components
 	// +options=aws,azure,cloudstack,fake,gce,mesos,openstack,ovirt,photon,rackspace,vsphere
 	Provider string
-	// Path to the cloud provider config file. This will be copied to all the machines in the cluster
+	// Path to the cloud provider config file. This will be copied to all the machines in the cluster.
+	// Can be a secret reference, such as `env:VAR`, `file:/path` or an `enc:` encrypted value.
 	Config string
 }
 
+// Authentication describes how users authenticate with the Kubernetes API server
+type Authentication struct {
+	// OpenID Connect authentication of users, using ID tokens issued by an identity provider.
+	OIDC OIDCAuthentication `yaml:"oidc"`
+}
+
+// OIDCAuthentication is the configuration of the OpenID Connect authenticator of the API server
+type OIDCAuthentication struct {
+	// The URL of the OpenID Connect issuer. Must use the https scheme.
+	// OpenID Connect authentication is disabled when empty.
+	IssuerURL string `yaml:"issuer_url"`
+	// The client ID of the cluster, that all ID tokens must be issued for.
+	// Required when the issuer URL is set.
+	ClientID string `yaml:"client_id"`
+	// The claim of the ID token that is used as the name of the user.
+	// Claims other than `email` are prefixed with the issuer URL.
+	// +default=sub
+	UsernameClaim string `yaml:"username_claim"`
+	// The claim of the ID token that is used as the groups of the user.
+	GroupsClaim string `yaml:"groups_claim"`
+	// Path to the certificate authority that signed the certificate of the identity provider.
+	// The file is copied to the master nodes. The host's root CAs are used when empty.
+	CAFile string `yaml:"ca_file"`
+}
+
+// Audit is the configuration of the audit logging of the API server
+type Audit struct {
+	// Whether the API server should audit the requests it receives.
+	// +default=false
+	Enabled bool
+	// Path to the audit policy file, that defines which requests are audited and what is recorded.
+	// The file is copied to the master nodes. A built-in policy is used when empty, that records
+	// the metadata of all requests, and does not record the content of secrets and configmaps.
+	PolicyFile string `yaml:"policy_file"`
+	// Path of the audit log file on the master nodes.
+	// Cannot be set when the webhook backend is used.
+	// +default=/var/log/kubernetes/audit.log
+	LogPath string `yaml:"log_path"`
+	// The maximum number of days to retain old audit log files.
+	LogMaxAge int `yaml:"log_max_age"`
+	// The maximum size in megabytes of the audit log file before it gets rotated.
+	LogMaxSize int `yaml:"log_max_size"`
+	// The maximum number of old audit log files to retain.
+	LogMaxBackups int `yaml:"log_max_backups"`
+	// Path to a kubeconfig file that describes the webhook the audit events are sent to.
+	// The file is copied to the master nodes. When set, the webhook backend is used
+	// instead of the audit log file.
+	WebhookConfigFile string `yaml:"webhook_config_file"`
+}
+
+// EncryptionAtRest is the configuration of the encryption of Secrets by the API server
+type EncryptionAtRest struct {
+	// Whether Secrets should be encrypted by the API server before they are stored in etcd.
+	// The encryption key is generated and stored in the generated assets directory.
+	// +default=false
+	Enabled bool
+	// The provider used to encrypt Secrets.
+	// +options=aescbc,secretbox
+	// +default=aescbc
+	Provider string
+}
+
 // Docker includes the configuration for the docker installation owned by KET.
 type Docker struct {
 	// Storage configuration for the docker engine
@@ -254,6 +318,7 @@ type DockerRegistry struct {
 	Username string
 	// The password that should be used when connecting to a registry that has authentication enabled.
 	// Otherwise leave blank for unauthenticated access.
+	// Can be a secret reference, such as `env:VAR`, `file:/path` or an `enc:` encrypted value.
 	Password string
 }
 
@@ -268,21 +333,10 @@ type AddOns struct {
 	HeapsterMonitoring *HeapsterMonitoring `yaml:"heapster"`
 	// The Dashboard add-on configuration.
 	Dashboard *Dashboard `yaml:"dashboard"`
-	// The Dashboard add-on configuration.
-	// +deprecated
-	DashboardDeprecated *Dashboard `yaml:"dashbard,omitempty"`
 	// The PackageManager add-on configuration.
 	PackageManager PackageManager `yaml:"package_manager"`
 }
 
-// Features configuration
-// +deprecated
-type Features struct {
-	// The PackageManager feature configuration.
-	// +deprecated
-	PackageManager *DeprecatedPackageManager `yaml:"package_manager,omitempty"`
-}
-
 // CNI add-on configuration
 type CNI struct {
 	// Whether the CNI add-on is disabled. When set to true,
@@ -339,14 +393,6 @@ type HeapsterOptions struct {
 	Heapster Heapster `yaml:"heapster"`
 	// The InfluxDB configuration options.
 	InfluxDB InfluxDB `yaml:"influxdb"`
-	// Number of Heapster replicas that should be scheduled on the cluster.
-	// +deprecated
-	HeapsterReplicas int `yaml:"heapster_replicas,omitempty"`
-	// Name of the Persistent Volume Claim that will be used by InfluxDB.
-	// When set, this PVC must be created after the installation.
-	// If not set, InfluxDB will be configured with ephemeral storage.
-	// +deprecated
-	InfluxDBPVCName string `yaml:"influxdb_pvc_name,omitempty"`
 }
 
 // Heapster configuration options for the Heapster add-on
@@ -391,12 +437,6 @@ type PackageManager struct {
 	Provider string
 }
 
-type DeprecatedPackageManager struct {
-	// Whether the package manager add-on should be enabled.
-	// +deprecated
-	Enabled bool
-}
-
 // MasterNodeGroup is the collection of master nodes
 type MasterNodeGroup struct {
 	// Number of master nodes that are part of the cluster.
@@ -450,6 +490,15 @@ type Node struct {
 	// Kubelet configuration applied to this node.
 	// If a node is repeated for multiple roles, the overrides cannot be different.
 	KubeletOptions KubeletOptions `yaml:"kubelet,omitempty"`
+	// Kubernetes API Server configuration applied to this node, on top of the cluster-wide configuration.
+	// Can only be set on master nodes. If a node is repeated for multiple roles, the overrides cannot be different.
+	APIServerOptions APIServerOptions `yaml:"kube_apiserver,omitempty"`
+	// Kubernetes Controller Manager configuration applied to this node, on top of the cluster-wide configuration.
+	// Can only be set on master nodes. If a node is repeated for multiple roles, the overrides cannot be different.
+	KubeControllerManagerOptions KubeControllerManagerOptions `yaml:"kube_controller_manager,omitempty"`
+	// Kubernetes Scheduler configuration applied to this node, on top of the cluster-wide configuration.
+	// Can only be set on master nodes. If a node is repeated for multiple roles, the overrides cannot be different.
+	KubeSchedulerOptions KubeSchedulerOptions `yaml:"kube_scheduler,omitempty"`
 }
 
 // Equal returns true of 2 nodes have the same host, IP and InternalIP
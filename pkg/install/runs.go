@@ -0,0 +1,246 @@
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+)
+
+// the format of the run directory names
+const runTimestampFormat = "2006-01-02-15-04-05"
+
+// RunStatus is the status of a run
+type RunStatus string
+
+const (
+	// RunSucceeded is a run where all tasks succeeded
+	RunSucceeded = RunStatus("succeeded")
+	// RunFailed is a run where at least one task failed, or a node was unreachable
+	RunFailed = RunStatus("failed")
+	// RunIncomplete is a run that is in progress, or that was interrupted
+	RunIncomplete = RunStatus("incomplete")
+	// RunUnknown is a run that did not record its events
+	RunUnknown = RunStatus("unknown")
+)
+
+// Run is an execution of a task, recorded in the runs directory
+type Run struct {
+	// ID of the run, in the form "task/timestamp"
+	ID string
+	// Task that was run, e.g. "apply"
+	Task string
+	// Directory of the run
+	Directory string
+	// Start of the run
+	Start time.Time
+	// End of the run, which is the last time an event was recorded
+	End time.Time
+	// Status of the run
+	Status RunStatus
+	// PlanHash is the hash of the plan that was used for the run
+	PlanHash string
+}
+
+// Duration of the run
+func (r Run) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// HostSummary contains the results of the tasks that ran on a host
+type HostSummary struct {
+	Host        string
+	OK          int
+	Failed      int
+	Ignored     int
+	Skipped     int
+	Unreachable int
+	// FailedTasks are the names of the tasks that failed on the host
+	FailedTasks []string
+}
+
+// ListRuns returns the runs recorded in the runs directory, newest first
+func ListRuns(runsDir string) ([]Run, error) {
+	tasks, err := ioutil.ReadDir(runsDir)
+	if os.IsNotExist(err) {
+		return []Run{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading runs directory: %v", err)
+	}
+	runs := []Run{}
+	for _, task := range tasks {
+		if !task.IsDir() {
+			continue
+		}
+		dirs, err := ioutil.ReadDir(filepath.Join(runsDir, task.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading runs directory: %v", err)
+		}
+		for _, d := range dirs {
+			if !d.IsDir() {
+				continue
+			}
+			r, err := readRun(runsDir, task.Name()+"/"+d.Name())
+			if err != nil {
+				// not a run directory
+				continue
+			}
+			runs = append(runs, *r)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Start.After(runs[j].Start)
+	})
+	return runs, nil
+}
+
+// ReadRun returns the run with the given ID
+func ReadRun(runsDir, id string) (*Run, error) {
+	r, err := readRun(runsDir, id)
+	if err != nil {
+		return nil, fmt.Errorf("run %q not found: %v", id, err)
+	}
+	return r, nil
+}
+
+func readRun(runsDir, id string) (*Run, error) {
+	parts := strings.Split(filepath.ToSlash(id), "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("run ID must be in the form TASK/TIMESTAMP")
+	}
+	start, err := time.ParseInLocation(runTimestampFormat, parts[1], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run timestamp: %v", err)
+	}
+	dir := filepath.Join(runsDir, parts[0], parts[1])
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("run directory %q does not exist", dir)
+	}
+	r := &Run{
+		ID:        parts[0] + "/" + parts[1],
+		Task:      parts[0],
+		Directory: dir,
+		Start:     start,
+		End:       start,
+		Status:    RunUnknown,
+	}
+	for _, f := range []string{ansible.EventsFilename, "ansible.log"} {
+		if fi, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			if fi.ModTime().After(r.End) {
+				r.End = fi.ModTime()
+			}
+		}
+	}
+	if plan, err := ioutil.ReadFile(filepath.Join(dir, "kismatic-cluster.yaml")); err == nil {
+		sum := sha256.Sum256(plan)
+		r.PlanHash = hex.EncodeToString(sum[:])[:12]
+	}
+	if _, err := os.Stat(filepath.Join(dir, ansible.EventsFilename)); err == nil {
+		status, _, err := replayRun(dir)
+		if err != nil {
+			return nil, err
+		}
+		r.Status = status
+	}
+	return r, nil
+}
+
+// RunHostSummaries replays the events of the run, and returns the results
+// of the tasks on each host
+func RunHostSummaries(r *Run) ([]HostSummary, error) {
+	_, summaries, err := replayRun(r.Directory)
+	return summaries, err
+}
+
+func replayRun(dir string) (RunStatus, []HostSummary, error) {
+	f, err := os.Open(filepath.Join(dir, ansible.EventsFilename))
+	if err != nil {
+		return RunUnknown, nil, fmt.Errorf("could not read the events of the run: %v", err)
+	}
+	defer f.Close()
+	hosts := map[string]*HostSummary{}
+	host := func(name string) *HostSummary {
+		if _, ok := hosts[name]; !ok {
+			hosts[name] = &HostSummary{Host: name}
+		}
+		return hosts[name]
+	}
+	var ended, failed bool
+	var currentTask string
+	for e := range ansible.EventStream(f) {
+		switch event := e.(type) {
+		case *ansible.TaskStartEvent:
+			currentTask = event.Name
+		case *ansible.HandlerTaskStartEvent:
+			currentTask = event.Name
+		case *ansible.PlaybookEndEvent:
+			ended = true
+		case *ansible.RunnerOKEvent:
+			host(event.Host).OK++
+		case *ansible.RunnerSkippedEvent:
+			host(event.Host).Skipped++
+		case *ansible.RunnerUnreachableEvent:
+			host(event.Host).Unreachable++
+			failed = true
+		case *ansible.RunnerFailedEvent:
+			h := host(event.Host)
+			if event.IgnoreErrors {
+				h.Ignored++
+				continue
+			}
+			h.Failed++
+			h.FailedTasks = append(h.FailedTasks, currentTask)
+			failed = true
+		}
+	}
+	summaries := []HostSummary{}
+	for _, h := range hosts {
+		summaries = append(summaries, *h)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Host < summaries[j].Host
+	})
+	status := RunIncomplete
+	if failed {
+		status = RunFailed
+	} else if ended {
+		status = RunSucceeded
+	}
+	return status, summaries, nil
+}
+
+// PruneRuns removes the runs that started before olderThan ago, and the runs
+// that exceed the newest keep runs. A zero value disables the corresponding
+// criteria. The removed runs are returned.
+func PruneRuns(runsDir string, olderThan time.Duration, keep int, now time.Time) ([]Run, error) {
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		return nil, err
+	}
+	removed := []Run{}
+	for i, r := range runs {
+		expired := olderThan > 0 && now.Sub(r.Start) > olderThan
+		exceeded := keep > 0 && i >= keep
+		if !expired && !exceeded {
+			continue
+		}
+		if err := os.RemoveAll(r.Directory); err != nil {
+			return removed, fmt.Errorf("error removing run %q: %v", r.ID, err)
+		}
+		removed = append(removed, r)
+		// remove the task directory if this was its last run
+		taskDir := filepath.Dir(r.Directory)
+		if left, err := ioutil.ReadDir(taskDir); err == nil && len(left) == 0 {
+			os.Remove(taskDir)
+		}
+	}
+	return removed, nil
+}
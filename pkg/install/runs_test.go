@@ -0,0 +1,136 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const succeededRunEvents = `{"eventType": "PLAYBOOK_START", "eventData": {"count": 1, "name": "kubernetes.yaml"}}
+{"eventType": "PLAY_START", "eventData": {"name": "etcd"}}
+{"eventType": "TASK_START", "eventData": {"name": "install etcd"}}
+{"eventType": "RUNNER_OK", "eventData": {"host": "etcd01", "ignoreErrors": false, "result": {}}}
+{"eventType": "RUNNER_FAILED", "eventData": {"host": "etcd02", "ignoreErrors": true, "result": {}}}
+{"eventType": "RUNNER_SKIPPED", "eventData": {"host": "etcd02", "ignoreErrors": false, "result": {}}}
+{"eventType": "PLAYBOOK_END", "eventData": {}}
+`
+
+const failedRunEvents = `{"eventType": "PLAYBOOK_START", "eventData": {"count": 1, "name": "kubernetes.yaml"}}
+{"eventType": "PLAY_START", "eventData": {"name": "worker"}}
+{"eventType": "TASK_START", "eventData": {"name": "install docker"}}
+{"eventType": "RUNNER_OK", "eventData": {"host": "worker01", "ignoreErrors": false, "result": {}}}
+{"eventType": "RUNNER_FAILED", "eventData": {"host": "worker02", "ignoreErrors": false, "result": {"msg": "failed"}}}
+{"eventType": "PLAYBOOK_END", "eventData": {}}
+`
+
+func writeTestRun(t *testing.T, runsDir, id, events string) {
+	dir := filepath.Join(runsDir, id)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatalf("error creating run dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kismatic-cluster.yaml"), []byte("cluster:\n  name: test\n"), 0644); err != nil {
+		t.Fatalf("error writing plan: %v", err)
+	}
+	if events == "" {
+		return
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "events.jsonl"), []byte(events), 0644); err != nil {
+		t.Fatalf("error writing events: %v", err)
+	}
+}
+
+func TestListRuns(t *testing.T) {
+	runsDir, err := ioutil.TempDir("", "test-list-runs")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(runsDir)
+	writeTestRun(t, runsDir, "apply/2017-05-01-10-00-00", succeededRunEvents)
+	writeTestRun(t, runsDir, "apply/2017-05-02-10-00-00", failedRunEvents)
+	writeTestRun(t, runsDir, "upgrade-nodes/2017-05-03-10-00-00", failedRunEvents[:200])
+	writeTestRun(t, runsDir, "smoketest/2017-04-30-10-00-00", "")
+	writeTestRun(t, runsDir, "smoketest/not-a-run", "")
+
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error listing runs: %v", err)
+	}
+	expected := []struct {
+		id     string
+		status RunStatus
+	}{
+		{"upgrade-nodes/2017-05-03-10-00-00", RunIncomplete},
+		{"apply/2017-05-02-10-00-00", RunFailed},
+		{"apply/2017-05-01-10-00-00", RunSucceeded},
+		{"smoketest/2017-04-30-10-00-00", RunUnknown},
+	}
+	if len(runs) != len(expected) {
+		t.Fatalf("expected %d runs, but got %d: %+v", len(expected), len(runs), runs)
+	}
+	for i, e := range expected {
+		if runs[i].ID != e.id || runs[i].Status != e.status {
+			t.Errorf("run %d: expected %s (%s), but got %s (%s)", i, e.id, e.status, runs[i].ID, runs[i].Status)
+		}
+		if runs[i].PlanHash == "" {
+			t.Errorf("run %d: expected the plan hash to be set", i)
+		}
+	}
+
+	summaries, err := RunHostSummaries(&runs[2])
+	if err != nil {
+		t.Fatalf("unexpected error replaying run: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].Host != "etcd01" || summaries[0].OK != 1 || summaries[1].Ignored != 1 || summaries[1].Skipped != 1 {
+		t.Errorf("unexpected host summaries: %+v", summaries)
+	}
+	summaries, err = RunHostSummaries(&runs[1])
+	if err != nil {
+		t.Fatalf("unexpected error replaying run: %v", err)
+	}
+	if len(summaries) != 2 || summaries[1].Failed != 1 || summaries[1].FailedTasks[0] != "install docker" {
+		t.Errorf("unexpected host summaries: %+v", summaries)
+	}
+}
+
+func TestPruneRuns(t *testing.T) {
+	runsDir, err := ioutil.TempDir("", "test-prune-runs")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(runsDir)
+	writeTestRun(t, runsDir, "apply/2017-05-01-10-00-00", succeededRunEvents)
+	writeTestRun(t, runsDir, "apply/2017-05-10-10-00-00", succeededRunEvents)
+	writeTestRun(t, runsDir, "smoketest/2017-05-02-10-00-00", succeededRunEvents)
+	writeTestRun(t, runsDir, "upgrade-nodes/2017-05-11-10-00-00", succeededRunEvents)
+	now := time.Date(2017, 5, 12, 10, 0, 0, 0, time.Local)
+
+	// remove the runs older than 5 days
+	removed, err := PruneRuns(runsDir, 5*24*time.Hour, 0, now)
+	if err != nil {
+		t.Fatalf("unexpected error pruning runs: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("expected 2 runs to be removed, but got %+v", removed)
+	}
+	if _, err = os.Stat(filepath.Join(runsDir, "smoketest")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty task directory to be removed")
+	}
+
+	// keep only the newest run
+	removed, err = PruneRuns(runsDir, 0, 1, now)
+	if err != nil {
+		t.Fatalf("unexpected error pruning runs: %v", err)
+	}
+	if len(removed) != 1 || removed[0].ID != "apply/2017-05-10-10-00-00" {
+		t.Errorf("expected the apply run to be removed, but got %+v", removed)
+	}
+	runs, err := ListRuns(runsDir)
+	if err != nil {
+		t.Fatalf("unexpected error listing runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != "upgrade-nodes/2017-05-11-10-00-00" {
+		t.Errorf("unexpected runs left: %+v", runs)
+	}
+}
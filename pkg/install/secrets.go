@@ -0,0 +1,268 @@
+package install
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	secretRefEnv       = "env:"
+	secretRefFile      = "file:"
+	secretRefEncrypted = "enc:"
+
+	// SecretsKeyFileEnvVar is the environment variable that can be used to
+	// override the location of the key used to decrypt plan secrets
+	SecretsKeyFileEnvVar = "KISMATIC_SECRETS_KEY_FILE"
+)
+
+// secretRef is a reference to a secret, and the value it resolved to
+// when the plan was read.
+type secretRef struct {
+	ref      string
+	resolved string
+}
+
+// a secretField is a plan field that can hold a secret reference.
+// The reference of a path field resolves to the path of a file that
+// contains the secret, instead of the secret itself.
+type secretField struct {
+	name  string
+	value func(p *Plan) *string
+	path  bool
+}
+
+var secretFields = []secretField{
+	{"cluster.admin_password", func(p *Plan) *string { return &p.Cluster.AdminPassword }, false},
+	{"cluster.cloud_provider.config", func(p *Plan) *string { return &p.Cluster.CloudProvider.Config }, true},
+	{"docker_registry.password", func(p *Plan) *string { return &p.DockerRegistry.Password }, false},
+}
+
+// DefaultSecretsKeyFile returns the location of the key that is used to
+// encrypt and decrypt plan secrets.
+func DefaultSecretsKeyFile() string {
+	if f := os.Getenv(SecretsKeyFileEnvVar); f != "" {
+		return f
+	}
+	home := os.Getenv("HOME")
+	return filepath.Join(home, ".kismatic", "secrets.key")
+}
+
+// isSecretRef returns true if the value is a reference to a secret
+func isSecretRef(v string) bool {
+	return strings.HasPrefix(v, secretRefEnv) || strings.HasPrefix(v, secretRefFile) || strings.HasPrefix(v, secretRefEncrypted)
+}
+
+// resolveSecrets replaces the secret references in the plan with their
+// values. The references are kept in the plan so that they can be written
+// back instead of the secret values.
+func resolveSecrets(p *Plan, keyFile string) error {
+	for _, f := range secretFields {
+		v := f.value(p)
+		if !isSecretRef(*v) {
+			continue
+		}
+		var resolved string
+		var err error
+		if f.path {
+			resolved, err = resolveSecretPath(*v, keyFile)
+		} else {
+			resolved, err = resolveSecret(*v, keyFile)
+		}
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %v", f.name, err)
+		}
+		if p.secretRefs == nil {
+			p.secretRefs = map[string]secretRef{}
+		}
+		p.secretRefs[f.name] = secretRef{ref: *v, resolved: resolved}
+		*v = resolved
+	}
+	return nil
+}
+
+// withSecretRefs returns a copy of the plan where the resolved secrets are
+// replaced with their original references. Secrets that have been modified
+// since the plan was read are left untouched.
+func withSecretRefs(p *Plan) *Plan {
+	c := *p
+	for _, f := range secretFields {
+		ref, ok := p.secretRefs[f.name]
+		if !ok {
+			continue
+		}
+		if v := f.value(&c); *v == ref.resolved {
+			*v = ref.ref
+		}
+	}
+	return &c
+}
+
+func resolveSecret(ref string, keyFile string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretRefEnv):
+		name := strings.TrimPrefix(ref, secretRefEnv)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(ref, secretRefFile):
+		d, err := ioutil.ReadFile(strings.TrimPrefix(ref, secretRefFile))
+		if err != nil {
+			return "", fmt.Errorf("could not read secret file: %v", err)
+		}
+		return strings.TrimRight(string(d), "\r\n"), nil
+	case strings.HasPrefix(ref, secretRefEncrypted):
+		key, err := readSecretsKey(keyFile)
+		if err != nil {
+			return "", err
+		}
+		return DecryptSecret(key, ref)
+	}
+	return ref, nil
+}
+
+// resolveSecretPath returns the path of a file that contains the secret.
+// A file reference resolves to the referenced file, while the value of any
+// other reference is written to a file that is only readable by the current
+// user, in the secrets directory next to the secrets key. The name of the
+// file is derived from the reference, so that reading the plan again
+// overwrites the same file instead of leaving a copy of the secret behind.
+func resolveSecretPath(ref string, keyFile string) (string, error) {
+	if strings.HasPrefix(ref, secretRefFile) {
+		path := strings.TrimPrefix(ref, secretRefFile)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("could not read secret file: %v", err)
+		}
+		return path, nil
+	}
+	secret, err := resolveSecret(ref, keyFile)
+	if err != nil {
+		return "", err
+	}
+	dir := secretFilesDirectory(keyFile)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating secrets directory: %v", err)
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte(ref))))
+	// write to a temporary file and rename it, so that concurrent reads of
+	// the plan never see a partial file. TempFile creates it with mode 0600.
+	f, err := ioutil.TempFile(dir, ".tmp")
+	if err != nil {
+		return "", fmt.Errorf("error creating secret file: %v", err)
+	}
+	_, err = f.WriteString(secret)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error writing secret file: %v", err)
+	}
+	return file, nil
+}
+
+// secretFilesDirectory returns the directory of the files that secrets are
+// written to when the plan needs the path of a file
+func secretFilesDirectory(keyFile string) string {
+	if keyFile == "" {
+		keyFile = DefaultSecretsKeyFile()
+	}
+	return filepath.Join(filepath.Dir(keyFile), "secrets")
+}
+
+func readSecretsKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		keyFile = DefaultSecretsKeyFile()
+	}
+	d, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read secrets key: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(d)))
+	if err != nil {
+		return nil, fmt.Errorf("secrets key %q is not base64 encoded: %v", keyFile, err)
+	}
+	return key, nil
+}
+
+// ReadOrCreateSecretsKey reads the key used to encrypt plan secrets. If the
+// key file does not exist, a new key is generated and written to it.
+func ReadOrCreateSecretsKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		keyFile = DefaultSecretsKeyFile()
+	}
+	if _, err := os.Stat(keyFile); err == nil {
+		return readSecretsKey(keyFile)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading secrets key: %v", err)
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("error generating secrets key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, fmt.Errorf("error creating secrets key directory: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("error writing secrets key: %v", err)
+	}
+	return key, nil
+}
+
+// EncryptSecret encrypts the secret with the given key, and returns
+// a reference that can be used in the plan file.
+func EncryptSecret(key []byte, secret string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %v", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return secretRefEncrypted + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret decrypts a secret reference that was created with EncryptSecret
+func DecryptSecret(key []byte, ref string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ref, secretRefEncrypted))
+	if err != nil {
+		return "", fmt.Errorf("encrypted secret is not base64 encoded: %v", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	secret, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting secret: %v", err)
+	}
+	return string(secret), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,190 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecryptSecret(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	ref, err := EncryptSecret(key, "supersecret")
+	if err != nil {
+		t.Fatalf("unexpected error encrypting secret: %v", err)
+	}
+	if !strings.HasPrefix(ref, "enc:") {
+		t.Errorf("expected encrypted secret to start with 'enc:', but got %q", ref)
+	}
+	secret, err := DecryptSecret(key, ref)
+	if err != nil {
+		t.Fatalf("unexpected error decrypting secret: %v", err)
+	}
+	if secret != "supersecret" {
+		t.Errorf("expected decrypted secret to be %q, but got %q", "supersecret", secret)
+	}
+	if _, err = DecryptSecret([]byte("fedcba9876543210fedcba9876543210"), ref); err == nil {
+		t.Errorf("expected an error decrypting with the wrong key, but got nil")
+	}
+}
+
+func TestReadWriteSecretRefs(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-read-write-secret-refs")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	keyFile := filepath.Join(tmpDir, "secrets.key")
+	key, err := ReadOrCreateSecretsKey(keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error creating key: %v", err)
+	}
+	encrypted, err := EncryptSecret(key, "cloudconfig")
+	if err != nil {
+		t.Fatalf("unexpected error encrypting secret: %v", err)
+	}
+	secretFile := filepath.Join(tmpDir, "registry-password")
+	if err = ioutil.WriteFile(secretFile, []byte("registrypass\n"), 0600); err != nil {
+		t.Fatalf("error writing secret file: %v", err)
+	}
+	os.Setenv("KET_TEST_ADMIN_PASSWORD", "adminpass")
+	defer os.Unsetenv("KET_TEST_ADMIN_PASSWORD")
+
+	planStr := `
+cluster:
+  admin_password: env:KET_TEST_ADMIN_PASSWORD
+  cloud_provider:
+    config: ` + encrypted + `
+docker_registry:
+  password: file:` + secretFile + `
+`
+	file := filepath.Join(tmpDir, "kismatic-cluster.yaml")
+	if err = ioutil.WriteFile(file, []byte(planStr), 0666); err != nil {
+		t.Fatalf("error writing plan file: %v", err)
+	}
+	fp := &FilePlanner{File: file, SecretsKeyFile: keyFile}
+	p, err := fp.Read()
+	if err != nil {
+		t.Fatalf("unexpected error reading plan: %v", err)
+	}
+	if p.Cluster.AdminPassword != "adminpass" {
+		t.Errorf("expected admin password to be read from the environment, but got %q", p.Cluster.AdminPassword)
+	}
+	if p.DockerRegistry.Password != "registrypass" {
+		t.Errorf("expected registry password to be read from file, but got %q", p.DockerRegistry.Password)
+	}
+	cloudConfig, err := ioutil.ReadFile(p.Cluster.CloudProvider.Config)
+	if err != nil {
+		t.Fatalf("expected cloud config to be decrypted to a file: %v", err)
+	}
+	if string(cloudConfig) != "cloudconfig" {
+		t.Errorf("expected cloud config file to contain the decrypted secret, but got %q", cloudConfig)
+	}
+	if info, err := os.Stat(p.Cluster.CloudProvider.Config); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected cloud config file to be only readable by the owner, but got %v", info.Mode())
+	}
+
+	// a modified secret is written as is
+	p.DockerRegistry.Password = "newpass"
+	if err = fp.Write(p); err != nil {
+		t.Fatalf("unexpected error writing plan: %v", err)
+	}
+	wrote, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("error reading plan file: %v", err)
+	}
+	for _, s := range []string{"env:KET_TEST_ADMIN_PASSWORD", encrypted, "newpass"} {
+		if !strings.Contains(string(wrote), s) {
+			t.Errorf("expected the plan file to contain %q", s)
+		}
+	}
+	for _, s := range []string{"adminpass", "cloudconfig"} {
+		if strings.Contains(string(wrote), s) {
+			t.Errorf("expected the plan file to not contain the secret %q", s)
+		}
+	}
+}
+
+func TestReadCloudConfigSecretTwice(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-read-cloud-config-secret")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	keyFile := filepath.Join(tmpDir, "secrets.key")
+	os.Setenv("KET_TEST_CLOUD_CONFIG", "cloudconfig")
+	defer os.Unsetenv("KET_TEST_CLOUD_CONFIG")
+	file := filepath.Join(tmpDir, "kismatic-cluster.yaml")
+	if err = ioutil.WriteFile(file, []byte("cluster:\n  cloud_provider:\n    config: env:KET_TEST_CLOUD_CONFIG\n"), 0666); err != nil {
+		t.Fatalf("error writing plan file: %v", err)
+	}
+	before, err := filepath.Glob(filepath.Join(os.TempDir(), "kismatic-secret*"))
+	if err != nil {
+		t.Fatalf("error listing temp files: %v", err)
+	}
+
+	fp := &FilePlanner{File: file, SecretsKeyFile: keyFile}
+	var paths []string
+	for i := 0; i < 2; i++ {
+		p, err := fp.Read()
+		if err != nil {
+			t.Fatalf("unexpected error reading plan: %v", err)
+		}
+		paths = append(paths, p.Cluster.CloudProvider.Config)
+	}
+	if paths[0] != paths[1] {
+		t.Errorf("expected the cloud config to be written to the same file, but got %q and %q", paths[0], paths[1])
+	}
+	files, err := ioutil.ReadDir(secretFilesDirectory(keyFile))
+	if err != nil {
+		t.Fatalf("error reading secrets directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected a single secret file, but got %d", len(files))
+	}
+	after, err := filepath.Glob(filepath.Join(os.TempDir(), "kismatic-secret*"))
+	if err != nil {
+		t.Fatalf("error listing temp files: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("expected no secret files to be left in the temp dir, but got %v", after)
+	}
+}
+
+func TestReadSecretRefNotFound(t *testing.T) {
+	p := &Plan{}
+	p.Cluster.AdminPassword = "env:KET_TEST_UNDEFINED_VAR"
+	if err := resolveSecrets(p, ""); err == nil {
+		t.Errorf("expected an error resolving an undefined environment variable, but got nil")
+	}
+}
+
+func TestResolveCloudConfigFileRef(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-cloud-config-ref")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	configFile := filepath.Join(tmpDir, "cloud.conf")
+	if err = ioutil.WriteFile(configFile, []byte("[Global]\n"), 0600); err != nil {
+		t.Fatalf("error writing cloud config: %v", err)
+	}
+	p := &Plan{}
+	p.Cluster.CloudProvider.Config = "file:" + configFile
+	if err = resolveSecrets(p, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Cluster.CloudProvider.Config != configFile {
+		t.Errorf("expected cloud config to resolve to %q, but got %q", configFile, p.Cluster.CloudProvider.Config)
+	}
+	if withSecretRefs(p).Cluster.CloudProvider.Config != "file:"+configFile {
+		t.Errorf("expected the reference to be written back")
+	}
+
+	p.Cluster.CloudProvider.Config = "file:" + filepath.Join(tmpDir, "missing.conf")
+	if err = resolveSecrets(p, ""); err == nil {
+		t.Errorf("expected an error resolving a missing cloud config file, but got nil")
+	}
+}
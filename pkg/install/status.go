@@ -0,0 +1,271 @@
+package install
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// the daemonsets that run the pod network on every node
+var networkDaemonSets = []string{"calico-node", "weave-net", "contiv-netplugin"}
+
+// ClusterStatus is the health of the nodes of the cluster
+type ClusterStatus struct {
+	Nodes []NodeStatus
+}
+
+// NodeStatus is the health of the services and components of a node
+type NodeStatus struct {
+	Node  Node
+	Roles []string
+	// Ready is the status of the Ready condition of the Kubernetes node
+	Ready string
+	// Services are the systemd services and the node components
+	Services []ComponentStatus
+	// Components are the control plane components of master nodes
+	Components []ComponentStatus
+	// Etcd is the health of the Kubernetes etcd member of etcd nodes
+	Etcd *EtcdMemberStatus `json:",omitempty"`
+	// NetworkPods are the pod network pods that run on the node
+	NetworkPods  []NetworkPodStatus
+	Certificates []CertificateStatus
+	// Errors are the errors encountered while getting the status
+	Errors []string
+}
+
+// ComponentStatus is the health of a service or a component
+type ComponentStatus struct {
+	Name    string
+	Healthy bool
+	Status  string
+}
+
+// EtcdMemberStatus is the health of an etcd member
+type EtcdMemberStatus struct {
+	Healthy bool
+	Leader  bool
+}
+
+// NetworkPodStatus is the phase of a pod network pod
+type NetworkPodStatus struct {
+	Namespace string
+	Name      string
+	Phase     string
+}
+
+// CertificateStatus is the expiration date of a certificate on the node
+type CertificateStatus struct {
+	File     string
+	NotAfter time.Time
+}
+
+// Healthy returns true if all the services and components of the node are healthy
+func (s NodeStatus) Healthy() bool {
+	if (isKubernetesNode(s.Roles) && s.Ready != "True") || len(s.Errors) > 0 {
+		return false
+	}
+	for _, c := range append(append([]ComponentStatus{}, s.Services...), s.Components...) {
+		if !c.Healthy {
+			return false
+		}
+	}
+	if s.Etcd != nil && !s.Etcd.Healthy {
+		return false
+	}
+	for _, p := range s.NetworkPods {
+		if p.Phase != "Running" {
+			return false
+		}
+	}
+	return true
+}
+
+// EarliestCertificateExpiry returns the certificate of the node that expires first
+func (s NodeStatus) EarliestCertificateExpiry() *CertificateStatus {
+	var earliest *CertificateStatus
+	for i, c := range s.Certificates {
+		if earliest == nil || c.NotAfter.Before(earliest.NotAfter) {
+			earliest = &s.Certificates[i]
+		}
+	}
+	return earliest
+}
+
+const statusCurl = "curl -s -o /dev/null -w '%{http_code}' "
+
+const etcdCurl = "sudo curl -s --cacert /etc/etcd_k8s/ca.pem --cert /etc/etcd_k8s/etcd-client.pem --key /etc/etcd_k8s/etcd-client-key.pem "
+
+// nodeStatusScript returns the script that prints the status of the node. The output is a line per item:
+// "service <name> <state>", "health <component> <http status>", "etcd-health <response>",
+// "etcd-state <response>" and "cert <file> <expiration date>".
+func nodeStatusScript(roles []string) string {
+	// the kubelet does not run on etcd only nodes
+	services := "docker"
+	if isKubernetesNode(roles) {
+		services = "docker kubelet"
+	}
+	lines := []string{
+		`for s in ` + services + `; do echo "service $s $(systemctl is-active $s)"; done`,
+	}
+	if isKubernetesNode(roles) {
+		lines = append(lines, `echo "health kube-proxy $(`+statusCurl+`http://127.0.0.1:10249/healthz)"`)
+	}
+	if util.Contains("master", roles) {
+		lines = append(lines,
+			`echo "health kube-apiserver $(`+statusCurl+`http://127.0.0.1:8080/healthz)"`,
+			`echo "health kube-controller-manager $(`+statusCurl+`http://127.0.0.1:10252/healthz)"`,
+			`echo "health kube-scheduler $(`+statusCurl+`http://127.0.0.1:10251/healthz)"`,
+		)
+	}
+	if util.Contains("etcd", roles) {
+		lines = append(lines,
+			`echo "etcd-health $(`+etcdCurl+`https://127.0.0.1:2379/health)"`,
+			`echo "etcd-state $(`+etcdCurl+`https://127.0.0.1:2379/v2/stats/self)"`,
+		)
+	}
+	lines = append(lines,
+		`for f in $(sudo find /etc/kubernetes/pki /etc/etcd_k8s /etc/etcd_networking -name '*.pem' ! -name '*-key.pem' 2>/dev/null); do `+
+			`echo "cert $f $(sudo openssl x509 -enddate -noout -in $f | cut -d= -f2)"; done`,
+	)
+	return strings.Join(lines, "; ")
+}
+
+// parseNodeStatus adds the output of the node status script to the status
+func parseNodeStatus(output string, status *NodeStatus) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// the lines are "<kind> <value>", and the value of services, components
+		// and certificates is "<name> <status>"
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		kind, name, value := fields[0], fields[1], fields[1]
+		if kind != "etcd-health" && kind != "etcd-state" {
+			nameValue := strings.SplitN(fields[1], " ", 2)
+			name, value = nameValue[0], ""
+			if len(nameValue) == 2 {
+				value = strings.TrimSpace(nameValue[1])
+			}
+		}
+		switch kind {
+		case "service":
+			status.Services = append(status.Services, ComponentStatus{Name: name, Healthy: value == "active", Status: value})
+		case "health":
+			c := ComponentStatus{Name: name, Healthy: value == "200", Status: "healthy"}
+			if !c.Healthy {
+				c.Status = "unhealthy"
+				if value == "000" || value == "" {
+					c.Status = "not responding"
+				}
+			}
+			if name == "kube-proxy" {
+				status.Services = append(status.Services, c)
+			} else {
+				status.Components = append(status.Components, c)
+			}
+		case "etcd-health":
+			if status.Etcd == nil {
+				status.Etcd = &EtcdMemberStatus{}
+			}
+			status.Etcd.Healthy = strings.Contains(strings.Replace(value, " ", "", -1), `"health":"true"`)
+		case "etcd-state":
+			if status.Etcd == nil {
+				status.Etcd = &EtcdMemberStatus{}
+			}
+			status.Etcd.Leader = strings.Contains(value, "StateLeader")
+		case "cert":
+			notAfter, err := time.Parse("Jan _2 15:04:05 2006 MST", value)
+			if err != nil {
+				status.Errors = append(status.Errors, fmt.Sprintf("error reading the expiration date of certificate %s: %q", name, value))
+				continue
+			}
+			status.Certificates = append(status.Certificates, CertificateStatus{File: name, NotAfter: notAfter})
+		}
+	}
+}
+
+// isKubernetesNode returns false for etcd only nodes
+func isKubernetesNode(roles []string) bool {
+	return util.Contains("master", roles) || util.Contains("worker", roles) || util.Contains("ingress", roles) || util.Contains("storage", roles)
+}
+
+// addKubernetesStatus adds the Ready condition and the pod network pods of the node to the status
+func addKubernetesStatus(status *NodeStatus, kubeClient data.NodeGetter, pods *data.PodList) {
+	name := strings.ToLower(status.Node.Host)
+	node, err := kubeClient.GetNode(name)
+	if err != nil {
+		status.Errors = append(status.Errors, fmt.Sprintf("error getting the Kubernetes node: %v", err))
+	} else {
+		for _, c := range node.Status.Conditions {
+			if c.Type == "Ready" {
+				status.Ready = c.Status
+			}
+		}
+	}
+	if pods == nil {
+		return
+	}
+	for _, p := range pods.Items {
+		if strings.ToLower(p.Spec.NodeName) != name || p.Namespace != "kube-system" {
+			continue
+		}
+		for _, ds := range networkDaemonSets {
+			if strings.HasPrefix(p.Name, ds+"-") {
+				status.NetworkPods = append(status.NetworkPods, NetworkPodStatus{Namespace: p.Namespace, Name: p.Name, Phase: p.Status.Phase})
+			}
+		}
+	}
+}
+
+// GetClusterStatus gets the status of all the nodes of the cluster in parallel.
+// Errors are reported in the status of each node.
+func GetClusterStatus(plan *Plan, kubeClient data.ClusterClient) ClusterStatus {
+	var pods *data.PodList
+	var podsErr error
+	if kubeClient != nil {
+		pods, podsErr = kubeClient.ListPods()
+	}
+	nodes := plan.GetUniqueNodes()
+	statuses := make([]NodeStatus, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func(i int, n Node) {
+			defer wg.Done()
+			s := NodeStatus{Node: n, Roles: plan.GetRolesForIP(n.IP)}
+			client, err := plan.GetSSHClient(n.Host)
+			if err == nil {
+				var out string
+				out, err = client.Output(true, nodeStatusScript(s.Roles))
+				if err != nil {
+					err = fmt.Errorf("%v: %s", err, strings.TrimSpace(out))
+				} else {
+					parseNodeStatus(out, &s)
+				}
+			}
+			if err != nil {
+				s.Errors = append(s.Errors, fmt.Sprintf("error getting the status of the node over SSH: %v", err))
+			}
+			if isKubernetesNode(s.Roles) {
+				s.Ready = "Unknown"
+			}
+			if kubeClient != nil && isKubernetesNode(s.Roles) {
+				addKubernetesStatus(&s, kubeClient, pods)
+				if podsErr != nil {
+					s.Errors = append(s.Errors, fmt.Sprintf("error listing pods: %v", podsErr))
+				}
+			}
+			sort.Slice(s.Certificates, func(a, b int) bool { return s.Certificates[a].File < s.Certificates[b].File })
+			statuses[i] = s
+		}(i, n)
+	}
+	wg.Wait()
+	return ClusterStatus{Nodes: statuses}
+}
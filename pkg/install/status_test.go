@@ -0,0 +1,182 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/data"
+)
+
+func TestParseNodeStatus(t *testing.T) {
+	output := "service docker active\r\n" +
+		"service kubelet inactive\r\n" +
+		"health kube-proxy 200\r\n" +
+		"health kube-apiserver 200\r\n" +
+		"health kube-controller-manager 500\r\n" +
+		"health kube-scheduler 000\r\n" +
+		"etcd-health {\"health\": \"true\"}\r\n" +
+		"etcd-state {\"name\":\"etcd1\",\"state\":\"StateLeader\"}\r\n" +
+		"cert /etc/kubernetes/pki/ca.pem Oct 19 12:00:00 2027 GMT\r\n" +
+		"cert /etc/kubernetes/pki/kubelet.pem Nov  2 08:30:00 2026 GMT\r\n" +
+		"cert /etc/kubernetes/pki/broken.pem unable to load certificate\r\n"
+	s := NodeStatus{Roles: []string{"etcd", "master"}, Ready: "True"}
+	parseNodeStatus(output, &s)
+
+	expectedServices := map[string]bool{"docker": true, "kubelet": false, "kube-proxy": true}
+	if len(s.Services) != len(expectedServices) {
+		t.Errorf("expected services %v, but got %+v", expectedServices, s.Services)
+	}
+	for _, c := range s.Services {
+		if healthy, ok := expectedServices[c.Name]; !ok || healthy != c.Healthy {
+			t.Errorf("unexpected service status %+v", c)
+		}
+	}
+	expectedComponents := []ComponentStatus{
+		{Name: "kube-apiserver", Healthy: true, Status: "healthy"},
+		{Name: "kube-controller-manager", Healthy: false, Status: "unhealthy"},
+		{Name: "kube-scheduler", Healthy: false, Status: "not responding"},
+	}
+	if len(s.Components) != len(expectedComponents) {
+		t.Fatalf("expected components %+v, but got %+v", expectedComponents, s.Components)
+	}
+	for i, c := range expectedComponents {
+		if s.Components[i] != c {
+			t.Errorf("expected component %+v, but got %+v", c, s.Components[i])
+		}
+	}
+	if s.Etcd == nil || !s.Etcd.Healthy || !s.Etcd.Leader {
+		t.Errorf("expected a healthy etcd leader, but got %+v", s.Etcd)
+	}
+	if len(s.Certificates) != 2 {
+		t.Fatalf("expected 2 certificates, but got %+v", s.Certificates)
+	}
+	earliest := s.EarliestCertificateExpiry()
+	if earliest.File != "/etc/kubernetes/pki/kubelet.pem" || !earliest.NotAfter.Equal(time.Date(2026, 11, 2, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected earliest certificate expiry %+v", earliest)
+	}
+	if len(s.Errors) != 1 || !strings.Contains(s.Errors[0], "broken.pem") {
+		t.Errorf("expected an error for the broken certificate, but got %v", s.Errors)
+	}
+	if s.Healthy() {
+		t.Error("expected the node to be unhealthy")
+	}
+}
+
+func TestNodeStatusHealthy(t *testing.T) {
+	tests := []struct {
+		status  NodeStatus
+		healthy bool
+	}{
+		{
+			status:  NodeStatus{Roles: []string{"worker"}, Ready: "True", Services: []ComponentStatus{{Name: "kubelet", Healthy: true}}},
+			healthy: true,
+		},
+		{
+			status:  NodeStatus{Roles: []string{"worker"}, Ready: "Unknown"},
+			healthy: false,
+		},
+		{
+			// etcd only nodes are not Kubernetes nodes
+			status:  NodeStatus{Roles: []string{"etcd"}, Etcd: &EtcdMemberStatus{Healthy: true}},
+			healthy: true,
+		},
+		{
+			status:  NodeStatus{Roles: []string{"etcd"}, Etcd: &EtcdMemberStatus{Healthy: false}},
+			healthy: false,
+		},
+		{
+			status:  NodeStatus{Roles: []string{"worker"}, Ready: "True", NetworkPods: []NetworkPodStatus{{Name: "calico-node-abcde", Phase: "Pending"}}},
+			healthy: false,
+		},
+	}
+	for i, test := range tests {
+		if healthy := test.status.Healthy(); healthy != test.healthy {
+			t.Errorf("test %d: expected healthy to be %v, but got %v", i, test.healthy, healthy)
+		}
+	}
+}
+
+// runNodeStatusScript runs the node status script of the roles locally, with
+// stubs of the commands it runs on the node
+func runNodeStatusScript(t *testing.T, roles []string) string {
+	dir, err := ioutil.TempDir("", "test-node-status-script")
+	if err != nil {
+		t.Fatalf("error creating tmp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stubs := map[string]string{
+		"sudo":      `exec "$@"`,
+		"systemctl": `echo active`,
+		"curl": `case "$*" in
+*stats/self*) echo '{"name":"etcd1","state":"StateLeader"}' ;;
+*2379/health*) echo '{"health": "true"}' ;;
+*) echo 200 ;;
+esac`,
+		"find": `true`,
+	}
+	for name, script := range stubs {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatalf("error writing stub: %v", err)
+		}
+	}
+	cmd := exec.Command("sh", "-c", nodeStatusScript(roles))
+	cmd.Env = append(os.Environ(), "PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("error running the node status script: %v: %s", err, out)
+	}
+	return string(out)
+}
+
+func TestNodeStatusScriptEtcdNode(t *testing.T) {
+	roles := []string{"etcd"}
+	s := NodeStatus{Roles: roles}
+	parseNodeStatus(runNodeStatusScript(t, roles), &s)
+	for _, c := range s.Services {
+		if c.Name == "kubelet" || c.Name == "kube-proxy" {
+			t.Errorf("expected the status of an etcd node to not include %s", c.Name)
+		}
+	}
+	if s.Etcd == nil || !s.Etcd.Healthy || !s.Etcd.Leader {
+		t.Errorf("expected a healthy etcd leader, but got %+v", s.Etcd)
+	}
+	if !s.Healthy() {
+		t.Errorf("expected the etcd node to be healthy, but got %+v", s)
+	}
+
+	roles = []string{"worker"}
+	s = NodeStatus{Roles: roles, Ready: "True"}
+	parseNodeStatus(runNodeStatusScript(t, roles), &s)
+	if len(s.Services) != 3 || s.Services[1].Name != "kubelet" || !s.Healthy() {
+		t.Errorf("expected the worker to report healthy docker, kubelet and kube-proxy services, but got %+v", s.Services)
+	}
+}
+
+type fakeNodeGetter map[string]data.Node
+
+func (f fakeNodeGetter) GetNode(name string) (*data.Node, error) {
+	n := f[name]
+	return &n, nil
+}
+
+func TestAddKubernetesStatus(t *testing.T) {
+	s := NodeStatus{Node: Node{Host: "Worker1"}, Roles: []string{"worker"}, Ready: "Unknown"}
+	nodes := fakeNodeGetter{"worker1": {Status: data.NodeStatus{Conditions: []data.NodeCondition{{Type: "Ready", Status: "True"}}}}}
+	pods := &data.PodList{Items: []data.Pod{
+		{ObjectMeta: data.ObjectMeta{Name: "calico-node-x1b2c", Namespace: "kube-system"}, Spec: data.PodSpec{NodeName: "worker1"}, Status: data.PodStatus{Phase: "Running"}},
+		{ObjectMeta: data.ObjectMeta{Name: "calico-node-y3d4e", Namespace: "kube-system"}, Spec: data.PodSpec{NodeName: "worker2"}, Status: data.PodStatus{Phase: "Running"}},
+		{ObjectMeta: data.ObjectMeta{Name: "kube-dns-123", Namespace: "kube-system"}, Spec: data.PodSpec{NodeName: "worker1"}, Status: data.PodStatus{Phase: "Running"}},
+	}}
+	addKubernetesStatus(&s, nodes, pods)
+	if s.Ready != "True" {
+		t.Errorf("expected the node to be ready, but got %q", s.Ready)
+	}
+	if len(s.NetworkPods) != 1 || s.NetworkPods[0].Name != "calico-node-x1b2c" {
+		t.Errorf("expected the calico pod of the node, but got %+v", s.NetworkPods)
+	}
+}
@@ -18,6 +18,8 @@ type upgradeKubeInfoClient interface {
 	data.PersistentVolumeClaimGetter
 	data.PersistentVolumeGetter
 	data.StatefulSetGetter
+	data.DeploymentGetter
+	data.PodDisruptionBudgetLister
 }
 
 type etcdNodeCountErr struct{}
@@ -133,6 +135,18 @@ func (e podRunningJobErr) Error() string {
 	return fmt.Sprintf(`Pod that belongs to job "%s/%s" is running on this node.`, e.name, e.namespace)
 }
 
+type podDisruptionBudgetErr struct {
+	namespace string
+	name      string
+	pods      int32
+	allowed   int32
+}
+
+func (e podDisruptionBudgetErr) Error() string {
+	return fmt.Sprintf(`Upgrading this node would evict %d pod(s) covered by the PodDisruptionBudget "%s/%s", `+
+		"which currently allows %d disruption(s).", e.pods, e.namespace, e.name, e.allowed)
+}
+
 // DetectNodeUpgradeSafety determines whether it's safe to upgrade a specific node
 // listed in the plan file. If any condition that could result in data or availability
 // loss is detected, the upgrade is deemed unsafe, and the conditions are returned as errors.
@@ -216,11 +230,31 @@ func detectWorkerNodeUpgradeSafety(node Node, kubeClient upgradeKubeInfoClient)
 		}
 	}
 
-	// Keep track of how many pods managed by replication controllers and replicasets
-	// are running on this node. If all replicas are running on the node, we need to
-	// return an error, as it would take the workload down.
-	rcPods := map[string]int32{}
-	rsPods := map[string]int32{}
+	// PodDisruptionBudgets decide whether evicting the pods they cover is safe.
+	// Pods that are covered by a budget are not subject to the replica checks.
+	pdbs := []data.PodDisruptionBudget{}
+	pdbList, err := kubeClient.ListPodDisruptionBudgets()
+	if err != nil || pdbList == nil {
+		errs = append(errs, fmt.Errorf("Failed to list PodDisruptionBudgets: %v", err))
+	} else {
+		pdbs = pdbList.Items
+	}
+	pdbPods := make([]int32, len(pdbs))
+
+	// Keep track of how many pods managed by replication controllers, replicasets
+	// and deployments are running on this node. If all replicas are running on the node,
+	// we need to return an error, as it would take the workload down.
+	replicaPods := map[string]int32{}
+	checkReplicas := func(kind, namespace, name string, replicas int32) {
+		if replicas < 2 {
+			errs = append(errs, unsafeReplicaCountErr{kind: kind, namespace: namespace, name: name})
+		}
+		key := kind + "/" + namespace + "/" + name
+		replicaPods[key]++
+		if replicaPods[key] == replicas {
+			errs = append(errs, replicasOnSingleNodeErr{kind: kind, namespace: namespace, name: name})
+		}
+	}
 
 	// 1. Are there any pods running on this node that are not managed by a controller?
 	// 2. Are there any pods running on this node that are managed by a controller,
@@ -228,70 +262,109 @@ func detectWorkerNodeUpgradeSafety(node Node, kubeClient upgradeKubeInfoClient)
 	// 3. Are there any daemonset managed pods running on this node? If so,
 	//    verify that it is not the only one
 	// 4. Are there any pods that belong to a job running on this node?
+	// 5. Would evicting the pods on this node violate a PodDisruptionBudget?
 	for _, p := range nodePods {
-		creator, ok := p.Annotations[kubeCreatedBy]
-		if !ok {
-			errs = append(errs, unmanagedPodErr{namespace: p.Namespace, name: p.Name})
+		ref, err := podController(p)
+		if err != nil {
+			errs = append(errs, err)
 			continue
 		}
-		var r data.SerializedReference
-		err := json.Unmarshal([]byte(creator), &r)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("Unable to determine the creator of pod %s/%s", p.Namespace, p.Name))
+		if ref == nil {
+			errs = append(errs, unmanagedPodErr{namespace: p.Namespace, name: p.Name})
 			continue
 		}
-		switch strings.ToLower(r.Reference.Kind) {
+		covered := false
+		for i, pdb := range pdbs {
+			if pdb.Namespace == p.Namespace && pdb.Spec.Selector.Matches(p.Labels) {
+				pdbPods[i]++
+				covered = true
+			}
+		}
+		switch strings.ToLower(ref.Kind) {
 		default:
-			errs = append(errs, fmt.Errorf("Unable to determine upgrade safety for a pod managed by a controller of type %q", r.Reference.Kind))
+			if !covered {
+				errs = append(errs, fmt.Errorf("Unable to determine upgrade safety for a pod managed by a controller of type %q. "+
+					"Define a PodDisruptionBudget for pod \"%s/%s\" to allow the upgrade to evaluate its availability", ref.Kind, p.Namespace, p.Name))
+			}
 		case "daemonset":
-			ds, err := kubeClient.GetDaemonSet(r.Reference.Namespace, r.Reference.Name)
+			ds, err := kubeClient.GetDaemonSet(ref.Namespace, ref.Name)
 			if err != nil || ds == nil {
-				errs = append(errs, fmt.Errorf("Failed to get information about DaemonSet %s/%s", r.Reference.Namespace, r.Reference.Name))
+				errs = append(errs, fmt.Errorf("Failed to get information about DaemonSet %s/%s", ref.Namespace, ref.Name))
 				continue
 			}
 			// Check if other nodes should be running this DS
 			if ds.Status.DesiredNumberScheduled < 2 {
-				errs = append(errs, podUnsafeDaemonErr{dsNamespace: r.Reference.Namespace, dsName: r.Reference.Name})
+				errs = append(errs, podUnsafeDaemonErr{dsNamespace: ref.Namespace, dsName: ref.Name})
 			}
 		case "job":
-			errs = append(errs, podRunningJobErr{namespace: r.Reference.Namespace, name: r.Reference.Name})
+			errs = append(errs, podRunningJobErr{namespace: ref.Namespace, name: ref.Name})
 		case "replicationcontroller":
-			rc, err := kubeClient.GetReplicationController(r.Reference.Namespace, r.Reference.Name)
+			rc, err := kubeClient.GetReplicationController(ref.Namespace, ref.Name)
 			if err != nil || rc == nil {
-				errs = append(errs, fmt.Errorf(`Failed to get information about ReplicationController "%s/%s"`, r.Reference.Namespace, r.Reference.Name))
+				errs = append(errs, fmt.Errorf(`Failed to get information about ReplicationController "%s/%s"`, ref.Namespace, ref.Name))
 				continue
 			}
-			if rc.Status.Replicas < 2 {
-				errs = append(errs, unsafeReplicaCountErr{kind: r.Reference.Kind, namespace: r.Reference.Namespace, name: r.Reference.Name})
-			}
-			rcPods[r.Reference.Namespace+r.Reference.Name]++
-			if rcPods[r.Reference.Namespace+r.Reference.Name] == rc.Status.Replicas {
-				errs = append(errs, replicasOnSingleNodeErr{kind: r.Reference.Kind, namespace: r.Reference.Namespace, name: r.Reference.Name})
+			if !covered {
+				checkReplicas(ref.Kind, ref.Namespace, ref.Name, rc.Status.Replicas)
 			}
 		case "replicaset":
-			rs, err := kubeClient.GetReplicaSet(r.Reference.Namespace, r.Reference.Name)
+			rs, err := kubeClient.GetReplicaSet(ref.Namespace, ref.Name)
 			if err != nil || rs == nil {
-				errs = append(errs, fmt.Errorf(`Failed to get information about ReplicaSet "%s/%s"`, r.Reference.Namespace, r.Reference.Name))
+				errs = append(errs, fmt.Errorf(`Failed to get information about ReplicaSet "%s/%s"`, ref.Namespace, ref.Name))
 				continue
 			}
-			if rs.Status.Replicas < 2 {
-				errs = append(errs, unsafeReplicaCountErr{kind: r.Reference.Kind, namespace: r.Reference.Namespace, name: r.Reference.Name})
+			// The availability of the pods of a deployment depends on all
+			// the replica sets of the deployment, not only on the current one
+			if owner := rs.ControllerRef(); owner != nil && strings.ToLower(owner.Kind) == "deployment" {
+				d, err := kubeClient.GetDeployment(ref.Namespace, owner.Name)
+				if err != nil || d == nil {
+					errs = append(errs, fmt.Errorf(`Failed to get information about Deployment "%s/%s"`, ref.Namespace, owner.Name))
+					continue
+				}
+				if !covered {
+					checkReplicas(owner.Kind, ref.Namespace, owner.Name, d.Status.Replicas)
+				}
+				continue
 			}
-			rsPods[r.Reference.Namespace+r.Reference.Name]++
-			if rsPods[r.Reference.Namespace+r.Reference.Name] == rs.Status.Replicas {
-				errs = append(errs, replicasOnSingleNodeErr{kind: r.Reference.Kind, namespace: r.Reference.Namespace, name: r.Reference.Name})
+			if !covered {
+				checkReplicas(ref.Kind, ref.Namespace, ref.Name, rs.Status.Replicas)
 			}
 		case "statefulset":
-			sts, err := kubeClient.GetStatefulSet(r.Reference.Namespace, r.Reference.Name)
+			sts, err := kubeClient.GetStatefulSet(ref.Namespace, ref.Name)
 			if err != nil || sts == nil {
-				errs = append(errs, fmt.Errorf(`Failed to get information about StatefulSet "%s/%s"`, r.Reference.Namespace, r.Reference.Name))
+				errs = append(errs, fmt.Errorf(`Failed to get information about StatefulSet "%s/%s"`, ref.Namespace, ref.Name))
 				continue
 			}
-			if sts.Status.Replicas < 2 {
-				errs = append(errs, unsafeReplicaCountErr{kind: r.Reference.Kind, namespace: r.Reference.Namespace, name: r.Reference.Name})
+			if !covered && sts.Status.Replicas < 2 {
+				errs = append(errs, unsafeReplicaCountErr{kind: ref.Kind, namespace: ref.Namespace, name: ref.Name})
 			}
 		}
 	}
 
+	// All the pods on the node are evicted during the upgrade
+	for i, pdb := range pdbs {
+		if pdbPods[i] > pdb.Status.PodDisruptionsAllowed {
+			errs = append(errs, podDisruptionBudgetErr{namespace: pdb.Namespace, name: pdb.Name, pods: pdbPods[i], allowed: pdb.Status.PodDisruptionsAllowed})
+		}
+	}
+
 	return errs
 }
+
+// podController returns a reference to the controller that manages the pod,
+// or nil if the pod is not managed by a controller. The owner references of the pod
+// are used, falling back to the created-by annotation set by older versions of Kubernetes.
+func podController(p data.Pod) (*data.ObjectReference, error) {
+	if owner := p.ControllerRef(); owner != nil {
+		return &data.ObjectReference{Kind: owner.Kind, Namespace: p.Namespace, Name: owner.Name}, nil
+	}
+	creator, ok := p.Annotations[kubeCreatedBy]
+	if !ok {
+		return nil, nil
+	}
+	var r data.SerializedReference
+	if err := json.Unmarshal([]byte(creator), &r); err != nil {
+		return nil, fmt.Errorf("Unable to determine the creator of pod %s/%s", p.Namespace, p.Name)
+	}
+	return &r.Reference, nil
+}
@@ -0,0 +1,378 @@
+package install
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// UpgradePlan describes what an online upgrade will do. It is computed ahead of
+// the upgrade, and can be executed verbatim later on.
+type UpgradePlan struct {
+	// KismaticVersion is the version that computed the plan, and the version
+	// the nodes are upgraded to
+	KismaticVersion string `json:"kismatic_version"`
+	// PlanChecksum is the checksum of the cluster plan the upgrade was computed for
+	PlanChecksum string `json:"plan_checksum"`
+	// Created is when the upgrade plan was computed
+	Created time.Time `json:"created"`
+	// MaxParallelWorkers is the maximum number of workers in a batch
+	MaxParallelWorkers int `json:"max_parallel_workers"`
+	// IgnoreSafetyChecks includes the unsafe nodes in the batches
+	IgnoreSafetyChecks bool `json:"ignore_safety_checks"`
+	// PartialAllowed excludes the unsafe workers from the upgrade, and skips
+	// the upgrade of the cluster services
+	PartialAllowed bool `json:"partial_allowed"`
+	// Batches of nodes, in the order they are upgraded. The nodes of a batch
+	// are upgraded in parallel.
+	Batches [][]UpgradePlanNode `json:"batches"`
+	// Unsafe are the nodes that failed the safety checks
+	Unsafe []UpgradePlanNode `json:"unsafe,omitempty"`
+	// UpToDate are the nodes that are at the target version
+	UpToDate []UpgradePlanNode `json:"up_to_date,omitempty"`
+	// Blocked is the reason the upgrade cannot be performed, if any
+	Blocked string `json:"blocked,omitempty"`
+}
+
+// UpgradePlanNode is a node in the upgrade plan
+type UpgradePlanNode struct {
+	Host    string   `json:"host"`
+	IP      string   `json:"ip"`
+	Roles   []string `json:"roles"`
+	Version string   `json:"version"`
+	// SafetyErrors are the conditions that make the upgrade of the node unsafe
+	SafetyErrors []string `json:"safety_errors,omitempty"`
+	// Packages that are upgraded on the node
+	Packages []VersionChange `json:"packages,omitempty"`
+	// Images that are upgraded on the node
+	Images []VersionChange `json:"images,omitempty"`
+}
+
+// VersionChange is a package or a container image that changes version
+type VersionChange struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// UpgradePlanOptions are the options used to compute the upgrade plan
+type UpgradePlanOptions struct {
+	MaxParallelWorkers int
+	IgnoreSafetyChecks bool
+	PartialAllowed     bool
+}
+
+// UpgradeBatches returns the nodes grouped in the batches they are upgraded in.
+// Etcd nodes are upgraded first, followed by the master nodes, one node at a time.
+// The rest of the nodes are upgraded last, up to maxParallelWorkers at a time.
+func UpgradeBatches(nodes []ListableNode, maxParallelWorkers int) [][]ListableNode {
+	if maxParallelWorkers < 1 {
+		maxParallelWorkers = 1
+	}
+	batches := [][]ListableNode{}
+	// Nodes can have multiple roles. For this reason, we need to keep track of which nodes
+	// have been scheduled to avoid upgrading them twice.
+	scheduled := map[string]bool{}
+	for _, role := range []string{"etcd", "master"} {
+		for _, n := range nodes {
+			if !scheduled[n.Node.IP] && util.Contains(role, n.Roles) {
+				batches = append(batches, []ListableNode{n})
+				scheduled[n.Node.IP] = true
+			}
+		}
+	}
+	var batch []ListableNode
+	for _, n := range nodes {
+		if scheduled[n.Node.IP] {
+			continue
+		}
+		batch = append(batch, n)
+		scheduled[n.Node.IP] = true
+		if len(batch) == maxParallelWorkers {
+			batches = append(batches, batch)
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// ComputeUpgradePlan runs the safety checks of an online upgrade against the
+// nodes, and computes the batches the nodes are upgraded in.
+func ComputeUpgradePlan(plan Plan, nodes []ListableNode, kubeClient upgradeKubeInfoClient, opts UpgradePlanOptions) (*UpgradePlan, error) {
+	checksum, err := PlanChecksum(&plan)
+	if err != nil {
+		return nil, err
+	}
+	up := &UpgradePlan{
+		KismaticVersion:    KismaticVersion.String(),
+		PlanChecksum:       checksum,
+		Created:            time.Now(),
+		MaxParallelWorkers: opts.MaxParallelWorkers,
+		IgnoreSafetyChecks: opts.IgnoreSafetyChecks,
+		PartialAllowed:     opts.PartialAllowed,
+		Batches:            [][]UpgradePlanNode{},
+	}
+	toUpgrade := []ListableNode{}
+	for _, n := range nodes {
+		if !IsOlderVersion(n.Version) {
+			up.UpToDate = append(up.UpToDate, newUpgradePlanNode(n))
+			continue
+		}
+		errs := DetectNodeUpgradeSafety(plan, n.Node, kubeClient)
+		if len(errs) == 0 || opts.IgnoreSafetyChecks {
+			toUpgrade = append(toUpgrade, n)
+		}
+		if len(errs) == 0 {
+			continue
+		}
+		unsafe := newUpgradePlanNode(n)
+		for _, err := range errs {
+			unsafe.SafetyErrors = append(unsafe.SafetyErrors, err.Error())
+		}
+		up.Unsafe = append(up.Unsafe, unsafe)
+		// etcd and master nodes always block the upgrade, workers only block a full upgrade
+		if !opts.IgnoreSafetyChecks && (!opts.PartialAllowed || util.Contains("etcd", n.Roles) || util.Contains("master", n.Roles)) {
+			up.Blocked = "Unable to perform an online upgrade due to the unsafe conditions detected."
+		}
+	}
+	for _, batch := range UpgradeBatches(toUpgrade, opts.MaxParallelWorkers) {
+		b := []UpgradePlanNode{}
+		for _, n := range batch {
+			b = append(b, newUpgradePlanNode(n))
+		}
+		up.Batches = append(up.Batches, b)
+	}
+	return up, nil
+}
+
+func newUpgradePlanNode(n ListableNode) UpgradePlanNode {
+	return UpgradePlanNode{
+		Host:    n.Node.Host,
+		IP:      n.Node.IP,
+		Roles:   n.Roles,
+		Version: n.Version.String(),
+	}
+}
+
+// ListableBatches returns the batches of the upgrade plan as the nodes of the
+// cluster. An error is returned if the plan cannot be executed verbatim against
+// the cluster in its current state.
+func (up UpgradePlan) ListableBatches(plan Plan, nodes []ListableNode) ([][]ListableNode, error) {
+	if up.KismaticVersion != KismaticVersion.String() {
+		return nil, fmt.Errorf("the upgrade plan was computed by Kismatic %s, but this is Kismatic %s", up.KismaticVersion, KismaticVersion)
+	}
+	checksum, err := PlanChecksum(&plan)
+	if err != nil {
+		return nil, err
+	}
+	if up.PlanChecksum != checksum {
+		return nil, fmt.Errorf("the plan file has changed since the upgrade plan was computed")
+	}
+	if up.Blocked != "" {
+		return nil, fmt.Errorf("the upgrade plan is blocked: %s", up.Blocked)
+	}
+	batches := [][]ListableNode{}
+	for _, b := range up.Batches {
+		batch := []ListableNode{}
+		for _, planned := range b {
+			var found *ListableNode
+			for i, n := range nodes {
+				if n.Node.Host == planned.Host && n.Node.IP == planned.IP {
+					found = &nodes[i]
+					break
+				}
+			}
+			if found == nil {
+				return nil, fmt.Errorf("node %q of the upgrade plan is not part of the cluster", planned.Host)
+			}
+			if found.Version.String() != planned.Version {
+				return nil, fmt.Errorf("node %q is at version %s, but the upgrade plan was computed when it was at version %s", planned.Host, found.Version, planned.Version)
+			}
+			batch = append(batch, *found)
+		}
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// ReadUpgradePlan reads the upgrade plan from the file
+func ReadUpgradePlan(file string) (*UpgradePlan, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upgrade plan: %v", err)
+	}
+	up := &UpgradePlan{}
+	if err := json.Unmarshal(b, up); err != nil {
+		return nil, fmt.Errorf("error unmarshaling upgrade plan: %v", err)
+	}
+	return up, nil
+}
+
+// WriteUpgradePlan writes the upgrade plan to the file
+func WriteUpgradePlan(file string, up UpgradePlan) error {
+	b, err := json.MarshalIndent(up, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling upgrade plan: %v", err)
+	}
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		return fmt.Errorf("error writing upgrade plan: %v", err)
+	}
+	return nil
+}
+
+// PlanChecksum returns the checksum of the plan. Secrets are hashed as the
+// references written in the plan file, so that the checksum does not depend
+// on their values, nor on the files they were resolved to.
+func PlanChecksum(p *Plan) (string, error) {
+	b, err := yaml.Marshal(withSecretRefs(p))
+	if err != nil {
+		return "", fmt.Errorf("error marshaling plan: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// UpgradeTargets are the package and container image versions installed by
+// this version of Kismatic
+type UpgradeTargets struct {
+	// Packages, by package manager and package name
+	Packages map[string]map[string]string
+	// Images, by image name
+	Images map[string]string
+}
+
+// ReadUpgradeTargets reads the versions installed by Kismatic from the
+// ansible group variables
+func ReadUpgradeTargets(groupVarsDir string) (*UpgradeTargets, error) {
+	vars := map[string]interface{}{}
+	if err := readYAMLFile(filepath.Join(groupVarsDir, "all.yaml"), &vars); err != nil {
+		return nil, err
+	}
+	str := func(name string) string {
+		if v, ok := vars[name]; ok {
+			return fmt.Sprintf("%v", v)
+		}
+		return ""
+	}
+	images := struct {
+		OfficialImages map[string]struct {
+			Name    string `yaml:"name"`
+			Version string `yaml:"version"`
+		} `yaml:"official_images"`
+	}{}
+	if err := readYAMLFile(filepath.Join(groupVarsDir, "container_images.yaml"), &images); err != nil {
+		return nil, err
+	}
+	t := &UpgradeTargets{
+		Packages: map[string]map[string]string{
+			"rpm": {
+				"kubelet":          str("kubernetes_yum_version"),
+				"kubectl":          str("kubernetes_yum_version"),
+				"docker-engine":    str("docker_engine_yum_version"),
+				"glusterfs-server": str("glusterfs_server_version_rhel"),
+			},
+			"deb": {
+				"kubelet":          str("kubernetes_deb_version"),
+				"kubectl":          str("kubernetes_deb_version"),
+				"docker-engine":    str("docker_engine_apt_version"),
+				"glusterfs-server": str("glusterfs_server_version_ubuntu"),
+			},
+		},
+		Images: map[string]string{},
+	}
+	for _, img := range images.OfficialImages {
+		t.Images[img.Name] = img.Version
+	}
+	return t, nil
+}
+
+func readYAMLFile(file string, v interface{}) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading %q: %v", file, err)
+	}
+	if err := yaml.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("error unmarshaling %q: %v", file, err)
+	}
+	return nil
+}
+
+// the output of this script is a line per package: "<manager> <package> <version>".
+// The version is empty if the package is not installed.
+const listPackagesScript = `for p in kubelet kubectl docker-engine glusterfs-server; do ` +
+	`if command -v rpm >/dev/null 2>&1; then v=$(rpm -q --qf '%{VERSION}-%{RELEASE}' $p 2>/dev/null) || v=""; echo "rpm $p $v"; ` +
+	`else v=$(dpkg-query -W -f='${Version}' $p 2>/dev/null) || v=""; echo "deb $p $v"; fi; done`
+
+// ListVersionChanges returns the packages and the container images that are
+// upgraded on the node
+func ListVersionChanges(plan Plan, node Node, targets UpgradeTargets) (packages []VersionChange, images []VersionChange, err error) {
+	client, err := plan.GetSSHClient(node.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkgs, err := client.Output(false, listPackagesScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing the packages of node %q: %v", node.Host, err)
+	}
+	imgs, err := client.Output(true, "sudo docker images --format '{{.Repository}}:{{.Tag}}'")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing the images of node %q: %v", node.Host, err)
+	}
+	packages, images = versionChanges(targets, pkgs, imgs)
+	return packages, images, nil
+}
+
+// versionChanges compares the installed packages and images with the targets.
+// Packages and images that are not on the node are not listed.
+func versionChanges(targets UpgradeTargets, pkgs, imgs string) (packages []VersionChange, images []VersionChange) {
+	scanner := bufio.NewScanner(strings.NewReader(pkgs))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		target := targets.Packages[fields[0]][fields[1]]
+		if target != "" && target != fields[2] {
+			packages = append(packages, VersionChange{Name: fields[1], From: fields[2], To: target})
+		}
+	}
+
+	tags := map[string][]string{}
+	scanner = bufio.NewScanner(strings.NewReader(imgs))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			continue
+		}
+		repo, tag := line[:i], line[i+1:]
+		for name := range targets.Images {
+			// images pulled from a private registry are prefixed with the registry
+			if repo == name || strings.HasSuffix(repo, "/"+name) {
+				tags[name] = append(tags[name], tag)
+			}
+		}
+	}
+	for name, existing := range tags {
+		target := targets.Images[name]
+		if !util.Contains(target, existing) {
+			sort.Strings(existing)
+			images = append(images, VersionChange{Name: name, From: strings.Join(existing, ","), To: target})
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return packages, images
+}
@@ -0,0 +1,252 @@
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/blang/semver"
+)
+
+func batchHosts(batches [][]ListableNode) [][]string {
+	hosts := [][]string{}
+	for _, b := range batches {
+		h := []string{}
+		for _, n := range b {
+			h = append(h, n.Node.Host)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+func listableNode(host, ip, version string, roles ...string) ListableNode {
+	return ListableNode{Node: Node{Host: host, IP: ip}, Roles: roles, Version: semver.MustParse(version)}
+}
+
+func TestUpgradeBatches(t *testing.T) {
+	nodes := []ListableNode{
+		listableNode("worker1", "10.0.0.1", "1.0.0", "worker"),
+		listableNode("master1", "10.0.0.2", "1.0.0", "master", "worker"),
+		listableNode("etcd1", "10.0.0.3", "1.0.0", "etcd", "master"),
+		listableNode("worker2", "10.0.0.4", "1.0.0", "worker"),
+		listableNode("ingress1", "10.0.0.5", "1.0.0", "ingress"),
+		listableNode("master2", "10.0.0.6", "1.0.0", "master"),
+	}
+	tests := []struct {
+		maxParallelWorkers int
+		expected           [][]string
+	}{
+		{
+			maxParallelWorkers: 1,
+			expected:           [][]string{{"etcd1"}, {"master1"}, {"master2"}, {"worker1"}, {"worker2"}, {"ingress1"}},
+		},
+		{
+			maxParallelWorkers: 2,
+			expected:           [][]string{{"etcd1"}, {"master1"}, {"master2"}, {"worker1", "worker2"}, {"ingress1"}},
+		},
+		{
+			maxParallelWorkers: 5,
+			expected:           [][]string{{"etcd1"}, {"master1"}, {"master2"}, {"worker1", "worker2", "ingress1"}},
+		},
+	}
+	for _, test := range tests {
+		batches := batchHosts(UpgradeBatches(nodes, test.maxParallelWorkers))
+		if !reflect.DeepEqual(batches, test.expected) {
+			t.Errorf("max parallel workers %d: expected batches %v, but got %v", test.maxParallelWorkers, test.expected, batches)
+		}
+	}
+}
+
+func TestComputeUpgradePlan(t *testing.T) {
+	SetVersion("1.2.0")
+	plan := Plan{
+		Master: MasterNodeGroup{ExpectedCount: 1, Nodes: []Node{{Host: "master1", IP: "10.0.0.1"}}},
+		Worker: NodeGroup{ExpectedCount: 3, Nodes: []Node{{Host: "worker1", IP: "10.0.0.2"}, {Host: "worker2", IP: "10.0.0.3"}, {Host: "worker3", IP: "10.0.0.4"}}},
+	}
+	nodes := []ListableNode{
+		listableNode("worker1", "10.0.0.2", "1.1.0", "worker"),
+		listableNode("worker2", "10.0.0.3", "1.1.0", "worker"),
+		listableNode("worker3", "10.0.0.4", "1.2.0", "worker"),
+	}
+	// worker2 runs a pod that is not managed by a controller
+	kubeClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{
+				Items: []data.Pod{{ObjectMeta: data.ObjectMeta{Name: "lone", Namespace: "default"}, Spec: data.PodSpec{NodeName: "worker2"}}},
+			}, nil
+		},
+	}
+
+	up, err := ComputeUpgradePlan(plan, nodes, kubeClient, UpgradePlanOptions{MaxParallelWorkers: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if up.Blocked == "" {
+		t.Error("expected a full upgrade to be blocked by the unsafe worker")
+	}
+	if len(up.Unsafe) != 1 || up.Unsafe[0].Host != "worker2" || len(up.Unsafe[0].SafetyErrors) != 1 {
+		t.Errorf("expected worker2 to be unsafe, but got %+v", up.Unsafe)
+	}
+	if len(up.UpToDate) != 1 || up.UpToDate[0].Host != "worker3" {
+		t.Errorf("expected worker3 to be up to date, but got %+v", up.UpToDate)
+	}
+	if len(up.Batches) != 1 || len(up.Batches[0]) != 1 || up.Batches[0][0].Host != "worker1" {
+		t.Errorf("expected a single batch with worker1, but got %+v", up.Batches)
+	}
+
+	up, err = ComputeUpgradePlan(plan, nodes, kubeClient, UpgradePlanOptions{MaxParallelWorkers: 2, PartialAllowed: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if up.Blocked != "" {
+		t.Errorf("expected a partial upgrade not to be blocked by an unsafe worker, but got %q", up.Blocked)
+	}
+
+	up, err = ComputeUpgradePlan(plan, nodes, kubeClient, UpgradePlanOptions{MaxParallelWorkers: 2, IgnoreSafetyChecks: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if up.Blocked != "" || len(up.Batches) != 1 || len(up.Batches[0]) != 2 {
+		t.Errorf("expected the unsafe worker to be upgraded when ignoring the safety checks, but got %+v", up)
+	}
+
+	// the upgrade plan is executed verbatim
+	batches, err := up.ListableBatches(plan, nodes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hosts := batchHosts(batches); !reflect.DeepEqual(hosts, [][]string{{"worker1", "worker2"}}) {
+		t.Errorf("expected the batches of the upgrade plan, but got %v", hosts)
+	}
+}
+
+func TestUpgradePlanListableBatchesStale(t *testing.T) {
+	SetVersion("1.2.0")
+	plan := Plan{
+		Worker: NodeGroup{ExpectedCount: 2, Nodes: []Node{{Host: "worker1", IP: "10.0.0.1"}, {Host: "worker2", IP: "10.0.0.2"}}},
+	}
+	nodes := []ListableNode{
+		listableNode("worker1", "10.0.0.1", "1.1.0", "worker"),
+		listableNode("worker2", "10.0.0.2", "1.1.0", "worker"),
+	}
+	up, err := ComputeUpgradePlan(plan, nodes, fakeUpgradeKubeClient{}, UpgradePlanOptions{MaxParallelWorkers: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	changed := plan
+	changed.Worker.ExpectedCount = 3
+	if _, err := up.ListableBatches(changed, nodes); err == nil || !strings.Contains(err.Error(), "plan file has changed") {
+		t.Errorf("expected an error when the plan changed, but got %v", err)
+	}
+	upgraded := []ListableNode{nodes[0], listableNode("worker2", "10.0.0.2", "1.2.0", "worker")}
+	if _, err := up.ListableBatches(plan, upgraded); err == nil {
+		t.Error("expected an error when a node changed version")
+	}
+	SetVersion("1.3.0")
+	defer SetVersion("1.2.0")
+	if _, err := up.ListableBatches(plan, nodes); err == nil {
+		t.Error("expected an error when the upgrade plan was computed by another version")
+	}
+}
+
+func TestPlanChecksumUsesSecretRefs(t *testing.T) {
+	checksum := func(password string) string {
+		os.Setenv("KET_TEST_CHECKSUM_PASSWORD", password)
+		defer os.Unsetenv("KET_TEST_CHECKSUM_PASSWORD")
+		p := &Plan{}
+		p.Cluster.AdminPassword = "env:KET_TEST_CHECKSUM_PASSWORD"
+		if err := resolveSecrets(p, ""); err != nil {
+			t.Fatalf("unexpected error resolving secrets: %v", err)
+		}
+		sum, err := PlanChecksum(p)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return sum
+	}
+	if checksum("first") != checksum("second") {
+		t.Error("expected the checksum to not depend on the values of the secrets")
+	}
+}
+
+func TestVersionChanges(t *testing.T) {
+	targets := UpgradeTargets{
+		Packages: map[string]map[string]string{
+			"rpm": {"kubelet": "1.8.0-0", "kubectl": "1.8.0-0", "docker-engine": "1.12.6-1.el7.centos"},
+		},
+		Images: map[string]string{
+			"gcr.io/google-containers/kube-proxy-amd64": "v1.8.0",
+			"quay.io/coreos/etcd":                       "v3.1.10",
+			"gcr.io/google_containers/pause-amd64":      "3.0",
+		},
+	}
+	pkgs := "rpm kubelet 1.7.4-0\nrpm kubectl 1.8.0-0\nrpm docker-engine 1.12.6-1.el7.centos\nrpm glusterfs-server \n"
+	imgs := "registry.example.com:5000/gcr.io/google-containers/kube-proxy-amd64:v1.7.4\n" +
+		"quay.io/coreos/etcd:v3.1.10\n" +
+		"nginx:latest\n"
+	packages, images := versionChanges(targets, pkgs, imgs)
+	expectedPackages := []VersionChange{{Name: "kubelet", From: "1.7.4-0", To: "1.8.0-0"}}
+	if !reflect.DeepEqual(packages, expectedPackages) {
+		t.Errorf("expected package changes %v, but got %v", expectedPackages, packages)
+	}
+	expectedImages := []VersionChange{{Name: "gcr.io/google-containers/kube-proxy-amd64", From: "v1.7.4", To: "v1.8.0"}}
+	if !reflect.DeepEqual(images, expectedImages) {
+		t.Errorf("expected image changes %v, but got %v", expectedImages, images)
+	}
+}
+
+func TestReadUpgradeTargets(t *testing.T) {
+	targets, err := ReadUpgradeTargets("../../ansible/group_vars")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if targets.Packages["rpm"]["kubelet"] == "" || targets.Packages["deb"]["kubelet"] == "" {
+		t.Errorf("expected the kubelet package versions, but got %v", targets.Packages)
+	}
+	if targets.Images["quay.io/coreos/etcd"] == "" {
+		t.Errorf("expected the etcd image version, but got %v", targets.Images)
+	}
+}
+
+func TestUpgradeNodeBatchesAndRollbackNode(t *testing.T) {
+	dryRunDir := mustGetTempDir(t)
+	defer os.RemoveAll(dryRunDir)
+	e := ansibleExecutor{
+		options:                ExecutorOptions{DryRun: true, DryRunDirectory: dryRunDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+	}
+	plan := Plan{
+		Worker: NodeGroup{ExpectedCount: 3, Nodes: []Node{{Host: "worker1", IP: "10.0.0.1"}, {Host: "worker2", IP: "10.0.0.2"}, {Host: "worker3", IP: "10.0.0.3"}}},
+	}
+	plan.Cluster.Networking.ServiceCIDRBlock = "10.3.0.0/16"
+	plan.Master = MasterNodeGroup{ExpectedCount: 1, LoadBalancedFQDN: "10.0.0.4", Nodes: []Node{{Host: "master1", IP: "10.0.0.4"}}}
+	batches := [][]ListableNode{
+		{listableNode("worker1", "10.0.0.1", "1.0.0", "worker"), listableNode("worker2", "10.0.0.2", "1.0.0", "worker")},
+		{listableNode("worker3", "10.0.0.3", "1.0.0", "worker")},
+	}
+	if err := e.UpgradeNodeBatches(plan, batches, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := e.RollbackNode(plan, batches[1][0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	playbooks, err := ioutil.ReadFile(filepath.Join(dryRunDir, dryRunPlaybookList))
+	if err != nil {
+		t.Fatalf("error reading playbook list: %v", err)
+	}
+	expected := "01-upgrade-nodes\tupgrade-nodes.yaml\tworker1,worker2\n" +
+		"02-upgrade-nodes\tupgrade-nodes.yaml\tworker3\n" +
+		"03-upgrade-rollback\tupgrade-rollback.yaml\tworker3\n"
+	if string(playbooks) != expected {
+		t.Errorf("expected playbook list %q, but got %q", expected, string(playbooks))
+	}
+}
@@ -18,6 +18,8 @@ type fakeUpgradeKubeClient struct {
 	getPersistentVolume      func(name string) (*data.PersistentVolume, error)
 	getPersistentVolumeClaim func(name string) (*data.PersistentVolumeClaim, error)
 	getStatefulSet           func() (*data.StatefulSet, error)
+	getDeployment            func(name string) (*data.Deployment, error)
+	listPDBs                 func() (*data.PodDisruptionBudgetList, error)
 }
 
 func (f fakeUpgradeKubeClient) ListPods() (*data.PodList, error) {
@@ -69,6 +71,37 @@ func (f fakeUpgradeKubeClient) GetStatefulSet(namespace, name string) (*data.Sta
 	return nil, errors.New("StatefulSet not found")
 }
 
+func (f fakeUpgradeKubeClient) GetDeployment(namespace, name string) (*data.Deployment, error) {
+	if f.getDeployment != nil {
+		return f.getDeployment(name)
+	}
+	return nil, errors.New("Deployment not found")
+}
+
+func (f fakeUpgradeKubeClient) ListPodDisruptionBudgets() (*data.PodDisruptionBudgetList, error) {
+	if f.listPDBs != nil {
+		return f.listPDBs()
+	}
+	return &data.PodDisruptionBudgetList{}, nil
+}
+
+func getPodWithOwner(nodeName, name, ownerKind, ownerName string) data.Pod {
+	controller := true
+	return data.Pod{
+		ObjectMeta: data.ObjectMeta{
+			Name:      name,
+			Namespace: "foo",
+			Labels:    map[string]string{"app": ownerName},
+			OwnerReferences: []data.OwnerReference{
+				{Kind: ownerKind, Name: ownerName, Controller: &controller},
+			},
+		},
+		Spec: data.PodSpec{
+			NodeName: nodeName,
+		},
+	}
+}
+
 func getSafePodWithCreatedByRef(t *testing.T, nodeName string, createdByKind string) data.Pod {
 	createdByRef := data.SerializedReference{
 		Reference: data.ObjectReference{
@@ -823,3 +856,204 @@ func TestDetectNodeUpgradeSafetyAllReplicaControllerPodsSameNode(t *testing.T) {
 		t.Errorf("expected replicasOnSingleNodeErr, but got %T", errs[0])
 	}
 }
+
+func twoWorkerPlan() Plan {
+	return Plan{
+		Worker: NodeGroup{
+			ExpectedCount: 2,
+			Nodes: []Node{
+				{
+					Host: "foo",
+					IP:   "10.0.0.1",
+				},
+				{
+					Host: "bar",
+					IP:   "10.0.0.2",
+				},
+			},
+		},
+	}
+}
+
+func TestDetectNodeUpgradeSafetyDeploymentOwnerReference(t *testing.T) {
+	plan := twoWorkerPlan()
+	node := plan.Worker.Nodes[0]
+	controller := true
+	k8sClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{
+				Items: []data.Pod{
+					getPodWithOwner(node.Host, "web-1", "ReplicaSet", "web-12345"),
+					getPodWithOwner(node.Host, "web-2", "ReplicaSet", "web-12345"),
+				},
+			}, nil
+		},
+		getReplicaSet: func() (*data.ReplicaSet, error) {
+			return &data.ReplicaSet{
+				ObjectMeta: data.ObjectMeta{
+					OwnerReferences: []data.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &controller}},
+				},
+				Status: data.ReplicaSetStatus{Replicas: 2},
+			}, nil
+		},
+		getDeployment: func(name string) (*data.Deployment, error) {
+			if name != "web" {
+				t.Errorf("expected the deployment that owns the replica set, but got %q", name)
+			}
+			// one of the replicas runs on another node
+			return &data.Deployment{Status: data.DeploymentStatus{Replicas: 3}}, nil
+		},
+	}
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	if len(errs) != 0 {
+		t.Errorf("Did not expect errors, but got: %v", errs)
+	}
+}
+
+func TestDetectNodeUpgradeSafetyAllDeploymentPodsSameNode(t *testing.T) {
+	plan := twoWorkerPlan()
+	node := plan.Worker.Nodes[0]
+	controller := true
+	k8sClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{
+				Items: []data.Pod{
+					getPodWithOwner(node.Host, "web-1", "ReplicaSet", "web-12345"),
+					getPodWithOwner(node.Host, "web-2", "ReplicaSet", "web-12345"),
+				},
+			}, nil
+		},
+		getReplicaSet: func() (*data.ReplicaSet, error) {
+			return &data.ReplicaSet{
+				ObjectMeta: data.ObjectMeta{
+					OwnerReferences: []data.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &controller}},
+				},
+			}, nil
+		},
+		getDeployment: func(name string) (*data.Deployment, error) {
+			return &data.Deployment{Status: data.DeploymentStatus{Replicas: 2}}, nil
+		},
+	}
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	if len(errs) != 1 {
+		t.Fatalf("Expected %d errors, but got %v", 1, errs)
+	}
+	if err, ok := errs[0].(replicasOnSingleNodeErr); !ok || err.kind != "Deployment" || err.name != "web" {
+		t.Errorf("expected replicasOnSingleNodeErr for the deployment, but got %v", errs[0])
+	}
+}
+
+func TestDetectNodeUpgradeSafetyCustomControllerWithoutPDB(t *testing.T) {
+	plan := twoWorkerPlan()
+	node := plan.Worker.Nodes[0]
+	k8sClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{
+				Items: []data.Pod{getPodWithOwner(node.Host, "db-0", "EtcdCluster", "db")},
+			}, nil
+		},
+	}
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	if len(errs) != 1 {
+		t.Fatalf("Expected %d errors, but got %v", 1, errs)
+	}
+	if !strings.Contains(errs[0].Error(), "EtcdCluster") {
+		t.Errorf("expected the error to name the controller, but got %v", errs[0])
+	}
+}
+
+func TestDetectNodeUpgradeSafetyPodDisruptionBudget(t *testing.T) {
+	tests := []struct {
+		allowed      int32
+		expectedErrs int
+	}{
+		{allowed: 0, expectedErrs: 1},
+		{allowed: 1, expectedErrs: 1},
+		{allowed: 2, expectedErrs: 0},
+	}
+	for _, test := range tests {
+		plan := twoWorkerPlan()
+		node := plan.Worker.Nodes[0]
+		k8sClient := fakeUpgradeKubeClient{
+			listPods: func() (*data.PodList, error) {
+				return &data.PodList{
+					Items: []data.Pod{
+						getPodWithOwner(node.Host, "db-0", "EtcdCluster", "db"),
+						getPodWithOwner(node.Host, "db-1", "EtcdCluster", "db"),
+						getPodWithOwner("bar", "db-2", "EtcdCluster", "db"),
+						// pods that are not covered by the budget
+						getPodWithOwner(node.Host, "web-0", "StatefulSet", "web"),
+					},
+				}, nil
+			},
+			getStatefulSet: func() (*data.StatefulSet, error) {
+				return &data.StatefulSet{Status: data.StatefulSetStatus{Replicas: 3}}, nil
+			},
+			listPDBs: func() (*data.PodDisruptionBudgetList, error) {
+				return &data.PodDisruptionBudgetList{
+					Items: []data.PodDisruptionBudget{
+						{
+							ObjectMeta: data.ObjectMeta{Name: "db", Namespace: "foo"},
+							Spec: data.PodDisruptionBudgetSpec{
+								Selector: &data.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+							},
+							Status: data.PodDisruptionBudgetStatus{PodDisruptionsAllowed: test.allowed},
+						},
+						{
+							// budgets of other namespaces do not apply
+							ObjectMeta: data.ObjectMeta{Name: "db", Namespace: "other"},
+							Spec: data.PodDisruptionBudgetSpec{
+								Selector: &data.LabelSelector{},
+							},
+						},
+					},
+				}, nil
+			},
+		}
+		errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+		if len(errs) != test.expectedErrs {
+			t.Errorf("allowed disruptions %d: expected %d errors, but got %v", test.allowed, test.expectedErrs, errs)
+			continue
+		}
+		if test.expectedErrs == 1 {
+			if err, ok := errs[0].(podDisruptionBudgetErr); !ok || err.pods != 2 {
+				t.Errorf("expected podDisruptionBudgetErr for 2 pods, but got %v", errs[0])
+			}
+		}
+	}
+}
+
+func TestDetectNodeUpgradeSafetyPDBCoversUnreplicatedPod(t *testing.T) {
+	plan := twoWorkerPlan()
+	node := plan.Worker.Nodes[0]
+	k8sClient := fakeUpgradeKubeClient{
+		listPods: func() (*data.PodList, error) {
+			return &data.PodList{
+				Items: []data.Pod{getPodWithOwner(node.Host, "cache-1", "ReplicaSet", "cache")},
+			}, nil
+		},
+		getReplicaSet: func() (*data.ReplicaSet, error) {
+			return &data.ReplicaSet{Status: data.ReplicaSetStatus{Replicas: 1}}, nil
+		},
+		listPDBs: func() (*data.PodDisruptionBudgetList, error) {
+			return &data.PodDisruptionBudgetList{
+				Items: []data.PodDisruptionBudget{
+					{
+						ObjectMeta: data.ObjectMeta{Name: "cache", Namespace: "foo"},
+						Spec: data.PodDisruptionBudgetSpec{
+							Selector: &data.LabelSelector{
+								MatchExpressions: []data.LabelSelectorRequirement{{Key: "app", Operator: "In", Values: []string{"cache"}}},
+							},
+						},
+						Status: data.PodDisruptionBudgetStatus{PodDisruptionsAllowed: 1},
+					},
+				},
+			}, nil
+		},
+	}
+	// the budget allows the disruption, so the replica count is not checked
+	errs := DetectNodeUpgradeSafety(plan, node, k8sClient)
+	if len(errs) != 0 {
+		t.Errorf("Did not expect errors, but got: %v", errs)
+	}
+}
@@ -0,0 +1,306 @@
+package install
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/data"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// WaveSize is the number of nodes upgraded in a wave, either as a count or as
+// a percentage of the nodes to upgrade
+type WaveSize struct {
+	Count   int
+	Percent int
+}
+
+func (w WaveSize) String() string {
+	if w.Percent > 0 {
+		return fmt.Sprintf("%d%%", w.Percent)
+	}
+	return strconv.Itoa(w.Count)
+}
+
+// nodes returns the number of nodes in the wave, out of total nodes
+func (w WaveSize) nodes(total int) int {
+	n := w.Count
+	if w.Percent > 0 {
+		// round up, so that a wave always has a node
+		n = (w.Percent*total + 99) / 100
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// ParseWaves parses a comma separated list of wave sizes, e.g. "1,25%,50%".
+// Sizes are either node counts, or percentages of the nodes to upgrade.
+func ParseWaves(s string) ([]WaveSize, error) {
+	waves := []WaveSize{}
+	for _, w := range strings.Split(s, ",") {
+		w = strings.TrimSpace(w)
+		percent := strings.HasSuffix(w, "%")
+		n, err := strconv.Atoi(strings.TrimSuffix(w, "%"))
+		if err != nil || n < 1 || (percent && n > 100) {
+			return nil, fmt.Errorf("invalid wave size %q: must be a count greater than 0, or a percentage between 1%% and 100%%", w)
+		}
+		if percent {
+			waves = append(waves, WaveSize{Percent: n})
+		} else {
+			waves = append(waves, WaveSize{Count: n})
+		}
+	}
+	return waves, nil
+}
+
+// UpgradeWaves returns the nodes grouped in the batches they are upgraded in.
+// Etcd and master nodes are upgraded first, one node at a time. The rest of the nodes
+// are upgraded in waves of the given sizes. The last size is used for the remaining waves.
+func UpgradeWaves(nodes []ListableNode, sizes []WaveSize) [][]ListableNode {
+	batches := [][]ListableNode{}
+	rest := []ListableNode{}
+	for _, b := range UpgradeBatches(nodes, 1) {
+		if isControlPlaneBatch(b) {
+			batches = append(batches, b)
+		} else {
+			rest = append(rest, b...)
+		}
+	}
+	if len(sizes) == 0 {
+		sizes = []WaveSize{{Count: 1}}
+	}
+	total := len(rest)
+	for i := 0; len(rest) > 0; i++ {
+		size := sizes[len(sizes)-1]
+		if i < len(sizes) {
+			size = sizes[i]
+		}
+		n := size.nodes(total)
+		if n > len(rest) {
+			n = len(rest)
+		}
+		batches = append(batches, rest[:n])
+		rest = rest[n:]
+	}
+	return batches
+}
+
+func isControlPlaneBatch(batch []ListableNode) bool {
+	return len(batch) == 1 && (util.Contains("etcd", batch[0].Roles) || util.Contains("master", batch[0].Roles))
+}
+
+// A HealthGate verifies the health of the cluster after a wave of nodes is upgraded
+type HealthGate interface {
+	// Name of the gate
+	Name() string
+	// Check returns an error if the gate fails for the nodes of the wave
+	Check(plan Plan, nodes []ListableNode) error
+}
+
+type healthGateKubeClient interface {
+	data.NodeGetter
+	data.PodLister
+}
+
+// waitFor calls the function until it succeeds, or until the timeout expires
+func waitFor(timeout, interval time.Duration, f func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := f()
+		if err == nil || time.Now().Add(interval).After(deadline) {
+			return err
+		}
+		time.Sleep(interval)
+	}
+}
+
+// NewNodeReadyGate returns a gate that waits for the nodes to be Ready
+func NewNodeReadyGate(kubeClient healthGateKubeClient, timeout time.Duration) HealthGate {
+	return nodeReadyGate{kubeClient: kubeClient, timeout: timeout, interval: 10 * time.Second}
+}
+
+type nodeReadyGate struct {
+	kubeClient healthGateKubeClient
+	timeout    time.Duration
+	interval   time.Duration
+}
+
+func (g nodeReadyGate) Name() string { return "node-ready" }
+
+func (g nodeReadyGate) Check(plan Plan, nodes []ListableNode) error {
+	return waitFor(g.timeout, g.interval, func() error {
+		for _, n := range nodes {
+			node, err := g.kubeClient.GetNode(strings.ToLower(n.Node.Host))
+			if err != nil {
+				return err
+			}
+			if !node.Ready() {
+				return fmt.Errorf("node %q is not Ready", n.Node.Host)
+			}
+		}
+		return nil
+	})
+}
+
+// NewPodsRunningGate returns a gate that waits for all the pods on the nodes to be running
+func NewPodsRunningGate(kubeClient healthGateKubeClient, timeout time.Duration) HealthGate {
+	return podsRunningGate{kubeClient: kubeClient, timeout: timeout, interval: 10 * time.Second}
+}
+
+type podsRunningGate struct {
+	kubeClient healthGateKubeClient
+	timeout    time.Duration
+	interval   time.Duration
+}
+
+func (g podsRunningGate) Name() string { return "pods-running" }
+
+func (g podsRunningGate) Check(plan Plan, nodes []ListableNode) error {
+	hosts := map[string]bool{}
+	for _, n := range nodes {
+		hosts[strings.ToLower(n.Node.Host)] = true
+	}
+	return waitFor(g.timeout, g.interval, func() error {
+		pods, err := g.kubeClient.ListPods()
+		if err != nil {
+			return err
+		}
+		if pods == nil {
+			return nil
+		}
+		notRunning := []string{}
+		for _, p := range pods.Items {
+			// pods of completed jobs are not expected to be running
+			if hosts[strings.ToLower(p.Spec.NodeName)] && p.Status.Phase != "Running" && p.Status.Phase != "Succeeded" {
+				notRunning = append(notRunning, fmt.Sprintf("%s/%s (%s)", p.Namespace, p.Name, p.Status.Phase))
+			}
+		}
+		if len(notRunning) > 0 {
+			return fmt.Errorf("pods are not running: %s", strings.Join(notRunning, ", "))
+		}
+		return nil
+	})
+}
+
+// NewSmokeTestGate returns a gate that runs the smoke test against the cluster
+func NewSmokeTestGate(executor Executor) HealthGate {
+	return smokeTestGate{executor: executor}
+}
+
+type smokeTestGate struct {
+	executor Executor
+}
+
+func (g smokeTestGate) Name() string { return "smoke-test" }
+
+func (g smokeTestGate) Check(plan Plan, nodes []ListableNode) error {
+	return g.executor.RunSmokeTest(&plan)
+}
+
+// NewHTTPProbeGate returns a gate that waits for the URL to return a 2xx status code
+func NewHTTPProbeGate(url string, timeout time.Duration) HealthGate {
+	return httpProbeGate{url: url, timeout: timeout, interval: 10 * time.Second, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type httpProbeGate struct {
+	url      string
+	timeout  time.Duration
+	interval time.Duration
+	client   *http.Client
+}
+
+func (g httpProbeGate) Name() string { return "http-probe " + g.url }
+
+func (g httpProbeGate) Check(plan Plan, nodes []ListableNode) error {
+	return waitFor(g.timeout, g.interval, func() error {
+		resp, err := g.client.Get(g.url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned status %d", g.url, resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// GateFailureAction is what to do when a health gate fails
+type GateFailureAction string
+
+const (
+	// GateRetry checks the health gates again
+	GateRetry = GateFailureAction("retry")
+	// GateContinue continues with the next wave
+	GateContinue = GateFailureAction("continue")
+	// GateAbort stops the upgrade
+	GateAbort = GateFailureAction("abort")
+)
+
+// WaveUpgradeOptions are the options of an upgrade in waves
+type WaveUpgradeOptions struct {
+	// Waves are the sizes of the waves of nodes
+	Waves []WaveSize
+	// Gates are checked after every wave of nodes that are not etcd or master nodes
+	Gates []HealthGate
+	// OnGateFailure decides what to do when a gate fails. The upgrade is
+	// aborted if it is not set.
+	OnGateFailure func(wave int, gate HealthGate, err error) (GateFailureAction, error)
+	// Progress is called before every wave of nodes is upgraded
+	Progress func(wave int, nodes []ListableNode)
+}
+
+// UpgradeNodesInWaves upgrades the nodes in waves, and checks the health gates
+// after every wave of nodes that are not etcd or master nodes.
+func UpgradeNodesInWaves(executor Executor, plan Plan, nodes []ListableNode, onlineUpgrade bool, opts WaveUpgradeOptions) error {
+	wave := 0
+	for _, batch := range UpgradeWaves(nodes, opts.Waves) {
+		if isControlPlaneBatch(batch) {
+			if err := executor.UpgradeNodeBatches(plan, [][]ListableNode{batch}, onlineUpgrade); err != nil {
+				return err
+			}
+			continue
+		}
+		wave++
+		if opts.Progress != nil {
+			opts.Progress(wave, batch)
+		}
+		if err := executor.UpgradeNodeBatches(plan, [][]ListableNode{batch}, onlineUpgrade); err != nil {
+			return err
+		}
+		if err := checkHealthGates(plan, batch, wave, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkHealthGates(plan Plan, nodes []ListableNode, wave int, opts WaveUpgradeOptions) error {
+	for _, gate := range opts.Gates {
+		for {
+			err := gate.Check(plan, nodes)
+			if err == nil {
+				break
+			}
+			action := GateAbort
+			if opts.OnGateFailure != nil {
+				var cbErr error
+				if action, cbErr = opts.OnGateFailure(wave, gate, err); cbErr != nil {
+					return cbErr
+				}
+			}
+			if action == GateContinue {
+				break
+			}
+			if action != GateRetry {
+				return fmt.Errorf("health gate %q failed after wave %d: %v", gate.Name(), wave, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/ansible"
+	"github.com/apprenda/kismatic/pkg/data"
+)
+
+func TestParseWaves(t *testing.T) {
+	tests := []struct {
+		waves    string
+		expected []WaveSize
+		valid    bool
+	}{
+		{waves: "1", expected: []WaveSize{{Count: 1}}, valid: true},
+		{waves: "1, 25%,50%", expected: []WaveSize{{Count: 1}, {Percent: 25}, {Percent: 50}}, valid: true},
+		{waves: "100%", expected: []WaveSize{{Percent: 100}}, valid: true},
+		{waves: "0"},
+		{waves: "101%"},
+		{waves: "1,,2"},
+		{waves: "a"},
+	}
+	for _, test := range tests {
+		waves, err := ParseWaves(test.waves)
+		if test.valid != (err == nil) {
+			t.Errorf("waves %q: expected valid to be %v, but got error %v", test.waves, test.valid, err)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(waves, test.expected) {
+			t.Errorf("waves %q: expected %v, but got %v", test.waves, test.expected, waves)
+		}
+	}
+}
+
+func TestUpgradeWaves(t *testing.T) {
+	nodes := []ListableNode{
+		listableNode("master1", "10.0.0.1", "1.0.0", "master"),
+		listableNode("etcd1", "10.0.0.2", "1.0.0", "etcd"),
+	}
+	for i := 1; i <= 10; i++ {
+		nodes = append(nodes, listableNode(fmt.Sprintf("worker%d", i), fmt.Sprintf("10.0.1.%d", i), "1.0.0", "worker"))
+	}
+	tests := []struct {
+		waves    []WaveSize
+		expected []int
+	}{
+		{
+			waves:    []WaveSize{{Count: 1}},
+			expected: []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			// percentages are of all the workers, rounded up, and the last size repeats
+			waves:    []WaveSize{{Count: 1}, {Percent: 25}, {Percent: 50}},
+			expected: []int{1, 1, 1, 3, 5, 1},
+		},
+		{
+			waves:    []WaveSize{{Count: 2}, {Count: 20}},
+			expected: []int{1, 1, 2, 8},
+		},
+		{
+			waves:    []WaveSize{{Percent: 1}, {Percent: 100}},
+			expected: []int{1, 1, 1, 9},
+		},
+	}
+	for _, test := range tests {
+		batches := UpgradeWaves(nodes, test.waves)
+		sizes := []int{}
+		for _, b := range batches {
+			sizes = append(sizes, len(b))
+		}
+		if !reflect.DeepEqual(sizes, test.expected) {
+			t.Errorf("waves %v: expected batch sizes %v, but got %v", test.waves, test.expected, sizes)
+		}
+		if batches[0][0].Node.Host != "etcd1" || batches[1][0].Node.Host != "master1" {
+			t.Errorf("waves %v: expected etcd and master nodes first, but got %v", test.waves, batchHosts(batches))
+		}
+	}
+}
+
+type fakeHealthGate struct {
+	name   string
+	checks []error
+	calls  int
+	nodes  [][]string
+}
+
+func (g *fakeHealthGate) Name() string { return g.name }
+
+func (g *fakeHealthGate) Check(plan Plan, nodes []ListableNode) error {
+	g.nodes = append(g.nodes, batchHosts([][]ListableNode{nodes})[0])
+	g.calls++
+	if len(g.checks) >= g.calls {
+		return g.checks[g.calls-1]
+	}
+	return nil
+}
+
+func wavesTestExecutor(dryRunDir string) (*ansibleExecutor, Plan) {
+	e := &ansibleExecutor{
+		options:                ExecutorOptions{DryRun: true, DryRunDirectory: dryRunDir},
+		stdout:                 ioutil.Discard,
+		consoleOutputFormat:    ansible.RawFormat,
+		runnerExplainerFactory: fakeRunnerExplainer(nil),
+	}
+	plan := Plan{
+		Worker: NodeGroup{ExpectedCount: 3, Nodes: []Node{{Host: "worker1", IP: "10.0.0.1"}, {Host: "worker2", IP: "10.0.0.2"}, {Host: "worker3", IP: "10.0.0.3"}}},
+	}
+	plan.Cluster.Networking.ServiceCIDRBlock = "10.3.0.0/16"
+	plan.Master = MasterNodeGroup{ExpectedCount: 1, LoadBalancedFQDN: "10.0.0.4", Nodes: []Node{{Host: "master1", IP: "10.0.0.4"}}}
+	return e, plan
+}
+
+func TestUpgradeNodesInWaves(t *testing.T) {
+	dryRunDir := mustGetTempDir(t)
+	defer os.RemoveAll(dryRunDir)
+	e, plan := wavesTestExecutor(dryRunDir)
+	nodes := []ListableNode{
+		listableNode("master1", "10.0.0.4", "1.0.0", "master"),
+		listableNode("worker1", "10.0.0.1", "1.0.0", "worker"),
+		listableNode("worker2", "10.0.0.2", "1.0.0", "worker"),
+		listableNode("worker3", "10.0.0.3", "1.0.0", "worker"),
+	}
+	// the gate fails once after the canary, and is retried
+	gate := &fakeHealthGate{name: "fake", checks: []error{errors.New("not ready")}}
+	failures := 0
+	err := UpgradeNodesInWaves(e, plan, nodes, true, WaveUpgradeOptions{
+		Waves: []WaveSize{{Count: 1}, {Percent: 100}},
+		Gates: []HealthGate{gate},
+		OnGateFailure: func(wave int, g HealthGate, err error) (GateFailureAction, error) {
+			failures++
+			if wave != 1 || g != gate {
+				t.Errorf("unexpected gate failure of %q after wave %d", g.Name(), wave)
+			}
+			return GateRetry, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if failures != 1 {
+		t.Errorf("expected one gate failure, but got %d", failures)
+	}
+	expectedNodes := [][]string{{"worker1"}, {"worker1"}, {"worker2", "worker3"}}
+	if !reflect.DeepEqual(gate.nodes, expectedNodes) {
+		t.Errorf("expected the gate to check %v, but got %v", expectedNodes, gate.nodes)
+	}
+	playbooks, err := ioutil.ReadFile(filepath.Join(dryRunDir, dryRunPlaybookList))
+	if err != nil {
+		t.Fatalf("error reading playbook list: %v", err)
+	}
+	expected := "01-upgrade-nodes\tupgrade-nodes.yaml\tmaster1\n" +
+		"02-upgrade-nodes\tupgrade-nodes.yaml\tworker1\n" +
+		"03-upgrade-nodes\tupgrade-nodes.yaml\tworker2,worker3\n"
+	if string(playbooks) != expected {
+		t.Errorf("expected playbook list %q, but got %q", expected, string(playbooks))
+	}
+}
+
+func TestUpgradeNodesInWavesGateFailure(t *testing.T) {
+	tests := []struct {
+		action          GateFailureAction
+		expectedErr     string
+		expectedUpgrade string
+	}{
+		{
+			action:          GateAbort,
+			expectedErr:     `health gate "fake" failed after wave 1: not ready`,
+			expectedUpgrade: "01-upgrade-nodes\tupgrade-nodes.yaml\tworker1\n",
+		},
+		{
+			action:          GateContinue,
+			expectedUpgrade: "01-upgrade-nodes\tupgrade-nodes.yaml\tworker1\n02-upgrade-nodes\tupgrade-nodes.yaml\tworker2,worker3\n",
+		},
+	}
+	for _, test := range tests {
+		dryRunDir := mustGetTempDir(t)
+		defer os.RemoveAll(dryRunDir)
+		e, plan := wavesTestExecutor(dryRunDir)
+		nodes := []ListableNode{
+			listableNode("worker1", "10.0.0.1", "1.0.0", "worker"),
+			listableNode("worker2", "10.0.0.2", "1.0.0", "worker"),
+			listableNode("worker3", "10.0.0.3", "1.0.0", "worker"),
+		}
+		gate := &fakeHealthGate{name: "fake", checks: []error{errors.New("not ready")}}
+		err := UpgradeNodesInWaves(e, plan, nodes, true, WaveUpgradeOptions{
+			Waves: []WaveSize{{Count: 1}, {Percent: 100}},
+			Gates: []HealthGate{gate},
+			OnGateFailure: func(wave int, g HealthGate, err error) (GateFailureAction, error) {
+				return test.action, nil
+			},
+		})
+		if test.expectedErr == "" && err != nil {
+			t.Errorf("action %s: unexpected error: %v", test.action, err)
+		}
+		if test.expectedErr != "" && (err == nil || err.Error() != test.expectedErr) {
+			t.Errorf("action %s: expected error %q, but got %v", test.action, test.expectedErr, err)
+		}
+		playbooks, err := ioutil.ReadFile(filepath.Join(dryRunDir, dryRunPlaybookList))
+		if err != nil {
+			t.Fatalf("error reading playbook list: %v", err)
+		}
+		if string(playbooks) != test.expectedUpgrade {
+			t.Errorf("action %s: expected playbook list %q, but got %q", test.action, test.expectedUpgrade, string(playbooks))
+		}
+	}
+}
+
+type fakeHealthGateKubeClient struct {
+	nodes map[string]data.Node
+	pods  data.PodList
+}
+
+func (f fakeHealthGateKubeClient) GetNode(name string) (*data.Node, error) {
+	n, ok := f.nodes[name]
+	if !ok {
+		return nil, errors.New("node not found")
+	}
+	return &n, nil
+}
+
+func (f fakeHealthGateKubeClient) ListPods() (*data.PodList, error) {
+	return &f.pods, nil
+}
+
+func readyNode(ready string) data.Node {
+	return data.Node{Status: data.NodeStatus{Conditions: []data.NodeCondition{{Type: "Ready", Status: ready}}}}
+}
+
+func TestKubeHealthGates(t *testing.T) {
+	nodes := []ListableNode{listableNode("Worker1", "10.0.0.1", "1.0.0", "worker")}
+	client := fakeHealthGateKubeClient{
+		nodes: map[string]data.Node{"worker1": readyNode("True")},
+		pods: data.PodList{Items: []data.Pod{
+			{ObjectMeta: data.ObjectMeta{Name: "running"}, Spec: data.PodSpec{NodeName: "worker1"}, Status: data.PodStatus{Phase: "Running"}},
+			{ObjectMeta: data.ObjectMeta{Name: "job"}, Spec: data.PodSpec{NodeName: "worker1"}, Status: data.PodStatus{Phase: "Succeeded"}},
+			{ObjectMeta: data.ObjectMeta{Name: "other"}, Spec: data.PodSpec{NodeName: "worker2"}, Status: data.PodStatus{Phase: "Pending"}},
+		}},
+	}
+	if err := (nodeReadyGate{kubeClient: client, interval: time.Millisecond}).Check(Plan{}, nodes); err != nil {
+		t.Errorf("expected the node ready gate to pass, but got %v", err)
+	}
+	if err := (podsRunningGate{kubeClient: client, interval: time.Millisecond}).Check(Plan{}, nodes); err != nil {
+		t.Errorf("expected the pods running gate to pass, but got %v", err)
+	}
+
+	client.nodes["worker1"] = readyNode("False")
+	client.pods.Items[0].Status.Phase = "Pending"
+	if err := (nodeReadyGate{kubeClient: client, interval: time.Millisecond}).Check(Plan{}, nodes); err == nil {
+		t.Error("expected the node ready gate to fail")
+	}
+	err := (podsRunningGate{kubeClient: client, interval: time.Millisecond}).Check(Plan{}, nodes)
+	if err == nil || !strings.Contains(err.Error(), "running") || strings.Contains(err.Error(), "other") {
+		t.Errorf("expected the pods running gate to fail on the pending pod of the node, but got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -146,6 +147,8 @@ func (p *Plan) validate() (bool, []error) {
 	v.validateWithErrPrefix("Docker", p.Docker)
 	v.validate(&p.AddOns)
 	v.validate(nodeList{Nodes: p.getAllNodes()})
+	v.addError(validateControlPlaneOptionsOnMasters(p)...)
+	v.addError(validateManagedAPIServerOptions(p)...)
 	v.validateWithErrPrefix("Etcd nodes", &p.Etcd)
 	v.validateWithErrPrefix("Master nodes", &p.Master)
 	v.validateWithErrPrefix("Worker nodes", &p.Worker)
@@ -173,6 +176,9 @@ func (c *Cluster) validate() (bool, []error) {
 	v.validate(&c.KubeSchedulerOptions)
 	v.validate(&c.KubeletOptions)
 	v.validate(&c.CloudProvider)
+	v.validate(&c.Authentication.OIDC)
+	v.validate(&c.Audit)
+	v.validate(&c.EncryptionAtRest)
 
 	return v.valid()
 }
@@ -241,6 +247,67 @@ func (c *CloudProvider) validate() (bool, []error) {
 	return v.valid()
 }
 
+func (o *OIDCAuthentication) validate() (bool, []error) {
+	v := newValidator()
+	if o.IssuerURL == "" {
+		if o.ClientID != "" || o.UsernameClaim != "" || o.GroupsClaim != "" || o.CAFile != "" {
+			v.addError(errors.New("OIDC issuer URL is required when OIDC authentication is configured"))
+		}
+		return v.valid()
+	}
+	u, err := url.Parse(o.IssuerURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		v.addError(fmt.Errorf("OIDC issuer URL %q is not valid, it must be an https URL", o.IssuerURL))
+	}
+	if o.ClientID == "" {
+		v.addError(errors.New("OIDC client ID cannot be empty"))
+	}
+	if o.CAFile != "" {
+		if _, err := os.Stat(o.CAFile); os.IsNotExist(err) {
+			v.addError(fmt.Errorf("OIDC CA file was not found at %q", o.CAFile))
+		}
+	}
+	return v.valid()
+}
+
+func (a *Audit) validate() (bool, []error) {
+	v := newValidator()
+	if !a.Enabled {
+		if a.PolicyFile != "" || a.LogPath != "" || a.LogMaxAge != 0 || a.LogMaxSize != 0 || a.LogMaxBackups != 0 || a.WebhookConfigFile != "" {
+			v.addError(errors.New("Audit must be enabled when audit options are set"))
+		}
+		return v.valid()
+	}
+	if a.PolicyFile != "" {
+		if _, err := os.Stat(a.PolicyFile); os.IsNotExist(err) {
+			v.addError(fmt.Errorf("Audit policy file was not found at %q", a.PolicyFile))
+		}
+	}
+	if a.LogPath != "" && !filepath.IsAbs(a.LogPath) {
+		v.addError(fmt.Errorf("Audit log path %q must be an absolute path", a.LogPath))
+	}
+	if a.LogMaxAge < 0 || a.LogMaxSize < 0 || a.LogMaxBackups < 0 {
+		v.addError(errors.New("Audit log max age, max size and max backups cannot be negative"))
+	}
+	if a.WebhookConfigFile != "" {
+		if _, err := os.Stat(a.WebhookConfigFile); os.IsNotExist(err) {
+			v.addError(fmt.Errorf("Audit webhook config file was not found at %q", a.WebhookConfigFile))
+		}
+		if a.LogPath != "" || a.LogMaxAge != 0 || a.LogMaxSize != 0 || a.LogMaxBackups != 0 {
+			v.addError(errors.New("Audit log options cannot be set when the webhook backend is used"))
+		}
+	}
+	return v.valid()
+}
+
+func (e *EncryptionAtRest) validate() (bool, []error) {
+	v := newValidator()
+	if e.Provider != "" && !util.Contains(e.Provider, encryptionProviders()) {
+		v.addError(fmt.Errorf("%q is not a valid encryption provider. Options are %v", e.Provider, encryptionProviders()))
+	}
+	return v.valid()
+}
+
 func (f *AddOns) validate() (bool, []error) {
 	v := newValidator()
 	v.validate(f.CNI)
@@ -271,7 +338,7 @@ func (h *HeapsterMonitoring) validate() (bool, []error) {
 	v := newValidator()
 	if h != nil && !h.Disable {
 		if h.Options.Heapster.Replicas <= 0 {
-			v.addError(fmt.Errorf("Heapster replicas %d is not valid, must be greater than 0", h.Options.HeapsterReplicas))
+			v.addError(fmt.Errorf("Heapster replicas %d is not valid, must be greater than 0", h.Options.Heapster.Replicas))
 		}
 		if !util.Contains(h.Options.Heapster.ServiceType, serviceTypes()) {
 			v.addError(fmt.Errorf("Heapster Service Type %q is not a valid option %v", h.Options.Heapster.ServiceType, serviceTypes()))
@@ -340,6 +407,7 @@ func (nl nodeList) validate() (bool, []error) {
 	v := newValidator()
 	v.addError(validateNoDuplicateNodeInfo(nl.Nodes)...)
 	v.addError(validateKubeletOptionsDefinedOnce(nl.Nodes)...)
+	v.addError(validateControlPlaneOptionsDefinedOnce(nl.Nodes)...)
 	return v.valid()
 }
 
@@ -372,13 +440,44 @@ func validateNoDuplicateNodeInfo(nodes []Node) []error {
 }
 
 func validateKubeletOptionsDefinedOnce(nodes []Node) []error {
+	return validateNodeOptionsDefinedOnce(nodes, "kubelet", func(n Node) map[string]string { return n.KubeletOptions.Overrides })
+}
+
+func validateControlPlaneOptionsDefinedOnce(nodes []Node) []error {
+	errs := validateNodeOptionsDefinedOnce(nodes, "kube_apiserver", func(n Node) map[string]string { return n.APIServerOptions.Overrides })
+	errs = append(errs, validateNodeOptionsDefinedOnce(nodes, "kube_controller_manager", func(n Node) map[string]string { return n.KubeControllerManagerOptions.Overrides })...)
+	return append(errs, validateNodeOptionsDefinedOnce(nodes, "kube_scheduler", func(n Node) map[string]string { return n.KubeSchedulerOptions.Overrides })...)
+}
+
+// validateNodeOptionsDefinedOnce returns an error for every node that is
+// repeated for multiple roles with different overrides of a component
+func validateNodeOptionsDefinedOnce(nodes []Node, component string, overrides func(Node) map[string]string) []error {
 	errs := []error{}
 	seenNodes := map[string]map[string]string{}
 	for _, n := range nodes {
-		if val, ok := seenNodes[n.HashCode()]; ok && !reflect.DeepEqual(val, n.KubeletOptions.Overrides) {
-			errs = append(errs, fmt.Errorf("Cannot redefine kubelet options for node %q", n.Host))
+		if val, ok := seenNodes[n.HashCode()]; ok && !reflect.DeepEqual(val, overrides(n)) {
+			errs = append(errs, fmt.Errorf("Cannot redefine %s options for node %q", component, n.Host))
 		} else {
-			seenNodes[n.HashCode()] = n.KubeletOptions.Overrides
+			seenNodes[n.HashCode()] = overrides(n)
+		}
+	}
+	return errs
+}
+
+// validateControlPlaneOptionsOnMasters returns an error for every node that
+// overrides the options of the control plane components, but is not a master
+func validateControlPlaneOptionsOnMasters(p *Plan) []error {
+	errs := []error{}
+	masters := map[string]bool{}
+	for _, n := range p.Master.Nodes {
+		masters[n.HashCode()] = true
+	}
+	for _, n := range p.getAllNodes() {
+		if masters[n.HashCode()] {
+			continue
+		}
+		if len(n.APIServerOptions.Overrides) > 0 || len(n.KubeControllerManagerOptions.Overrides) > 0 || len(n.KubeSchedulerOptions.Overrides) > 0 {
+			errs = append(errs, fmt.Errorf("Node %q is not a master node, and cannot override the options of kube_apiserver, kube_controller_manager or kube_scheduler", n.Host))
 		}
 	}
 	return errs
@@ -462,6 +561,9 @@ func (n *Node) validate() (bool, []error) {
 	if ip := net.ParseIP(n.InternalIP); n.InternalIP != "" && ip == nil {
 		v.addError(fmt.Errorf("Invalid InternalIP provided"))
 	}
+	v.validate(&n.APIServerOptions)
+	v.validate(&n.KubeControllerManagerOptions)
+	v.validate(&n.KubeSchedulerOptions)
 	// validate node labels don't start with 'kismatic/' as that is reserved
 	for key, val := range n.Labels {
 		if strings.HasPrefix(key, "kismatic/") {
@@ -2,6 +2,7 @@ package install
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -10,7 +11,6 @@ var validPlan = Plan{
 		Name:          "test",
 		AdminPassword: "password",
 		Networking: NetworkConfig{
-			Type:             "overlay",
 			PodCIDRBlock:     "172.16.0.0/16",
 			ServiceCIDRBlock: "172.20.0.0/16",
 		},
@@ -1223,6 +1223,136 @@ func TestCloudProvider(t *testing.T) {
 	}
 }
 
+func TestOIDCAuthentication(t *testing.T) {
+	tests := []struct {
+		o     OIDCAuthentication
+		valid bool
+	}{
+		{
+			o:     OIDCAuthentication{},
+			valid: true,
+		},
+		{
+			o:     OIDCAuthentication{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes"},
+			valid: true,
+		},
+		{
+			o:     OIDCAuthentication{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes", UsernameClaim: "email", GroupsClaim: "groups", CAFile: "/bin/sh"},
+			valid: true,
+		},
+		{
+			o:     OIDCAuthentication{IssuerURL: "http://accounts.example.com", ClientID: "kubernetes"},
+			valid: false,
+		},
+		{
+			o:     OIDCAuthentication{IssuerURL: "accounts.example.com", ClientID: "kubernetes"},
+			valid: false,
+		},
+		{
+			o:     OIDCAuthentication{IssuerURL: "https://accounts.example.com"},
+			valid: false,
+		},
+		{
+			o:     OIDCAuthentication{IssuerURL: "https://accounts.example.com", ClientID: "kubernetes", CAFile: "/bin/foo"},
+			valid: false,
+		},
+		{
+			o:     OIDCAuthentication{ClientID: "kubernetes"},
+			valid: false,
+		},
+	}
+	for i, test := range tests {
+		ok, _ := test.o.validate()
+		if ok != test.valid {
+			t.Errorf("test %d: expect %t, but got %t", i, test.valid, ok)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		a     Audit
+		valid bool
+	}{
+		{
+			a:     Audit{},
+			valid: true,
+		},
+		{
+			a:     Audit{Enabled: true},
+			valid: true,
+		},
+		{
+			a:     Audit{Enabled: true, PolicyFile: "/bin/sh", LogPath: "/var/log/audit/kube-apiserver.log", LogMaxAge: 30, LogMaxSize: 100, LogMaxBackups: 10},
+			valid: true,
+		},
+		{
+			a:     Audit{Enabled: true, WebhookConfigFile: "/bin/sh"},
+			valid: true,
+		},
+		{
+			a:     Audit{LogPath: "/var/log/audit.log"},
+			valid: false,
+		},
+		{
+			a:     Audit{Enabled: true, PolicyFile: "/bin/foo"},
+			valid: false,
+		},
+		{
+			a:     Audit{Enabled: true, LogPath: "audit.log"},
+			valid: false,
+		},
+		{
+			a:     Audit{Enabled: true, LogMaxAge: -1},
+			valid: false,
+		},
+		{
+			a:     Audit{Enabled: true, WebhookConfigFile: "/bin/foo"},
+			valid: false,
+		},
+		{
+			a:     Audit{Enabled: true, WebhookConfigFile: "/bin/sh", LogMaxSize: 100},
+			valid: false,
+		},
+	}
+	for i, test := range tests {
+		ok, _ := test.a.validate()
+		if ok != test.valid {
+			t.Errorf("test %d: expect %t, but got %t", i, test.valid, ok)
+		}
+	}
+}
+
+func TestEncryptionAtRest(t *testing.T) {
+	tests := []struct {
+		e     EncryptionAtRest
+		valid bool
+	}{
+		{
+			e:     EncryptionAtRest{},
+			valid: true,
+		},
+		{
+			e:     EncryptionAtRest{Enabled: true},
+			valid: true,
+		},
+		{
+			e:     EncryptionAtRest{Enabled: true, Provider: "secretbox"},
+			valid: true,
+		},
+		{
+			e:     EncryptionAtRest{Enabled: true, Provider: "aesgcm"},
+			valid: false,
+		},
+	}
+	for i, test := range tests {
+		ok, _ := test.e.validate()
+		if ok != test.valid {
+			t.Errorf("test %d: expect %t, but got %t", i, test.valid, ok)
+		}
+	}
+}
+
 func TestNodeLabels(t *testing.T) {
 	tests := []struct {
 		n     Node
@@ -1471,3 +1601,113 @@ func TestNodeKubeletOptions(t *testing.T) {
 		}
 	}
 }
+
+func TestNodeControlPlaneOptions(t *testing.T) {
+	tests := []struct {
+		nl    nodeList
+		valid bool
+	}{
+		{
+			nl: nodeList{
+				[]Node{
+					{
+						Host:             "host1",
+						IP:               "10.0.0.1",
+						APIServerOptions: APIServerOptions{Overrides: map[string]string{"audit-log-path": "/var/log/audit"}},
+					},
+					{
+						Host:             "host2",
+						IP:               "10.0.0.2",
+						APIServerOptions: APIServerOptions{Overrides: map[string]string{"audit-log-path": "/data/audit"}},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			nl: nodeList{
+				[]Node{
+					{
+						Host:                 "host1",
+						IP:                   "10.0.0.1",
+						KubeSchedulerOptions: KubeSchedulerOptions{Overrides: map[string]string{"v": "2"}},
+					},
+					{
+						Host:                 "host1",
+						IP:                   "10.0.0.1",
+						KubeSchedulerOptions: KubeSchedulerOptions{Overrides: map[string]string{"v": "2"}},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			nl: nodeList{
+				[]Node{
+					{
+						Host:             "host1",
+						IP:               "10.0.0.1",
+						APIServerOptions: APIServerOptions{Overrides: map[string]string{"v": "2"}},
+					},
+					{
+						Host: "host1",
+						IP:   "10.0.0.1",
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			nl: nodeList{
+				[]Node{
+					{
+						Host:                         "host1",
+						IP:                           "10.0.0.1",
+						KubeControllerManagerOptions: KubeControllerManagerOptions{Overrides: map[string]string{"v": "2"}},
+					},
+					{
+						Host:                         "host1",
+						IP:                           "10.0.0.1",
+						KubeControllerManagerOptions: KubeControllerManagerOptions{Overrides: map[string]string{"v": "3"}},
+					},
+				},
+			},
+			valid: false,
+		},
+	}
+	for i, test := range tests {
+		ok, _ := test.nl.validate()
+		if ok != test.valid {
+			t.Errorf("test %d: expect %t, but got %t", i, test.valid, ok)
+		}
+	}
+}
+
+func TestNodeControlPlaneProtectedOptions(t *testing.T) {
+	n := Node{
+		Host:                 "host1",
+		IP:                   "10.0.0.1",
+		APIServerOptions:     APIServerOptions{Overrides: map[string]string{"etcd-servers": "https://10.0.0.2:2379"}},
+		KubeSchedulerOptions: KubeSchedulerOptions{Overrides: map[string]string{"kubeconfig": "/tmp/kubeconfig"}},
+	}
+	ok, errs := n.validate()
+	if ok {
+		t.Fatal("expected the protected options of the node to be invalid")
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors, but got %v", errs)
+	}
+}
+
+func TestControlPlaneOptionsOnlyOnMasters(t *testing.T) {
+	master := Node{Host: "master1", IP: "10.0.0.1", APIServerOptions: APIServerOptions{Overrides: map[string]string{"v": "2"}}}
+	worker := Node{Host: "worker1", IP: "10.0.0.2", KubeSchedulerOptions: KubeSchedulerOptions{Overrides: map[string]string{"v": "2"}}}
+	p := &Plan{
+		Master: MasterNodeGroup{Nodes: []Node{master}},
+		Worker: NodeGroup{Nodes: []Node{master, worker}},
+	}
+	errs := validateControlPlaneOptionsOnMasters(p)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "worker1") {
+		t.Errorf("expected an error for the worker node only, but got %v", errs)
+	}
+}
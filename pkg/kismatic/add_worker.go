@@ -0,0 +1,97 @@
+package kismatic
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// AddWorkerOptions are the options for adding a worker
+type AddWorkerOptions struct {
+	// SkipPreFlight skips the pre-flight checks on the new worker
+	SkipPreFlight bool
+}
+
+// AddWorkerResult is the result of adding a worker
+type AddWorkerResult struct {
+	// Plan is the plan that includes the new worker. It is up to the caller
+	// to persist it.
+	Plan *install.Plan
+}
+
+// AddWorker adds a worker node to the cluster described in the plan. The plan
+// itself is not modified, the updated plan is returned in the result. The
+// pre-flight checks are skipped during a dry run.
+func (c *Client) AddWorker(plan *install.Plan, worker install.Node, opts AddWorkerOptions) (result *AddWorkerResult, err error) {
+	const operation = "add-worker"
+	err = c.phase(operation, "validate", "Validating the new worker", func() error {
+		if ok, errs := install.ValidateNode(&worker); !ok {
+			util.PrintValidationErrors(c.options.Log, errs)
+			return ValidationError{Message: "the new worker is not valid", Errors: errs}
+		}
+		if ok, errs := install.ValidatePlan(plan); !ok {
+			util.PrintValidationErrors(c.options.Log, errs)
+			return ValidationError{Message: "the plan is not valid", Errors: errs}
+		}
+		con := &install.SSHConnection{SSHConfig: &plan.Cluster.SSH, Node: &worker}
+		if ok, errs := install.ValidateSSHConnection(con, "New worker node"); !ok {
+			util.PrintValidationErrors(c.options.Log, errs)
+			return ValidationError{Message: "could not connect to the new worker over SSH", Errors: errs}
+		}
+		return ensureNodeIsNew(*plan, worker)
+	})
+	if err != nil {
+		return nil, err
+	}
+	executor, err := c.newExecutor(operation)
+	if err != nil {
+		return nil, err
+	}
+	release, err := executor.LockCluster(*plan, operation)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLock(release, &err)
+
+	// The pre-flight checks install the inspector on the node, so they are
+	// skipped during a dry run
+	if !opts.SkipPreFlight && !c.options.DryRun {
+		util.PrintHeader(c.options.Log, "Running Pre-Flight Checks On New Worker", '=')
+		err = c.phase(operation, "preflight", "Running the pre-flight checks on the new worker", func() error {
+			return executor.RunNewWorkerPreFlightCheck(*plan, worker)
+		})
+		if err != nil {
+			return nil, ValidationError{Message: "the pre-flight checks failed", Errors: []error{err}}
+		}
+	}
+
+	result = &AddWorkerResult{}
+	err = c.phase(operation, "add-worker", fmt.Sprintf("Adding worker %q to the cluster", worker.Host), func() error {
+		updated, err := executor.AddWorker(plan, worker)
+		result.Plan = updated
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// returns an error if the plan contains a worker that is "equivalent"
+// to the new worker that is being added
+func ensureNodeIsNew(plan install.Plan, newWorker install.Node) error {
+	for _, n := range plan.Worker.Nodes {
+		if n.Host == newWorker.Host {
+			return errors.New("the host name of the new node is already being used by another worker node")
+		}
+		if n.IP == newWorker.IP {
+			return errors.New("the IP of the new node is already being used by another worker node")
+		}
+		if newWorker.InternalIP != "" && n.InternalIP == newWorker.InternalIP {
+			return errors.New("the internal IP of the new node is already being used by another worker node")
+		}
+	}
+	return nil
+}
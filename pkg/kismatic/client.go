@@ -0,0 +1,220 @@
+package kismatic
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+// EventType is the type of a progress event
+type EventType string
+
+const (
+	// PhaseStarted is emitted when a phase of an operation starts
+	PhaseStarted = EventType("phase_started")
+	// PhaseSucceeded is emitted when a phase of an operation succeeds
+	PhaseSucceeded = EventType("phase_succeeded")
+	// PhaseFailed is emitted when a phase of an operation fails
+	PhaseFailed = EventType("phase_failed")
+	// AnsibleEvent is emitted for every event of the ansible playbooks
+	// that are run by an operation
+	AnsibleEvent = EventType("ansible")
+)
+
+// Event reports the progress of an operation
+type Event struct {
+	// Time of the event
+	Time time.Time `json:"time"`
+	// Type of the event
+	Type EventType `json:"type"`
+	// Operation that emitted the event, e.g. "install"
+	Operation string `json:"operation"`
+	// Phase of the operation, e.g. "generate-certificates"
+	Phase string `json:"phase,omitempty"`
+	// Message describes the phase. On PhaseFailed events, it contains the error.
+	Message string `json:"message,omitempty"`
+	// Ansible is the ansible event, and is only set on AnsibleEvent events
+	Ansible *explain.JSONEvent `json:"ansible,omitempty"`
+}
+
+// Options are used to configure the client
+type Options struct {
+	// GeneratedAssetsDirectory is where the certificates and the kubeconfig
+	// file are stored. Defaults to "generated".
+	GeneratedAssetsDirectory string
+	// RunsDirectory is where information about the ansible runs is kept.
+	// Defaults to "runs".
+	RunsDirectory string
+	// DiagnosticsDirectory is where the diagnostics of the nodes are
+	// collected. Defaults to "diagnostics".
+	DiagnosticsDirectory string
+	// RestartServices forces the restart of the cluster services during
+	// installations and upgrades
+	RestartServices bool
+	// Verbose includes the output of every ansible task in the log
+	Verbose bool
+	// ForceUnlock removes the operation lock of the cluster, that is left
+	// behind by a run that did not complete
+	ForceUnlock bool
+	// Webhooks are notified when the ansible playbooks start, fail and complete
+	Webhooks []explain.Webhook
+	// FailureSignatures are matched against failed tasks, in addition to the
+	// default failure signatures
+	FailureSignatures []explain.FailureSignature
+	// Progress is called with the progress events of the operations. Calls
+	// are serialized, and should return quickly.
+	Progress func(Event)
+	// Log receives the human-readable output of the operations, as printed
+	// by the command-line tool. The output is discarded if not set.
+	Log io.Writer
+	// Out receives the output of the ansible playbooks. Defaults to Log.
+	Out io.Writer
+	// OutputFormat of the ansible playbooks, "simple", "raw" or "json".
+	// Defaults to "simple". In the json format, Out only receives the
+	// ansible events, and everything else is written to Log.
+	OutputFormat string
+	// Profile prints the slowest tasks of the playbooks once they are done
+	Profile bool
+	// DryRun renders everything that would be deployed to the nodes in
+	// DryRunDirectory, without changing the cluster. The directory must be
+	// prepared with install.PrepareDryRunDirectory, and is usually also the
+	// GeneratedAssetsDirectory, so that the existing assets are left untouched.
+	// Remove the private keys with install.RemoveDryRunSecrets before sharing
+	// the bundle.
+	DryRun          bool
+	DryRunDirectory string
+	// Executor runs the playbooks of all operations instead of the executor
+	// that is created from these options. It is meant for testing.
+	Executor install.Executor
+}
+
+// Client performs operations against the clusters described by plans
+type Client struct {
+	options Options
+	mu      sync.Mutex
+
+	// Hooks for testing purposes. The default implementations are used at runtime.
+	newExecutor            func(operation string) (install.Executor, error)
+	newPreFlightExecutor   func(operation string) (install.PreFlightExecutor, error)
+	newDiagnosticsExecutor func(operation string) (install.DiagnosticsExecutor, error)
+}
+
+// New returns a client that is configured with the given options
+func New(options Options) *Client {
+	if options.GeneratedAssetsDirectory == "" {
+		options.GeneratedAssetsDirectory = "generated"
+	}
+	if options.RunsDirectory == "" {
+		options.RunsDirectory = "runs"
+	}
+	if options.DiagnosticsDirectory == "" {
+		options.DiagnosticsDirectory = "diagnostics"
+	}
+	if options.Log == nil {
+		options.Log = ioutil.Discard
+	}
+	if options.Out == nil {
+		options.Out = options.Log
+	}
+	if options.OutputFormat == "" {
+		options.OutputFormat = "simple"
+	}
+	c := &Client{options: options}
+	c.newExecutor = func(operation string) (install.Executor, error) {
+		if c.options.Executor != nil {
+			return c.options.Executor, nil
+		}
+		return install.NewExecutor(c.options.Out, c.options.Log, c.executorOptions(operation))
+	}
+	c.newPreFlightExecutor = func(operation string) (install.PreFlightExecutor, error) {
+		if c.options.Executor != nil || !c.options.DryRun {
+			return c.newExecutor(operation)
+		}
+		// The upgrade pre-flight checks only inspect the nodes, so they
+		// also run during a dry run
+		opts := c.executorOptions(operation)
+		opts.DryRun = false
+		return install.NewPreFlightExecutor(c.options.Out, c.options.Log, opts)
+	}
+	c.newDiagnosticsExecutor = func(operation string) (install.DiagnosticsExecutor, error) {
+		return install.NewDiagnosticsExecutor(c.options.Out, c.options.Log, c.executorOptions(operation))
+	}
+	return c
+}
+
+func (c *Client) executorOptions(operation string) install.ExecutorOptions {
+	return install.ExecutorOptions{
+		GeneratedAssetsDirectory: c.options.GeneratedAssetsDirectory,
+		RunsDirectory:            c.options.RunsDirectory,
+		DiagnosticsDirecty:       c.options.DiagnosticsDirectory,
+		RestartServices:          c.options.RestartServices,
+		OutputFormat:             c.options.OutputFormat,
+		Verbose:                  c.options.Verbose,
+		Webhooks:                 c.options.Webhooks,
+		FailureSignatures:        c.options.FailureSignatures,
+		ForceUnlock:              c.options.ForceUnlock,
+		Profile:                  c.options.Profile,
+		DryRun:                   c.options.DryRun,
+		DryRunDirectory:          c.options.DryRunDirectory,
+		EventCallback: func(je explain.JSONEvent) {
+			c.emit(Event{Type: AnsibleEvent, Operation: operation, Ansible: &je})
+		},
+	}
+}
+
+func (c *Client) emit(e Event) {
+	if c.options.Progress == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options.Progress(e)
+}
+
+// phase runs a phase of an operation, and reports its progress
+func (c *Client) phase(operation, phase, message string, run func() error) error {
+	c.emit(Event{Type: PhaseStarted, Operation: operation, Phase: phase, Message: message})
+	if err := run(); err != nil {
+		c.emit(Event{Type: PhaseFailed, Operation: operation, Phase: phase, Message: err.Error()})
+		return err
+	}
+	c.emit(Event{Type: PhaseSucceeded, Operation: operation, Phase: phase, Message: message})
+	return nil
+}
+
+// releaseLock releases the operation lock of the cluster, and reports the error
+// of the release along with the error of the operation
+func releaseLock(release func() error, err *error) {
+	releaseErr := release()
+	if releaseErr == nil {
+		return
+	}
+	if *err != nil {
+		*err = fmt.Errorf("%v. %v", *err, releaseErr)
+		return
+	}
+	*err = releaseErr
+}
+
+// ValidationError is returned when the input of an operation is not valid
+type ValidationError struct {
+	// Message describes what failed validation
+	Message string
+	// Errors found during validation
+	Errors []error
+}
+
+func (e ValidationError) Error() string {
+	if len(e.Errors) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Errors)
+}
@@ -0,0 +1,222 @@
+package kismatic
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/install/explain"
+)
+
+type fakeExecutor struct {
+	install.Executor
+	operation     string
+	callback      func(explain.JSONEvent)
+	installCalled bool
+	installErr    error
+	volume        install.StorageVolume
+}
+
+func (fe *fakeExecutor) Install(p *install.Plan) error {
+	fe.installCalled = true
+	// report an ansible event, as the real executor would
+	fe.callback(explain.JSONEvent{Type: "playbook_start", Task: "apply"})
+	return fe.installErr
+}
+
+func (fe *fakeExecutor) AddVolume(p *install.Plan, v install.StorageVolume) error {
+	fe.volume = v
+	return nil
+}
+
+func newTestClient(fe *fakeExecutor) (*Client, *[]Event) {
+	events := &[]Event{}
+	c := New(Options{Progress: func(e Event) { *events = append(*events, e) }})
+	c.newExecutor = func(operation string) (install.Executor, error) {
+		fe.operation = operation
+		fe.callback = c.executorOptions(operation).EventCallback
+		return fe, nil
+	}
+	return c, events
+}
+
+func TestValidateInvalidPlan(t *testing.T) {
+	fe := &fakeExecutor{}
+	c, events := newTestClient(fe)
+	result, err := c.Validate(&install.Plan{}, ValidateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Valid() {
+		t.Fatal("expected the empty plan to be invalid")
+	}
+	if len(result.PlanErrors) == 0 {
+		t.Error("expected plan errors")
+	}
+	if _, ok := result.Err().(ValidationError); !ok {
+		t.Errorf("expected a ValidationError, but got %T", result.Err())
+	}
+	// the validation stops at the plan
+	expected := []EventType{PhaseStarted, PhaseFailed}
+	if got := eventTypes(*events); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected events %v, but got %v", expected, got)
+	}
+	if (*events)[1].Phase != "validate-plan" {
+		t.Errorf("expected the validate-plan phase to fail, but got %q", (*events)[1].Phase)
+	}
+}
+
+func TestInstallInvalidPlanIsNotInstalled(t *testing.T) {
+	fe := &fakeExecutor{}
+	c, _ := newTestClient(fe)
+	result, err := c.Install(&install.Plan{}, InstallOptions{})
+	if err == nil {
+		t.Fatal("expected an error installing an invalid plan")
+	}
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("expected a ValidationError, but got %T", err)
+	}
+	if result == nil || result.Validation == nil || result.Validation.Valid() {
+		t.Error("expected the failed validation in the result")
+	}
+	if fe.installCalled {
+		t.Error("install was called with an invalid plan")
+	}
+}
+
+func TestAddVolume(t *testing.T) {
+	fe := &fakeExecutor{}
+	c, events := newTestClient(fe)
+	v := install.StorageVolume{
+		Name:              "vol",
+		SizeGB:            10,
+		ReplicateCount:    1,
+		DistributionCount: 1,
+		ReclaimPolicy:     "Retain",
+		AccessModes:       []string{"ReadWriteMany"},
+	}
+	if err := c.AddVolume(&install.Plan{}, v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fe.volume.Name != "vol" {
+		t.Errorf("expected the volume to be added, but got %+v", fe.volume)
+	}
+	if fe.operation != "add-volume" {
+		t.Errorf("expected the executor of the add-volume operation, but got %q", fe.operation)
+	}
+	expected := []EventType{PhaseStarted, PhaseSucceeded, PhaseStarted, PhaseSucceeded}
+	if got := eventTypes(*events); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected events %v, but got %v", expected, got)
+	}
+}
+
+func TestAddVolumeInvalid(t *testing.T) {
+	fe := &fakeExecutor{}
+	c, _ := newTestClient(fe)
+	err := c.AddVolume(&install.Plan{}, install.StorageVolume{})
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("expected a ValidationError, but got %v", err)
+	}
+	if fe.operation != "" {
+		t.Error("the executor was created for an invalid volume")
+	}
+}
+
+func TestAnsibleEventsAreReported(t *testing.T) {
+	fe := &fakeExecutor{}
+	c, events := newTestClient(fe)
+	executor, _ := c.newExecutor("install")
+	executor.Install(&install.Plan{})
+	if len(*events) != 1 {
+		t.Fatalf("expected one event, but got %d", len(*events))
+	}
+	e := (*events)[0]
+	if e.Type != AnsibleEvent || e.Operation != "install" || e.Ansible == nil || e.Ansible.Type != "playbook_start" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e.Time.IsZero() {
+		t.Error("expected the time of the event to be set")
+	}
+}
+
+func TestUpgradableNodes(t *testing.T) {
+	worker1 := install.ListableNode{Node: install.Node{Host: "worker1", IP: "10.0.0.1"}, Roles: []string{"worker"}}
+	worker2 := install.ListableNode{Node: install.Node{Host: "worker2", IP: "10.0.0.2"}, Roles: []string{"worker"}}
+	worker3 := install.ListableNode{Node: install.Node{Host: "worker3", IP: "10.0.0.3"}, Roles: []string{"worker"}}
+	result := &UpgradeResult{
+		Unsafe:  []NodeErrors{{Node: worker1, Errors: []error{errors.New("unsafe")}}},
+		Unready: []NodeErrors{{Node: worker2, Errors: []error{errors.New("unready")}}},
+	}
+	nodes := upgradableNodes([]install.ListableNode{worker1, worker2, worker3}, result, UpgradeOptions{})
+	if len(nodes) != 1 || nodes[0].Node.Host != "worker3" {
+		t.Errorf("expected only worker3 to be upgraded, but got %v", nodes)
+	}
+	nodes = upgradableNodes([]install.ListableNode{worker1, worker2, worker3}, result, UpgradeOptions{IgnoreSafetyChecks: true})
+	if len(nodes) != 2 {
+		t.Errorf("expected the unsafe node to be upgraded when ignoring safety checks, but got %v", nodes)
+	}
+}
+
+func TestBlockingNodes(t *testing.T) {
+	worker := NodeErrors{Node: install.ListableNode{Node: install.Node{Host: "worker"}, Roles: []string{"worker"}}}
+	master := NodeErrors{Node: install.ListableNode{Node: install.Node{Host: "master"}, Roles: []string{"etcd", "master"}}}
+	if err := blockingNodes([]NodeErrors{worker}, false, "unsafe"); err == nil {
+		t.Error("expected workers to block a full upgrade")
+	}
+	if err := blockingNodes([]NodeErrors{worker}, true, "unsafe"); err != nil {
+		t.Errorf("expected workers not to block a partial upgrade, but got %v", err)
+	}
+	if err := blockingNodes([]NodeErrors{worker, master}, true, "unsafe"); err == nil {
+		t.Error("expected masters to block a partial upgrade")
+	}
+}
+
+func TestUpgradeWavesCannotBeUsedWithFromPlan(t *testing.T) {
+	fe := &fakeExecutor{}
+	c, _ := newTestClient(fe)
+	opts := UpgradeOptions{
+		FromPlan: &install.UpgradePlan{},
+		Waves:    []install.WaveSize{{Count: 1}},
+	}
+	if _, err := c.Upgrade(&install.Plan{}, opts); err == nil {
+		t.Error("expected an error using waves with an upgrade plan")
+	}
+	if fe.operation != "" {
+		t.Error("the executor was created for invalid options")
+	}
+}
+
+func TestRollbackUnknownNode(t *testing.T) {
+	fe := &fakeExecutor{}
+	c, _ := newTestClient(fe)
+	plan := &install.Plan{}
+	plan.Worker.Nodes = []install.Node{{Host: "worker", IP: "10.0.0.1"}}
+	_, err := c.Rollback(plan, "other")
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("expected a ValidationError, but got %v", err)
+	}
+	if fe.operation != "" {
+		t.Error("the executor was created for an unknown node")
+	}
+}
+
+func TestExecutorOption(t *testing.T) {
+	fe := &fakeExecutor{}
+	c := New(Options{Executor: fe})
+	executor, err := c.newExecutor("install")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if executor != fe {
+		t.Error("expected the executor of the options to be used")
+	}
+}
+
+func eventTypes(events []Event) []EventType {
+	types := []EventType{}
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
@@ -0,0 +1,38 @@
+package kismatic
+
+import (
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+// DiagnosticsResult is the result of collecting diagnostics
+type DiagnosticsResult struct {
+	// Directory that contains the diagnostics of the nodes, in a
+	// timestamped directory per collection
+	Directory string
+}
+
+// Diagnose collects diagnostics from the nodes of the cluster described in
+// the plan
+func (c *Client) Diagnose(plan *install.Plan) (*DiagnosticsResult, error) {
+	const operation = "diagnose"
+	err := c.phase(operation, "validate-ssh", "Validating SSH connectivity to the nodes", func() error {
+		if ok, errs := install.ValidatePlanSSHConnections(plan); !ok {
+			return ValidationError{Message: "could not connect to the nodes over SSH", Errors: errs}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	executor, err := c.newDiagnosticsExecutor(operation)
+	if err != nil {
+		return nil, err
+	}
+	err = c.phase(operation, "diagnose", "Collecting diagnostics from the nodes", func() error {
+		return executor.DiagnoseNodes(*plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DiagnosticsResult{Directory: c.options.DiagnosticsDirectory}, nil
+}
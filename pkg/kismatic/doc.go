@@ -0,0 +1,5 @@
+// Package kismatic is a client library for managing Kubernetes clusters with
+// KET from other programs. The command-line tool is built on this package, so
+// the operations are the same, but instead of prompting on a terminal, the
+// operations return typed results and report their progress as structured events.
+package kismatic
@@ -0,0 +1,84 @@
+package kismatic
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// InstallOptions are the options of the installation
+type InstallOptions struct {
+	// SkipPreFlight skips the pre-flight checks on the nodes
+	SkipPreFlight bool
+}
+
+// InstallResult is the result of an installation
+type InstallResult struct {
+	// Validation is the result of the validation that ran before the installation
+	Validation *ValidationResult
+	// GeneratedAssetsDirectory contains the certificates of the cluster
+	GeneratedAssetsDirectory string
+	// KubeconfigFile is the kubeconfig file of the cluster administrator
+	KubeconfigFile string
+}
+
+// Install the cluster described in the plan. The plan is validated first, and
+// a ValidationError is returned if it fails validation. The pre-flight checks
+// are skipped during a dry run.
+func (c *Client) Install(plan *install.Plan, opts InstallOptions) (result *InstallResult, err error) {
+	const operation = "install"
+	validation, err := c.validate(operation, plan, ValidateOptions{SkipPreFlight: opts.SkipPreFlight})
+	if err != nil {
+		return nil, err
+	}
+	result = &InstallResult{Validation: validation}
+	if err = validation.Err(); err != nil {
+		return result, err
+	}
+	executor, err := c.newExecutor(operation)
+	if err != nil {
+		return result, err
+	}
+	release, err := executor.LockCluster(*plan, operation)
+	if err != nil {
+		return result, err
+	}
+	defer releaseLock(release, &err)
+
+	err = c.phase(operation, "generate-certificates", "Generating the certificates of the cluster", func() error {
+		return executor.GenerateCertificates(plan, false)
+	})
+	if err != nil {
+		return result, fmt.Errorf("error generating certificates: %v", err)
+	}
+	result.GeneratedAssetsDirectory = c.options.GeneratedAssetsDirectory
+
+	util.PrintHeader(c.options.Log, "Generating Kubeconfig File", '=')
+	err = c.phase(operation, "generate-kubeconfig", "Generating the kubeconfig file", func() error {
+		return install.GenerateKubeconfig(plan, c.options.GeneratedAssetsDirectory)
+	})
+	if err != nil {
+		return result, fmt.Errorf("error generating kubeconfig file: %v", err)
+	}
+	util.PrettyPrintOk(c.options.Log, "Generated kubeconfig file in the %q directory", c.options.GeneratedAssetsDirectory)
+	result.KubeconfigFile = filepath.Join(c.options.GeneratedAssetsDirectory, "kubeconfig")
+
+	err = c.phase(operation, "install", "Installing the cluster", func() error {
+		return executor.Install(plan)
+	})
+	if err != nil {
+		return result, fmt.Errorf("error installing: %v", err)
+	}
+
+	if plan.NetworkConfigured() {
+		err = c.phase(operation, "smoke-test", "Running the smoke test", func() error {
+			return executor.RunSmokeTest(plan)
+		})
+		if err != nil {
+			return result, fmt.Errorf("error running smoke test: %v", err)
+		}
+	}
+	return result, nil
+}
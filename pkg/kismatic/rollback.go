@@ -0,0 +1,54 @@
+package kismatic
+
+import (
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+// RollbackResult is the result of rolling back the upgrade of a node
+type RollbackResult struct {
+	// Node that was rolled back, at the version it has after the rollback.
+	// The version is not listed during a dry run.
+	Node install.ListableNode
+}
+
+// Rollback the upgrade of a node, by restoring the snapshot that was saved on
+// the node before it was upgraded. The cluster services are not rolled back.
+func (c *Client) Rollback(plan *install.Plan, host string) (*RollbackResult, error) {
+	const operation = "rollback"
+	var node *install.ListableNode
+	for _, n := range plan.GetUniqueNodes() {
+		if n.Host == host {
+			node = &install.ListableNode{Node: n, Roles: plan.GetRolesForIP(n.IP)}
+			break
+		}
+	}
+	if node == nil {
+		return nil, ValidationError{Message: fmt.Sprintf("node %q was not found in the plan", host)}
+	}
+	executor, err := c.newExecutor(operation)
+	if err != nil {
+		return nil, err
+	}
+	err = c.phase(operation, "rollback", fmt.Sprintf("Rolling back node %q", host), func() error {
+		return executor.RollbackNode(*plan, *node)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back node %q: %v", host, err)
+	}
+	result := &RollbackResult{Node: *node}
+	if c.options.DryRun {
+		return result, nil
+	}
+	cv, err := install.ListVersions(plan)
+	if err != nil {
+		return result, fmt.Errorf("error listing cluster versions: %v", err)
+	}
+	for _, n := range cv.Nodes {
+		if n.Node.Host == host {
+			result.Node = n
+		}
+	}
+	return result, nil
+}
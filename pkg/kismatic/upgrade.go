@@ -0,0 +1,403 @@
+package kismatic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// UpgradeOptions are the options of the upgrade
+type UpgradeOptions struct {
+	// Online runs the safety checks, and drains the nodes before upgrading them
+	Online bool
+	// IgnoreSafetyChecks upgrades the nodes that failed the safety checks
+	IgnoreSafetyChecks bool
+	// SkipPreFlight skips the upgrade pre-flight checks
+	SkipPreFlight bool
+	// PartialAllowed upgrades the nodes that are ready, skipping the worker
+	// nodes that are unsafe or unready. The cluster services are not
+	// upgraded in a partial upgrade.
+	PartialAllowed bool
+	// MaxParallelWorkers is the maximum number of workers upgraded in parallel.
+	// Defaults to 1.
+	MaxParallelWorkers int
+	// FromPlan is an upgrade plan computed with "kismatic upgrade plan". The
+	// nodes are upgraded in the batches of the upgrade plan, without running
+	// the safety checks again, and PartialAllowed is taken from the upgrade plan.
+	FromPlan *install.UpgradePlan
+	// Waves are the sizes of the waves in which the worker nodes are upgraded.
+	// The health gates are checked after every wave. Cannot be used with FromPlan.
+	Waves []install.WaveSize
+	// HealthProbes are URLs that must return a 2xx status code after every wave
+	HealthProbes []string
+	// GateTimeout is how long to wait for the health gates to pass after
+	// every wave. Defaults to 5 minutes.
+	GateTimeout time.Duration
+	// OnGateFailure is called when a health gate fails after a wave, and
+	// decides how the upgrade proceeds. The upgrade is aborted if not set.
+	OnGateFailure func(wave int, gate install.HealthGate, err error) (install.GateFailureAction, error)
+	// ConfirmUnsafe is called when nodes that failed the safety checks block
+	// the upgrade. The upgrade ignores the safety checks and continues if it
+	// returns true. The upgrade stops if it is not set.
+	ConfirmUnsafe func(unsafe []NodeErrors) (bool, error)
+}
+
+// NodeErrors are the errors found on a node
+type NodeErrors struct {
+	Node   install.ListableNode
+	Errors []error
+}
+
+// UpgradeResult is the result of an upgrade
+type UpgradeResult struct {
+	// Upgraded are the nodes that were upgraded
+	Upgraded []install.ListableNode
+	// UpToDate are the nodes that were already at the target version
+	UpToDate []install.ListableNode
+	// Unsafe are the nodes that failed the safety checks of an online upgrade
+	Unsafe []NodeErrors
+	// Unready are the nodes that failed the upgrade pre-flight checks
+	Unready []NodeErrors
+	// ClusterServicesUpgraded is true if the cluster services were upgraded
+	ClusterServicesUpgraded bool
+}
+
+// Upgrade the cluster described in the plan to the version of this library.
+// The upgrade does not prompt: nodes that fail the safety checks stop the
+// upgrade, unless they are ignored, the upgrade is partial, or ConfirmUnsafe
+// allows them.
+func (c *Client) Upgrade(plan *install.Plan, opts UpgradeOptions) (result *UpgradeResult, err error) {
+	const operation = "upgrade"
+	if opts.MaxParallelWorkers == 0 {
+		opts.MaxParallelWorkers = 1
+	}
+	if opts.MaxParallelWorkers < 1 {
+		return nil, fmt.Errorf("MaxParallelWorkers must be greater or equal to 1, got: %d", opts.MaxParallelWorkers)
+	}
+	if opts.FromPlan != nil {
+		if len(opts.Waves) > 0 {
+			return nil, errors.New("Waves cannot be used with FromPlan")
+		}
+		opts.PartialAllowed = opts.FromPlan.PartialAllowed
+	}
+	if opts.GateTimeout == 0 {
+		opts.GateTimeout = 5 * time.Minute
+	}
+	log := c.options.Log
+	if err := c.validatePlanAndSSH(operation, plan).Err(); err != nil {
+		return nil, err
+	}
+	executor, err := c.newExecutor(operation)
+	if err != nil {
+		return nil, err
+	}
+	preflightExec, err := c.newPreFlightExecutor(operation)
+	if err != nil {
+		return nil, err
+	}
+	// the lock is held for the whole upgrade, so that no other run can start
+	// between the upgrades of the nodes and of the cluster services
+	release, err := executor.LockCluster(*plan, operation)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLock(release, &err)
+
+	// Generate new certs, or use existing ones. Always ensure that the CA exists.
+	err = c.phase(operation, "generate-certificates", "Generating the certificates of the cluster", func() error {
+		return executor.GenerateCertificates(plan, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	util.PrintHeader(log, "Generating Kubeconfig File", '=')
+	err = c.phase(operation, "generate-kubeconfig", "Generating the kubeconfig file", func() error {
+		isDiff, err := install.RegenerateKubeconfig(plan, c.options.GeneratedAssetsDirectory)
+		if err != nil {
+			return fmt.Errorf("error generating kubeconfig file: %v", err)
+		}
+		if isDiff {
+			util.PrettyPrintWarn(log, "An updated kubeconfig file has been generated in %q", c.options.GeneratedAssetsDirectory)
+		} else {
+			util.PrettyPrintOk(log, "Found existing kubeconfig file in %q", c.options.GeneratedAssetsDirectory)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result = &UpgradeResult{}
+	var nodes, toUpgrade []install.ListableNode
+	err = c.phase(operation, "list-versions", "Listing the versions of the nodes", func() error {
+		cv, err := install.ListVersions(plan)
+		if err != nil {
+			return fmt.Errorf("error listing cluster versions: %v", err)
+		}
+		nodes = cv.Nodes
+		for _, n := range cv.Nodes {
+			if install.IsOlderVersion(n.Version) {
+				toUpgrade = append(toUpgrade, n)
+			} else {
+				result.UpToDate = append(result.UpToDate, n)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.FromPlan != nil {
+		err = c.upgradeFromPlan(operation, plan, opts, nodes, executor, preflightExec, result)
+	} else {
+		err = c.upgradeVersionedNodes(operation, plan, opts, toUpgrade, executor, preflightExec, result)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if opts.PartialAllowed {
+		return result, nil
+	}
+	util.PrintHeader(log, "Upgrade: Cluster Services", '=')
+	err = c.phase(operation, "upgrade-cluster-services", "Upgrading the cluster services", func() error {
+		return executor.UpgradeClusterServices(*plan)
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to upgrade cluster services: %v", err)
+	}
+	result.ClusterServicesUpgraded = true
+	if plan.NetworkConfigured() {
+		err = c.phase(operation, "smoke-test", "Running the smoke test", func() error {
+			return executor.RunSmokeTest(plan)
+		})
+		if err != nil {
+			return result, fmt.Errorf("smoke test failed: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// upgradeFromPlan upgrades the batches of nodes of the upgrade plan, without
+// running the safety checks again
+func (c *Client) upgradeFromPlan(operation string, plan *install.Plan, opts UpgradeOptions, nodes []install.ListableNode, executor install.Executor, preflightExec install.PreFlightExecutor, result *UpgradeResult) error {
+	batches, err := opts.FromPlan.ListableBatches(*plan, nodes)
+	if err != nil {
+		return fmt.Errorf("cannot execute the upgrade plan: %v. Run \"kismatic upgrade plan\" to compute a new upgrade plan", err)
+	}
+	var toUpgrade []install.ListableNode
+	for _, batch := range batches {
+		toUpgrade = append(toUpgrade, batch...)
+	}
+	// The nodes of the upgrade plan are upgraded verbatim, so any unready node
+	// blocks the upgrade
+	if !opts.SkipPreFlight {
+		err = c.phase(operation, "preflight", "Running the upgrade pre-flight checks", func() error {
+			c.runUpgradePreFlight(plan, toUpgrade, preflightExec, result)
+			if len(result.Unready) > 0 {
+				return errors.New("errors found during preflight checks")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = c.phase(operation, "upgrade-nodes", fmt.Sprintf("Upgrading %d node(s)", len(toUpgrade)), func() error {
+		return executor.UpgradeNodeBatches(*plan, batches, true)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upgrade nodes: %v", err)
+	}
+	result.Upgraded = toUpgrade
+	return nil
+}
+
+// upgradeVersionedNodes upgrades the nodes that are not at the target version
+func (c *Client) upgradeVersionedNodes(operation string, plan *install.Plan, opts UpgradeOptions, toUpgrade []install.ListableNode, executor install.Executor, preflightExec install.PreFlightExecutor, result *UpgradeResult) error {
+	log := c.options.Log
+	if len(result.UpToDate) > 0 {
+		util.PrintHeader(log, "Skipping nodes", '=')
+		for _, n := range result.UpToDate {
+			util.PrettyPrintOk(log, "- %q is at the target version %q", n.Node.Host, n.Version)
+		}
+		fmt.Fprintln(log)
+	}
+	if len(toUpgrade) == 0 {
+		fmt.Fprintln(log, "All nodes are at the target version. Skipping node upgrades.")
+		return nil
+	}
+
+	if opts.Online {
+		err := c.phase(operation, "safety-checks", "Running the safety checks of the online upgrade", func() error {
+			return c.checkUpgradeSafety(*plan, toUpgrade, &opts, result)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if !opts.SkipPreFlight {
+		err := c.phase(operation, "preflight", "Running the upgrade pre-flight checks", func() error {
+			c.runUpgradePreFlight(plan, toUpgrade, preflightExec, result)
+			return blockingNodes(result.Unready, opts.PartialAllowed, "errors found during preflight checks")
+		})
+		if err != nil {
+			return err
+		}
+	}
+	nodes := upgradableNodes(toUpgrade, result, opts)
+	err := c.phase(operation, "upgrade-nodes", fmt.Sprintf("Upgrading %d node(s)", len(nodes)), func() error {
+		if len(opts.Waves) > 0 {
+			return c.upgradeNodesInWaves(*plan, nodes, opts, executor)
+		}
+		return executor.UpgradeNodes(*plan, nodes, opts.Online, opts.MaxParallelWorkers)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upgrade nodes: %v", err)
+	}
+	result.Upgraded = nodes
+	return nil
+}
+
+// runUpgradePreFlight runs the upgrade pre-flight checks on the nodes, and
+// records the nodes that are not ready in the result
+func (c *Client) runUpgradePreFlight(plan *install.Plan, nodes []install.ListableNode, preflightExec install.PreFlightExecutor, result *UpgradeResult) {
+	for _, n := range nodes {
+		util.PrintHeader(c.options.Log, fmt.Sprintf("Preflight Checks: %s %s", n.Node.Host, n.Roles), '=')
+		if err := preflightExec.RunUpgradePreFlightCheck(plan, n); err != nil {
+			result.Unready = append(result.Unready, NodeErrors{Node: n, Errors: []error{err}})
+		}
+	}
+}
+
+// upgradeNodesInWaves upgrades the worker nodes in waves, and checks the
+// health gates after every wave
+func (c *Client) upgradeNodesInWaves(plan install.Plan, nodes []install.ListableNode, opts UpgradeOptions, executor install.Executor) error {
+	log := c.options.Log
+	var gates []install.HealthGate
+	// the health of the cluster cannot be checked when it is not modified
+	if !c.options.DryRun {
+		kubeClient, err := install.NewClusterClient(&plan, c.options.GeneratedAssetsDirectory)
+		if err != nil {
+			return err
+		}
+		gates = append(gates, install.NewNodeReadyGate(kubeClient, opts.GateTimeout), install.NewPodsRunningGate(kubeClient, opts.GateTimeout))
+		if plan.NetworkConfigured() {
+			gates = append(gates, install.NewSmokeTestGate(executor))
+		}
+		for _, url := range opts.HealthProbes {
+			gates = append(gates, install.NewHTTPProbeGate(url, opts.GateTimeout))
+		}
+	}
+	return install.UpgradeNodesInWaves(executor, plan, nodes, opts.Online, install.WaveUpgradeOptions{
+		Waves: opts.Waves,
+		Gates: gates,
+		Progress: func(wave int, nodes []install.ListableNode) {
+			hosts := []string{}
+			for _, n := range nodes {
+				hosts = append(hosts, n.Node.Host)
+			}
+			util.PrintHeader(log, fmt.Sprintf("Upgrade: Wave %d (%s)", wave, strings.Join(hosts, ", ")), '=')
+		},
+		OnGateFailure: func(wave int, gate install.HealthGate, gateErr error) (install.GateFailureAction, error) {
+			util.PrettyPrintErr(log, "Health gate %q after wave %d: %v", gate.Name(), wave, gateErr)
+			if opts.OnGateFailure == nil {
+				return install.GateAbort, nil
+			}
+			return opts.OnGateFailure(wave, gate, gateErr)
+		},
+	})
+}
+
+// checkUpgradeSafety runs the safety checks of the online upgrade on the nodes.
+// When unsafe nodes block the upgrade, and ConfirmUnsafe allows them, the
+// safety checks are ignored for the rest of the upgrade.
+func (c *Client) checkUpgradeSafety(plan install.Plan, nodes []install.ListableNode, opts *UpgradeOptions, result *UpgradeResult) error {
+	log := c.options.Log
+	util.PrintHeader(log, "Validate Online Upgrade", '=')
+	kubeClient, err := install.NewClusterClient(&plan, c.options.GeneratedAssetsDirectory)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		util.PrettyPrint(log, "%s %v", n.Node.Host, n.Roles)
+		errs := install.DetectNodeUpgradeSafety(plan, n.Node, kubeClient)
+		if len(errs) == 0 {
+			util.PrintOkln(log)
+			continue
+		}
+		if opts.IgnoreSafetyChecks {
+			util.PrintWarn(log)
+		} else {
+			util.PrintError(log)
+		}
+		fmt.Fprintln(log)
+		for _, err := range errs {
+			fmt.Fprintln(log, "-", err.Error())
+		}
+		result.Unsafe = append(result.Unsafe, NodeErrors{Node: n, Errors: errs})
+	}
+	// the safety checks are still run and printed when they are ignored
+	if opts.IgnoreSafetyChecks {
+		if len(result.Unsafe) > 0 {
+			util.PrettyPrintWarn(log, "\nIgnoring safety checks and continuing with the upgrade")
+		}
+		return nil
+	}
+	safetyErr := blockingNodes(result.Unsafe, opts.PartialAllowed, "unsafe conditions detected")
+	if safetyErr == nil || opts.ConfirmUnsafe == nil {
+		return safetyErr
+	}
+	ok, err := opts.ConfirmUnsafe(result.Unsafe)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return safetyErr
+	}
+	opts.IgnoreSafetyChecks = true
+	util.PrettyPrintWarn(log, "\nIgnoring safety checks and continuing with the upgrade")
+	return nil
+}
+
+// blockingNodes returns an error if any of the nodes blocks the upgrade. Etcd
+// and master nodes always block the upgrade, workers only block a full upgrade.
+func blockingNodes(nodes []NodeErrors, partialAllowed bool, message string) error {
+	for _, n := range nodes {
+		if !partialAllowed {
+			return errors.New(message)
+		}
+		for _, r := range n.Node.Roles {
+			if r == "master" || r == "etcd" {
+				return fmt.Errorf("%s on %s node %q", message, r, n.Node.Node.Host)
+			}
+		}
+	}
+	return nil
+}
+
+// upgradableNodes filters out the nodes that are unsafe or unready
+func upgradableNodes(nodes []install.ListableNode, result *UpgradeResult, opts UpgradeOptions) []install.ListableNode {
+	excluded := append([]NodeErrors{}, result.Unready...)
+	if !opts.IgnoreSafetyChecks {
+		excluded = append(excluded, result.Unsafe...)
+	}
+	upgradable := []install.ListableNode{}
+	for _, n := range nodes {
+		upgrade := true
+		for _, e := range excluded {
+			if e.Node.Node.Equal(n.Node) {
+				upgrade = false
+			}
+		}
+		if upgrade {
+			upgradable = append(upgradable, n)
+		}
+	}
+	return upgradable
+}
@@ -0,0 +1,118 @@
+package kismatic
+
+import (
+	"path/filepath"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/util"
+)
+
+// ValidateOptions are the options of the validation
+type ValidateOptions struct {
+	// SkipPreFlight skips the pre-flight checks on the nodes
+	SkipPreFlight bool
+}
+
+// ValidationResult is the result of the validation of a plan. The validation
+// stops at the first check that fails, so the checks that did not run have
+// no errors.
+type ValidationResult struct {
+	// PlanErrors are the errors found in the plan
+	PlanErrors []error
+	// SSHErrors are the errors connecting to the nodes over SSH
+	SSHErrors []error
+	// CertificateErrors are the errors found in the existing certificates
+	CertificateErrors []error
+	// PreFlightError is set when the pre-flight checks failed
+	PreFlightError error
+}
+
+// Valid returns true if no errors were found
+func (r ValidationResult) Valid() bool {
+	return r.Err() == nil
+}
+
+// Err returns a ValidationError describing the first check that failed, or nil
+// if the validation succeeded
+func (r ValidationResult) Err() error {
+	switch {
+	case len(r.PlanErrors) > 0:
+		return ValidationError{Message: "the plan is not valid", Errors: r.PlanErrors}
+	case len(r.SSHErrors) > 0:
+		return ValidationError{Message: "could not connect to the nodes over SSH", Errors: r.SSHErrors}
+	case len(r.CertificateErrors) > 0:
+		return ValidationError{Message: "the existing certificates are not valid", Errors: r.CertificateErrors}
+	case r.PreFlightError != nil:
+		return ValidationError{Message: "the pre-flight checks failed", Errors: []error{r.PreFlightError}}
+	}
+	return nil
+}
+
+// Validate the plan, the SSH connectivity to the nodes and the existing
+// certificates, and run the pre-flight checks on the nodes. An error is
+// returned if the validation could not be performed. Validation failures are
+// reported in the result.
+func (c *Client) Validate(plan *install.Plan, opts ValidateOptions) (*ValidationResult, error) {
+	return c.validate("validate", plan, opts)
+}
+
+func (c *Client) validate(operation string, plan *install.Plan, opts ValidateOptions) (*ValidationResult, error) {
+	result := c.validatePlanAndSSH(operation, plan)
+	if !result.Valid() {
+		return result, nil
+	}
+
+	pki := &install.LocalPKI{
+		CACsr:                   filepath.Join("ansible", "playbooks", "tls", "ca-csr.json"),
+		GeneratedCertsDirectory: filepath.Join(c.options.GeneratedAssetsDirectory, "keys"),
+		Log:                     c.options.Log,
+	}
+	if ok, errs := install.ValidateCertificates(plan, pki); !ok {
+		result.CertificateErrors = errs
+		util.PrettyPrintErr(c.options.Log, "Validating cluster certificates")
+		util.PrintValidationErrors(c.options.Log, errs)
+	}
+	if c.phase(operation, "validate-certificates", "Validating the existing certificates", result.Err) != nil {
+		return result, nil
+	}
+
+	// The pre-flight checks install the inspector on the nodes, so they are
+	// skipped during a dry run
+	if opts.SkipPreFlight || c.options.DryRun {
+		return result, nil
+	}
+	executor, err := c.newExecutor(operation)
+	if err != nil {
+		return nil, err
+	}
+	c.phase(operation, "preflight", "Running the pre-flight checks on the nodes", func() error {
+		result.PreFlightError = executor.RunPreFlightCheck(plan)
+		return result.PreFlightError
+	})
+	return result, nil
+}
+
+// validatePlanAndSSH validates the plan and the SSH connectivity to the nodes
+func (c *Client) validatePlanAndSSH(operation string, plan *install.Plan) *ValidationResult {
+	result := &ValidationResult{}
+	if ok, errs := install.ValidatePlan(plan); !ok {
+		result.PlanErrors = errs
+		util.PrettyPrintErr(c.options.Log, "Validating installation plan file")
+		util.PrintValidationErrors(c.options.Log, errs)
+	} else {
+		util.PrettyPrintOk(c.options.Log, "Validating installation plan file")
+	}
+	if c.phase(operation, "validate-plan", "Validating the plan", result.Err) != nil {
+		return result
+	}
+
+	if ok, errs := install.ValidatePlanSSHConnections(plan); !ok {
+		result.SSHErrors = errs
+		util.PrettyPrintErr(c.options.Log, "Validating SSH connectivity to nodes")
+		util.PrintValidationErrors(c.options.Log, errs)
+	} else {
+		util.PrettyPrintOk(c.options.Log, "Validating SSH connectivity to nodes")
+	}
+	c.phase(operation, "validate-ssh", "Validating SSH connectivity to the nodes", result.Err)
+	return result
+}
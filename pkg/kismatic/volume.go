@@ -0,0 +1,42 @@
+package kismatic
+
+import (
+	"fmt"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+// AddVolume adds a persistent storage volume to the cluster described in the
+// plan. A ValidationError is returned if the volume is not valid.
+func (c *Client) AddVolume(plan *install.Plan, volume install.StorageVolume) error {
+	const operation = "add-volume"
+	err := c.phase(operation, "validate", "Validating the volume", func() error {
+		if ok, errs := install.ValidateStorageVolume(volume); !ok {
+			return ValidationError{Message: "the storage volume is not valid", Errors: errs}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	executor, err := c.newExecutor(operation)
+	if err != nil {
+		return err
+	}
+	return c.phase(operation, "add-volume", fmt.Sprintf("Adding volume %q", volume.Name), func() error {
+		return executor.AddVolume(plan, volume)
+	})
+}
+
+// DeleteVolume deletes the persistent storage volume from the cluster
+// described in the plan
+func (c *Client) DeleteVolume(plan *install.Plan, name string) error {
+	const operation = "delete-volume"
+	executor, err := c.newExecutor(operation)
+	if err != nil {
+		return err
+	}
+	return c.phase(operation, "delete-volume", fmt.Sprintf("Deleting volume %q", name), func() error {
+		return executor.DeleteVolume(plan, name)
+	})
+}
@@ -0,0 +1,5 @@
+// Package server implements an HTTP server that manages the lifecycle of
+// clusters on behalf of its users. The plans of the clusters are submitted
+// to the server, which runs the operations as asynchronous jobs using the
+// SSH key that is only available to the server.
+package server
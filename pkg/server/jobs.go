@@ -0,0 +1,280 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
+)
+
+// JobRequest is the request to run an operation against a cluster
+type JobRequest struct {
+	// Operation to run: "validate", "apply", "add-worker" or "upgrade"
+	Operation string `json:"operation"`
+	// SkipPreFlight skips the pre-flight checks
+	SkipPreFlight bool `json:"skip_preflight,omitempty"`
+	// Worker is the node added by the "add-worker" operation
+	Worker *WorkerRequest `json:"worker,omitempty"`
+	// Online performs an online upgrade
+	Online bool `json:"online,omitempty"`
+	// IgnoreSafetyChecks upgrades the nodes that failed the safety checks
+	IgnoreSafetyChecks bool `json:"ignore_safety_checks,omitempty"`
+	// PartialAllowed upgrades the nodes that are ready, skipping the others
+	PartialAllowed bool `json:"partial_allowed,omitempty"`
+	// MaxParallelWorkers is the maximum number of workers upgraded in parallel
+	MaxParallelWorkers int `json:"max_parallel_workers,omitempty"`
+}
+
+// WorkerRequest is the node added by the "add-worker" operation
+type WorkerRequest struct {
+	Host       string            `json:"host"`
+	IP         string            `json:"ip"`
+	InternalIP string            `json:"internal_ip,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// the operations that can be run by a job, and whether they modify the cluster
+var jobOperations = map[string]bool{
+	"validate":   false,
+	"apply":      true,
+	"add-worker": true,
+	"upgrade":    true,
+}
+
+// validate the request, before creating the job
+func (r JobRequest) validate() error {
+	if _, ok := jobOperations[r.Operation]; !ok {
+		return fmt.Errorf("unknown operation %q", r.Operation)
+	}
+	if r.Operation == "add-worker" && (r.Worker == nil || r.Worker.Host == "" || r.Worker.IP == "") {
+		return errors.New("the host and the IP of the worker are required")
+	}
+	if r.MaxParallelWorkers < 0 {
+		return fmt.Errorf("max_parallel_workers must be greater or equal to 1, got: %d", r.MaxParallelWorkers)
+	}
+	return nil
+}
+
+// operations are the cluster operations run by the jobs. They are
+// implemented by the kismatic client.
+type operations interface {
+	Validate(plan *install.Plan, opts kismatic.ValidateOptions) (*kismatic.ValidationResult, error)
+	Install(plan *install.Plan, opts kismatic.InstallOptions) (*kismatic.InstallResult, error)
+	AddWorker(plan *install.Plan, worker install.Node, opts kismatic.AddWorkerOptions) (*kismatic.AddWorkerResult, error)
+	Upgrade(plan *install.Plan, opts kismatic.UpgradeOptions) (*kismatic.UpgradeResult, error)
+}
+
+// the results of the operations, as returned by the API
+type validationResult struct {
+	Valid             bool     `json:"valid"`
+	PlanErrors        []string `json:"plan_errors,omitempty"`
+	SSHErrors         []string `json:"ssh_errors,omitempty"`
+	CertificateErrors []string `json:"certificate_errors,omitempty"`
+	PreFlightError    string   `json:"preflight_error,omitempty"`
+}
+
+type upgradeResult struct {
+	Upgraded                []string            `json:"upgraded"`
+	UpToDate                []string            `json:"up_to_date"`
+	Unsafe                  map[string][]string `json:"unsafe,omitempty"`
+	Unready                 map[string][]string `json:"unready,omitempty"`
+	ClusterServicesUpgraded bool                `json:"cluster_services_upgraded"`
+}
+
+func newValidationResult(r *kismatic.ValidationResult) *validationResult {
+	if r == nil {
+		return nil
+	}
+	res := &validationResult{
+		Valid:             r.Valid(),
+		PlanErrors:        errorStrings(r.PlanErrors),
+		SSHErrors:         errorStrings(r.SSHErrors),
+		CertificateErrors: errorStrings(r.CertificateErrors),
+	}
+	if r.PreFlightError != nil {
+		res.PreFlightError = r.PreFlightError.Error()
+	}
+	return res
+}
+
+func newUpgradeResult(r *kismatic.UpgradeResult) *upgradeResult {
+	if r == nil {
+		return nil
+	}
+	res := &upgradeResult{
+		Upgraded:                hosts(r.Upgraded),
+		UpToDate:                hosts(r.UpToDate),
+		ClusterServicesUpgraded: r.ClusterServicesUpgraded,
+	}
+	if len(r.Unsafe) > 0 {
+		res.Unsafe = nodeErrors(r.Unsafe)
+	}
+	if len(r.Unready) > 0 {
+		res.Unready = nodeErrors(r.Unready)
+	}
+	return res
+}
+
+func errorStrings(errs []error) []string {
+	var s []string
+	for _, err := range errs {
+		s = append(s, err.Error())
+	}
+	return s
+}
+
+func hosts(nodes []install.ListableNode) []string {
+	h := []string{}
+	for _, n := range nodes {
+		h = append(h, n.Node.Host)
+	}
+	return h
+}
+
+func nodeErrors(nodes []kismatic.NodeErrors) map[string][]string {
+	m := map[string][]string{}
+	for _, n := range nodes {
+		m[n.Node.Node.Host] = errorStrings(n.Errors)
+	}
+	return m
+}
+
+// newJobID returns a unique ID that sorts by creation time
+func newJobID(now time.Time) string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// runningJob is a job that is being run by this server. Its events are
+// recorded in the events file, and the readers of the events are notified
+// when new events are recorded.
+type runningJob struct {
+	mu      sync.Mutex
+	job     Job
+	events  *os.File
+	output  *os.File
+	changed chan struct{}
+	done    bool
+}
+
+func newRunningJob(store Store, job Job) (*runningJob, error) {
+	if err := store.SaveJob(job); err != nil {
+		return nil, err
+	}
+	dir := store.JobDirectory(job.Cluster, job.ID)
+	events, err := os.Create(filepath.Join(dir, eventsFilename))
+	if err != nil {
+		return nil, fmt.Errorf("error creating events file: %v", err)
+	}
+	output, err := os.Create(filepath.Join(dir, outputFilename))
+	if err != nil {
+		events.Close()
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	return &runningJob{job: job, events: events, output: output, changed: make(chan struct{})}, nil
+}
+
+// record the event in the events file
+func (r *runningJob) record(e kismatic.Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		fmt.Fprintf(r.output, "error marshaling event: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.events.Write(append(data, '\n')); err != nil {
+		fmt.Fprintf(r.output, "error recording event: %v\n", err)
+	}
+	r.notify()
+}
+
+// finish the job with the result of the operation
+func (r *runningJob) finish(store Store, result interface{}, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.job.Finished = &now
+	r.job.Status = JobSucceeded
+	if err != nil {
+		r.job.Status = JobFailed
+		r.job.Error = err.Error()
+	}
+	if data, marshalErr := json.Marshal(result); marshalErr == nil && string(data) != "null" {
+		r.job.Result = data
+	}
+	if saveErr := store.SaveJob(r.job); saveErr != nil {
+		fmt.Fprintf(r.output, "error saving job: %v\n", saveErr)
+	}
+	r.events.Close()
+	r.output.Close()
+	r.done = true
+	r.notify()
+}
+
+// status returns the job, whether it is done and a channel that is closed
+// when the job changes
+func (r *runningJob) status() (Job, bool, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.job, r.done, r.changed
+}
+
+// must be called with the lock held
+func (r *runningJob) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// run the operation requested by the job, and return its result
+func runOperation(ops operations, store Store, cluster string, plan *install.Plan, req JobRequest) (interface{}, error) {
+	switch req.Operation {
+	case "validate":
+		result, err := ops.Validate(plan, kismatic.ValidateOptions{SkipPreFlight: req.SkipPreFlight})
+		if err != nil {
+			return nil, err
+		}
+		return newValidationResult(result), result.Err()
+	case "apply":
+		result, err := ops.Install(plan, kismatic.InstallOptions{SkipPreFlight: req.SkipPreFlight})
+		if result == nil {
+			return nil, err
+		}
+		return newValidationResult(result.Validation), err
+	case "add-worker":
+		worker := install.Node{
+			Host:       req.Worker.Host,
+			IP:         req.Worker.IP,
+			InternalIP: req.Worker.InternalIP,
+			Labels:     req.Worker.Labels,
+		}
+		result, err := ops.AddWorker(plan, worker, kismatic.AddWorkerOptions{SkipPreFlight: req.SkipPreFlight})
+		if err != nil {
+			return nil, err
+		}
+		// the worker was added, keep track of it in the plan of the cluster
+		if err := store.Planner(cluster).Write(result.Plan); err != nil {
+			return nil, fmt.Errorf("the worker was added, but the plan could not be updated: %v", err)
+		}
+		return nil, nil
+	case "upgrade":
+		result, err := ops.Upgrade(plan, kismatic.UpgradeOptions{
+			Online:             req.Online,
+			IgnoreSafetyChecks: req.IgnoreSafetyChecks,
+			SkipPreFlight:      req.SkipPreFlight,
+			PartialAllowed:     req.PartialAllowed,
+			MaxParallelWorkers: req.MaxParallelWorkers,
+		})
+		return newUpgradeResult(result), err
+	}
+	return nil, fmt.Errorf("unknown operation %q", req.Operation)
+}
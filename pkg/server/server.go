@@ -0,0 +1,503 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
+)
+
+const (
+	eventsFilename = "events.jsonl"
+	outputFilename = "output.log"
+	// the maximum size of a plan file submitted to the server
+	maxPlanSize = 1 << 20
+)
+
+// Options are used to configure the server
+type Options struct {
+	// Directory where the plans and the history of the jobs are stored
+	Directory string
+	// Token that clients must present as a bearer token. Authentication is
+	// disabled when empty. Every client that has the token has full access
+	// to all the clusters.
+	Token string
+	// Verbose includes the output of every ansible task in the output of the jobs
+	Verbose bool
+	// AllowedDirectories are the directories, in addition to the files
+	// directory of each cluster, that the plans can reference files in
+	AllowedDirectories []string
+	// Log receives the messages of the server
+	Log io.Writer
+}
+
+// Server runs the operations of the clusters as asynchronous jobs. Only one
+// job that modifies a cluster can run at a time.
+type Server struct {
+	store   Store
+	token   string
+	verbose bool
+	log     *log.Logger
+
+	mu sync.Mutex
+	// the jobs that were started by this server, by cluster and ID
+	jobs map[string]*runningJob
+	// the ID of the job that is modifying each cluster
+	mutating map[string]string
+	wg       sync.WaitGroup
+
+	// Hook for testing purposes. The kismatic client is used at runtime.
+	newOperations func(cluster string, progress func(kismatic.Event), out io.Writer) operations
+}
+
+// New returns a server that stores its data in the configured directory.
+// The jobs that were running when the server last stopped are marked as failed.
+func New(options Options) (*Server, error) {
+	if options.Directory == "" {
+		return nil, errors.New("the directory of the server is required")
+	}
+	if options.Log == nil {
+		options.Log = ioutil.Discard
+	}
+	s := &Server{
+		store:    Store{Directory: options.Directory, AllowedDirectories: options.AllowedDirectories},
+		token:    options.Token,
+		verbose:  options.Verbose,
+		log:      log.New(options.Log, "", log.LstdFlags),
+		jobs:     map[string]*runningJob{},
+		mutating: map[string]string{},
+	}
+	s.newOperations = func(cluster string, progress func(kismatic.Event), out io.Writer) operations {
+		dir := s.store.ClusterDirectory(cluster)
+		return kismatic.New(kismatic.Options{
+			GeneratedAssetsDirectory: filepath.Join(dir, "generated"),
+			RunsDirectory:            filepath.Join(dir, "runs"),
+			DiagnosticsDirectory:     filepath.Join(dir, "diagnostics"),
+			Verbose:                  s.verbose,
+			Progress:                 progress,
+			Log:                      out,
+		})
+	}
+	if err := s.failInterruptedJobs(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) failInterruptedJobs() error {
+	clusters, err := s.store.ListClusters()
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		jobs, err := s.store.ListJobs(c)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if job.Status != JobRunning {
+				continue
+			}
+			job.Status = JobFailed
+			job.Error = "the server stopped while the job was running"
+			if err := s.store.SaveJob(job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Wait blocks until the jobs that are running complete
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// Handler returns the HTTP handler of the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clusters", s.handleClusters)
+	mux.HandleFunc("/clusters/", s.handleCluster)
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if s.token != "" {
+			token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+				return
+			}
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// GET /clusters
+func (s *Server) handleClusters(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", req.Method))
+		return
+	}
+	clusters, err := s.store.ListClusters()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, clusters)
+}
+
+// handleCluster routes the requests under /clusters/<cluster>
+func (s *Server) handleCluster(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/clusters/"), "/"), "/")
+	for _, p := range parts {
+		if !validNameRE.MatchString(p) {
+			writeError(w, http.StatusNotFound, fmt.Errorf("%q is not a valid path", req.URL.Path))
+			return
+		}
+	}
+	cluster := parts[0]
+	switch {
+	case len(parts) == 2 && parts[1] == "plan" && req.Method == http.MethodGet:
+		s.getPlan(w, req, cluster)
+	case len(parts) == 2 && parts[1] == "plan" && req.Method == http.MethodPut:
+		s.putPlan(w, req, cluster)
+	case len(parts) == 2 && parts[1] == "jobs" && req.Method == http.MethodGet:
+		s.listJobs(w, req, cluster)
+	case len(parts) == 2 && parts[1] == "jobs" && req.Method == http.MethodPost:
+		s.createJob(w, req, cluster)
+	case len(parts) == 3 && parts[1] == "jobs" && req.Method == http.MethodGet:
+		s.getJob(w, req, cluster, parts[2])
+	case len(parts) == 4 && parts[1] == "jobs" && parts[3] == "events" && req.Method == http.MethodGet:
+		s.streamJobEvents(w, req, cluster, parts[2])
+	case len(parts) == 4 && parts[1] == "jobs" && parts[3] == "output" && req.Method == http.MethodGet:
+		s.getJobOutput(w, req, cluster, parts[2])
+	case len(parts) == 2 && parts[1] == "runs" && req.Method == http.MethodGet:
+		s.listRuns(w, req, cluster)
+	case len(parts) == 5 && parts[1] == "runs" && req.Method == http.MethodGet:
+		s.getRunArtifact(w, req, cluster, parts[2]+"/"+parts[3], parts[4])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s is not supported", req.Method, req.URL.Path))
+	}
+}
+
+// GET /clusters/<cluster>/plan
+func (s *Server) getPlan(w http.ResponseWriter, req *http.Request, cluster string) {
+	f, err := os.Open(s.store.PlanFile(cluster))
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("cluster %q does not have a plan", cluster))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/x-yaml")
+	io.Copy(w, f)
+}
+
+// PUT /clusters/<cluster>/plan
+func (s *Server) putPlan(w http.ResponseWriter, req *http.Request, cluster string) {
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, maxPlanSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading plan: %v", err))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.mutating[cluster]; ok {
+		writeError(w, http.StatusConflict, fmt.Errorf("the plan cannot be changed while job %q is running", id))
+		return
+	}
+	if _, err := s.store.SavePlan(cluster, data); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /clusters/<cluster>/jobs
+func (s *Server) listJobs(w http.ResponseWriter, req *http.Request, cluster string) {
+	jobs, err := s.store.ListJobs(cluster)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the jobs of this server have the latest status
+	for i, job := range jobs {
+		if r := s.runningJob(cluster, job.ID); r != nil {
+			jobs[i], _, _ = r.status()
+		}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// POST /clusters/<cluster>/jobs
+func (s *Server) createJob(w http.ResponseWriter, req *http.Request, cluster string) {
+	jobReq := JobRequest{}
+	if err := json.NewDecoder(req.Body).Decode(&jobReq); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error decoding job request: %v", err))
+		return
+	}
+	if err := jobReq.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	job, err := s.startJob(cluster, jobReq)
+	switch {
+	case err == ErrNotFound:
+		writeError(w, http.StatusNotFound, fmt.Errorf("cluster %q does not have a plan", cluster))
+	case err == errConflict:
+		writeError(w, http.StatusConflict, fmt.Errorf("another job is modifying cluster %q", cluster))
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.Header().Set("Location", fmt.Sprintf("/clusters/%s/jobs/%s", cluster, job.ID))
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+var errConflict = errors.New("conflict")
+
+// startJob starts a job that runs the requested operation in the background
+func (s *Server) startJob(cluster string, jobReq JobRequest) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plan, err := s.store.ReadPlan(cluster)
+	if err != nil {
+		return nil, err
+	}
+	mutating := jobOperations[jobReq.Operation]
+	if _, ok := s.mutating[cluster]; ok && mutating {
+		return nil, errConflict
+	}
+	now := time.Now()
+	job := Job{
+		ID:        newJobID(now),
+		Cluster:   cluster,
+		Operation: jobReq.Operation,
+		Request:   jobReq,
+		Status:    JobRunning,
+		Created:   now,
+	}
+	r, err := newRunningJob(s.store, job)
+	if err != nil {
+		return nil, err
+	}
+	s.jobs[cluster+"/"+job.ID] = r
+	if mutating {
+		s.mutating[cluster] = job.ID
+	}
+
+	s.log.Printf("starting job %q of cluster %q: %s", job.ID, cluster, job.Operation)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ops := s.newOperations(cluster, r.record, r.output)
+		result, err := runOperation(ops, s.store, cluster, plan, jobReq)
+		r.finish(s.store, result, err)
+		if err != nil {
+			s.log.Printf("job %q of cluster %q failed: %v", job.ID, cluster, err)
+		} else {
+			s.log.Printf("job %q of cluster %q succeeded", job.ID, cluster)
+		}
+		if mutating {
+			s.mu.Lock()
+			delete(s.mutating, cluster)
+			s.mu.Unlock()
+		}
+	}()
+	return &job, nil
+}
+
+func (s *Server) runningJob(cluster, id string) *runningJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[cluster+"/"+id]
+}
+
+// readJob returns the latest status of the job
+func (s *Server) readJob(cluster, id string) (*Job, error) {
+	if r := s.runningJob(cluster, id); r != nil {
+		job, _, _ := r.status()
+		return &job, nil
+	}
+	return s.store.ReadJob(cluster, id)
+}
+
+// GET /clusters/<cluster>/jobs/<job>
+func (s *Server) getJob(w http.ResponseWriter, req *http.Request, cluster, id string) {
+	job, err := s.readJob(cluster, id)
+	if err == ErrNotFound {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %q of cluster %q not found", id, cluster))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// GET /clusters/<cluster>/jobs/<job>/output
+func (s *Server) getJobOutput(w http.ResponseWriter, req *http.Request, cluster, id string) {
+	if _, err := s.readJob(cluster, id); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %q of cluster %q not found", id, cluster))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, req, filepath.Join(s.store.JobDirectory(cluster, id), outputFilename))
+}
+
+// GET /clusters/<cluster>/jobs/<job>/events streams the events of the job
+// as server-sent events, until the job is done. Every event has the index
+// of the event as ID, and clients resume the stream by sending the ID of
+// the last event they received in the Last-Event-ID header. The last event
+// is a "done" event that contains the job.
+func (s *Server) streamJobEvents(w http.ResponseWriter, req *http.Request, cluster, id string) {
+	job, err := s.readJob(cluster, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %q of cluster %q not found", id, cluster))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	f, err := os.Open(filepath.Join(s.store.JobDirectory(cluster, id), eventsFilename))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("error opening events file: %v", err))
+		return
+	}
+	defer f.Close()
+	skip := -1
+	if last := req.Header.Get("Last-Event-ID"); last != "" {
+		if skip, err = strconv.Atoi(last); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID %q", last))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	r := s.runningJob(cluster, id)
+	reader := bufio.NewReader(f)
+	var partial []byte
+	index := 0
+	for {
+		// get the status of the job before reading the events, so that
+		// all the events are read when the job is done
+		done := true
+		var changed <-chan struct{}
+		if r != nil {
+			*job, done, changed = r.status()
+		}
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				// keep the incomplete line until the rest of it is written
+				partial = append(partial, line...)
+				break
+			}
+			line = append(partial, line...)
+			partial = nil
+			if index > skip {
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", index, eventType(line), bytes.TrimSpace(line))
+			}
+			index++
+		}
+		if done {
+			data, _ := json.Marshal(job)
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// eventType returns the type of the recorded event
+func eventType(line []byte) string {
+	e := struct {
+		Type string `json:"type"`
+	}{}
+	json.Unmarshal(line, &e)
+	return e.Type
+}
+
+// GET /clusters/<cluster>/runs
+func (s *Server) listRuns(w http.ResponseWriter, req *http.Request, cluster string) {
+	runs, err := install.ListRuns(filepath.Join(s.store.ClusterDirectory(cluster), "runs"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	type run struct {
+		ID       string    `json:"id"`
+		Task     string    `json:"task"`
+		Start    time.Time `json:"start"`
+		End      time.Time `json:"end"`
+		Status   string    `json:"status"`
+		PlanHash string    `json:"plan_hash,omitempty"`
+	}
+	res := []run{}
+	for _, r := range runs {
+		res = append(res, run{ID: r.ID, Task: r.Task, Start: r.Start, End: r.End, Status: string(r.Status), PlanHash: r.PlanHash})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GET /clusters/<cluster>/runs/<task>/<timestamp>/<file> returns a file
+// recorded in the directory of the run, e.g. ansible.log
+func (s *Server) getRunArtifact(w http.ResponseWriter, req *http.Request, cluster, runID, file string) {
+	run, err := install.ReadRun(filepath.Join(s.store.ClusterDirectory(cluster), "runs"), runID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	path := filepath.Join(run.Directory, file)
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %q does not have a file named %q", runID, file))
+		return
+	}
+	http.ServeFile(w, req, path)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
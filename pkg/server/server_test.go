@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/apprenda/kismatic/pkg/install"
+	"github.com/apprenda/kismatic/pkg/kismatic"
+)
+
+const testPlan = `cluster:
+  name: test
+worker:
+  expected_count: 1
+  nodes:
+  - host: worker1
+    ip: 10.0.0.1
+`
+
+type fakeState struct {
+	// the install blocks until this channel is closed
+	release chan struct{}
+	err     error
+}
+
+type fakeOperations struct {
+	*fakeState
+	progress func(kismatic.Event)
+}
+
+func (f *fakeOperations) Validate(plan *install.Plan, opts kismatic.ValidateOptions) (*kismatic.ValidationResult, error) {
+	f.progress(kismatic.Event{Type: kismatic.PhaseStarted, Operation: "validate", Phase: "validate-plan"})
+	f.progress(kismatic.Event{Type: kismatic.PhaseSucceeded, Operation: "validate", Phase: "validate-plan"})
+	return &kismatic.ValidationResult{}, f.err
+}
+
+func (f *fakeOperations) Install(plan *install.Plan, opts kismatic.InstallOptions) (*kismatic.InstallResult, error) {
+	f.progress(kismatic.Event{Type: kismatic.PhaseStarted, Operation: "install", Phase: "install"})
+	<-f.release
+	return &kismatic.InstallResult{Validation: &kismatic.ValidationResult{}}, f.err
+}
+
+func (f *fakeOperations) AddWorker(plan *install.Plan, worker install.Node, opts kismatic.AddWorkerOptions) (*kismatic.AddWorkerResult, error) {
+	updated := *plan
+	updated.Worker.Nodes = append(updated.Worker.Nodes, worker)
+	updated.Worker.ExpectedCount++
+	return &kismatic.AddWorkerResult{Plan: &updated}, f.err
+}
+
+func (f *fakeOperations) Upgrade(plan *install.Plan, opts kismatic.UpgradeOptions) (*kismatic.UpgradeResult, error) {
+	return &kismatic.UpgradeResult{}, f.err
+}
+
+func newTestServer(t *testing.T, token string) (*Server, *httptest.Server, *fakeState, func()) {
+	dir, err := ioutil.TempDir("", "kismatic-server-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	s, err := New(Options{Directory: dir, Token: token})
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	fake := &fakeState{release: make(chan struct{})}
+	s.newOperations = func(cluster string, progress func(kismatic.Event), out io.Writer) operations {
+		return &fakeOperations{fakeState: fake, progress: progress}
+	}
+	ts := httptest.NewServer(s.Handler())
+	return s, ts, fake, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func doRequest(t *testing.T, method, url, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	return resp
+}
+
+func submitJob(t *testing.T, ts *httptest.Server, body string, expectedStatus int) Job {
+	resp := doRequest(t, http.MethodPost, ts.URL+"/clusters/test/jobs", body)
+	defer resp.Body.Close()
+	if resp.StatusCode != expectedStatus {
+		b, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("expected status %d, but got %d: %s", expectedStatus, resp.StatusCode, b)
+	}
+	job := Job{}
+	json.NewDecoder(resp.Body).Decode(&job)
+	return job
+}
+
+func TestJobEventsAreStreamed(t *testing.T) {
+	s, ts, _, cleanup := newTestServer(t, "")
+	defer cleanup()
+	if resp := doRequest(t, http.MethodPut, ts.URL+"/clusters/test/plan", testPlan); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected the plan to be stored, but got status %d", resp.StatusCode)
+	}
+	job := submitJob(t, ts, `{"operation": "validate"}`, http.StatusAccepted)
+	if job.Status != JobRunning {
+		t.Errorf("expected the job to be running, but got %q", job.Status)
+	}
+
+	resp := doRequest(t, http.MethodGet, ts.URL+"/clusters/test/jobs/"+job.ID+"/events", "")
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, but got %q", ct)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	stream := string(b)
+	for _, expected := range []string{"id: 0\nevent: phase_started\n", "id: 1\nevent: phase_succeeded\n", "event: done\n", `"status":"succeeded"`} {
+		if !strings.Contains(stream, expected) {
+			t.Errorf("expected the stream to contain %q, but got:\n%s", expected, stream)
+		}
+	}
+	s.Wait()
+
+	// resume the stream after the first event
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/clusters/test/jobs/"+job.ID+"/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ = ioutil.ReadAll(resp.Body)
+	if strings.Contains(string(b), "id: 0\n") || !strings.Contains(string(b), "id: 1\n") {
+		t.Errorf("expected the stream to resume after the first event, but got:\n%s", b)
+	}
+}
+
+func TestOneMutatingJobPerCluster(t *testing.T) {
+	s, ts, fake, cleanup := newTestServer(t, "")
+	defer cleanup()
+	doRequest(t, http.MethodPut, ts.URL+"/clusters/test/plan", testPlan)
+	fake.err = errors.New("failed")
+
+	apply := submitJob(t, ts, `{"operation": "apply"}`, http.StatusAccepted)
+	submitJob(t, ts, `{"operation": "upgrade"}`, http.StatusConflict)
+	if resp := doRequest(t, http.MethodPut, ts.URL+"/clusters/test/plan", testPlan); resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected the plan not to be changed during the apply, but got status %d", resp.StatusCode)
+	}
+	// other clusters are not affected
+	doRequest(t, http.MethodPut, ts.URL+"/clusters/other/plan", testPlan)
+	resp := doRequest(t, http.MethodPost, ts.URL+"/clusters/other/jobs", `{"operation": "upgrade"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected the upgrade of another cluster to be accepted, but got status %d", resp.StatusCode)
+	}
+
+	close(fake.release)
+	s.Wait()
+	job, err := s.store.ReadJob("test", apply.ID)
+	if err != nil {
+		t.Fatalf("error reading job: %v", err)
+	}
+	if job.Status != JobFailed || job.Error != "failed" || job.Finished == nil {
+		t.Errorf("expected the job to fail, but got %+v", job)
+	}
+	submitJob(t, ts, `{"operation": "upgrade"}`, http.StatusAccepted)
+	s.Wait()
+}
+
+func TestAddWorkerUpdatesPlan(t *testing.T) {
+	s, ts, _, cleanup := newTestServer(t, "")
+	defer cleanup()
+	doRequest(t, http.MethodPut, ts.URL+"/clusters/test/plan", testPlan)
+	submitJob(t, ts, `{"operation": "add-worker"}`, http.StatusBadRequest)
+	submitJob(t, ts, `{"operation": "add-worker", "worker": {"host": "worker2", "ip": "10.0.0.2"}}`, http.StatusAccepted)
+	s.Wait()
+	plan, err := s.store.ReadPlan("test")
+	if err != nil {
+		t.Fatalf("error reading plan: %v", err)
+	}
+	if len(plan.Worker.Nodes) != 2 || plan.Worker.Nodes[1].Host != "worker2" {
+		t.Errorf("expected the worker to be added to the plan, but got %v", plan.Worker.Nodes)
+	}
+}
+
+func TestJobRequiresPlan(t *testing.T) {
+	_, ts, _, cleanup := newTestServer(t, "")
+	defer cleanup()
+	submitJob(t, ts, `{"operation": "validate"}`, http.StatusNotFound)
+	submitJob(t, ts, `{"operation": "destroy"}`, http.StatusBadRequest)
+	if resp := doRequest(t, http.MethodPut, ts.URL+"/clusters/test/plan", "cluster: ["); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an invalid plan to be rejected, but got status %d", resp.StatusCode)
+	}
+	if resp := doRequest(t, http.MethodGet, ts.URL+"/clusters/../plan", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an invalid cluster name to be rejected, but got status %d", resp.StatusCode)
+	}
+}
+
+func TestPlanCannotReferenceServerFiles(t *testing.T) {
+	s, ts, _, cleanup := newTestServer(t, "")
+	defer cleanup()
+	// the test plan, with additional fields in the cluster section
+	withClusterFields := func(fields string) string {
+		return strings.Replace(testPlan, "  name: test\n", "  name: test\n"+fields, 1)
+	}
+	rejected := []string{
+		withClusterFields("  ssh:\n    ssh_key: /etc/shadow\n"),
+		withClusterFields("  ssh:\n    ssh_key: " + s.store.FilesDirectory("other") + "/key\n"),
+		withClusterFields("  admin_password: file:/etc/passwd\n"),
+		withClusterFields("  admin_password: env:HOME\n"),
+		withClusterFields("  admin_password: ${HOME}\n"),
+	}
+	for _, plan := range rejected {
+		if resp := doRequest(t, http.MethodPut, ts.URL+"/clusters/test/plan", plan); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected the plan to be rejected, but got status %d:\n%s", resp.StatusCode, plan)
+		}
+	}
+	plan := withClusterFields("  ssh:\n    ssh_key: " + s.store.FilesDirectory("test") + "/key\n")
+	if resp := doRequest(t, http.MethodPut, ts.URL+"/clusters/test/plan", plan); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected a plan that references the files of the cluster to be stored, but got status %d", resp.StatusCode)
+	}
+}
+
+func TestTokenIsRequired(t *testing.T) {
+	_, ts, _, cleanup := newTestServer(t, "secret")
+	defer cleanup()
+	if resp := doRequest(t, http.MethodGet, ts.URL+"/clusters", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the request to be unauthorized, but got status %d", resp.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/clusters", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the request to be authorized, but got status %d", resp.StatusCode)
+	}
+}
+
+func TestInterruptedJobsAreFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kismatic-server-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	store := Store{Directory: dir}
+	if _, err := store.SavePlan("test", []byte(testPlan)); err != nil {
+		t.Fatalf("error saving plan: %v", err)
+	}
+	if err := store.SaveJob(Job{ID: "job", Cluster: "test", Status: JobRunning}); err != nil {
+		t.Fatalf("error saving job: %v", err)
+	}
+	if _, err := New(Options{Directory: dir}); err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	job, err := store.ReadJob("test", "job")
+	if err != nil {
+		t.Fatalf("error reading job: %v", err)
+	}
+	if job.Status != JobFailed {
+		t.Errorf("expected the interrupted job to be failed, but got %q", job.Status)
+	}
+}
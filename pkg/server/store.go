@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/apprenda/kismatic/pkg/install"
+)
+
+// ErrNotFound is returned when a cluster, a plan or a job does not exist
+var ErrNotFound = errors.New("not found")
+
+// names of clusters and jobs are used as directory names
+var validNameRE = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// JobStatus is the status of a job
+type JobStatus string
+
+const (
+	// JobRunning is a job that is in progress
+	JobRunning = JobStatus("running")
+	// JobSucceeded is a job that completed successfully
+	JobSucceeded = JobStatus("succeeded")
+	// JobFailed is a job that failed, or that was interrupted
+	JobFailed = JobStatus("failed")
+)
+
+// Job is an operation that runs asynchronously against a cluster
+type Job struct {
+	// ID of the job
+	ID string `json:"id"`
+	// Cluster the job runs against
+	Cluster string `json:"cluster"`
+	// Operation run by the job, e.g. "apply"
+	Operation string `json:"operation"`
+	// Request that created the job
+	Request JobRequest `json:"request"`
+	// Status of the job
+	Status JobStatus `json:"status"`
+	// Created is when the job was submitted
+	Created time.Time `json:"created"`
+	// Finished is when the job completed
+	Finished *time.Time `json:"finished,omitempty"`
+	// Error is the error that failed the job
+	Error string `json:"error,omitempty"`
+	// Result of the operation. Its content depends on the operation.
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Store keeps the plans of the clusters, the assets generated for them and
+// the history of their jobs on the local disk. The layout of the directory is:
+//
+//	clusters/<cluster>/kismatic-cluster.yaml     the plan of the cluster
+//	clusters/<cluster>/files                     the files the plan can reference
+//	clusters/<cluster>/generated                 the certificates and the kubeconfig
+//	clusters/<cluster>/runs                      the ansible runs
+//	clusters/<cluster>/diagnostics               the diagnostics of the nodes
+//	clusters/<cluster>/jobs/<job>/job.json       the status of the job
+//	clusters/<cluster>/jobs/<job>/events.jsonl   the progress events of the job
+//	clusters/<cluster>/jobs/<job>/output.log     the output of the job
+type Store struct {
+	Directory string
+	// AllowedDirectories are the directories, in addition to the files
+	// directory of each cluster, that the plans can reference files in
+	AllowedDirectories []string
+}
+
+// ClusterDirectory returns the directory of the cluster
+func (s Store) ClusterDirectory(cluster string) string {
+	return filepath.Join(s.Directory, "clusters", cluster)
+}
+
+// FilesDirectory returns the directory of the files that the plan of the
+// cluster can reference, such as its SSH key
+func (s Store) FilesDirectory(cluster string) string {
+	return filepath.Join(s.ClusterDirectory(cluster), "files")
+}
+
+// PlanFile returns the plan file of the cluster
+func (s Store) PlanFile(cluster string) string {
+	return filepath.Join(s.ClusterDirectory(cluster), "kismatic-cluster.yaml")
+}
+
+// JobDirectory returns the directory of the job
+func (s Store) JobDirectory(cluster, id string) string {
+	return filepath.Join(s.ClusterDirectory(cluster), "jobs", id)
+}
+
+// ListClusters returns the names of the clusters that have a plan
+func (s Store) ListClusters() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.Directory, "clusters"))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading clusters directory: %v", err)
+	}
+	clusters := []string{}
+	for _, f := range files {
+		if _, err := os.Stat(s.PlanFile(f.Name())); f.IsDir() && err == nil {
+			clusters = append(clusters, f.Name())
+		}
+	}
+	return clusters, nil
+}
+
+// SavePlan stores the plan of the cluster. The plan is only stored if it
+// can be read, and only references the files of the allowed directories,
+// but it is not validated otherwise.
+func (s Store) SavePlan(cluster string, data []byte) (*install.Plan, error) {
+	if err := s.validateReferences(cluster, data); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.ClusterDirectory(cluster), 0700); err != nil {
+		return nil, fmt.Errorf("error creating cluster directory: %v", err)
+	}
+	tmp := s.PlanFile(cluster) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return nil, fmt.Errorf("error writing plan file: %v", err)
+	}
+	planner := &install.FilePlanner{File: tmp}
+	plan, err := planner.Read()
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, s.PlanFile(cluster)); err != nil {
+		return nil, fmt.Errorf("error writing plan file: %v", err)
+	}
+	return plan, nil
+}
+
+// Planner returns the planner of the cluster
+func (s Store) Planner(cluster string) install.Planner {
+	return &install.FilePlanner{File: s.PlanFile(cluster)}
+}
+
+// ReadPlan returns the plan of the cluster
+func (s Store) ReadPlan(cluster string) (*install.Plan, error) {
+	planner := s.Planner(cluster)
+	if !planner.PlanExists() {
+		return nil, ErrNotFound
+	}
+	// plans stored by previous versions of the server were not validated
+	data, err := ioutil.ReadFile(s.PlanFile(cluster))
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan file: %v", err)
+	}
+	if err := s.validateReferences(cluster, data); err != nil {
+		return nil, err
+	}
+	return planner.Read()
+}
+
+// validateReferences returns an error if the plan references files outside of
+// the allowed directories, or the environment of the server
+func (s Store) validateReferences(cluster string, data []byte) error {
+	dirs := append([]string{s.FilesDirectory(cluster)}, s.AllowedDirectories...)
+	if ok, errs := install.ValidateLocalReferences(data, dirs); !ok {
+		return fmt.Errorf("the plan references files or secrets of the server that are not allowed: %v", errs)
+	}
+	return nil
+}
+
+// SaveJob stores the status of the job
+func (s Store) SaveJob(job Job) error {
+	dir := s.JobDirectory(job.Cluster, job.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("error creating job directory: %v", err)
+	}
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling job: %v", err)
+	}
+	tmp := filepath.Join(dir, "job.json.tmp")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing job file: %v", err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, "job.json"))
+}
+
+// ReadJob returns the job of the cluster with the given ID
+func (s Store) ReadJob(cluster, id string) (*Job, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.JobDirectory(cluster, id), "job.json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading job file: %v", err)
+	}
+	job := &Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("error unmarshaling job %q: %v", id, err)
+	}
+	return job, nil
+}
+
+// ListJobs returns the jobs of the cluster, newest first
+func (s Store) ListJobs(cluster string) ([]Job, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.ClusterDirectory(cluster), "jobs"))
+	if os.IsNotExist(err) {
+		return []Job{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading jobs directory: %v", err)
+	}
+	jobs := []Job{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		job, err := s.ReadJob(cluster, f.Name())
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.After(jobs[j].Created)
+	})
+	return jobs, nil
+}
@@ -50,6 +50,22 @@ func PromptForString(in io.Reader, out io.Writer, prompt string, defaultValue st
 	return ans, nil
 }
 
+// PromptForInput reads free-form command line input
+func PromptForInput(in io.Reader, out io.Writer, prompt string, defaultValue string) (string, error) {
+	fmt.Fprintf(out, "=> %s [%s]: ", prompt, defaultValue)
+	s := bufio.NewScanner(in)
+	// Scan the first token
+	s.Scan()
+	if s.Err() != nil {
+		return defaultValue, fmt.Errorf("error reading input: %v", s.Err())
+	}
+	ans := strings.TrimSpace(s.Text())
+	if ans == "" {
+		return defaultValue, nil
+	}
+	return ans, nil
+}
+
 // CreateDir check if directory exists and create it
 func CreateDir(dir string, perm os.FileMode) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {